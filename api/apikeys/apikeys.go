@@ -0,0 +1,64 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// prefix starts every key, so that leaked keys are easy to scan for
+const prefix = "rbac"
+
+// Generate returns a new API key for the named service account, along with
+// the key's ID and the hash to store. Keys have the form
+// "rbac.<account>.<id>.<secret>", where the account is base64url encoded,
+// so that the account can be read back from the key without an index.
+func Generate(account string) (key, id, hash string, err error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate key id: %s", err)
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate key secret: %s", err)
+	}
+
+	id = hex.EncodeToString(idBytes)
+	key = strings.Join([]string{
+		prefix,
+		base64.RawURLEncoding.EncodeToString([]byte(account)),
+		id,
+		base64.RawURLEncoding.EncodeToString(secretBytes),
+	}, ".")
+	return key, id, Hash(key), nil
+}
+
+// Parse returns the service account and the ID of a key,
+// or false if it doesn't have the form of an API key
+func Parse(key string) (account, id string, ok bool) {
+	parts := strings.Split(key, ".")
+	if len(parts) != 4 || parts[0] != prefix || parts[2] == "" || parts[3] == "" {
+		return "", "", false
+	}
+	accountBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(accountBytes) == 0 {
+		return "", "", false
+	}
+	return string(accountBytes), parts[2], true
+}
+
+// Hash returns the hash of a key. Keys are random, so a fast
+// unsalted hash is enough to keep stored hashes from being used.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify returns true if a key matches a stored hash
+func Verify(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(key)), []byte(hash)) == 1
+}
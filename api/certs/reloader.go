@@ -0,0 +1,130 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// checkInterval is how often the files are checked for changes
+const checkInterval = 10 * time.Second
+
+// Reloader serves a TLS certificate and key from files, reloading them when
+// they change so that rotated certificates are picked up without a restart.
+// The files are checked at most once every checkInterval, during handshakes.
+type Reloader struct {
+	sync.Mutex
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modified time.Time // latest modification time of the files when last loaded
+	checked  time.Time // last time the files were checked for changes
+}
+
+// NewReloader returns a new Reloader, failing if the certificate can't be loaded
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate and key from their files. The
+// current certificate is kept if they are invalid, e.g. mid-rotation.
+func (r *Reloader) Reload() error {
+	modified, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s and key %s: %s", r.certFile, r.keyFile, err)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.cert = &cert
+	r.modified = modified
+	r.checked = time.Now()
+	return nil
+}
+
+// GetCertificate returns the current certificate, reloading it first if
+// its files changed. It is meant for the GetCertificate of a tls.Config.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.Lock()
+	due := time.Since(r.checked) > checkInterval
+	if due {
+		r.checked = time.Now()
+	}
+	r.Unlock()
+
+	if due {
+		if modified, err := r.lastModified(); err == nil && r.changed(modified) {
+			if err := r.Reload(); err != nil {
+				slog.Error("failed to reload TLS certificate, keeping the current one", slog.String("error", err.Error()))
+			} else {
+				slog.Info("reloaded TLS certificate", slog.String("cert_file", r.certFile))
+			}
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	return r.cert, nil
+}
+
+func (r *Reloader) changed(modified time.Time) bool {
+	r.Lock()
+	defer r.Unlock()
+	return !modified.Equal(r.modified)
+}
+
+// lastModified returns the latest modification time of the files
+func (r *Reloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat %s: %s", file, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// LoadCertPool returns a pool of the PEM encoded certificates in a file
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	pemBytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %s", file, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("no PEM encoded certificates in %s", file)
+	}
+	return pool, nil
+}
+
+// Identity returns the identity a client certificate authenticates: its
+// first DNS name, URI, or email address, in that order, or else its
+// subject's common name
+func Identity(cert *x509.Certificate) string {
+	switch {
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	}
+	return cert.Subject.CommonName
+}
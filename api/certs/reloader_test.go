@@ -0,0 +1,191 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a new self-signed certificate for a common name
+// and its key to files in dir, which are modified at the given time
+func writeCertificate(t *testing.T, dir, commonName string, modified time.Time) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to encode key: %s", err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), modified)
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), modified)
+	return certFile, keyFile
+}
+
+func writeFile(t *testing.T, file string, data []byte, modified time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatalf("failed to write %s: %s", file, err)
+	}
+	if err := os.Chtimes(file, modified, modified); err != nil {
+		t.Fatalf("failed to set the modification time of %s: %s", file, err)
+	}
+}
+
+// servedName returns the common name of the certificate served by r
+func servedName(t *testing.T, r *Reloader) string {
+	t.Helper()
+
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("failed to get certificate: %s", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %s", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestReloaderPicksUpRotation(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	certFile, keyFile := writeCertificate(t, dir, "first", start)
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to create reloader: %s", err)
+	}
+	if name := servedName(t, r); name != "first" {
+		t.Fatalf("serving %q, want the first certificate", name)
+	}
+
+	writeCertificate(t, dir, "second", start.Add(time.Minute))
+	if name := servedName(t, r); name != "first" {
+		t.Errorf("serving %q before the check interval passed, want the first certificate", name)
+	}
+
+	r.checked = time.Time{} // the check interval has passed
+	if name := servedName(t, r); name != "second" {
+		t.Errorf("serving %q after the files changed, want the rotated certificate", name)
+	}
+}
+
+func TestReloaderKeepsCertificateMidRotation(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	certFile, keyFile := writeCertificate(t, dir, "first", start)
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("failed to create reloader: %s", err)
+	}
+
+	// the certificate is rotated, but the key is not yet
+	second, _ := writeCertificate(t, t.TempDir(), "second", start)
+	data, err := os.ReadFile(second)
+	if err != nil {
+		t.Fatalf("failed to read certificate: %s", err)
+	}
+	writeFile(t, certFile, data, start.Add(time.Minute))
+
+	r.checked = time.Time{} // the check interval has passed
+	if name := servedName(t, r); name != "first" {
+		t.Errorf("serving %q with a mismatched key, want the current certificate kept", name)
+	}
+	if err := r.Reload(); err == nil {
+		t.Error("reloaded a certificate with a mismatched key")
+	}
+}
+
+func TestNewReloaderFails(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, "first", time.Now())
+
+	if _, err := NewReloader(certFile, filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("created a reloader without a key file")
+	}
+	if _, err := NewReloader(keyFile, keyFile); err == nil {
+		t.Error("created a reloader with a key as the certificate")
+	}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, "ca", time.Now())
+
+	if _, err := LoadCertPool(certFile); err != nil {
+		t.Errorf("failed to load pool: %s", err)
+	}
+	if _, err := LoadCertPool(keyFile); err == nil {
+		t.Error("loaded a pool from a file without certificates")
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.com/billing")
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want string
+	}{
+		{
+			name: "DNS name first",
+			cert: &x509.Certificate{DNSNames: []string{"billing.example.com", "other"}, URIs: []*url.URL{spiffe}, EmailAddresses: []string{"billing@example.com"}, Subject: pkix.Name{CommonName: "cn"}},
+			want: "billing.example.com",
+		},
+		{
+			name: "URI before email",
+			cert: &x509.Certificate{URIs: []*url.URL{spiffe}, EmailAddresses: []string{"billing@example.com"}, Subject: pkix.Name{CommonName: "cn"}},
+			want: "spiffe://example.com/billing",
+		},
+		{
+			name: "email before common name",
+			cert: &x509.Certificate{EmailAddresses: []string{"billing@example.com"}, Subject: pkix.Name{CommonName: "cn"}},
+			want: "billing@example.com",
+		},
+		{
+			name: "common name without SANs",
+			cert: &x509.Certificate{Subject: pkix.Name{CommonName: "cn"}},
+			want: "cn",
+		},
+		{
+			name: "nothing",
+			cert: &x509.Certificate{},
+			want: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Identity(test.cert); got != test.want {
+				t.Errorf("got identity %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adrianosela/rbac/api/certs"
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/storage"
+	"github.com/adrianosela/rbac/api/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// StorageMemory keeps all data in memory, it is lost on restart
+	StorageMemory = "memory"
+
+	// GroupSourceOkta looks up group memberships in Okta
+	GroupSourceOkta = "okta"
+	// GroupSourceStatic serves group memberships listed in the config
+	GroupSourceStatic = "static"
+
+	// LogFormatJSON writes one JSON object per log entry
+	LogFormatJSON = "json"
+	// LogFormatText writes one line of key=value pairs per log entry
+	LogFormatText = "text"
+)
+
+// Config represents the configuration of the server. Values are taken from
+// flags, then environment variables, then the config file, then defaults,
+// in that order.
+type Config struct {
+	Listen   ListenConfig   `yaml:"listen"`
+	TLS      TLSConfig      `yaml:"tls"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Storage  StorageConfig  `yaml:"storage"`
+	Groups   GroupsConfig   `yaml:"groups"`
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+	Watch    WatchConfig    `yaml:"watch"`
+	Log      LogConfig      `yaml:"log"`
+	Tracing  tracing.Config `yaml:"tracing"`
+	Shutdown ShutdownConfig `yaml:"shutdown"`
+
+	warnings []string // settings which were ignored while loading
+}
+
+// ListenConfig represents the addresses the server listens on
+type ListenConfig struct {
+	HTTP string `yaml:"http"` // defaults to ":8080"
+	GRPC string `yaml:"grpc"` // defaults to ":9090", empty disables the gRPC API
+}
+
+// TLSConfig represents the certificate the server presents, which is
+// reloaded when its files change. TLS is disabled unless both files are set.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+
+	// clients presenting a certificate signed by one of these CAs are
+	// authenticated as the identity in the certificate (see certs.Identity)
+	ClientCAFile      string `yaml:"client_ca_file"`
+	RequireClientCert bool   `yaml:"require_client_cert"` // reject clients without a certificate
+}
+
+// AuthConfig represents authorization settings
+type AuthConfig struct {
+	Admins []string `yaml:"admins"` // users bound to the built-in "rbac.admin" role on start
+
+	// only users granted the "rbac.*.create" meta-permissions may create
+	// roles, permissions, service accounts, and namespaces. Anyone may when
+	// unset, as before meta-permissions existed, except for top-level
+	// namespaces, which always require "rbac.namespaces.create".
+	RestrictCreation bool `yaml:"restrict_creation"`
+}
+
+// StorageConfig represents the storage backend
+type StorageConfig struct {
+	Backend string `yaml:"backend"` // defaults to StorageMemory
+	DSN     string `yaml:"dsn"`     // connection string, unused by StorageMemory
+}
+
+// GroupsConfig represents the chain of group sources. Sources are consulted
+// in order, and the first one which returns the groups of a user provides
+// them. Sources which don't know the user or fail are skipped.
+type GroupsConfig struct {
+	Sources  []GroupSourceConfig `yaml:"sources"`   // defaults to a single GroupSourceOkta
+	CacheTTL time.Duration       `yaml:"cache_ttl"` // defaults to 1m, negative disables caching
+}
+
+// GroupSourceConfig represents a single source in the chain of group sources
+type GroupSourceConfig struct {
+	Type string `yaml:"type"` // one of the GroupSource constants
+
+	// only for GroupSourceOkta
+	OrgDomain string `yaml:"org_domain"` // e.g. "your_company.okta"
+	APIToken  string `yaml:"api_token"`
+
+	// only for GroupSourceStatic
+	Users map[string][]string `yaml:"users"` // groups of each user
+}
+
+// WebhooksConfig represents the delivery settings of webhooks
+type WebhooksConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts"`    // defaults to 5
+	InitialBackoff time.Duration `yaml:"initial_backoff"` // defaults to 1s, doubles on every retry
+
+	// allows webhooks to loopback, link-local, and private addresses,
+	// which could otherwise reach internal services
+	AllowPrivateDestinations bool `yaml:"allow_private_destinations"`
+}
+
+// WatchConfig represents the settings of change watches
+type WatchConfig struct {
+	HistorySize int `yaml:"history_size"` // number of change events retained for resuming watches, defaults to 10000
+}
+
+// LogConfig represents the settings of the server's logs
+type LogConfig struct {
+	Level  string `yaml:"level"`  // one of "debug", "info", "warn", or "error", defaults to "info"
+	Format string `yaml:"format"` // one of the LogFormat constants, defaults to LogFormatJSON
+}
+
+// ShutdownConfig represents the settings of graceful shutdown
+type ShutdownConfig struct {
+	Timeout time.Duration `yaml:"timeout"` // how long in-flight requests have to finish, defaults to 30s
+}
+
+// Default returns the configuration used for any value which isn't set
+func Default() *Config {
+	return &Config{
+		Listen:   ListenConfig{HTTP: ":8080", GRPC: ":9090"},
+		Storage:  StorageConfig{Backend: StorageMemory},
+		Groups:   GroupsConfig{Sources: []GroupSourceConfig{{Type: GroupSourceOkta}}, CacheTTL: time.Minute},
+		Webhooks: WebhooksConfig{MaxAttempts: 5, InitialBackoff: time.Second},
+		Watch:    WatchConfig{HistorySize: 10000},
+		Log:      LogConfig{Level: "info", Format: LogFormatJSON},
+		Tracing:  tracing.Config{Exporter: tracing.ExporterNone, SampleRatio: 1, ServiceName: "rbac"},
+		Shutdown: ShutdownConfig{Timeout: 30 * time.Second},
+	}
+}
+
+// Load returns the configuration given by the command line arguments (without
+// the program name), the environment, and the config file named by either of
+// them. The configuration is validated, so that the server fails at startup
+// rather than when a setting is first used. It returns flag.ErrHelp when
+// -h or -help is given.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("rbac", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	path := fs.String(flagConfigPath, os.Getenv(envConfigPath), "path of the YAML config file")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.flag] = fs.String(s.flag, "", s.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s\n\n%s", err, Usage())
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument \"%s\"", fs.Arg(0))
+	}
+
+	c := Default()
+	if *path != "" {
+		if err := c.readFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			if err := s.set(c, v); err != nil {
+				return nil, fmt.Errorf("invalid value \"%s\" for environment variable %s: %s", v, s.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		s, ok := settingsByFlag[f.Name]
+		if !ok || flagErr != nil {
+			return
+		}
+		if err := s.set(c, *flagValues[f.Name]); err != nil {
+			flagErr = fmt.Errorf("invalid value \"%s\" for flag -%s: %s", *flagValues[f.Name], f.Name, err)
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Warnings returns a description of every setting which was ignored while
+// loading the configuration, e.g. Okta settings when there is no okta source
+func (c *Config) Warnings() []string {
+	return c.warnings
+}
+
+// readFile overrides the configuration with the values in a YAML file.
+// Unknown keys are rejected, since they are most likely typos.
+func (c *Config) readFile(path string) error {
+	fileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %s", path, err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(fileBytes))
+	dec.KnownFields(true)
+	if err = dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to decode config file %s: %s", path, err)
+	}
+	return nil
+}
+
+// Validate returns an error describing every invalid value in the configuration
+func (c *Config) Validate() error {
+	var problems []string
+	addProblem := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if c.Listen.HTTP == "" {
+		addProblem("listen.http must be set")
+	}
+	if c.Listen.HTTP != "" && c.Listen.HTTP == c.Listen.GRPC {
+		addProblem("listen.http and listen.grpc are both \"%s\"", c.Listen.HTTP)
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		addProblem("tls.cert_file and tls.key_file must be set together")
+	}
+	if c.TLS.CertFile != "" {
+		if _, err := os.Stat(c.TLS.CertFile); err != nil {
+			addProblem("tls.cert_file: %s", err)
+		}
+	}
+	if c.TLS.KeyFile != "" {
+		if _, err := os.Stat(c.TLS.KeyFile); err != nil {
+			addProblem("tls.key_file: %s", err)
+		}
+	}
+	if c.TLS.ClientCAFile != "" {
+		if c.TLS.CertFile == "" {
+			addProblem("tls.client_ca_file requires tls.cert_file and tls.key_file")
+		}
+		if _, err := os.Stat(c.TLS.ClientCAFile); err != nil {
+			addProblem("tls.client_ca_file: %s", err)
+		}
+	}
+	if c.TLS.RequireClientCert && c.TLS.ClientCAFile == "" {
+		addProblem("tls.require_client_cert requires tls.client_ca_file")
+	}
+
+	for i, admin := range c.Auth.Admins {
+		if strings.TrimSpace(admin) == "" {
+			addProblem("auth.admins[%d] is empty", i)
+		}
+	}
+	if c.Auth.RestrictCreation && len(c.Auth.Admins) == 0 {
+		addProblem("auth.restrict_creation requires auth.admins, or no one could create anything")
+	}
+
+	switch c.Storage.Backend {
+	case StorageMemory:
+		if c.Storage.DSN != "" {
+			addProblem("storage.dsn must not be set for storage backend \"%s\"", StorageMemory)
+		}
+	default:
+		addProblem("storage.backend \"%s\" is not supported, must be \"%s\"", c.Storage.Backend, StorageMemory)
+	}
+
+	if len(c.Groups.Sources) == 0 {
+		addProblem("groups.sources must have at least one source")
+	}
+	for i, src := range c.Groups.Sources {
+		key := fmt.Sprintf("groups.sources[%d]", i)
+		switch src.Type {
+		case GroupSourceOkta:
+			if src.OrgDomain == "" {
+				addProblem("%s.org_domain must be set for source type \"%s\" (or OKTA_ORG_DOMAIN)", key, GroupSourceOkta)
+			}
+			if src.APIToken == "" {
+				addProblem("%s.api_token must be set for source type \"%s\" (or OKTA_API_TOKEN)", key, GroupSourceOkta)
+			}
+			if len(src.Users) > 0 {
+				addProblem("%s.users must not be set for source type \"%s\"", key, GroupSourceOkta)
+			}
+		case GroupSourceStatic:
+			if src.OrgDomain != "" || src.APIToken != "" {
+				addProblem("%s.org_domain and %s.api_token must not be set for source type \"%s\"", key, key, GroupSourceStatic)
+			}
+		default:
+			addProblem("%s.type \"%s\" is not one of \"%s\" or \"%s\"", key, src.Type, GroupSourceOkta, GroupSourceStatic)
+		}
+	}
+
+	if c.Webhooks.MaxAttempts < 1 {
+		addProblem("webhooks.max_attempts must be at least 1")
+	}
+	if c.Webhooks.InitialBackoff <= 0 {
+		addProblem("webhooks.initial_backoff must be positive")
+	}
+	if c.Watch.HistorySize < 1 {
+		addProblem("watch.history_size must be at least 1")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		addProblem("log.level \"%s\" is not one of \"debug\", \"info\", \"warn\", or \"error\"", c.Log.Level)
+	}
+	if c.Log.Format != LogFormatJSON && c.Log.Format != LogFormatText {
+		addProblem("log.format \"%s\" is not one of \"%s\" or \"%s\"", c.Log.Format, LogFormatJSON, LogFormatText)
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	default:
+		addProblem("tracing.exporter \"%s\" is not one of \"%s\", \"%s\", or \"%s\"",
+			c.Tracing.Exporter, tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP)
+	}
+	if c.Tracing.SampleRatio <= 0 || c.Tracing.SampleRatio > 1 {
+		addProblem("tracing.sample_ratio must be greater than 0 and at most 1")
+	}
+
+	if c.Shutdown.Timeout <= 0 {
+		addProblem("shutdown.timeout must be positive")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// NewStorage returns the configured storage backend
+func (c *Config) NewStorage() (storage.Storage, error) {
+	switch c.Storage.Backend {
+	case StorageMemory:
+		return storage.NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("storage backend \"%s\" is not supported", c.Storage.Backend)
+	}
+}
+
+// NewGroupsSource returns the configured chain of group sources
+func (c *Config) NewGroupsSource() (groups.Source, error) {
+	sources := []groups.Source{}
+	for _, src := range c.Groups.Sources {
+		switch src.Type {
+		case GroupSourceOkta:
+			sources = append(sources, groups.NewOktaSource(src.OrgDomain, src.APIToken))
+		case GroupSourceStatic:
+			sources = append(sources, groups.NewMemorySource(src.Users))
+		default:
+			return nil, fmt.Errorf("group source type \"%s\" is not supported", src.Type)
+		}
+	}
+	if len(sources) == 1 {
+		return sources[0], nil
+	}
+	return groups.NewChainSource(sources...), nil
+}
+
+// NewTLSConfig returns the TLS configuration of the server, or nil
+// if TLS is disabled. The certificate is reloaded when its files change.
+func (c *Config) NewTLSConfig() (*tls.Config, error) {
+	if c.TLS.CertFile == "" {
+		return nil, nil
+	}
+
+	reloader, err := certs.NewReloader(c.TLS.CertFile, c.TLS.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if c.TLS.ClientCAFile != "" {
+		pool, err := certs.LoadCertPool(c.TLS.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.TLS.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// NewLogger returns a logger with the configured level and format
+func (c *Config) NewLogger(w io.Writer) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(c.Log.Level)) // validated
+	opts := &slog.HandlerOptions{Level: level}
+	if c.Log.Format == LogFormatText {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	flagConfigPath = "config"
+	envConfigPath  = "RBAC_CONFIG"
+)
+
+// setting is a configuration value which can be set
+// with both a flag and an environment variable
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"http-addr", "RBAC_HTTP_ADDR", "address to serve the HTTP API on", func(c *Config, v string) error {
+		c.Listen.HTTP = v
+		return nil
+	}},
+	{"grpc-addr", "RBAC_GRPC_ADDR", "address to serve the gRPC API on, \"off\" disables it", func(c *Config, v string) error {
+		if v == "off" {
+			v = ""
+		}
+		c.Listen.GRPC = v
+		return nil
+	}},
+	{"tls-cert-file", "RBAC_TLS_CERT_FILE", "path of the PEM encoded TLS certificate", func(c *Config, v string) error {
+		c.TLS.CertFile = v
+		return nil
+	}},
+	{"tls-key-file", "RBAC_TLS_KEY_FILE", "path of the PEM encoded TLS private key", func(c *Config, v string) error {
+		c.TLS.KeyFile = v
+		return nil
+	}},
+	{"tls-client-ca-file", "RBAC_TLS_CLIENT_CA_FILE", "path of the PEM encoded CAs whose client certificates authenticate callers", func(c *Config, v string) error {
+		c.TLS.ClientCAFile = v
+		return nil
+	}},
+	{"tls-require-client-cert", "RBAC_TLS_REQUIRE_CLIENT_CERT", "reject clients without a certificate signed by the client CAs", func(c *Config, v string) error {
+		return setBool(&c.TLS.RequireClientCert, v)
+	}},
+	{"admins", "RBAC_ADMINS", "comma separated users bound to the built-in \"rbac.admin\" role on start", func(c *Config, v string) error {
+		c.Auth.Admins = strings.Split(v, ",")
+		return nil
+	}},
+	{"restrict-creation", "RBAC_RESTRICT_CREATION", "only allow users with the \"rbac.*.create\" meta-permissions to create objects", func(c *Config, v string) error {
+		return setBool(&c.Auth.RestrictCreation, v)
+	}},
+	{"storage-backend", "RBAC_STORAGE_BACKEND", "storage backend", func(c *Config, v string) error {
+		c.Storage.Backend = v
+		return nil
+	}},
+	{"storage-dsn", "RBAC_STORAGE_DSN", "connection string of the storage backend", func(c *Config, v string) error {
+		c.Storage.DSN = v
+		return nil
+	}},
+	{"okta-org-domain", "OKTA_ORG_DOMAIN", "Okta organization domain of every okta group source", func(c *Config, v string) error {
+		return setOkta(c, "OKTA_ORG_DOMAIN", func(src *GroupSourceConfig) { src.OrgDomain = v })
+	}},
+	{"okta-api-token", "OKTA_API_TOKEN", "Okta API token of every okta group source, prefer the environment variable", func(c *Config, v string) error {
+		return setOkta(c, "OKTA_API_TOKEN", func(src *GroupSourceConfig) { src.APIToken = v })
+	}},
+	{"groups-cache-ttl", "RBAC_GROUPS_CACHE_TTL", "how long group memberships are cached, negative disables caching", func(c *Config, v string) error {
+		return setDuration(&c.Groups.CacheTTL, v)
+	}},
+	{"webhook-max-attempts", "RBAC_WEBHOOK_MAX_ATTEMPTS", "attempts to deliver a webhook", func(c *Config, v string) error {
+		return setInt(&c.Webhooks.MaxAttempts, v)
+	}},
+	{"webhook-initial-backoff", "RBAC_WEBHOOK_INITIAL_BACKOFF", "wait before retrying a webhook delivery, doubles on every retry", func(c *Config, v string) error {
+		return setDuration(&c.Webhooks.InitialBackoff, v)
+	}},
+	{"webhook-allow-private", "RBAC_WEBHOOK_ALLOW_PRIVATE", "allow webhooks to loopback, link-local, and private addresses", func(c *Config, v string) error {
+		return setBool(&c.Webhooks.AllowPrivateDestinations, v)
+	}},
+	{"watch-history-size", "RBAC_WATCH_HISTORY_SIZE", "number of change events retained for resuming watches", func(c *Config, v string) error {
+		return setInt(&c.Watch.HistorySize, v)
+	}},
+	{"log-level", "RBAC_LOG_LEVEL", "one of \"debug\", \"info\", \"warn\", or \"error\"", func(c *Config, v string) error {
+		c.Log.Level = v
+		return nil
+	}},
+	{"log-format", "RBAC_LOG_FORMAT", "one of \"json\" or \"text\"", func(c *Config, v string) error {
+		c.Log.Format = v
+		return nil
+	}},
+	{"trace-exporter", "RBAC_TRACE_EXPORTER", "one of \"none\", \"stdout\", or \"otlp\"", func(c *Config, v string) error {
+		c.Tracing.Exporter = v
+		return nil
+	}},
+	{"trace-otlp-endpoint", "RBAC_TRACE_OTLP_ENDPOINT", "host:port of the OpenTelemetry collector", func(c *Config, v string) error {
+		c.Tracing.OTLPEndpoint = v
+		return nil
+	}},
+	{"trace-sample-ratio", "RBAC_TRACE_SAMPLE_RATIO", "ratio of traces started here which are sampled", func(c *Config, v string) error {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("not a number")
+		}
+		c.Tracing.SampleRatio = ratio
+		return nil
+	}},
+	{"shutdown-timeout", "RBAC_SHUTDOWN_TIMEOUT", "how long in-flight requests have to finish on shutdown", func(c *Config, v string) error {
+		return setDuration(&c.Shutdown.Timeout, v)
+	}},
+}
+
+var settingsByFlag = func() map[string]setting {
+	m := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		m[s.flag] = s
+	}
+	return m
+}()
+
+// Usage returns the description of every flag and its environment variable
+func Usage() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Usage: rbac [flags]\n\n")
+	fmt.Fprintf(&b, "  -%s (%s)\n\tpath of the YAML config file\n", flagConfigPath, envConfigPath)
+	for _, s := range settings {
+		fmt.Fprintf(&b, "  -%s (%s)\n\t%s\n", s.flag, s.env, s.usage)
+	}
+	fmt.Fprintf(&b, "\nFlags take precedence over environment variables, which take precedence over the config file.\n")
+	return b.String()
+}
+
+// setOkta applies a change to every okta source in the chain of group
+// sources. The setting is ignored with a warning when there are none, since
+// leftover Okta environment variables shouldn't stop the server.
+func setOkta(c *Config, name string, change func(*GroupSourceConfig)) error {
+	found := false
+	for i := range c.Groups.Sources {
+		if c.Groups.Sources[i].Type == GroupSourceOkta {
+			change(&c.Groups.Sources[i])
+			found = true
+		}
+	}
+	if !found {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring %s, there are no group sources of type \"%s\"", name, GroupSourceOkta))
+	}
+	return nil
+}
+
+func setDuration(d *time.Duration, v string) error {
+	parsed, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("not a duration, e.g. \"30s\" or \"5m\"")
+	}
+	*d = parsed
+	return nil
+}
+
+func setBool(b *bool, v string) error {
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("not a boolean")
+	}
+	*b = parsed
+	return nil
+}
+
+func setInt(i *int, v string) error {
+	parsed, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("not an integer")
+	}
+	*i = parsed
+	return nil
+}
@@ -0,0 +1,57 @@
+package events
+
+import "time"
+
+// Event types emitted after successful writes
+const (
+	RoleCreated = "role.created"
+	RoleUpdated = "role.updated"
+	RoleDeleted = "role.deleted"
+
+	PermissionCreated = "permission.created"
+	PermissionUpdated = "permission.updated"
+	PermissionDeleted = "permission.deleted"
+
+	ServiceAccountCreated = "service_account.created"
+	ServiceAccountUpdated = "service_account.updated" // keys created, rotated, or revoked
+	ServiceAccountDeleted = "service_account.deleted"
+
+	NamespaceCreated = "namespace.created"
+	NamespaceUpdated = "namespace.updated"
+	NamespaceDeleted = "namespace.deleted"
+
+	UserRoleAdded    = "user.role_added"
+	UserRoleRemoved  = "user.role_removed"
+	GroupRoleAdded   = "group.role_added"
+	GroupRoleRemoved = "group.role_removed"
+
+	SnapshotImported = "snapshot.imported" // any object may have changed
+)
+
+// Event represents a change to an object in the RBAC system
+type Event struct {
+	Revision uint64    `json:"revision,omitempty"`
+	Type     string    `json:"type"`
+	Name     string    `json:"name"`
+	Role     string    `json:"role,omitempty"` // only set for binding events
+	Actor    string    `json:"actor,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// New returns a new event of the given type for the named object
+func New(typ, name, actor string) Event {
+	return Event{
+		Type:  typ,
+		Name:  name,
+		Actor: actor,
+		Time:  time.Now().UTC(),
+	}
+}
+
+// NewBinding returns a new event of the given type for a change in the
+// binding between a user or group and a role
+func NewBinding(typ, name, role, actor string) Event {
+	e := New(typ, name, actor)
+	e.Role = role
+	return e
+}
@@ -0,0 +1,115 @@
+package events
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLogCapacity = 10000
+	watcherBufferSize  = 256
+)
+
+// ErrCompacted is returned when watching from a revision that is no longer
+// retained in the log, or was never in it, e.g. a revision of the log of a
+// process since restarted. Watchers must re-read the state they care about
+// and resume from the current revision.
+var ErrCompacted = errors.New("requested revision has been compacted")
+
+// Log is a bounded, in-memory history of events with monotonically
+// increasing revision numbers, which can be watched for new events.
+// Revisions start from the time the log is created in microseconds, so
+// that the revisions of a log before a restart are older than the first
+// revision of the new log rather than mistaken for its revisions.
+type Log struct {
+	sync.Mutex
+	revision uint64
+	history  []Event
+	capacity int
+	watchers map[chan Event]struct{}
+}
+
+// NewLog returns a new Log retaining up to capacity events.
+// A non positive capacity is replaced with a sensible default.
+func NewLog(capacity int) *Log {
+	if capacity <= 0 {
+		capacity = defaultLogCapacity
+	}
+	return &Log{
+		revision: uint64(time.Now().UnixMicro()),
+		history:  []Event{},
+		capacity: capacity,
+		watchers: make(map[chan Event]struct{}),
+	}
+}
+
+// Revision returns the revision of the latest event in the log
+func (l *Log) Revision() uint64 {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.revision
+}
+
+// Append assigns the next revision to an event, records it,
+// and notifies all watchers. It returns the recorded event.
+func (l *Log) Append(e Event) Event {
+	l.Lock()
+	defer l.Unlock()
+
+	l.revision++
+	e.Revision = l.revision
+
+	l.history = append(l.history, e)
+	if len(l.history) > l.capacity {
+		l.history = l.history[len(l.history)-l.capacity:]
+	}
+
+	for ch := range l.watchers {
+		select {
+		case ch <- e:
+		default:
+			// watcher is not keeping up, drop it so it can resume from its last revision
+			delete(l.watchers, ch)
+			close(ch)
+		}
+	}
+
+	return e
+}
+
+// Watch returns the retained events after the given revision and a channel
+// on which subsequent events are delivered. The channel is closed when the
+// watcher falls behind or the returned cancel function is called.
+func (l *Log) Watch(since uint64) ([]Event, <-chan Event, func(), error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if since > l.revision {
+		return nil, nil, nil, ErrCompacted
+	}
+
+	backlog := []Event{}
+	if since < l.revision {
+		if len(l.history) == 0 || l.history[0].Revision > since+1 {
+			return nil, nil, nil, ErrCompacted
+		}
+		backlog = append(backlog, l.history[len(l.history)-int(l.revision-since):]...)
+	}
+
+	ch := make(chan Event, watcherBufferSize)
+	l.watchers[ch] = struct{}{}
+
+	cancel := func() {
+		l.Lock()
+		defer l.Unlock()
+
+		if _, ok := l.watchers[ch]; ok {
+			delete(l.watchers, ch)
+			close(ch)
+		}
+	}
+
+	return backlog, ch, cancel, nil
+}
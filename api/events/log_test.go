@@ -0,0 +1,81 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWatchResumes(t *testing.T) {
+	l := NewLog(10)
+	first := l.Append(New(RoleCreated, "a", "alice"))
+	l.Append(New(RoleUpdated, "a", "alice"))
+
+	backlog, ch, cancel, err := l.Watch(first.Revision)
+	if err != nil {
+		t.Fatalf("failed to watch: %s", err)
+	}
+	defer cancel()
+	if len(backlog) != 1 || backlog[0].Type != RoleUpdated || backlog[0].Revision != first.Revision+1 {
+		t.Errorf("got backlog %+v, want the update after the first revision", backlog)
+	}
+
+	l.Append(New(RoleDeleted, "a", "alice"))
+	if e := <-ch; e.Type != RoleDeleted || e.Revision != first.Revision+2 {
+		t.Errorf("got event %+v, want the delete", e)
+	}
+
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Error("got an event after cancelling")
+	}
+}
+
+func TestWatchCurrentRevision(t *testing.T) {
+	l := NewLog(10)
+	l.Append(New(RoleCreated, "a", "alice"))
+
+	backlog, _, cancel, err := l.Watch(l.Revision())
+	if err != nil {
+		t.Fatalf("failed to watch: %s", err)
+	}
+	defer cancel()
+	if len(backlog) != 0 {
+		t.Errorf("got backlog %+v, want none from the current revision", backlog)
+	}
+}
+
+func TestWatchCompacted(t *testing.T) {
+	l := NewLog(2)
+	first := l.Append(New(RoleCreated, "a", "alice"))
+	for i := 0; i < 3; i++ {
+		l.Append(New(RoleUpdated, "a", "alice"))
+	}
+
+	if _, _, _, err := l.Watch(first.Revision); !errors.Is(err, ErrCompacted) {
+		t.Errorf("got error %v watching from an evicted revision, want ErrCompacted", err)
+	}
+	if _, _, cancel, err := l.Watch(first.Revision + 2); err != nil {
+		t.Errorf("failed to watch from the oldest retained revision: %s", err)
+	} else {
+		cancel()
+	}
+}
+
+func TestWatchOtherLog(t *testing.T) {
+	// a log before a restart, and the log after it
+	before := NewLog(10)
+	for i := 0; i < 3; i++ {
+		before.Append(New(RoleCreated, "a", "alice"))
+	}
+	time.Sleep(time.Millisecond) // the restart
+	after := NewLog(10)
+	after.Append(New(RoleCreated, "b", "alice"))
+
+	if _, _, _, err := after.Watch(before.Revision()); !errors.Is(err, ErrCompacted) {
+		t.Errorf("got error %v watching from a revision of the log before, want ErrCompacted", err)
+	}
+	if _, _, _, err := after.Watch(after.Revision() + 1); !errors.Is(err, ErrCompacted) {
+		t.Errorf("got error %v watching from a revision ahead of the log, want ErrCompacted", err)
+	}
+}
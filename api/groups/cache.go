@@ -0,0 +1,96 @@
+package groups
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CacheStats represents the usage of a CachingSource since it was created
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// CachingSource is an implementation of the Source interface which caches
+// the groups of each user from another Source for a fixed amount of time
+type CachingSource struct {
+	sync.Mutex
+	src     Source
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	swept   time.Time // last time expired entries were dropped
+	hits    uint64
+	misses  uint64
+}
+
+type cacheEntry struct {
+	groups  []string
+	expires time.Time
+}
+
+// NewCachingSource returns a new CachingSource
+func NewCachingSource(src Source, ttl time.Duration) *CachingSource {
+	return &CachingSource{
+		src:     src,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// GetForUser returns the groups a given user is a member of, from the
+// cache if they were looked up less than the cache's TTL ago. Errors
+// are not cached.
+func (cs *CachingSource) GetForUser(ctx context.Context, id string) ([]string, error) {
+	now := time.Now()
+
+	cs.Lock()
+	entry, ok := cs.entries[id]
+	if ok && now.Before(entry.expires) {
+		cs.hits++
+		cs.Unlock()
+		return entry.groups, nil
+	}
+	cs.misses++
+	cs.Unlock()
+
+	groups, err := cs.src.GetForUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.Lock()
+	defer cs.Unlock()
+	// drop expired entries once per TTL, so the cache doesn't grow forever
+	if now.Sub(cs.swept) > cs.ttl {
+		for user, entry := range cs.entries {
+			if !now.Before(entry.expires) {
+				delete(cs.entries, user)
+			}
+		}
+		cs.swept = now
+	}
+	cs.entries[id] = cacheEntry{groups: groups, expires: now.Add(cs.ttl)}
+	return groups, nil
+}
+
+// Stats returns the usage of the cache
+func (cs *CachingSource) Stats() CacheStats {
+	cs.Lock()
+	defer cs.Unlock()
+
+	return CacheStats{Hits: cs.hits, Misses: cs.misses, Entries: len(cs.entries)}
+}
+
+// UserActive calls UserActive of the cached source, it is not cached since
+// it is only used to find orphaned objects, which is never in a hot path
+func (cs *CachingSource) UserActive(ctx context.Context, id string) (bool, error) {
+	return cs.src.UserActive(ctx, id)
+}
+
+// Ping checks that the cached source is reachable, since
+// lookups of users not in the cache depend on it
+func (cs *CachingSource) Ping(ctx context.Context) error {
+	return cs.src.Ping(ctx)
+}
@@ -0,0 +1,68 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ChainSource is an implementation of the Source interface which consults
+// other sources in order. The first source which returns the groups of a
+// user provides them, skipping sources which don't know the user or fail,
+// so e.g. a static source can fill in for users missing from the identity
+// provider.
+type ChainSource struct {
+	sources []Source
+}
+
+// NewChainSource returns a new ChainSource
+func NewChainSource(sources ...Source) *ChainSource {
+	return &ChainSource{sources: sources}
+}
+
+// GetForUser returns the groups a given user is a member of,
+// from the first source in the chain which doesn't fail. The user is only
+// not found if no source knows the user, rather than some failing.
+func (cs *ChainSource) GetForUser(ctx context.Context, id string) ([]string, error) {
+	errs := []string{}
+	unknown := true
+	for _, src := range cs.sources {
+		groups, err := src.GetForUser(ctx, id)
+		if err == nil {
+			return groups, nil
+		}
+		unknown = unknown && errors.Is(err, ErrUserNotFound)
+		errs = append(errs, err.Error())
+	}
+	if unknown {
+		return nil, fmt.Errorf("%w: no group source knows user \"%s\": %s", ErrUserNotFound, id, strings.Join(errs, "; "))
+	}
+	return nil, fmt.Errorf("no group source knows user \"%s\": %s", id, strings.Join(errs, "; "))
+}
+
+// UserActive returns whether any source in the chain has a given active
+// user. A failing source fails the lookup, since the user may be active in it.
+func (cs *ChainSource) UserActive(ctx context.Context, id string) (bool, error) {
+	for i, src := range cs.sources {
+		active, err := src.UserActive(ctx, id)
+		if err != nil {
+			return false, fmt.Errorf("source %d of the chain failed to look up user \"%s\": %s", i, id, err)
+		}
+		if active {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Ping checks that every source in the chain is reachable, so that
+// an outage isn't hidden by a fallback source
+func (cs *ChainSource) Ping(ctx context.Context) error {
+	for i, src := range cs.sources {
+		if err := src.Ping(ctx); err != nil {
+			return fmt.Errorf("source %d of the chain is unreachable: %s", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// closeRecorder records whether a response body was closed
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// newTestOktaSource returns an OktaSource answering every request
+// with the given status and body
+func newTestOktaSource(status int, body string) (*OktaSource, *closeRecorder) {
+	rec := &closeRecorder{Reader: strings.NewReader(body)}
+	src := NewOktaSource("example.okta", "token")
+	src.httpClient.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: status, Body: rec, Header: http.Header{}, Request: r}, nil
+	})
+	return src, rec
+}
+
+func TestOktaGetForUser(t *testing.T) {
+	src, _ := newTestOktaSource(http.StatusOK, `[{"profile":{"name":"eng"}},{"profile":{"name":"ops"}}]`)
+	groups, err := src.GetForUser(context.Background(), "alice")
+	if err != nil || len(groups) != 2 || groups[0] != "eng" || groups[1] != "ops" {
+		t.Errorf("got groups %v and error %v, want eng and ops", groups, err)
+	}
+
+	src, rec := newTestOktaSource(http.StatusNotFound, `{"errorCode":"E0000007"}`)
+	if _, err := src.GetForUser(context.Background(), "mallory"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("got error %v for a user unknown to Okta, want ErrUserNotFound", err)
+	}
+	if !rec.closed {
+		t.Error("got the body of a 404 response left open")
+	}
+
+	src, rec = newTestOktaSource(http.StatusInternalServerError, "")
+	if _, err := src.GetForUser(context.Background(), "alice"); err == nil || errors.Is(err, ErrUserNotFound) {
+		t.Errorf("got error %v for a failing Okta, want a lookup failure", err)
+	}
+	if !rec.closed {
+		t.Error("got the body of a 500 response left open")
+	}
+}
+
+func TestChainOktaFirst(t *testing.T) {
+	static := NewMemorySource(map[string][]string{"ci-bot": {"deployers"}})
+
+	tests := []struct {
+		name     string
+		status   int
+		user     string
+		want     []string
+		notFound bool
+	}{
+		{"known to Okta", http.StatusOK, "alice", []string{"eng"}, false},
+		{"unknown to Okta", http.StatusNotFound, "ci-bot", []string{"deployers"}, false},
+		{"failing Okta", http.StatusInternalServerError, "ci-bot", []string{"deployers"}, false},
+		{"unknown to all", http.StatusNotFound, "mallory", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			okta, _ := newTestOktaSource(test.status, `[{"profile":{"name":"eng"}}]`)
+			groups, err := NewChainSource(okta, static).GetForUser(context.Background(), test.user)
+			if test.notFound {
+				if !errors.Is(err, ErrUserNotFound) {
+					t.Errorf("got error %v, want ErrUserNotFound", err)
+				}
+				return
+			}
+			if err != nil || strings.Join(groups, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got groups %v and error %v, want %v", groups, err, test.want)
+			}
+		})
+	}
+
+	// a failing source is not the same as an unknown user
+	okta, _ := newTestOktaSource(http.StatusInternalServerError, "")
+	if _, err := NewChainSource(okta, static).GetForUser(context.Background(), "mallory"); err == nil || errors.Is(err, ErrUserNotFound) {
+		t.Errorf("got error %v with a failing source, want a lookup failure", err)
+	}
+}
@@ -1,6 +1,7 @@
 package groups
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -15,10 +16,21 @@ func NewMemorySource(groups map[string][]string) *MemorySource {
 }
 
 // GetForUser returns the groups a given user is a member of
-func (ms *MemorySource) GetForUser(id string) ([]string, error) {
+func (ms *MemorySource) GetForUser(ctx context.Context, id string) ([]string, error) {
 	gm, ok := ms.groups[id]
 	if !ok {
-		return nil, fmt.Errorf("User \"%s\" not found", id)
+		return nil, fmt.Errorf("%w: \"%s\"", ErrUserNotFound, id)
 	}
 	return gm, nil
 }
+
+// UserActive returns whether a given user is in the source
+func (ms *MemorySource) UserActive(ctx context.Context, id string) (bool, error) {
+	_, ok := ms.groups[id]
+	return ok, nil
+}
+
+// Ping checks that the source is reachable, which memory always is
+func (ms *MemorySource) Ping(ctx context.Context) error {
+	return nil
+}
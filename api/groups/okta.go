@@ -1,11 +1,15 @@
 package groups
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 // OktaSource is an implementation of the Source interface that
@@ -27,12 +31,14 @@ func NewOktaSource(orgOktaDomain, apiToken string) *OktaSource {
 	}
 }
 
-// GetForUser returns the groups a given user (id or login) is a member of.
+// GetForUser returns the groups a given user (id or login) is a member of,
+// or ErrUserNotFound if Okta doesn't know the user.
+// The trace context of ctx, if any, is propagated to Okta.
 // https://developer.okta.com/docs/reference/api/users/#get-user-s-groups
-func (os *OktaSource) GetForUser(id string) ([]string, error) {
+func (os *OktaSource) GetForUser(ctx context.Context, id string) ([]string, error) {
 	url := fmt.Sprintf("https://%s.com/api/v1/users/%s/groups", os.orgOktaDomain, id)
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to build http request: %s", err)
 	}
@@ -40,14 +46,16 @@ func (os *OktaSource) GetForUser(id string) ([]string, error) {
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("SSWS %s", os.apiToken))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := os.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to make http request: %s", err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		return []string{}, nil
+		return nil, fmt.Errorf("%w: \"%s\"", ErrUserNotFound, id)
 	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("Got a non 200 HTTP status code: %d", resp.StatusCode)
@@ -57,7 +65,6 @@ func (os *OktaSource) GetForUser(id string) ([]string, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Failed to read http response body: %s", err)
 	}
-	defer resp.Body.Close()
 
 	var oktaGroupsResponse []struct {
 		Profile struct {
@@ -77,3 +84,73 @@ func (os *OktaSource) GetForUser(id string) ([]string, error) {
 
 	return names, nil
 }
+
+// UserActive returns whether a given user (id or login) exists in Okta and
+// has not been suspended or deactivated
+// https://developer.okta.com/docs/reference/api/users/#get-user
+func (os *OktaSource) UserActive(ctx context.Context, id string) (bool, error) {
+	url := fmt.Sprintf("https://%s.com/api/v1/users/%s", os.orgOktaDomain, id)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("Failed to build http request: %s", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("SSWS %s", os.apiToken))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := os.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("Failed to make http request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("Got a non 200 HTTP status code: %d", resp.StatusCode)
+	}
+
+	var oktaUserResponse struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&oktaUserResponse); err != nil {
+		return false, fmt.Errorf("Failed to decode HTTP response body: %s", err)
+	}
+
+	switch oktaUserResponse.Status {
+	case "SUSPENDED", "DEPROVISIONED":
+		return false, nil
+	default:
+		return true, nil
+	}
+}
+
+// Ping checks that Okta is reachable and accepts the API token,
+// by looking up the user the token belongs to
+// https://developer.okta.com/docs/reference/api/users/#get-current-user
+func (os *OktaSource) Ping(ctx context.Context) error {
+	url := fmt.Sprintf("https://%s.com/api/v1/users/me", os.orgOktaDomain)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("Failed to build http request: %s", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("SSWS %s", os.apiToken))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := os.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to make http request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Got a non 200 HTTP status code: %d", resp.StatusCode)
+	}
+	return nil
+}
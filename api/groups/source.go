@@ -1,6 +1,17 @@
 package groups
 
+import (
+	"context"
+	"errors"
+)
+
+// ErrUserNotFound is returned (wrapped) by GetForUser when a source doesn't
+// know a user, as opposed to failing to look the user up
+var ErrUserNotFound = errors.New("user not found")
+
 // Source represents the functionality of a groups source
 type Source interface {
-	GetForUser(string) ([]string, error)
+	GetForUser(context.Context, string) ([]string, error)
+	UserActive(context.Context, string) (bool, error) // whether a user exists and is not deactivated, for finding orphaned objects
+	Ping(context.Context) error                       // checks that the source is reachable, for readiness probes
 }
@@ -0,0 +1,93 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/adrianosela/rbac/api/validation"
+	"github.com/adrianosela/rbac/utils/set"
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the only supported manifest version
+const Version = "v1"
+
+// Manifest represents the desired state of a set of permissions and roles
+type Manifest struct {
+	Version     string       `json:"version" yaml:"version"`
+	Permissions []Permission `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	Roles       []Role       `json:"roles,omitempty" yaml:"roles,omitempty"`
+}
+
+// Permission represents the desired state of a permission
+type Permission struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Owners      []string `json:"owners,omitempty" yaml:"owners,omitempty"`
+}
+
+// Role represents the desired state of a role and its user and group bindings
+type Role struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Owners      []string `json:"owners,omitempty" yaml:"owners,omitempty"`
+	Permissions []string `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	Users       []string `json:"users,omitempty" yaml:"users,omitempty"`
+	Groups      []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+}
+
+// Parse decodes a YAML or JSON manifest and validates it
+func Parse(data []byte) (*Manifest, error) {
+	var m *Manifest
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to decode manifest: %s", err)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("manifest is empty")
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Validate checks the manifest version and that every object is
+// well formed and declared once. Problems are returned as validation.Errors.
+func (m *Manifest) Validate() error {
+	var errs validation.Errors
+	if m.Version != Version {
+		errs.Add("version", "unsupported manifest version \"%s\", must be \"%s\"", m.Version, Version)
+	}
+
+	perms := set.NewSet()
+	for i, p := range m.Permissions {
+		field := fmt.Sprintf("permissions[%d]", i)
+		errs.Name(field+".name", p.Name)
+		errs.Description(field+".description", p.Description)
+		errs.Owners(field+".owners", p.Owners)
+		if perms.Has(p.Name) {
+			errs.Add(field+".name", "permission \"%s\" is declared more than once", p.Name)
+		}
+		perms.Add(p.Name)
+	}
+
+	roles := set.NewSet()
+	for i, r := range m.Roles {
+		field := fmt.Sprintf("roles[%d]", i)
+		errs.Name(field+".name", r.Name)
+		errs.Description(field+".description", r.Description)
+		errs.Owners(field+".owners", r.Owners)
+		errs.Names(field+".permissions", r.Permissions)
+		errs.Principals(field+".users", r.Users)
+		errs.Subjects(field+".groups", r.Groups)
+		if roles.Has(r.Name) {
+			errs.Add(field+".name", "role \"%s\" is declared more than once", r.Name)
+		}
+		roles.Add(r.Name)
+	}
+
+	return errs.Err()
+}
@@ -0,0 +1,198 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// Change actions
+const (
+	ActionCreate = "create" // create the object with all fields in the change
+	ActionUpdate = "update" // set the description of the object
+	ActionAdd    = "add"    // add the listed members to the object
+	ActionRemove = "remove" // remove the listed members from the object
+	ActionDelete = "delete" // delete the object
+)
+
+// Change kinds
+const (
+	KindPermission = "permission"
+	KindRole       = "role"
+)
+
+// Change represents a single write needed to converge to a manifest
+type Change struct {
+	Action      string   `json:"action"`
+	Kind        string   `json:"kind"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Owners      []string `json:"owners,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	Users       []string `json:"users,omitempty"`
+	Groups      []string `json:"groups,omitempty"`
+}
+
+// ErrPermissionInUse is returned (wrapped) by Plan when pruning would delete
+// a permission which a role that is kept still uses
+var ErrPermissionInUse = errors.New("permission in use")
+
+// State represents the current state of the objects a manifest may touch
+type State struct {
+	Permissions map[string]*model.Permission
+	Roles       map[string]*model.Role
+
+	// names of the objects the actor may delete, only needed when pruning
+	PrunablePermissions set.Set
+	PrunableRoles       set.Set
+}
+
+// Plan returns the ordered changes that take the current state to the one
+// described by the manifest, on behalf of actor. The actor is never removed
+// as an owner, since objects can't be left without the owner applying them.
+// When prune is set, prunable objects which are not in the manifest are
+// deleted, unless a role which is kept uses them, which fails the plan rather
+// than the deletion once other changes were made. Changes are ordered such
+// that permissions exist before roles reference them, and roles are deleted
+// before the permissions they use.
+func Plan(m *Manifest, current *State, actor string, prune bool) ([]Change, error) {
+	changes := []Change{}
+
+	for _, p := range m.Permissions {
+		existing, ok := current.Permissions[p.Name]
+		if !ok {
+			changes = append(changes, Change{
+				Action:      ActionCreate,
+				Kind:        KindPermission,
+				Name:        p.Name,
+				Description: p.Description,
+				Owners:      sorted(set.NewSet(p.Owners...)),
+			})
+			continue
+		}
+		if existing.Description != p.Description {
+			changes = append(changes, Change{Action: ActionUpdate, Kind: KindPermission, Name: p.Name, Description: p.Description})
+		}
+		add, remove := diff(existing.Owners, p.Owners)
+		remove.Remove(actor)
+		if len(add) > 0 {
+			changes = append(changes, Change{Action: ActionAdd, Kind: KindPermission, Name: p.Name, Owners: sorted(add)})
+		}
+		if len(remove) > 0 {
+			changes = append(changes, Change{Action: ActionRemove, Kind: KindPermission, Name: p.Name, Owners: sorted(remove)})
+		}
+	}
+
+	for _, r := range m.Roles {
+		existing, ok := current.Roles[r.Name]
+		if !ok {
+			changes = append(changes, Change{
+				Action:      ActionCreate,
+				Kind:        KindRole,
+				Name:        r.Name,
+				Description: r.Description,
+				Owners:      sorted(set.NewSet(r.Owners...)),
+				Permissions: sorted(set.NewSet(r.Permissions...)),
+				Users:       sorted(set.NewSet(r.Users...)),
+				Groups:      sorted(set.NewSet(r.Groups...)),
+			})
+			continue
+		}
+		if existing.Description != r.Description {
+			changes = append(changes, Change{Action: ActionUpdate, Kind: KindRole, Name: r.Name, Description: r.Description})
+		}
+		addOwners, removeOwners := diff(existing.Owners, r.Owners)
+		removeOwners.Remove(actor)
+		addPerms, removePerms := diff(existing.Permissions, r.Permissions)
+		addUsers, removeUsers := diff(existing.Users, r.Users)
+		addGroups, removeGroups := diff(existing.Groups, r.Groups)
+		if len(addOwners)+len(addPerms)+len(addUsers)+len(addGroups) > 0 {
+			changes = append(changes, Change{
+				Action:      ActionAdd,
+				Kind:        KindRole,
+				Name:        r.Name,
+				Owners:      sorted(addOwners),
+				Permissions: sorted(addPerms),
+				Users:       sorted(addUsers),
+				Groups:      sorted(addGroups),
+			})
+		}
+		if len(removeOwners)+len(removePerms)+len(removeUsers)+len(removeGroups) > 0 {
+			changes = append(changes, Change{
+				Action:      ActionRemove,
+				Kind:        KindRole,
+				Name:        r.Name,
+				Owners:      sorted(removeOwners),
+				Permissions: sorted(removePerms),
+				Users:       sorted(removeUsers),
+				Groups:      sorted(removeGroups),
+			})
+		}
+	}
+
+	if !prune {
+		return changes, nil
+	}
+
+	managedRoles := set.NewSet()
+	for _, r := range m.Roles {
+		managedRoles.Add(r.Name)
+	}
+	unmanagedRoles := set.NewSet()
+	for name := range current.Roles {
+		if !managedRoles.Has(name) && current.PrunableRoles.Has(name) {
+			unmanagedRoles.Add(name)
+		}
+	}
+	for _, name := range sorted(unmanagedRoles) {
+		changes = append(changes, Change{Action: ActionDelete, Kind: KindRole, Name: name})
+	}
+
+	managedPerms := set.NewSet()
+	for _, p := range m.Permissions {
+		managedPerms.Add(p.Name)
+	}
+	unmanagedPerms := set.NewSet()
+	for name := range current.Permissions {
+		if !managedPerms.Has(name) && current.PrunablePermissions.Has(name) {
+			unmanagedPerms.Add(name)
+		}
+	}
+	for _, name := range sorted(unmanagedPerms) {
+		users := set.NewSet()
+		for _, r := range m.Roles {
+			if set.NewSet(r.Permissions...).Has(name) {
+				users.Add(r.Name)
+			}
+		}
+		for _, r := range current.Roles {
+			if !managedRoles.Has(r.Name) && !unmanagedRoles.Has(r.Name) && set.NewSet(r.Permissions...).Has(name) {
+				users.Add(r.Name)
+			}
+		}
+		if len(users) > 0 {
+			return nil, fmt.Errorf("%w: permission \"%s\" is not in the manifest, but roles %v which are kept use it. Remove it from them first", ErrPermissionInUse, name, sorted(users))
+		}
+		changes = append(changes, Change{Action: ActionDelete, Kind: KindPermission, Name: name})
+	}
+
+	return changes, nil
+}
+
+// diff returns the elements to add to and remove from have to get want
+func diff(have, want []string) (set.Set, set.Set) {
+	haveSet, wantSet := set.NewSet(have...), set.NewSet(want...)
+	add := wantSet.Copy().Remove(have...)
+	remove := haveSet.Copy().Remove(want...)
+	return add, remove
+}
+
+// sorted returns the elements of a set in a stable order
+func sorted(s set.Set) []string {
+	slice := s.Slice()
+	sort.Strings(slice)
+	return slice
+}
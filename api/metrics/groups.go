@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/adrianosela/rbac/api/groups"
+)
+
+// instrumentedSource is a groups.Source which records
+// the latency and errors of lookups in another
+type instrumentedSource struct {
+	src     groups.Source
+	metrics *Metrics
+}
+
+// InstrumentGroups returns a groups.Source which records the latency
+// and errors of lookups in the given one
+func (m *Metrics) InstrumentGroups(src groups.Source) groups.Source {
+	return &instrumentedSource{src: src, metrics: m}
+}
+
+// GetForUser calls GetForUser of the instrumented source
+func (is *instrumentedSource) GetForUser(ctx context.Context, id string) ([]string, error) {
+	start := time.Now()
+	groups, err := is.src.GetForUser(ctx, id)
+	is.metrics.groupsDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		is.metrics.groupsErrors.Inc()
+	}
+	return groups, err
+}
+
+// UserActive calls UserActive of the instrumented source
+func (is *instrumentedSource) UserActive(ctx context.Context, id string) (bool, error) {
+	start := time.Now()
+	active, err := is.src.UserActive(ctx, id)
+	is.metrics.groupsDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		is.metrics.groupsErrors.Inc()
+	}
+	return active, err
+}
+
+// Ping calls Ping of the instrumented source, which isn't a lookup
+func (is *instrumentedSource) Ping(ctx context.Context) error {
+	return is.src.Ping(ctx)
+}
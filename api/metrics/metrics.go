@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "rbac"
+
+// Metrics holds the Prometheus metrics of the service. Every Metrics has
+// its own registry, so that many services can run in the same process.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	checks          *prometheus.CounterVec
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+	groupsDuration  prometheus.Histogram
+	groupsErrors    prometheus.Counter
+}
+
+// New returns a new Metrics, with Go runtime and process metrics registered
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route template, method, and status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route template, method, and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		checks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "permission_checks_total",
+			Help:      "Number of permission checks by decision, either \"allow\" or \"deny\".",
+		}, []string{"decision"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Latency of storage operations by operation.",
+			Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+		}, []string{"operation"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_errors_total",
+			Help:      "Number of failed storage operations by operation.",
+		}, []string{"operation"}),
+		groupsDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "groups_lookup_duration_seconds",
+			Help:      "Latency of group membership lookups in the groups source.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		groupsErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "groups_lookup_errors_total",
+			Help:      "Number of failed group membership lookups in the groups source.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.checks,
+		m.storageDuration,
+		m.storageErrors,
+		m.groupsDuration,
+		m.groupsErrors,
+	)
+	return m
+}
+
+// Handler returns the handler which serves the metrics to Prometheus
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a served HTTP request
+func (m *Metrics) ObserveRequest(route, method string, status int, duration time.Duration) {
+	labels := prometheus.Labels{"route": route, "method": method, "status": strconv.Itoa(status)}
+	m.requests.With(labels).Inc()
+	m.requestDuration.With(labels).Observe(duration.Seconds())
+}
+
+// ObserveCheck records the decision of a permission check
+func (m *Metrics) ObserveCheck(allowed bool) {
+	if allowed {
+		m.checks.WithLabelValues("allow").Inc()
+		return
+	}
+	m.checks.WithLabelValues("deny").Inc()
+}
+
+// RegisterGroupsCache exposes the statistics of a groups cache
+func (m *Metrics) RegisterGroupsCache(cache *groups.CachingSource) {
+	m.registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "groups_cache_hits_total",
+			Help:      "Number of group membership lookups served from the cache.",
+		}, func() float64 { return float64(cache.Stats().Hits) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "groups_cache_misses_total",
+			Help:      "Number of group membership lookups not found in the cache.",
+		}, func() float64 { return float64(cache.Stats().Misses) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "groups_cache_entries",
+			Help:      "Number of users whose groups are in the cache.",
+		}, func() float64 { return float64(cache.Stats().Entries) }),
+	)
+}
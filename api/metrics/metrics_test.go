@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/storage"
+)
+
+// scrape returns the metrics as served to Prometheus
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d scraping metrics", w.Code)
+	}
+	return w.Body.String()
+}
+
+// checkSamples fails the test unless every sample is in the scraped metrics
+func checkSamples(t *testing.T, m *Metrics, samples ...string) {
+	t.Helper()
+
+	body := scrape(t, m)
+	for _, sample := range samples {
+		if !strings.Contains(body, sample+"\n") {
+			t.Errorf("got no sample %s", sample)
+		}
+	}
+}
+
+func TestObserve(t *testing.T) {
+	m := New()
+	m.ObserveRequest("/role/{name}", http.MethodGet, http.StatusOK, time.Millisecond)
+	m.ObserveRequest("/role/{name}", http.MethodGet, http.StatusOK, time.Millisecond)
+	m.ObserveRequest("/role/{name}", http.MethodGet, http.StatusNotFound, time.Millisecond)
+	m.ObserveCheck(true)
+	m.ObserveCheck(false)
+	m.ObserveCheck(false)
+
+	checkSamples(t, m,
+		`rbac_http_requests_total{method="GET",route="/role/{name}",status="200"} 2`,
+		`rbac_http_requests_total{method="GET",route="/role/{name}",status="404"} 1`,
+		`rbac_http_request_duration_seconds_count{method="GET",route="/role/{name}",status="200"} 2`,
+		`rbac_permission_checks_total{decision="allow"} 1`,
+		`rbac_permission_checks_total{decision="deny"} 2`,
+	)
+	if body := scrape(t, New()); !strings.Contains(body, "go_goroutines") || !strings.Contains(body, "process_") {
+		t.Error("got no runtime and process metrics")
+	}
+}
+
+func TestInstrumentStorage(t *testing.T) {
+	m := New()
+	store := m.InstrumentStorage(storage.NewMemoryStorage())
+	ctx := context.Background()
+
+	if err := store.CreateRole(ctx, &model.Role{Name: "readers"}); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+	if _, err := store.ReadRole(ctx, "readers"); err != nil {
+		t.Fatalf("failed to read role: %s", err)
+	}
+	if err := store.UpdateRole(ctx, &model.Role{Name: "writers"}); err == nil {
+		t.Fatal("updated a role which does not exist")
+	}
+
+	checkSamples(t, m,
+		`rbac_storage_operation_duration_seconds_count{operation="CreateRole"} 1`,
+		`rbac_storage_operation_duration_seconds_count{operation="ReadRole"} 1`,
+		`rbac_storage_operation_duration_seconds_count{operation="UpdateRole"} 1`,
+		`rbac_storage_operation_errors_total{operation="UpdateRole"} 1`,
+	)
+	if body := scrape(t, m); strings.Contains(body, `rbac_storage_operation_errors_total{operation="ReadRole"}`) {
+		t.Error("got errors counted for a successful operation")
+	}
+}
+
+func TestInstrumentGroups(t *testing.T) {
+	m := New()
+	cache := groups.NewCachingSource(m.InstrumentGroups(groups.NewMemorySource(map[string][]string{"alice": {"eng"}})), time.Minute)
+	m.RegisterGroupsCache(cache)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.GetForUser(ctx, "alice"); err != nil {
+			t.Fatalf("failed to get groups: %s", err)
+		}
+	}
+	if _, err := cache.GetForUser(ctx, "mallory"); err == nil {
+		t.Fatal("got groups for a user unknown to the source")
+	}
+
+	// only lookups which miss the cache reach the source
+	checkSamples(t, m,
+		`rbac_groups_lookup_duration_seconds_count 2`,
+		`rbac_groups_lookup_errors_total 1`,
+		`rbac_groups_cache_hits_total 1`,
+		`rbac_groups_cache_misses_total 2`,
+		`rbac_groups_cache_entries 1`,
+	)
+}
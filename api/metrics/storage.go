@@ -0,0 +1,269 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/storage"
+)
+
+// instrumentedStorage is a storage.Storage which records
+// the latency and errors of every operation of another
+type instrumentedStorage struct {
+	store   storage.Storage
+	metrics *Metrics
+}
+
+// InstrumentStorage returns a storage.Storage which records the latency
+// and errors of every operation of the given one
+func (m *Metrics) InstrumentStorage(store storage.Storage) storage.Storage {
+	return &instrumentedStorage{store: store, metrics: m}
+}
+
+func (is *instrumentedStorage) observe(operation string, start time.Time, err *error) {
+	is.metrics.storageDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		is.metrics.storageErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// CreatePermission calls CreatePermission of the instrumented storage
+func (is *instrumentedStorage) CreatePermission(ctx context.Context, p *model.Permission) (err error) {
+	defer is.observe("CreatePermission", time.Now(), &err)
+	return is.store.CreatePermission(ctx, p)
+}
+
+// ReadPermission calls ReadPermission of the instrumented storage
+func (is *instrumentedStorage) ReadPermission(ctx context.Context, name string) (permission *model.Permission, err error) {
+	defer is.observe("ReadPermission", time.Now(), &err)
+	return is.store.ReadPermission(ctx, name)
+}
+
+// BulkReadPermissions calls BulkReadPermissions of the instrumented storage
+func (is *instrumentedStorage) BulkReadPermissions(ctx context.Context, names []string) (permissions []*model.Permission, err error) {
+	defer is.observe("BulkReadPermissions", time.Now(), &err)
+	return is.store.BulkReadPermissions(ctx, names)
+}
+
+// ListPermissions calls ListPermissions of the instrumented storage
+func (is *instrumentedStorage) ListPermissions(ctx context.Context) (permissions []*model.Permission, err error) {
+	defer is.observe("ListPermissions", time.Now(), &err)
+	return is.store.ListPermissions(ctx)
+}
+
+// ScanPermissions calls ScanPermissions of the instrumented storage
+func (is *instrumentedStorage) ScanPermissions(ctx context.Context, opts storage.ListOptions) (permissions []*model.Permission, after string, err error) {
+	defer is.observe("ScanPermissions", time.Now(), &err)
+	return is.store.ScanPermissions(ctx, opts)
+}
+
+// UpdatePermission calls UpdatePermission of the instrumented storage
+func (is *instrumentedStorage) UpdatePermission(ctx context.Context, p *model.Permission) (err error) {
+	defer is.observe("UpdatePermission", time.Now(), &err)
+	return is.store.UpdatePermission(ctx, p)
+}
+
+// DeletePermission calls DeletePermission of the instrumented storage
+func (is *instrumentedStorage) DeletePermission(ctx context.Context, name string) (err error) {
+	defer is.observe("DeletePermission", time.Now(), &err)
+	return is.store.DeletePermission(ctx, name)
+}
+
+// AddRoleToPermissions calls AddRoleToPermissions of the instrumented storage
+func (is *instrumentedStorage) AddRoleToPermissions(ctx context.Context, role string, names []string) (err error) {
+	defer is.observe("AddRoleToPermissions", time.Now(), &err)
+	return is.store.AddRoleToPermissions(ctx, role, names)
+}
+
+// RemoveRoleFromPermissions calls RemoveRoleFromPermissions of the instrumented storage
+func (is *instrumentedStorage) RemoveRoleFromPermissions(ctx context.Context, role string, names []string) (err error) {
+	defer is.observe("RemoveRoleFromPermissions", time.Now(), &err)
+	return is.store.RemoveRoleFromPermissions(ctx, role, names)
+}
+
+// CreateRole calls CreateRole of the instrumented storage
+func (is *instrumentedStorage) CreateRole(ctx context.Context, r *model.Role) (err error) {
+	defer is.observe("CreateRole", time.Now(), &err)
+	return is.store.CreateRole(ctx, r)
+}
+
+// ReadRole calls ReadRole of the instrumented storage
+func (is *instrumentedStorage) ReadRole(ctx context.Context, name string) (role *model.Role, err error) {
+	defer is.observe("ReadRole", time.Now(), &err)
+	return is.store.ReadRole(ctx, name)
+}
+
+// BulkReadRoles calls BulkReadRoles of the instrumented storage
+func (is *instrumentedStorage) BulkReadRoles(ctx context.Context, names []string) (roles []*model.Role, err error) {
+	defer is.observe("BulkReadRoles", time.Now(), &err)
+	return is.store.BulkReadRoles(ctx, names)
+}
+
+// ListRoles calls ListRoles of the instrumented storage
+func (is *instrumentedStorage) ListRoles(ctx context.Context) (roles []*model.Role, err error) {
+	defer is.observe("ListRoles", time.Now(), &err)
+	return is.store.ListRoles(ctx)
+}
+
+// ScanRoles calls ScanRoles of the instrumented storage
+func (is *instrumentedStorage) ScanRoles(ctx context.Context, opts storage.ListOptions) (roles []*model.Role, after string, err error) {
+	defer is.observe("ScanRoles", time.Now(), &err)
+	return is.store.ScanRoles(ctx, opts)
+}
+
+// UpdateRole calls UpdateRole of the instrumented storage
+func (is *instrumentedStorage) UpdateRole(ctx context.Context, r *model.Role) (err error) {
+	defer is.observe("UpdateRole", time.Now(), &err)
+	return is.store.UpdateRole(ctx, r)
+}
+
+// DeleteRole calls DeleteRole of the instrumented storage
+func (is *instrumentedStorage) DeleteRole(ctx context.Context, name string) (err error) {
+	defer is.observe("DeleteRole", time.Now(), &err)
+	return is.store.DeleteRole(ctx, name)
+}
+
+// ReadUser calls ReadUser of the instrumented storage
+func (is *instrumentedStorage) ReadUser(ctx context.Context, id string) (user *model.User, err error) {
+	defer is.observe("ReadUser", time.Now(), &err)
+	return is.store.ReadUser(ctx, id)
+}
+
+// ListUsers calls ListUsers of the instrumented storage
+func (is *instrumentedStorage) ListUsers(ctx context.Context) (users []*model.User, err error) {
+	defer is.observe("ListUsers", time.Now(), &err)
+	return is.store.ListUsers(ctx)
+}
+
+// UpdateUser calls UpdateUser of the instrumented storage
+func (is *instrumentedStorage) UpdateUser(ctx context.Context, u *model.User) (err error) {
+	defer is.observe("UpdateUser", time.Now(), &err)
+	return is.store.UpdateUser(ctx, u)
+}
+
+// DeleteUser calls DeleteUser of the instrumented storage
+func (is *instrumentedStorage) DeleteUser(ctx context.Context, id string) (err error) {
+	defer is.observe("DeleteUser", time.Now(), &err)
+	return is.store.DeleteUser(ctx, id)
+}
+
+// AddRoleToUsers calls AddRoleToUsers of the instrumented storage
+func (is *instrumentedStorage) AddRoleToUsers(ctx context.Context, role string, ids []string) (err error) {
+	defer is.observe("AddRoleToUsers", time.Now(), &err)
+	return is.store.AddRoleToUsers(ctx, role, ids)
+}
+
+// RemoveRoleFromUsers calls RemoveRoleFromUsers of the instrumented storage
+func (is *instrumentedStorage) RemoveRoleFromUsers(ctx context.Context, role string, ids []string) (err error) {
+	defer is.observe("RemoveRoleFromUsers", time.Now(), &err)
+	return is.store.RemoveRoleFromUsers(ctx, role, ids)
+}
+
+// ReadGroups calls ReadGroups of the instrumented storage
+func (is *instrumentedStorage) ReadGroups(ctx context.Context, ids []string) (groups []*model.Group, err error) {
+	defer is.observe("ReadGroups", time.Now(), &err)
+	return is.store.ReadGroups(ctx, ids)
+}
+
+// ListGroups calls ListGroups of the instrumented storage
+func (is *instrumentedStorage) ListGroups(ctx context.Context) (groups []*model.Group, err error) {
+	defer is.observe("ListGroups", time.Now(), &err)
+	return is.store.ListGroups(ctx)
+}
+
+// UpdateGroup calls UpdateGroup of the instrumented storage
+func (is *instrumentedStorage) UpdateGroup(ctx context.Context, g *model.Group) (err error) {
+	defer is.observe("UpdateGroup", time.Now(), &err)
+	return is.store.UpdateGroup(ctx, g)
+}
+
+// DeleteGroup calls DeleteGroup of the instrumented storage
+func (is *instrumentedStorage) DeleteGroup(ctx context.Context, id string) (err error) {
+	defer is.observe("DeleteGroup", time.Now(), &err)
+	return is.store.DeleteGroup(ctx, id)
+}
+
+// AddRoleToGroups calls AddRoleToGroups of the instrumented storage
+func (is *instrumentedStorage) AddRoleToGroups(ctx context.Context, role string, ids []string) (err error) {
+	defer is.observe("AddRoleToGroups", time.Now(), &err)
+	return is.store.AddRoleToGroups(ctx, role, ids)
+}
+
+// RemoveRoleFromGroups calls RemoveRoleFromGroups of the instrumented storage
+func (is *instrumentedStorage) RemoveRoleFromGroups(ctx context.Context, role string, ids []string) (err error) {
+	defer is.observe("RemoveRoleFromGroups", time.Now(), &err)
+	return is.store.RemoveRoleFromGroups(ctx, role, ids)
+}
+
+// CreateServiceAccount calls CreateServiceAccount of the instrumented storage
+func (is *instrumentedStorage) CreateServiceAccount(ctx context.Context, sa *model.ServiceAccount) (err error) {
+	defer is.observe("CreateServiceAccount", time.Now(), &err)
+	return is.store.CreateServiceAccount(ctx, sa)
+}
+
+// ReadServiceAccount calls ReadServiceAccount of the instrumented storage
+func (is *instrumentedStorage) ReadServiceAccount(ctx context.Context, name string) (sa *model.ServiceAccount, err error) {
+	defer is.observe("ReadServiceAccount", time.Now(), &err)
+	return is.store.ReadServiceAccount(ctx, name)
+}
+
+// ListServiceAccounts calls ListServiceAccounts of the instrumented storage
+func (is *instrumentedStorage) ListServiceAccounts(ctx context.Context) (serviceAccounts []*model.ServiceAccount, err error) {
+	defer is.observe("ListServiceAccounts", time.Now(), &err)
+	return is.store.ListServiceAccounts(ctx)
+}
+
+// UpdateServiceAccount calls UpdateServiceAccount of the instrumented storage
+func (is *instrumentedStorage) UpdateServiceAccount(ctx context.Context, sa *model.ServiceAccount) (err error) {
+	defer is.observe("UpdateServiceAccount", time.Now(), &err)
+	return is.store.UpdateServiceAccount(ctx, sa)
+}
+
+// DeleteServiceAccount calls DeleteServiceAccount of the instrumented storage
+func (is *instrumentedStorage) DeleteServiceAccount(ctx context.Context, name string) (err error) {
+	defer is.observe("DeleteServiceAccount", time.Now(), &err)
+	return is.store.DeleteServiceAccount(ctx, name)
+}
+
+// TouchAPIKey calls TouchAPIKey of the instrumented storage
+func (is *instrumentedStorage) TouchAPIKey(ctx context.Context, name, id string, t time.Time) (err error) {
+	defer is.observe("TouchAPIKey", time.Now(), &err)
+	return is.store.TouchAPIKey(ctx, name, id, t)
+}
+
+// CreateNamespace calls CreateNamespace of the instrumented storage
+func (is *instrumentedStorage) CreateNamespace(ctx context.Context, ns *model.Namespace) (err error) {
+	defer is.observe("CreateNamespace", time.Now(), &err)
+	return is.store.CreateNamespace(ctx, ns)
+}
+
+// ReadNamespace calls ReadNamespace of the instrumented storage
+func (is *instrumentedStorage) ReadNamespace(ctx context.Context, name string) (ns *model.Namespace, err error) {
+	defer is.observe("ReadNamespace", time.Now(), &err)
+	return is.store.ReadNamespace(ctx, name)
+}
+
+// ListNamespaces calls ListNamespaces of the instrumented storage
+func (is *instrumentedStorage) ListNamespaces(ctx context.Context) (namespaces []*model.Namespace, err error) {
+	defer is.observe("ListNamespaces", time.Now(), &err)
+	return is.store.ListNamespaces(ctx)
+}
+
+// UpdateNamespace calls UpdateNamespace of the instrumented storage
+func (is *instrumentedStorage) UpdateNamespace(ctx context.Context, ns *model.Namespace) (err error) {
+	defer is.observe("UpdateNamespace", time.Now(), &err)
+	return is.store.UpdateNamespace(ctx, ns)
+}
+
+// DeleteNamespace calls DeleteNamespace of the instrumented storage
+func (is *instrumentedStorage) DeleteNamespace(ctx context.Context, name string) (err error) {
+	defer is.observe("DeleteNamespace", time.Now(), &err)
+	return is.store.DeleteNamespace(ctx, name)
+}
+
+// Ping calls Ping of the instrumented storage
+func (is *instrumentedStorage) Ping(ctx context.Context) (err error) {
+	defer is.observe("Ping", time.Now(), &err)
+	return is.store.Ping(ctx)
+}
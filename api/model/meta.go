@@ -0,0 +1,56 @@
+package model
+
+import "strings"
+
+// ReservedPrefix starts the names of the built-in meta-permissions and the
+// built-in admin role, which manage the RBAC service with itself. Other roles,
+// permissions, and namespaces can't be created with it.
+const ReservedPrefix = "rbac."
+
+// Meta-permissions are granted through ordinary roles, and are enforced by
+// the service in addition to the ownership of roles, permissions, service
+// accounts, and namespaces
+const (
+	PermissionRolesCreate           = "rbac.roles.create"
+	PermissionRolesAdmin            = "rbac.roles.admin" // modify and delete any role
+	PermissionPermissionsCreate     = "rbac.permissions.create"
+	PermissionPermissionsAdmin      = "rbac.permissions.admin" // modify, delete, and grant any permission
+	PermissionServiceAccountsCreate = "rbac.serviceaccounts.create"
+	PermissionServiceAccountsAdmin  = "rbac.serviceaccounts.admin" // modify and delete any service account
+	PermissionNamespacesCreate      = "rbac.namespaces.create"
+	PermissionNamespacesAdmin       = "rbac.namespaces.admin" // modify and delete any namespace, and create permissions in it
+	PermissionSnapshotsAdmin        = "rbac.snapshots.admin"  // export and import the full dataset
+)
+
+// CreatePermissions are the meta-permissions for creating objects. They are
+// only enforced when the service restricts creation, anyone may create
+// objects otherwise. Top-level namespaces are the exception, they always
+// require PermissionNamespacesCreate.
+var CreatePermissions = []string{
+	PermissionRolesCreate,
+	PermissionPermissionsCreate,
+	PermissionServiceAccountsCreate,
+	PermissionNamespacesCreate,
+}
+
+// AdminRole is the built-in role holding every meta-permission
+const AdminRole = "rbac.admin"
+
+// MetaPermissions describes every meta-permission
+var MetaPermissions = map[string]string{
+	PermissionRolesCreate:           "Create roles",
+	PermissionRolesAdmin:            "Modify and delete any role regardless of its owners",
+	PermissionPermissionsCreate:     "Create permissions",
+	PermissionPermissionsAdmin:      "Modify, delete, and grant any permission regardless of its owners",
+	PermissionServiceAccountsCreate: "Create service accounts",
+	PermissionServiceAccountsAdmin:  "Modify and delete any service account regardless of its owners",
+	PermissionNamespacesCreate:      "Create permission namespaces",
+	PermissionNamespacesAdmin:       "Modify and delete any namespace, and create permissions in it, regardless of its owners",
+	PermissionSnapshotsAdmin:        "Export and import the full dataset",
+}
+
+// IsReserved returns whether a role, permission, or namespace name is
+// reserved for built-ins
+func IsReserved(name string) bool {
+	return name == strings.TrimSuffix(ReservedPrefix, ".") || strings.HasPrefix(name, ReservedPrefix)
+}
@@ -0,0 +1,23 @@
+package model
+
+import "strings"
+
+// Namespace represents a prefix of permission names owned by a team, e.g.
+// namespace "payments" holds permissions named "payments.*". Only its
+// owners may create permissions in it.
+type Namespace struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Owners      []string `json:"owners"`
+}
+
+// NamespaceCandidates returns the namespaces a permission could be in, from
+// the most to the least specific, e.g. "payments.refunds" and "payments"
+// for permission "payments.refunds.create"
+func NamespaceCandidates(permission string) []string {
+	candidates := []string{}
+	for i := strings.LastIndex(permission, "."); i > 0; i = strings.LastIndex(permission[:i], ".") {
+		candidates = append(candidates, permission[:i])
+	}
+	return candidates
+}
@@ -0,0 +1,40 @@
+package model
+
+import "strings"
+
+// ServiceAccountPrefix marks service accounts among the principals in
+// Role.Users and in owners. Principals without a prefix are users.
+const ServiceAccountPrefix = "sa:"
+
+// ServiceAccountPrincipal returns the principal of the named service account
+func ServiceAccountPrincipal(name string) string {
+	return ServiceAccountPrefix + name
+}
+
+// ServiceAccountName returns the name of the service account
+// a principal refers to, or false if it isn't a service account
+func ServiceAccountName(principal string) (string, bool) {
+	return strings.CutPrefix(principal, ServiceAccountPrefix)
+}
+
+const (
+	// GroupOwnerPrefix marks a group among owners, every member of
+	// the group is an owner
+	GroupOwnerPrefix = "group:"
+
+	// RoleOwnerPrefix marks a role among owners, every user who has
+	// the role is an owner
+	RoleOwnerPrefix = "role:"
+)
+
+// OwnerGroup returns the ID of the group an owner refers to,
+// or false if it isn't a group
+func OwnerGroup(owner string) (string, bool) {
+	return strings.CutPrefix(owner, GroupOwnerPrefix)
+}
+
+// OwnerRole returns the name of the role an owner refers to,
+// or false if it isn't a role
+func OwnerRole(owner string) (string, bool) {
+	return strings.CutPrefix(owner, RoleOwnerPrefix)
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// ServiceAccount represents a non-human principal, e.g. a CI pipeline
+// or another service, which authenticates with API keys
+type ServiceAccount struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Owners      []string  `json:"owners"`
+	Keys        []*APIKey `json:"keys"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// APIKey represents an API key of a service account. Only a hash of the
+// key is kept, the key itself is returned once when it is created.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Hash      string     `json:"-"` // never encoded, so that it can't leak in responses
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+// Expired returns true if the key expired at or before the given time
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
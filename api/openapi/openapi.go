@@ -0,0 +1,186 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Version is the version of the OpenAPI specification documents conform to
+const Version = "3.0.3"
+
+// Document represents an OpenAPI document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info represents the metadata of an API
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem represents the operations available on a path, by lowercase method
+type PathItem map[string]*Operation
+
+// Operation represents a single API operation on a path
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter represents a path or query parameter of an operation
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody represents the request body of an operation
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response represents a response of an operation
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType represents the schema of a body of a given content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Components holds the reusable schemas and security schemes of a document
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme represents a way of authenticating requests
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema represents a JSON schema, or a reference to a component schema
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+// NewDocument returns a new empty document
+func NewDocument(title, version string) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       Info{Title: title, Version: version},
+		Paths:      make(map[string]*PathItem),
+		Components: Components{Schemas: make(map[string]*Schema)},
+	}
+}
+
+// SchemaFor returns the schema of a Go value as encoded by encoding/json.
+// Named struct types are added to the document's component schemas and
+// referenced, so that generated clients get one type per Go type.
+func (d *Document) SchemaFor(v interface{}) *Schema {
+	return d.schemaForType(reflect.TypeOf(v))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (d *Document) schemaForType(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.String:
+		return &Schema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &Schema{Type: "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return &Schema{Type: "array", Items: d.schemaForType(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaForType(t.Elem())}
+	case t.Kind() == reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		name := componentName(t)
+		if _, ok := d.Components.Schemas[name]; !ok {
+			d.Components.Schemas[name] = &Schema{} // placeholder for recursive types
+			d.Components.Schemas[name] = d.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		name, omitempty := f.Name, false
+		if tag := f.Tag.Get("json"); tag != "" {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				omitempty = omitempty || opt == "omitempty"
+			}
+		}
+		s.Properties[name] = d.schemaForType(f.Type)
+		if !omitempty {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// componentName returns the schema name of a named type. Types in the
+// model and payloads packages keep their name, other types are prefixed
+// with their package name to avoid collisions (e.g. manifest.Role), unless
+// named after their package (e.g. snapshot.Snapshot).
+func componentName(t reflect.Type) string {
+	pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+	if pkg == "model" || pkg == "payloads" || strings.EqualFold(pkg, t.Name()) {
+		return t.Name()
+	}
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + t.Name()
+}
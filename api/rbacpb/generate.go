@@ -0,0 +1,4 @@
+// Package rbacpb holds the protobuf definitions of the gRPC API
+package rbacpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative rbac.proto
@@ -0,0 +1,121 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/storage"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// ErrGroupsLookup is returned when the groups of a user can't be looked up,
+// e.g. because the user is unknown to the groups source
+var ErrGroupsLookup = errors.New("failed to get groups for user")
+
+// Roles represents the roles of a user by how they are bound to the user
+type Roles struct {
+	Groups    []string           // groups the user is a member of
+	Direct    set.Set            // roles tied to the user directly
+	ViaGroups map[string]set.Set // roles tied to each group the user is in
+}
+
+// Effective returns all the roles of the user
+func (r *Roles) Effective() set.Set {
+	roles := r.Direct.Copy()
+	for _, groupRoles := range r.ViaGroups {
+		roles.Join(groupRoles)
+	}
+	return roles
+}
+
+// ResolveRoles returns the roles of a user, whether tied to
+// the user directly or to any of the groups the user is in
+func ResolveRoles(ctx context.Context, store storage.Storage, src groups.Source, user string) (*Roles, error) {
+	// service accounts are not in the directory, so they are in no groups
+	groups := []string{}
+	if _, ok := model.ServiceAccountName(user); !ok {
+		var err error
+		if groups, err = src.GetForUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrGroupsLookup, err)
+		}
+	}
+	return ResolveRolesInGroups(ctx, store, user, groups)
+}
+
+// ResolveRolesInGroups returns the roles of a user in the given
+// groups, whether tied to the user directly or to the groups
+func ResolveRolesInGroups(ctx context.Context, store storage.Storage, user string, groups []string) (*Roles, error) {
+	roles := &Roles{
+		Groups:    groups,
+		Direct:    set.NewSet(),
+		ViaGroups: make(map[string]set.Set),
+	}
+
+	// collect roles tied to groups
+	gs, err := store.ReadGroups(ctx, groups)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bulk-get groups from store: %s", err)
+	}
+	for _, group := range gs {
+		roles.ViaGroups[group.ID] = set.NewSet(group.Roles...)
+	}
+
+	// collect roles tied to user
+	u, err := store.ReadUser(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user from store: %s", err)
+	}
+	if u != nil {
+		roles.Direct.Add(u.Roles...)
+	}
+
+	return roles, nil
+}
+
+// UserRoles returns the effective roles of a user
+func UserRoles(ctx context.Context, store storage.Storage, src groups.Source, user string) (set.Set, error) {
+	roles, err := ResolveRoles(ctx, store, src, user)
+	if err != nil {
+		return nil, err
+	}
+	return roles.Effective(), nil
+}
+
+// UserPermissions returns the effective permissions of a user
+func UserPermissions(ctx context.Context, store storage.Storage, src groups.Source, user string) (set.Set, error) {
+	roles, err := UserRoles(ctx, store, src, user)
+	if err != nil {
+		return nil, err
+	}
+	return RolePermissions(ctx, store, roles, nil)
+}
+
+// RolePermissions returns the union of the permissions of the given roles.
+// Roles in overrides are used instead of their stored version, which allows
+// evaluating the effect of changes before they are written.
+func RolePermissions(ctx context.Context, store storage.Storage, roles set.Set, overrides map[string]*model.Role) (set.Set, error) {
+	perms := set.NewSet()
+
+	stored := []string{}
+	for role := range roles {
+		if override, ok := overrides[role]; ok {
+			if override != nil {
+				perms.Add(override.Permissions...)
+			}
+			continue
+		}
+		stored = append(stored, role)
+	}
+
+	rs, err := store.BulkReadRoles(ctx, stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bulk-get roles from store: %s", err)
+	}
+	for _, role := range rs {
+		perms.Add(role.Permissions...)
+	}
+	return perms, nil
+}
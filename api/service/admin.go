@@ -0,0 +1,78 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/snapshot"
+)
+
+func (s *service) setAdminEndpoints() {
+	s.router.Methods(http.MethodGet).Path("/admin/export").Handler(s.admin(s.exportHandler))
+	s.router.Methods(http.MethodPost).Path("/admin/import").Handler(s.admin(s.importHandler)) // ?mode=replace|merge, defaults to merge
+}
+
+func (s *service) exportHandler(w http.ResponseWriter, r *http.Request) {
+	// no writes may happen while storage is read for the snapshot to be consistent
+	s.writes.Lock()
+	snap, err := snapshot.Read(r.Context(), s.store, s.changes.Revision())
+	s.writes.Unlock()
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to read snapshot from storage"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := snap.Encode(w); err != nil {
+		logFields(r.Context(), slog.String("error", fmt.Sprintf("failed to stream snapshot: %s", err)))
+	}
+	return
+}
+
+func (s *service) importHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = snapshot.ModeMerge
+	}
+	logFields(r.Context(), slog.String("mode", mode))
+
+	var snap *snapshot.Snapshot
+	defer r.Body.Close()
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&snap); err != nil || snap == nil || dec.More() {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a snapshot"))
+		return
+	}
+
+	s.writes.Lock()
+	defer s.writes.Unlock()
+
+	if err := snapshot.Load(r.Context(), s.store, snap, mode); err != nil {
+		if errors.Is(err, snapshot.ErrInvalid) {
+			writeError(w, r, newError(payloads.CodeInvalidSnapshot, err.Error()))
+			return
+		}
+		writeError(w, r, internalError(err, "failed to write snapshot to storage"))
+		return
+	}
+	s.publish(events.New(events.SnapshotImported, mode, authenticatedUser))
+
+	// a snapshot replacing all data may lack the admin role
+	if err := s.bootstrap(r.Context()); err != nil {
+		writeError(w, r, internalError(err, "failed to bootstrap the admin role after import"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Snapshot imported successfully! (%d permissions, %d roles, %d users, %d groups, %d service accounts, %d namespaces in %s mode)", len(snap.Permissions), len(snap.Roles), len(snap.Users), len(snap.Groups), len(snap.ServiceAccounts), len(snap.Namespaces), mode)))
+	return
+}
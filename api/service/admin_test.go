@@ -0,0 +1,21 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/snapshot"
+)
+
+func TestImportRejectsUnknownFields(t *testing.T) {
+	svc := newAdminTestService(t)
+
+	body := map[string]any{"version": snapshot.Version, "rolls": []string{}}
+	if status, code := httpCode(t, svc, "dave", http.MethodPost, "/admin/import?mode=replace", body); status != http.StatusBadRequest || code != payloads.CodeInvalidRequest {
+		t.Errorf("got %d %s importing a snapshot with an unknown field, want %d %s", status, code, http.StatusBadRequest, payloads.CodeInvalidRequest)
+	}
+	if status, code := httpCode(t, svc, "alice", http.MethodPost, "/admin/import", &snapshot.Snapshot{Version: snapshot.Version}); status != http.StatusForbidden || code != payloads.CodeNotAdmin {
+		t.Errorf("got %d %s importing as a non-admin, want %d %s", status, code, http.StatusForbidden, payloads.CodeNotAdmin)
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/adrianosela/rbac/api/manifest"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/validation"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+func (s *service) setApplyEndpoints() {
+	s.router.Methods(http.MethodPost).Path("/apply").Handler(s.auth(s.applyHandler)) // ?prune=true deletes unmanaged objects, ?dry_run=true only plans
+}
+
+func (s *service) applyHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	prune := false
+	if v := r.URL.Query().Get("prune"); v != "" {
+		var err error
+		if prune, err = strconv.ParseBool(v); err != nil {
+			writeError(w, r, newError(payloads.CodeInvalidRequest, "prune value \"%s\" is not a boolean", v))
+			return
+		}
+	}
+
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "failed to read request body"))
+		return
+	}
+
+	m, err := manifest.Parse(bodyBytes)
+	if err != nil {
+		var fields validation.Errors
+		if errors.As(err, &fields) {
+			writeError(w, r, invalidPayload(err))
+			return
+		}
+		writeError(w, r, newError(payloads.CodeInvalidRequest, err.Error()))
+		return
+	}
+
+	current, err := s.readManifestState(r.Context(), authenticatedUser, m, prune)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	changes, err := manifest.Plan(m, current, authenticatedUser, prune)
+	if err != nil {
+		if errors.Is(err, manifest.ErrPermissionInUse) {
+			writeError(w, r, newError(payloads.CodePermissionInUse, err.Error()))
+			return
+		}
+		writeError(w, r, internalError(err, "failed to plan changes"))
+		return
+	}
+	logFields(r.Context(), slog.Int("changes", len(changes)), slog.Bool("prune", prune), slog.Bool("dry_run", dryRun))
+	// changes depend on each other, so a dry run only returns the plan. They
+	// are not rolled back when one fails, so the error lists those made.
+	if !dryRun {
+		for i, change := range changes {
+			if err := s.applyChange(r.Context(), authenticatedUser, change); err != nil {
+				ae, ok := err.(*apiError)
+				if !ok {
+					ae = internalError(err, "internal error")
+				}
+				ae.msg = fmt.Sprintf("failed to apply change %d of %d (%s %s \"%s\"), the %d before it were applied: %s", i+1, len(changes), change.Action, change.Kind, change.Name, i, ae.msg)
+				ae.applied = changes[:i]
+				writeError(w, r, ae)
+				return
+			}
+		}
+	}
+
+	respBytes, err := json.Marshal(&payloads.ApplyResponse{DryRun: dryRun, Changes: changes})
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return
+}
+
+// readManifestState reads the current state of the objects in a manifest, or
+// of all objects in storage when unmanaged objects are to be pruned, along
+// with which of them the actor may prune
+func (s *service) readManifestState(ctx context.Context, actor string, m *manifest.Manifest, prune bool) (*manifest.State, error) {
+	state := &manifest.State{
+		Permissions:         make(map[string]*model.Permission),
+		Roles:               make(map[string]*model.Role),
+		PrunablePermissions: set.NewSet(),
+		PrunableRoles:       set.NewSet(),
+	}
+
+	if prune {
+		permsAdmin, err := s.hasPermission(ctx, actor, model.PermissionPermissionsAdmin)
+		if err != nil {
+			return nil, err
+		}
+		rolesAdmin, err := s.hasPermission(ctx, actor, model.PermissionRolesAdmin)
+		if err != nil {
+			return nil, err
+		}
+
+		perms, err := s.store.ListPermissions(ctx)
+		if err != nil {
+			return nil, internalError(err, "failed to list permissions in storage")
+		}
+		for _, perm := range perms {
+			state.Permissions[perm.Name] = perm
+			if prunable, err := s.isPrunable(ctx, actor, perm.Name, perm.Owners, permsAdmin); err != nil {
+				return nil, err
+			} else if prunable {
+				state.PrunablePermissions.Add(perm.Name)
+			}
+		}
+		roles, err := s.store.ListRoles(ctx)
+		if err != nil {
+			return nil, internalError(err, "failed to list roles in storage")
+		}
+		for _, role := range roles {
+			state.Roles[role.Name] = role
+			if prunable, err := s.isPrunable(ctx, actor, role.Name, role.Owners, rolesAdmin); err != nil {
+				return nil, err
+			} else if prunable {
+				state.PrunableRoles.Add(role.Name)
+			}
+		}
+		return state, nil
+	}
+
+	for _, p := range m.Permissions {
+		perm, err := s.store.ReadPermission(ctx, p.Name)
+		if err != nil {
+			return nil, internalError(err, "failed to read permission from storage")
+		}
+		if perm != nil {
+			state.Permissions[perm.Name] = perm
+		}
+	}
+	for _, r := range m.Roles {
+		role, err := s.store.ReadRole(ctx, r.Name)
+		if err != nil {
+			return nil, internalError(err, "failed to read role from storage")
+		}
+		if role != nil {
+			state.Roles[role.Name] = role
+		}
+	}
+	return state, nil
+}
+
+// isPrunable returns whether the actor may delete an object when pruning, the
+// same as checkOwner would allow: as one of its owners, as a member of an
+// owner group or role, or as an admin of its kind. Built-ins are never pruned.
+func (s *service) isPrunable(ctx context.Context, actor, name string, owners []string, admin bool) (bool, error) {
+	if model.IsReserved(name) {
+		return false, nil
+	}
+	if admin {
+		return true, nil
+	}
+	return s.isOwner(ctx, actor, owners)
+}
+
+// applyChange performs a planned change through the same
+// operations, and therefore the same checks, as the handlers
+func (s *service) applyChange(ctx context.Context, actor string, c manifest.Change) error {
+	var err error
+	switch c.Kind + "/" + c.Action {
+	case manifest.KindPermission + "/" + manifest.ActionCreate:
+		_, err = s.createPermission(ctx, actor, &payloads.CreatePermissionRequest{Name: c.Name, Description: c.Description, Owners: c.Owners}, false)
+	case manifest.KindPermission + "/" + manifest.ActionUpdate:
+		_, err = s.updatePermission(ctx, actor, c.Name, &payloads.GenericUpdateDescriptionRequest{Description: c.Description}, false)
+	case manifest.KindPermission + "/" + manifest.ActionAdd:
+		_, err = s.addToPermission(ctx, actor, c.Name, &payloads.ModifyPermissionRequest{Owners: c.Owners}, false)
+	case manifest.KindPermission + "/" + manifest.ActionRemove:
+		_, err = s.removeFromPermission(ctx, actor, c.Name, &payloads.ModifyPermissionRequest{Owners: c.Owners}, false)
+	case manifest.KindPermission + "/" + manifest.ActionDelete:
+		err = s.deletePermission(ctx, actor, c.Name, false)
+	case manifest.KindRole + "/" + manifest.ActionCreate:
+		_, err = s.createRole(ctx, actor, &payloads.CreateRoleRequest{
+			Name:        c.Name,
+			Description: c.Description,
+			Permissions: c.Permissions,
+			Users:       c.Users,
+			Groups:      c.Groups,
+			Owners:      c.Owners,
+		}, false)
+	case manifest.KindRole + "/" + manifest.ActionUpdate:
+		_, err = s.updateRole(ctx, actor, c.Name, &payloads.GenericUpdateDescriptionRequest{Description: c.Description}, false)
+	case manifest.KindRole + "/" + manifest.ActionAdd:
+		_, err = s.addToRole(ctx, actor, c.Name, &payloads.ModifyRoleRequest{Permissions: c.Permissions, Users: c.Users, Groups: c.Groups, Owners: c.Owners}, false)
+	case manifest.KindRole + "/" + manifest.ActionRemove:
+		_, err = s.removeFromRole(ctx, actor, c.Name, &payloads.ModifyRoleRequest{Permissions: c.Permissions, Users: c.Users, Groups: c.Groups, Owners: c.Owners}, false)
+	case manifest.KindRole + "/" + manifest.ActionDelete:
+		err = s.deleteRole(ctx, actor, c.Name, false)
+	default:
+		err = fmt.Errorf("unknown change %s %s", c.Action, c.Kind)
+	}
+	return err
+}
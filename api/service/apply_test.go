@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/manifest"
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+// apply applies a manifest as user, and returns the status and the body
+func apply(t *testing.T, svc *service, user string, m *manifest.Manifest, query string) (int, []byte) {
+	t.Helper()
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("failed to encode manifest: %s", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/apply?"+query, strings.NewReader(string(b)))
+	req.Header.Set("MOCK_AUTHENTICATED_USER", user)
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, req)
+	return w.Code, w.Body.Bytes()
+}
+
+// deleted returns the sorted names of the objects an apply deleted
+func deleted(t *testing.T, body []byte) []string {
+	t.Helper()
+
+	var resp payloads.ApplyResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("failed to decode response %s: %s", body, err)
+	}
+	names := []string{}
+	for _, c := range resp.Changes {
+		if c.Action == manifest.ActionDelete {
+			names = append(names, c.Kind+"/"+c.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestApplyPrunesOwnedObjects(t *testing.T) {
+	svc, err := newService(Config{
+		Groups: groups.NewMemorySource(map[string][]string{"alice": {"eng"}, "carol": {}, "dave": {}}),
+		Admins: []string{"dave"},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	ctx := context.Background()
+
+	for _, pl := range []struct {
+		actor string
+		role  payloads.CreateRoleRequest
+	}{
+		{"carol", payloads.CreateRoleRequest{Name: "carols"}},
+		{"carol", payloads.CreateRoleRequest{Name: "eng-owned", Owners: []string{"group:eng"}}},
+		{"carol", payloads.CreateRoleRequest{Name: "leads", Users: []string{"alice"}}},
+		{"carol", payloads.CreateRoleRequest{Name: "leads-owned", Owners: []string{"role:leads"}}},
+		{"alice", payloads.CreateRoleRequest{Name: "alices"}},
+	} {
+		if _, err := svc.createRole(ctx, pl.actor, &pl.role, false); err != nil {
+			t.Fatalf("failed to create role %s: %s", pl.role.Name, err)
+		}
+	}
+	for _, name := range []string{"docs.read", "docs.write"} {
+		if _, err := svc.createPermission(ctx, "alice", &payloads.CreatePermissionRequest{Name: name}, false); err != nil {
+			t.Fatalf("failed to create permission %s: %s", name, err)
+		}
+	}
+	m := &manifest.Manifest{Version: manifest.Version, Permissions: []manifest.Permission{{Name: "docs.read", Owners: []string{"alice"}}}}
+
+	status, body := apply(t, svc, "alice", m, "prune=true&dry_run=true")
+	if status != http.StatusOK {
+		t.Fatalf("got status %d: %s", status, body)
+	}
+	want := []string{"permission/docs.write", "role/alices", "role/eng-owned", "role/leads-owned"}
+	if got := deleted(t, body); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("owner would prune %v, want %v", got, want)
+	}
+
+	// an admin may prune everything but the built-ins
+	status, body = apply(t, svc, "dave", m, "prune=true")
+	if status != http.StatusOK {
+		t.Fatalf("got status %d: %s", status, body)
+	}
+	want = []string{"permission/docs.write", "role/alices", "role/carols", "role/eng-owned", "role/leads", "role/leads-owned"}
+	if got := deleted(t, body); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("admin pruned %v, want %v", got, want)
+	}
+	roles, err := svc.store.ListRoles(ctx)
+	if err != nil || len(roles) != 1 {
+		t.Errorf("got roles %v, %v after pruning, want only the admin role", roles, err)
+	}
+}
+
+func TestApplyReportsAppliedChanges(t *testing.T) {
+	svc := newTestService(t)
+	if _, err := svc.createRole(context.Background(), "carol", &payloads.CreateRoleRequest{Name: "carols"}, false); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+
+	// the permission is created before the role owned by someone else fails
+	m := &manifest.Manifest{
+		Version:     manifest.Version,
+		Permissions: []manifest.Permission{{Name: "docs.read", Owners: []string{"alice"}}},
+		Roles:       []manifest.Role{{Name: "carols", Description: "alice's now", Owners: []string{"carol"}}},
+	}
+	status, body := apply(t, svc, "alice", m, "")
+	if status != http.StatusForbidden {
+		t.Fatalf("got status %d: %s", status, body)
+	}
+	var resp payloads.ErrorResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("failed to decode response %s: %s", body, err)
+	}
+	if resp.Code != payloads.CodeNotOwner || !strings.Contains(resp.Message, "change 2 of 2") {
+		t.Errorf("got error %s: %s", resp.Code, resp.Message)
+	}
+	if len(resp.Applied) != 1 || resp.Applied[0].Kind != manifest.KindPermission || resp.Applied[0].Name != "docs.read" {
+		t.Errorf("got applied changes %+v, want the permission created", resp.Applied)
+	}
+	if perm, err := svc.store.ReadPermission(context.Background(), "docs.read"); err != nil || perm == nil {
+		t.Errorf("got permission %v, %v, want the applied change kept", perm, err)
+	}
+}
+
+func TestApplyPruneFailsForUsedPermissions(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	// carol's role uses a permission of alice's, so alice can't prune it
+	for _, name := range []string{"docs.read", "docs.write"} {
+		if _, err := svc.createPermission(ctx, "alice", &payloads.CreatePermissionRequest{Name: name}, false); err != nil {
+			t.Fatalf("failed to create permission %s: %s", name, err)
+		}
+	}
+	if _, err := svc.createRole(ctx, "alice", &payloads.CreateRoleRequest{Name: "readers", Permissions: []string{"docs.read"}}, false); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+	if _, err := svc.transferRole(ctx, "alice", "readers", &payloads.TransferOwnershipRequest{To: []string{"carol"}, Exclusive: true}, false); err != nil {
+		t.Fatalf("failed to transfer role: %s", err)
+	}
+
+	m := &manifest.Manifest{Version: manifest.Version}
+	for _, query := range []string{"prune=true&dry_run=true", "prune=true"} {
+		status, body := apply(t, svc, "alice", m, query)
+		var resp payloads.ErrorResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("failed to decode response %s: %s", body, err)
+		}
+		if status != http.StatusConflict || resp.Code != payloads.CodePermissionInUse || !strings.Contains(resp.Message, "readers") {
+			t.Errorf("got %d %s: %s with %s, want %d %s naming the role", status, resp.Code, resp.Message, query, http.StatusConflict, payloads.CodePermissionInUse)
+		}
+	}
+
+	// the plan failed before anything was written
+	for _, name := range []string{"docs.read", "docs.write"} {
+		if perm, err := svc.store.ReadPermission(ctx, name); err != nil || perm == nil {
+			t.Errorf("got permission %v, %v, want %s kept", perm, err, name)
+		}
+	}
+
+	// pruning works once the role no longer uses the permission
+	if _, err := svc.removeFromRole(ctx, "carol", "readers", &payloads.ModifyRoleRequest{Permissions: []string{"docs.read"}}, false); err != nil {
+		t.Fatalf("failed to remove permission from role: %s", err)
+	}
+	status, body := apply(t, svc, "alice", m, "prune=true")
+	if status != http.StatusOK {
+		t.Fatalf("got status %d: %s", status, body)
+	}
+	want := []string{"permission/docs.read", "permission/docs.write"}
+	if got := deleted(t, body); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("pruned %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// bootstrapActor is the actor of the changes made by bootstrap
+const bootstrapActor = "rbac"
+
+// bootstrap creates any missing meta-permissions and the built-in admin role
+// holding all of them, and binds the configured admins to the role. Both the
+// role and the meta-permissions are owned by the role, so that admins can
+// grant meta-permissions to other roles. It is idempotent, and runs on start
+// and after every import, so that the service can't be locked out of itself.
+func (s *service) bootstrap(ctx context.Context) error {
+	owners := []string{model.RoleOwnerPrefix + model.AdminRole}
+
+	metaPermissions := []string{}
+	for name := range model.MetaPermissions {
+		metaPermissions = append(metaPermissions, name)
+	}
+	sort.Strings(metaPermissions)
+
+	for _, name := range metaPermissions {
+		perm, err := s.store.ReadPermission(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to read permission \"%s\": %s", name, err)
+		}
+		if perm != nil {
+			continue
+		}
+		perm = &model.Permission{Name: name, Description: model.MetaPermissions[name], Owners: owners}
+		if err := s.store.CreatePermission(ctx, perm); err != nil {
+			return fmt.Errorf("failed to create permission \"%s\": %s", name, err)
+		}
+		s.publish(events.New(events.PermissionCreated, name, bootstrapActor))
+	}
+
+	role, err := s.store.ReadRole(ctx, model.AdminRole)
+	if err != nil {
+		return fmt.Errorf("failed to read role \"%s\": %s", model.AdminRole, err)
+	}
+
+	var missingPermissions, missingUsers []string
+	if role == nil {
+		role = &model.Role{
+			Name:        model.AdminRole,
+			Description: "Administers the RBAC service",
+			Owners:      owners,
+			Users:       set.NewSet(s.admins...).Slice(),
+			Groups:      []string{},
+			Permissions: metaPermissions,
+		}
+		if err := s.store.CreateRole(ctx, role); err != nil {
+			return fmt.Errorf("failed to create role \"%s\": %s", model.AdminRole, err)
+		}
+		s.publish(events.New(events.RoleCreated, role.Name, bootstrapActor))
+		missingPermissions, missingUsers = role.Permissions, role.Users
+	} else {
+		permissions, users := set.NewSet(role.Permissions...), set.NewSet(role.Users...)
+		for _, name := range metaPermissions {
+			if !permissions.Has(name) {
+				missingPermissions = append(missingPermissions, name)
+			}
+		}
+		for _, admin := range s.admins {
+			if !users.Has(admin) {
+				missingUsers = append(missingUsers, admin)
+			}
+		}
+		if len(missingPermissions) == 0 && len(missingUsers) == 0 {
+			return nil
+		}
+
+		role.Permissions = permissions.Add(missingPermissions...).Slice()
+		role.Users = users.Add(missingUsers...).Slice()
+		if err := s.store.UpdateRole(ctx, role); err != nil {
+			return fmt.Errorf("failed to update role \"%s\": %s", model.AdminRole, err)
+		}
+		s.publish(events.New(events.RoleUpdated, role.Name, bootstrapActor))
+	}
+
+	if err := s.store.AddRoleToPermissions(ctx, model.AdminRole, missingPermissions); err != nil {
+		return fmt.Errorf("failed to add role \"%s\" to permissions: %s", model.AdminRole, err)
+	}
+	if err := s.store.AddRoleToUsers(ctx, model.AdminRole, missingUsers); err != nil {
+		return fmt.Errorf("failed to add role \"%s\" to users: %s", model.AdminRole, err)
+	}
+	s.publishBindings(events.UserRoleAdded, missingUsers, model.AdminRole, bootstrapActor)
+	return nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/snapshot"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// checkBootstrapped fails the test unless every meta-permission and the
+// admin role exist, owned by the admin role, with dave bound to the role
+func checkBootstrapped(t *testing.T, svc *service) {
+	t.Helper()
+
+	ctx := context.Background()
+	owner := model.RoleOwnerPrefix + model.AdminRole
+	for name := range model.MetaPermissions {
+		perm, err := svc.readPermission(ctx, name)
+		if err != nil {
+			t.Fatalf("failed to read meta-permission %s: %s", name, err)
+		}
+		if len(perm.Owners) != 1 || perm.Owners[0] != owner {
+			t.Errorf("got owners %v of %s, want the admin role", perm.Owners, name)
+		}
+	}
+
+	role, err := svc.readRole(ctx, model.AdminRole)
+	if err != nil {
+		t.Fatalf("failed to read admin role: %s", err)
+	}
+	if len(role.Owners) != 1 || role.Owners[0] != owner {
+		t.Errorf("got owners %v of the admin role, want the admin role", role.Owners)
+	}
+	if !set.NewSet(role.Users...).Has("dave") {
+		t.Errorf("got users %v of the admin role, want the configured admin", role.Users)
+	}
+	if perms := set.NewSet(role.Permissions...); len(perms) != len(model.MetaPermissions) {
+		t.Errorf("got permissions %v of the admin role, want every meta-permission", role.Permissions)
+	}
+	for name := range model.MetaPermissions {
+		if allowed, err := svc.hasPermission(ctx, "dave", name); err != nil || !allowed {
+			t.Errorf("got %t, %v checking the admin for %s, want the admin granted it", allowed, err, name)
+		}
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	svc := newAdminTestService(t)
+	checkBootstrapped(t, svc)
+
+	// bootstrapping again changes nothing
+	revision := svc.changes.Revision()
+	if err := svc.bootstrap(context.Background()); err != nil {
+		t.Fatalf("failed to bootstrap again: %s", err)
+	}
+	if svc.changes.Revision() != revision {
+		t.Errorf("got revision %d after bootstrapping again, want %d", svc.changes.Revision(), revision)
+	}
+}
+
+func TestBootstrapAfterImport(t *testing.T) {
+	svc := newAdminTestService(t)
+
+	// a snapshot replacing all data, without the admin role
+	empty := &snapshot.Snapshot{Version: snapshot.Version}
+	if status, code := httpCode(t, svc, "dave", http.MethodPost, "/admin/import?mode=replace", empty); status != http.StatusOK {
+		t.Fatalf("got %d %s importing snapshot, want %d", status, code, http.StatusOK)
+	}
+	checkBootstrapped(t, svc)
+}
+
+func TestAdminsOverrideOwnership(t *testing.T) {
+	svc := newAdminTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.createRole(ctx, "alice", &payloads.CreateRoleRequest{Name: "alices"}, false); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+	if _, err := svc.createPermission(ctx, "alice", &payloads.CreatePermissionRequest{Name: "docs.read"}, false); err != nil {
+		t.Fatalf("failed to create permission: %s", err)
+	}
+
+	update := &payloads.GenericUpdateDescriptionRequest{Description: "updated"}
+	if _, err := svc.updateRole(ctx, "bob", "alices", update, false); !hasCode(err, payloads.CodeNotOwner) {
+		t.Errorf("got error %v updating someone else's role, want %s", err, payloads.CodeNotOwner)
+	}
+	if _, err := svc.updateRole(ctx, "dave", "alices", update, false); err != nil {
+		t.Errorf("failed to update role as an admin: %s", err)
+	}
+	if _, err := svc.addToPermission(ctx, "dave", "docs.read", &payloads.ModifyPermissionRequest{Owners: []string{"bob"}}, false); err != nil {
+		t.Errorf("failed to add owner to permission as an admin: %s", err)
+	}
+	if err := svc.deletePermission(ctx, "dave", "docs.read", false); err != nil {
+		t.Errorf("failed to delete permission as an admin: %s", err)
+	}
+	if err := svc.deleteRole(ctx, "dave", "alices", false); err != nil {
+		t.Errorf("failed to delete role as an admin: %s", err)
+	}
+}
+
+func TestReservedOwners(t *testing.T) {
+	svc := newAdminTestService(t)
+	ctx := context.Background()
+
+	owners := []string{model.RoleOwnerPrefix + model.AdminRole}
+	if _, err := svc.removeFromRole(ctx, "dave", model.AdminRole, &payloads.ModifyRoleRequest{Owners: owners}, false); !hasCode(err, payloads.CodeReservedName) {
+		t.Errorf("got error %v removing the owner of the admin role, want %s", err, payloads.CodeReservedName)
+	}
+	if _, err := svc.addToRole(ctx, "dave", model.AdminRole, &payloads.ModifyRoleRequest{Owners: []string{"alice"}}, false); !hasCode(err, payloads.CodeReservedName) {
+		t.Errorf("got error %v adding an owner to the admin role, want %s", err, payloads.CodeReservedName)
+	}
+	if _, err := svc.removeFromRole(ctx, "dave", model.AdminRole, &payloads.ModifyRoleRequest{Permissions: []string{model.PermissionRolesAdmin}}, false); !hasCode(err, payloads.CodeReservedName) {
+		t.Errorf("got error %v removing a meta-permission from the admin role, want %s", err, payloads.CodeReservedName)
+	}
+	if _, err := svc.removeFromPermission(ctx, "dave", model.PermissionRolesAdmin, &payloads.ModifyPermissionRequest{Owners: owners}, false); !hasCode(err, payloads.CodeReservedName) {
+		t.Errorf("got error %v removing the owner of a meta-permission, want %s", err, payloads.CodeReservedName)
+	}
+	if _, err := svc.addToPermission(ctx, "dave", model.PermissionRolesAdmin, &payloads.ModifyPermissionRequest{Owners: []string{"alice"}}, false); !hasCode(err, payloads.CodeReservedName) {
+		t.Errorf("got error %v adding an owner to a meta-permission, want %s", err, payloads.CodeReservedName)
+	}
+
+	// admins still bind users to the admin role
+	if _, err := svc.addToRole(ctx, "dave", model.AdminRole, &payloads.ModifyRoleRequest{Users: []string{"alice"}}, false); err != nil {
+		t.Errorf("failed to add user to the admin role: %s", err)
+	}
+	checkBootstrapped(t, svc)
+}
+
+func TestRestrictCreation(t *testing.T) {
+	svc, err := newService(Config{
+		Groups:           groups.NewMemorySource(map[string][]string{"alice": {"eng"}, "dave": {}}),
+		Admins:           []string{"dave"},
+		RestrictCreation: true,
+		Logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	ctx := context.Background()
+
+	if _, err := svc.createRole(ctx, "alice", &payloads.CreateRoleRequest{Name: "alices"}, false); !hasCode(err, payloads.CodeMissingPermission) {
+		t.Errorf("got error %v creating a role, want %s", err, payloads.CodeMissingPermission)
+	}
+	if _, err := svc.createPermission(ctx, "alice", &payloads.CreatePermissionRequest{Name: "docs.read"}, false); !hasCode(err, payloads.CodeMissingPermission) {
+		t.Errorf("got error %v creating a permission, want %s", err, payloads.CodeMissingPermission)
+	}
+	if _, err := svc.createServiceAccount(ctx, "alice", &payloads.CreateServiceAccountRequest{Name: "ci"}); !hasCode(err, payloads.CodeMissingPermission) {
+		t.Errorf("got error %v creating a service account, want %s", err, payloads.CodeMissingPermission)
+	}
+
+	// admins grant the meta-permissions to others
+	if _, err := svc.createRole(ctx, "dave", &payloads.CreateRoleRequest{Name: "creators", Users: []string{"alice"}, Permissions: []string{model.PermissionRolesCreate}}, false); err != nil {
+		t.Fatalf("failed to create role as an admin: %s", err)
+	}
+	if _, err := svc.createRole(ctx, "alice", &payloads.CreateRoleRequest{Name: "alices"}, false); err != nil {
+		t.Errorf("failed to create role with the meta-permission: %s", err)
+	}
+	if _, err := svc.createPermission(ctx, "alice", &payloads.CreatePermissionRequest{Name: "docs.read"}, false); !hasCode(err, payloads.CodeMissingPermission) {
+		t.Errorf("got error %v creating a permission with another meta-permission, want %s", err, payloads.CodeMissingPermission)
+	}
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"context"
+
+	"github.com/adrianosela/rbac/api/resolver"
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+// check returns whether a user has each of the given permissions,
+// in the same order, resolving the user's permissions only once
+func (s *service) check(ctx context.Context, user string, permissions []string) ([]bool, error) {
+	if user == "" {
+		return nil, newError(payloads.CodeInvalidRequest, "no user to check permissions for")
+	}
+
+	perms, err := resolver.UserPermissions(ctx, s.store, s.groups, user)
+	if err != nil {
+		return nil, internalError(err, "failed to resolve permissions for user")
+	}
+
+	allowed := make([]bool, len(permissions))
+	for i, permission := range permissions {
+		allowed[i] = perms.Has(permission)
+		s.metrics.ObserveCheck(allowed[i])
+	}
+	return allowed, nil
+}
@@ -1,21 +1,83 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
 )
 
+// readinessTimeout is how long each dependency has to respond to a readiness probe
+const readinessTimeout = time.Second * 5
+
 func (s *service) setDebugEndpoints() {
 	s.router.Methods(http.MethodGet).Path("/healthcheck").HandlerFunc(s.healthcheckHandler)
+	s.router.Methods(http.MethodGet).Path("/readyz").HandlerFunc(s.readyzHandler)
 	s.router.Methods(http.MethodGet).Path("/authcheck").Handler(s.auth(s.authcheckHandler))
 }
 
+// healthcheckHandler reports that the process is alive, regardless of its
+// dependencies, since restarting it wouldn't make them reachable
 func (s *service) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("I'm alive!"))
 	return
 }
 
+// readyzHandler checks that the dependencies of the service are reachable.
+// Unlike healthcheckHandler it fails while they aren't, so that traffic is
+// routed elsewhere without the service being restarted.
+func (s *service) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]func(context.Context) error{
+		"storage": s.store.Ping,
+		"groups":  s.groups.Ping,
+	}
+
+	resp := &payloads.ReadinessResponse{Ready: true, Dependencies: make(map[string]payloads.DependencyStatus)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) error) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(ctx)
+			status := payloads.DependencyStatus{Healthy: err == nil, Latency: time.Since(start).String()}
+			if err != nil {
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Dependencies[name] = status
+			resp.Ready = resp.Ready && status.Healthy
+		}(name, check)
+	}
+	wg.Wait()
+
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(respBytes)
+	return
+}
+
 func (s *service) authcheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(fmt.Sprintf("User \"%s\" is authenticated!", getAuthenticatedUser(r))))
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/storage"
+)
+
+// unreachableStorage is in-memory storage which fails to be pinged
+type unreachableStorage struct {
+	*storage.MemoryStorage
+}
+
+func (us *unreachableStorage) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestReadyz(t *testing.T) {
+	memory := groups.NewMemorySource(map[string][]string{"alice": {"eng"}})
+	failing := &failingSource{err: errors.New("okta is down")}
+
+	tests := []struct {
+		name      string
+		store     storage.Storage
+		src       groups.Source
+		status    int
+		unhealthy string
+	}{
+		{"healthy", storage.NewMemoryStorage(), memory, http.StatusOK, ""},
+		{"groups source down", storage.NewMemoryStorage(), failing, http.StatusServiceUnavailable, "groups"},
+		{"storage down", &unreachableStorage{storage.NewMemoryStorage()}, memory, http.StatusServiceUnavailable, "storage"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc, err := newService(Config{Storage: test.store, Groups: test.src, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+			if err != nil {
+				t.Fatalf("failed to create service: %s", err)
+			}
+
+			w := httptest.NewRecorder()
+			svc.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != test.status || w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("got %d %s, want %d application/json", w.Code, w.Header().Get("Content-Type"), test.status)
+			}
+			var resp payloads.ReadinessResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %s", err)
+			}
+			if resp.Ready != (test.unhealthy == "") || len(resp.Dependencies) != 2 {
+				t.Errorf("got %+v, want ready %t with storage and groups", resp, test.unhealthy == "")
+			}
+			for name, dep := range resp.Dependencies {
+				if dep.Healthy != (name != test.unhealthy) || dep.Latency == "" || (dep.Error == "") != dep.Healthy {
+					t.Errorf("got %s %+v, want only %q unhealthy, with an error", name, dep, test.unhealthy)
+				}
+			}
+
+			// liveness doesn't depend on the dependencies
+			w = httptest.NewRecorder()
+			svc.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthcheck", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("got %d from the healthcheck, want %d", w.Code, http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/resolver"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// isDryRun returns whether a request asks for its effects to be computed
+// without writing anything, through the "dry_run" query parameter
+func isDryRun(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, newError(payloads.CodeInvalidRequest, "dry_run value \"%s\" is not a boolean", v)
+	}
+	return dryRun, nil
+}
+
+// roleChangeImpact returns the users and groups whose effective permissions
+// change when a role goes from before to after, and the users whose groups
+// couldn't be looked up. A nil before means the role is created, and a nil
+// after means the role is deleted.
+func (s *service) roleChangeImpact(ctx context.Context, before, after *model.Role) ([]payloads.UserPermissionsChange, []payloads.GroupPermissionsChange, []string, error) {
+	name, beforePerms, afterPerms := "", set.NewSet(), set.NewSet()
+	beforeUsers, afterUsers := set.NewSet(), set.NewSet()
+	beforeGroups, afterGroups := set.NewSet(), set.NewSet()
+	if before != nil {
+		name = before.Name
+		beforePerms.Add(before.Permissions...)
+		beforeUsers.Add(before.Users...)
+		beforeGroups.Add(before.Groups...)
+	}
+	if after != nil {
+		name = after.Name
+		afterPerms.Add(after.Permissions...)
+		afterUsers.Add(after.Users...)
+		afterGroups.Add(after.Groups...)
+	}
+
+	userChanges, unresolved := []payloads.UserPermissionsChange{}, []string{}
+	for _, user := range sorted(beforeUsers.Copy().Join(afterUsers)) {
+		roles, err := resolver.ResolveRoles(ctx, s.store, s.groups, user)
+		if errors.Is(err, resolver.ErrGroupsLookup) {
+			// users can be bound to roles before the groups source knows them
+			unresolved = append(unresolved, user)
+			roles, err = resolver.ResolveRolesInGroups(ctx, s.store, user, nil)
+		}
+		if err != nil {
+			return nil, nil, nil, internalError(err, "failed to resolve roles for user \"%s\"", user)
+		}
+
+		rolesBefore := roles.Effective()
+		rolesAfter := rolesBefore.Copy().Remove(name)
+		if afterUsers.Has(user) {
+			rolesAfter.Add(name)
+		}
+		for _, group := range roles.Groups {
+			if afterGroups.Has(group) {
+				rolesAfter.Add(name)
+			}
+		}
+
+		permsBefore, err := resolver.RolePermissions(ctx, s.store, rolesBefore, map[string]*model.Role{name: before})
+		if err != nil {
+			return nil, nil, nil, internalError(err, "failed to resolve permissions for user \"%s\"", user)
+		}
+		permsAfter, err := resolver.RolePermissions(ctx, s.store, rolesAfter, map[string]*model.Role{name: after})
+		if err != nil {
+			return nil, nil, nil, internalError(err, "failed to resolve permissions for user \"%s\"", user)
+		}
+
+		added, removed := permsAfter.Copy().Remove(permsBefore.Slice()...), permsBefore.Copy().Remove(permsAfter.Slice()...)
+		if len(added)+len(removed) > 0 {
+			userChanges = append(userChanges, payloads.UserPermissionsChange{User: user, Added: sorted(added), Removed: sorted(removed)})
+		}
+	}
+
+	groupChanges := []payloads.GroupPermissionsChange{}
+	for _, group := range sorted(beforeGroups.Copy().Join(afterGroups)) {
+		had, has := set.NewSet(), set.NewSet()
+		if beforeGroups.Has(group) {
+			had = beforePerms
+		}
+		if afterGroups.Has(group) {
+			has = afterPerms
+		}
+		added, removed := has.Copy().Remove(had.Slice()...), had.Copy().Remove(has.Slice()...)
+		if len(added)+len(removed) > 0 {
+			groupChanges = append(groupChanges, payloads.GroupPermissionsChange{Group: group, Added: sorted(added), Removed: sorted(removed)})
+		}
+	}
+
+	return userChanges, groupChanges, unresolved, nil
+}
+
+// writeRoleDryRun writes the response for a dry run of a mutation
+// of the named role, given the role that would have resulted from it
+func (s *service) writeRoleDryRun(w http.ResponseWriter, r *http.Request, name string, after *model.Role) {
+	ctx := r.Context()
+	before, err := s.store.ReadRole(ctx, name)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to read role from storage"))
+		return
+	}
+
+	users, groups, unresolved, err := s.roleChangeImpact(ctx, before, after)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeDryRun(w, r, &payloads.DryRunResponse{
+		DryRun:          true,
+		Role:            after,
+		Deleted:         before != nil && after == nil,
+		AffectedUsers:   users,
+		AffectedGroups:  groups,
+		UnresolvedUsers: unresolved,
+	})
+}
+
+// writePermissionDryRun writes the response for a dry run of a mutation of
+// the named permission, given the permission that would have resulted from it.
+// Permission mutations never change effective permissions, since permissions
+// in use by roles can't be deleted.
+func (s *service) writePermissionDryRun(w http.ResponseWriter, r *http.Request, name string, after *model.Permission) {
+	before, err := s.store.ReadPermission(r.Context(), name)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to read permission from storage"))
+		return
+	}
+
+	writeDryRun(w, r, &payloads.DryRunResponse{
+		DryRun:         true,
+		Permission:     after,
+		Deleted:        before != nil && after == nil,
+		AffectedUsers:  []payloads.UserPermissionsChange{},
+		AffectedGroups: []payloads.GroupPermissionsChange{},
+	})
+}
+
+func writeDryRun(w http.ResponseWriter, r *http.Request, resp *payloads.DryRunResponse) {
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+}
+
+// sorted returns the elements of a set in a stable order
+func sorted(s set.Set) []string {
+	slice := s.Slice()
+	sort.Strings(slice)
+	return slice
+}
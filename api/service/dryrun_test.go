@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+func TestRoleDryRunWithUnknownUser(t *testing.T) {
+	svc := newTestService(t)
+	if _, err := svc.createPermission(context.Background(), "alice", &payloads.CreatePermissionRequest{Name: "docs.read"}, false); err != nil {
+		t.Fatalf("failed to create permission: %s", err)
+	}
+
+	// zed is not in the groups source
+	body := `{"name":"readers","permissions":["docs.read"],"users":["bob","zed"]}`
+	req := httptest.NewRequest(http.MethodPost, "/role?dry_run=true", strings.NewReader(body))
+	req.Header.Set("MOCK_AUTHENTICATED_USER", "alice")
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+
+	var resp payloads.DryRunResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	if len(resp.AffectedUsers) != 2 || resp.AffectedUsers[1].User != "zed" || len(resp.AffectedUsers[1].Added) != 1 {
+		t.Errorf("got affected users %+v, want bob and zed gaining the permission", resp.AffectedUsers)
+	}
+	if len(resp.UnresolvedUsers) != 1 || resp.UnresolvedUsers[0] != "zed" {
+		t.Errorf("got unresolved users %v, want zed", resp.UnresolvedUsers)
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/adrianosela/rbac/api/manifest"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/validation"
+)
+
+// codeStatus is the HTTP status code each error code is reported with
+var codeStatus = map[string]int{
+	payloads.CodeInvalidRequest:         http.StatusBadRequest,
+	payloads.CodeValidationFailed:       http.StatusBadRequest,
+	payloads.CodeInvalidSnapshot:        http.StatusBadRequest,
+	payloads.CodeCannotRemoveSelf:       http.StatusBadRequest,
+	payloads.CodeUnknownPermission:      http.StatusBadRequest,
+	payloads.CodeUnauthenticated:        http.StatusUnauthorized,
+	payloads.CodeNotOwner:               http.StatusForbidden,
+	payloads.CodeNotAdmin:               http.StatusForbidden,
+	payloads.CodeMissingPermission:      http.StatusForbidden,
+	payloads.CodeReservedName:           http.StatusForbidden,
+	payloads.CodeNotFound:               http.StatusNotFound,
+	payloads.CodeRoleNotFound:           http.StatusNotFound,
+	payloads.CodePermissionNotFound:     http.StatusNotFound,
+	payloads.CodeWebhookNotFound:        http.StatusNotFound,
+	payloads.CodeServiceAccountNotFound: http.StatusNotFound,
+	payloads.CodeAPIKeyNotFound:         http.StatusNotFound,
+	payloads.CodeNamespaceNotFound:      http.StatusNotFound,
+	payloads.CodeMethodNotAllowed:       http.StatusMethodNotAllowed,
+	payloads.CodeRoleExists:             http.StatusConflict,
+	payloads.CodePermissionExists:       http.StatusConflict,
+	payloads.CodeServiceAccountExists:   http.StatusConflict,
+	payloads.CodeNamespaceExists:        http.StatusConflict,
+	payloads.CodePermissionInUse:        http.StatusConflict,
+	payloads.CodeNamespaceConflict:      http.StatusConflict,
+	payloads.CodeServiceAccountInUse:    http.StatusConflict,
+	payloads.CodeRevisionCompacted:      http.StatusGone,
+	payloads.CodeInternal:               http.StatusInternalServerError,
+}
+
+// apiError is an error which is reported to clients with a stable code.
+// Its cause, if any, is logged but never returned to clients.
+type apiError struct {
+	code   string
+	msg    string
+	fields []validation.FieldError
+	cause  error
+
+	applied []manifest.Change // see payloads.ErrorResponse
+}
+
+// newError returns an error with the given code and client-facing message
+func newError(code, format string, args ...interface{}) *apiError {
+	return &apiError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// internalError returns an error for an unexpected failure. Only the
+// message is returned to clients, so it must not include the cause.
+func internalError(cause error, format string, args ...interface{}) *apiError {
+	return &apiError{code: payloads.CodeInternal, msg: fmt.Sprintf(format, args...), cause: cause}
+}
+
+// invalidPayload returns an error for a request payload which failed validation
+func invalidPayload(err error) *apiError {
+	ae := newError(payloads.CodeValidationFailed, "request payload is invalid: %s", err)
+	var fields validation.Errors
+	if errors.As(err, &fields) {
+		ae.fields = fields
+	}
+	return ae
+}
+
+// withCause sets the internal cause of an error
+func (e *apiError) withCause(cause error) *apiError {
+	e.cause = cause
+	return e
+}
+
+// Error returns the string representation of the error
+func (e *apiError) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %s: %s", e.code, e.msg, e.cause)
+	}
+	return fmt.Sprintf("%s: %s", e.code, e.msg)
+}
+
+// status returns the HTTP status code of the error
+func (e *apiError) status() int {
+	if status, ok := codeStatus[e.code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// reportError returns an error as an *apiError, treating other errors as
+// internal errors, and attaches it to the request's log entry if it has
+// a cause or is an internal error
+func reportError(ctx context.Context, err error) *apiError {
+	ae, ok := err.(*apiError)
+	if !ok {
+		ae = internalError(err, "internal error")
+	}
+	if ae.cause != nil || ae.code == payloads.CodeInternal {
+		logFields(ctx, slog.String("error", ae.Error()))
+	}
+	return ae
+}
+
+// writeError writes the JSON response for an error, which
+// includes the request ID for correlation with the logs
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	ae := reportError(r.Context(), err)
+
+	respBytes, _ := json.Marshal(&payloads.ErrorResponse{Code: ae.code, Message: ae.msg, Fields: ae.fields, Applied: ae.applied, RequestID: requestID(r.Context())})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(ae.status())
+	w.Write(respBytes)
+}
+
+// notFoundHandler reports requests for unknown routes
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, newError(payloads.CodeNotFound, "no such endpoint %s %s", r.Method, r.URL.Path))
+}
+
+// methodNotAllowedHandler reports requests with the wrong method for a route
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, newError(payloads.CodeMethodNotAllowed, "method %s is not allowed for %s", r.Method, r.URL.Path))
+}
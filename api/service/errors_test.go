@@ -0,0 +1,113 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/validation"
+)
+
+func TestCodesAreMapped(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "payloads/errors.go", nil, 0)
+	if err != nil {
+		t.Fatalf("failed to parse error codes: %s", err)
+	}
+
+	n := 0
+	ast.Inspect(f, func(node ast.Node) bool {
+		spec, ok := node.(*ast.ValueSpec)
+		if !ok || !strings.HasPrefix(spec.Names[0].Name, "Code") {
+			return true
+		}
+		lit := spec.Values[0].(*ast.BasicLit)
+		code := strings.Trim(lit.Value, `"`)
+		if _, ok := codeStatus[code]; !ok {
+			t.Errorf("got no HTTP status for %s", code)
+		}
+		if _, ok := codeGRPC[code]; !ok {
+			t.Errorf("got no gRPC code for %s", code)
+		}
+		n++
+		return true
+	})
+	if n == 0 {
+		t.Fatal("got no error codes")
+	}
+	if n != len(codeStatus) || n != len(codeGRPC) {
+		t.Errorf("got %d codes, %d HTTP statuses, and %d gRPC codes, want one of each per code", n, len(codeStatus), len(codeGRPC))
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	var fields validation.Errors
+	fields.Add("name", "is required")
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		msg    string
+	}{
+		{"api error", newError(payloads.CodeRoleNotFound, "Role \"readers\" does not exist!"), http.StatusNotFound, payloads.CodeRoleNotFound, "Role \"readers\" does not exist!"},
+		{"internal error", internalError(errors.New("dial tcp 10.0.0.1: refused"), "failed to read role from storage"), http.StatusInternalServerError, payloads.CodeInternal, "failed to read role from storage"},
+		{"cause of a client error", newError(payloads.CodeInvalidRequest, "bad request").withCause(errors.New("secret detail")), http.StatusBadRequest, payloads.CodeInvalidRequest, "bad request"},
+		{"other error", errors.New("secret detail"), http.StatusInternalServerError, payloads.CodeInternal, "internal error"},
+		{"unmapped code", newError("SOMETHING_NEW", "something new"), http.StatusInternalServerError, "SOMETHING_NEW", "something new"},
+		{"invalid payload", invalidPayload(fields.Err()), http.StatusBadRequest, payloads.CodeValidationFailed, "request payload is invalid: name: is required"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeError(w, httptest.NewRequest(http.MethodGet, "/", nil), test.err)
+
+			if w.Code != test.status || w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("got %d %s, want %d application/json", w.Code, w.Header().Get("Content-Type"), test.status)
+			}
+			var e payloads.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+				t.Fatalf("failed to decode error %s: %s", w.Body, err)
+			}
+			if e.Code != test.code || e.Message != test.msg {
+				t.Errorf("got %s: %s, want %s: %s", e.Code, e.Message, test.code, test.msg)
+			}
+			// causes are logged, never returned
+			if strings.Contains(w.Body.String(), "10.0.0.1") || strings.Contains(w.Body.String(), "secret") {
+				t.Errorf("got the cause of the error in response %s", w.Body)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	writeError(w, httptest.NewRequest(http.MethodGet, "/", nil), invalidPayload(fields.Err()))
+	var e payloads.ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &e)
+	if len(e.Fields) != 1 || e.Fields[0].Field != "name" {
+		t.Errorf("got fields %+v, want the field errors of the payload", e.Fields)
+	}
+}
+
+func TestRouteErrors(t *testing.T) {
+	svc := newTestService(t)
+
+	if status, code := httpCode(t, svc, "alice", http.MethodGet, "/nope", nil); status != http.StatusNotFound || code != payloads.CodeNotFound {
+		t.Errorf("got %d %s for an unknown route, want %d %s", status, code, http.StatusNotFound, payloads.CodeNotFound)
+	}
+	if status, code := httpCode(t, svc, "alice", http.MethodPatch, "/roles", nil); status != http.StatusMethodNotAllowed || code != payloads.CodeMethodNotAllowed {
+		t.Errorf("got %d %s for the wrong method, want %d %s", status, code, http.StatusMethodNotAllowed, payloads.CodeMethodNotAllowed)
+	}
+	if status, code := httpCode(t, svc, "", http.MethodPost, "/role", &payloads.CreateRoleRequest{Name: "readers"}); status != http.StatusUnauthorized || code != payloads.CodeUnauthenticated {
+		t.Errorf("got %d %s without a user, want %d %s", status, code, http.StatusUnauthorized, payloads.CodeUnauthenticated)
+	}
+	if status, code := httpCode(t, svc, "alice", http.MethodGet, "/role/readers", nil); status != http.StatusNotFound || code != payloads.CodeRoleNotFound {
+		t.Errorf("got %d %s for a missing role, want %d %s", status, code, http.StatusNotFound, payloads.CodeRoleNotFound)
+	}
+}
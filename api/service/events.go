@@ -0,0 +1,19 @@
+package service
+
+import (
+	"github.com/adrianosela/rbac/api/events"
+)
+
+// publish records an event in the change log and notifies all event
+// consumers of it. It must only be called after a successful write.
+func (s *service) publish(e events.Event) {
+	e = s.changes.Append(e)
+	s.webhooks.Publish(e)
+}
+
+// publishBindings publishes a binding event for each of the given users or groups
+func (s *service) publishBindings(typ string, names []string, role, actor string) {
+	for _, name := range names {
+		s.publish(events.NewBinding(typ, name, role, actor))
+	}
+}
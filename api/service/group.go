@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/utils/set"
+	"github.com/gorilla/mux"
+)
+
+func (s *service) setGroupEndpoints() {
+	s.router.Methods(http.MethodGet).Path("/group/{id}").HandlerFunc(s.readGroupHandler)
+	s.router.Methods(http.MethodGet).Path("/group/{id}/members-roles").HandlerFunc(s.readGroupMembersRolesHandler)
+}
+
+// readGroup returns the stored group, or a group with no roles if the group
+// has never been bound to a role. Group membership is managed externally, so
+// a group not being in storage does not mean it does not exist.
+func (s *service) readGroup(ctx context.Context, id string) (*model.Group, error) {
+	gs, err := s.store.ReadGroups(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(gs) == 0 {
+		return &model.Group{ID: id, Roles: []string{}}, nil
+	}
+	gs[0].Roles = sorted(set.NewSet(gs[0].Roles...))
+	return gs[0], nil
+}
+
+func (s *service) readGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no group id in request URL"))
+		return
+	}
+
+	group, err := s.readGroup(r.Context(), id)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to read group from storage"))
+		return
+	}
+
+	groupBytes, err := json.Marshal(&group)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(groupBytes)
+	return
+}
+
+func (s *service) readGroupMembersRolesHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no group id in request URL"))
+		return
+	}
+
+	group, err := s.readGroup(r.Context(), id)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to read group from storage"))
+		return
+	}
+
+	roles, err := s.store.BulkReadRoles(r.Context(), group.Roles)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to read group roles from storage"))
+		return
+	}
+
+	resp := &payloads.GetGroupMembersRolesResponse{Group: id, Roles: []*payloads.GroupRole{}}
+	perms := set.NewSet()
+	for _, role := range roles {
+		resp.Roles = append(resp.Roles, &payloads.GroupRole{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: sorted(set.NewSet(role.Permissions...)),
+		})
+		perms.Add(role.Permissions...)
+	}
+	resp.Permissions = sorted(perms)
+
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return
+}
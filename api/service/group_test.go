@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+func TestReadGroup(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	for _, perm := range []string{"docs.read", "docs.write"} {
+		if _, err := svc.createPermission(ctx, "alice", &payloads.CreatePermissionRequest{Name: perm}, false); err != nil {
+			t.Fatalf("failed to create permission %s: %s", perm, err)
+		}
+	}
+	for _, role := range []payloads.CreateRoleRequest{
+		{Name: "writers", Description: "write docs", Groups: []string{"eng"}, Permissions: []string{"docs.write", "docs.read"}},
+		{Name: "readers", Groups: []string{"eng"}, Permissions: []string{"docs.read"}},
+		{Name: "oncall", Users: []string{"alice"}},
+	} {
+		if _, err := svc.createRole(ctx, "alice", &role, false); err != nil {
+			t.Fatalf("failed to create role %s: %s", role.Name, err)
+		}
+	}
+
+	var group model.Group
+	list(t, svc, "/group/eng", &group)
+	if group.ID != "eng" || strings.Join(group.Roles, ",") != "readers,writers" {
+		t.Errorf("got group %+v, want eng with readers,writers", group)
+	}
+
+	var resp payloads.GetGroupMembersRolesResponse
+	list(t, svc, "/group/eng/members-roles", &resp)
+	if resp.Group != "eng" || len(resp.Roles) != 2 {
+		t.Fatalf("got group %s with roles %+v, want eng with 2 roles", resp.Group, resp.Roles)
+	}
+	if w := resp.Roles[1]; w.Name != "writers" || w.Description != "write docs" || strings.Join(w.Permissions, ",") != "docs.read,docs.write" {
+		t.Errorf("got role %+v, want writers with its description and sorted permissions", w)
+	}
+	if got := strings.Join(resp.Permissions, ","); got != "docs.read,docs.write" {
+		t.Errorf("got permissions %q, want each permission once", got)
+	}
+
+	// groups never bound to a role exist with no roles
+	var unbound payloads.GetGroupMembersRolesResponse
+	list(t, svc, "/group/sales/members-roles", &unbound)
+	if unbound.Roles == nil || len(unbound.Roles) != 0 || len(unbound.Permissions) != 0 {
+		t.Errorf("got roles %v and permissions %v for an unbound group, want none", unbound.Roles, unbound.Permissions)
+	}
+	var empty model.Group
+	list(t, svc, "/group/sales", &empty)
+	if empty.ID != "sales" || empty.Roles == nil || len(empty.Roles) != 0 {
+		t.Errorf("got group %+v, want sales with an empty list of roles", empty)
+	}
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/rbacpb"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// authenticatedUserMetadataKey is the gRPC equivalent of the MOCK_AUTHENTICATED_USER header
+const authenticatedUserMetadataKey = "mock_authenticated_user"
+
+// codeGRPC is the gRPC status code each error code is reported with
+var codeGRPC = map[string]codes.Code{
+	payloads.CodeInvalidRequest:         codes.InvalidArgument,
+	payloads.CodeValidationFailed:       codes.InvalidArgument,
+	payloads.CodeInvalidSnapshot:        codes.InvalidArgument,
+	payloads.CodeCannotRemoveSelf:       codes.FailedPrecondition,
+	payloads.CodeUnknownPermission:      codes.InvalidArgument,
+	payloads.CodeUnauthenticated:        codes.Unauthenticated,
+	payloads.CodeNotOwner:               codes.PermissionDenied,
+	payloads.CodeNotAdmin:               codes.PermissionDenied,
+	payloads.CodeMissingPermission:      codes.PermissionDenied,
+	payloads.CodeReservedName:           codes.PermissionDenied,
+	payloads.CodeNotFound:               codes.NotFound,
+	payloads.CodeRoleNotFound:           codes.NotFound,
+	payloads.CodePermissionNotFound:     codes.NotFound,
+	payloads.CodeWebhookNotFound:        codes.NotFound,
+	payloads.CodeServiceAccountNotFound: codes.NotFound,
+	payloads.CodeAPIKeyNotFound:         codes.NotFound,
+	payloads.CodeNamespaceNotFound:      codes.NotFound,
+	payloads.CodeMethodNotAllowed:       codes.Unimplemented,
+	payloads.CodeRoleExists:             codes.AlreadyExists,
+	payloads.CodePermissionExists:       codes.AlreadyExists,
+	payloads.CodeServiceAccountExists:   codes.AlreadyExists,
+	payloads.CodeNamespaceExists:        codes.AlreadyExists,
+	payloads.CodePermissionInUse:        codes.FailedPrecondition,
+	payloads.CodeNamespaceConflict:      codes.FailedPrecondition,
+	payloads.CodeServiceAccountInUse:    codes.FailedPrecondition,
+	payloads.CodeRevisionCompacted:      codes.OutOfRange,
+	payloads.CodeInternal:               codes.Internal,
+}
+
+// grpcServer implements the gRPC API on top of the same
+// operations as the HTTP handlers of the service
+type grpcServer struct {
+	rbacpb.UnimplementedRBACServer
+	svc *service
+}
+
+// newGRPCServer returns a gRPC server for the service
+func (s *service) newGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(s.traceGRPC, s.logGRPC))
+	server := grpc.NewServer(opts...)
+	rbacpb.RegisterRBACServer(server, &grpcServer{svc: s})
+	return server
+}
+
+// grpcError returns the gRPC status error for an error. The message
+// starts with the error code, and field errors are attached as details.
+func grpcError(ctx context.Context, err error) error {
+	ae := reportError(ctx, err)
+
+	code, ok := codeGRPC[ae.code]
+	if !ok {
+		code = codes.Internal
+	}
+	st := status.Newf(code, "%s: %s", ae.code, ae.msg)
+	if len(ae.fields) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, fe := range ae.fields {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: fe.Field, Description: fe.Message})
+		}
+		if withDetails, err := st.WithDetails(br); err == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+// authenticatedUser returns the authenticated user of a call, from the
+// verified client certificate of the connection, an API key in the
+// "authorization" metadata, or else the user in the metadata
+func (g *grpcServer) authenticatedUser(ctx context.Context) (string, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			if user := clientCertificateIdentity(&info.State); user != "" {
+				if err := checkAssertedIdentity(user); err != nil {
+					return "", err
+				}
+				logFields(ctx, slog.String("user", user), slog.String("auth_method", authMethodClientCert))
+				return user, nil
+			}
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if auth := md.Get("authorization"); len(auth) > 0 {
+		if key := bearerToken(auth[0]); isAPIKey(key) {
+			user, err := g.svc.authenticateAPIKey(ctx, key)
+			if err != nil {
+				return "", err
+			}
+			logFields(ctx, slog.String("user", user), slog.String("auth_method", authMethodAPIKey))
+			return user, nil
+		}
+	}
+	if users := md.Get(authenticatedUserMetadataKey); len(users) > 0 && users[0] != "" {
+		if err := checkAssertedIdentity(users[0]); err != nil {
+			return "", err
+		}
+		logFields(ctx, slog.String("user", users[0]), slog.String("auth_method", authMethodHeader))
+		return users[0], nil
+	}
+	return "", newError(payloads.CodeUnauthenticated, "No user in \"%s\" metadata", authenticatedUserMetadataKey)
+}
+
+// Check returns whether a user has a permission
+func (g *grpcServer) Check(ctx context.Context, req *rbacpb.CheckRequest) (*rbacpb.CheckResponse, error) {
+	allowed, err := g.svc.check(ctx, req.User, []string{req.Permission})
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &rbacpb.CheckResponse{Allowed: allowed[0]}, nil
+}
+
+// BatchCheck runs many checks at once, resolving every user only once
+func (g *grpcServer) BatchCheck(ctx context.Context, req *rbacpb.BatchCheckRequest) (*rbacpb.BatchCheckResponse, error) {
+	// group checks by user, keeping track of their position in the request
+	users := []string{}
+	perms := make(map[string][]string)
+	indices := make(map[string][]int)
+	for i, c := range req.Checks {
+		if _, ok := perms[c.User]; !ok {
+			users = append(users, c.User)
+		}
+		perms[c.User] = append(perms[c.User], c.Permission)
+		indices[c.User] = append(indices[c.User], i)
+	}
+
+	results := make([]*rbacpb.CheckResponse, len(req.Checks))
+	for _, user := range users {
+		allowed, err := g.svc.check(ctx, user, perms[user])
+		if err != nil {
+			return nil, grpcError(ctx, err)
+		}
+		for j, i := range indices[user] {
+			results[i] = &rbacpb.CheckResponse{Allowed: allowed[j]}
+		}
+	}
+	return &rbacpb.BatchCheckResponse{Results: results}, nil
+}
+
+// GetRole returns a role
+func (g *grpcServer) GetRole(ctx context.Context, req *rbacpb.GetRoleRequest) (*rbacpb.Role, error) {
+	role, err := g.svc.readRole(ctx, req.Name)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return roleToProto(role), nil
+}
+
+// CreateRole creates a role owned by the caller
+func (g *grpcServer) CreateRole(ctx context.Context, req *rbacpb.CreateRoleRequest) (*rbacpb.Role, error) {
+	actor, err := g.authenticatedUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	role, err := g.svc.createRole(ctx, actor, &payloads.CreateRoleRequest{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+		Users:       req.Users,
+		Groups:      req.Groups,
+		Owners:      req.Owners,
+	}, req.DryRun)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return roleToProto(role), nil
+}
+
+// UpdateRole modifies the description of a role
+func (g *grpcServer) UpdateRole(ctx context.Context, req *rbacpb.UpdateRoleRequest) (*rbacpb.Role, error) {
+	actor, err := g.authenticatedUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	role, err := g.svc.updateRole(ctx, actor, req.Name, &payloads.GenericUpdateDescriptionRequest{Description: req.Description}, req.DryRun)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return roleToProto(role), nil
+}
+
+// AddToRole adds permissions, users, groups, or owners to a role
+func (g *grpcServer) AddToRole(ctx context.Context, req *rbacpb.ModifyRoleRequest) (*rbacpb.Role, error) {
+	actor, err := g.authenticatedUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	role, err := g.svc.addToRole(ctx, actor, req.Name, modifyRolePayload(req), req.DryRun)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return roleToProto(role), nil
+}
+
+// RemoveFromRole removes permissions, users, groups, or owners from a role
+func (g *grpcServer) RemoveFromRole(ctx context.Context, req *rbacpb.ModifyRoleRequest) (*rbacpb.Role, error) {
+	actor, err := g.authenticatedUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	role, err := g.svc.removeFromRole(ctx, actor, req.Name, modifyRolePayload(req), req.DryRun)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return roleToProto(role), nil
+}
+
+// DeleteRole deletes a role and all its bindings
+func (g *grpcServer) DeleteRole(ctx context.Context, req *rbacpb.DeleteRoleRequest) (*rbacpb.DeleteRoleResponse, error) {
+	actor, err := g.authenticatedUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	if err := g.svc.deleteRole(ctx, actor, req.Name, req.DryRun); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &rbacpb.DeleteRoleResponse{}, nil
+}
+
+// GetPermission returns a permission
+func (g *grpcServer) GetPermission(ctx context.Context, req *rbacpb.GetPermissionRequest) (*rbacpb.Permission, error) {
+	perm, err := g.svc.readPermission(ctx, req.Name)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return permissionToProto(perm), nil
+}
+
+// CreatePermission creates a permission owned by the caller
+func (g *grpcServer) CreatePermission(ctx context.Context, req *rbacpb.CreatePermissionRequest) (*rbacpb.Permission, error) {
+	actor, err := g.authenticatedUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	perm, err := g.svc.createPermission(ctx, actor, &payloads.CreatePermissionRequest{
+		Name:        req.Name,
+		Description: req.Description,
+		Owners:      req.Owners,
+	}, req.DryRun)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return permissionToProto(perm), nil
+}
+
+// UpdatePermission modifies the description of a permission
+func (g *grpcServer) UpdatePermission(ctx context.Context, req *rbacpb.UpdatePermissionRequest) (*rbacpb.Permission, error) {
+	actor, err := g.authenticatedUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	perm, err := g.svc.updatePermission(ctx, actor, req.Name, &payloads.GenericUpdateDescriptionRequest{Description: req.Description}, req.DryRun)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return permissionToProto(perm), nil
+}
+
+// AddToPermission adds owners to a permission
+func (g *grpcServer) AddToPermission(ctx context.Context, req *rbacpb.ModifyPermissionRequest) (*rbacpb.Permission, error) {
+	actor, err := g.authenticatedUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	perm, err := g.svc.addToPermission(ctx, actor, req.Name, &payloads.ModifyPermissionRequest{Owners: req.Owners}, req.DryRun)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return permissionToProto(perm), nil
+}
+
+// RemoveFromPermission removes owners from a permission
+func (g *grpcServer) RemoveFromPermission(ctx context.Context, req *rbacpb.ModifyPermissionRequest) (*rbacpb.Permission, error) {
+	actor, err := g.authenticatedUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	perm, err := g.svc.removeFromPermission(ctx, actor, req.Name, &payloads.ModifyPermissionRequest{Owners: req.Owners}, req.DryRun)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return permissionToProto(perm), nil
+}
+
+// DeletePermission deletes a permission which is not in use
+func (g *grpcServer) DeletePermission(ctx context.Context, req *rbacpb.DeletePermissionRequest) (*rbacpb.DeletePermissionResponse, error) {
+	actor, err := g.authenticatedUser(ctx)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	if err := g.svc.deletePermission(ctx, actor, req.Name, req.DryRun); err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return &rbacpb.DeletePermissionResponse{}, nil
+}
+
+func modifyRolePayload(req *rbacpb.ModifyRoleRequest) *payloads.ModifyRoleRequest {
+	return &payloads.ModifyRoleRequest{
+		Permissions: req.Permissions,
+		Users:       req.Users,
+		Groups:      req.Groups,
+		Owners:      req.Owners,
+	}
+}
+
+func roleToProto(role *model.Role) *rbacpb.Role {
+	return &rbacpb.Role{
+		Name:        role.Name,
+		Description: role.Description,
+		Owners:      role.Owners,
+		Users:       role.Users,
+		Groups:      role.Groups,
+		Permissions: role.Permissions,
+	}
+}
+
+func permissionToProto(perm *model.Permission) *rbacpb.Permission {
+	return &rbacpb.Permission{
+		Name:        perm.Name,
+		Description: perm.Description,
+		Owners:      perm.Owners,
+		Roles:       perm.Roles,
+	}
+}
@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/rbacpb"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestGRPC serves the gRPC API of svc over an in-memory connection
+func newTestGRPC(t *testing.T, svc *service) rbacpb.RBACClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	server := svc.newGRPCServer()
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return rbacpb.NewRBACClient(conn)
+}
+
+func newTestService(t *testing.T) *service {
+	t.Helper()
+
+	svc, err := newService(Config{
+		Groups: groups.NewMemorySource(map[string][]string{"alice": {"eng"}, "bob": {"eng"}, "carol": {}}),
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	return svc
+}
+
+// as returns a context for calls made by user
+func as(user string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), authenticatedUserMetadataKey, user)
+}
+
+// grpcCode returns the status code and error code of a gRPC error
+func grpcCode(err error) (codes.Code, string) {
+	st := status.Convert(err)
+	code, _, _ := strings.Cut(st.Message(), ":")
+	return st.Code(), code
+}
+
+// httpCode makes a request as user to the HTTP API of svc, and returns
+// the status and error code of the response
+func httpCode(t *testing.T, svc *service, user, method, path string, body any) (int, string) {
+	t.Helper()
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("failed to encode body: %s", err)
+		}
+		r = strings.NewReader(string(b))
+	}
+	req := httptest.NewRequest(method, path, r)
+	if user != "" {
+		req.Header.Set("MOCK_AUTHENTICATED_USER", user)
+	}
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, req)
+
+	var e payloads.ErrorResponse
+	json.NewDecoder(w.Body).Decode(&e)
+	return w.Code, e.Code
+}
+
+func TestGRPCRolesAndPermissions(t *testing.T) {
+	c := newTestGRPC(t, newTestService(t))
+	alice := as("alice")
+
+	perm, err := c.CreatePermission(alice, &rbacpb.CreatePermissionRequest{Name: "docs.read", Description: "read docs"})
+	if err != nil {
+		t.Fatalf("CreatePermission: %s", err)
+	}
+	if len(perm.Owners) != 1 || perm.Owners[0] != "alice" {
+		t.Errorf("got owners %v, want the caller", perm.Owners)
+	}
+	if _, err := c.UpdatePermission(alice, &rbacpb.UpdatePermissionRequest{Name: "docs.read", Description: "read all docs"}); err != nil {
+		t.Fatalf("UpdatePermission: %s", err)
+	}
+	if _, err := c.AddToPermission(alice, &rbacpb.ModifyPermissionRequest{Name: "docs.read", Owners: []string{"bob"}}); err != nil {
+		t.Fatalf("AddToPermission: %s", err)
+	}
+	if _, err := c.RemoveFromPermission(alice, &rbacpb.ModifyPermissionRequest{Name: "docs.read", Owners: []string{"bob"}}); err != nil {
+		t.Fatalf("RemoveFromPermission: %s", err)
+	}
+	perm, err = c.GetPermission(context.Background(), &rbacpb.GetPermissionRequest{Name: "docs.read"})
+	if err != nil {
+		t.Fatalf("GetPermission: %s", err)
+	}
+	if perm.Description != "read all docs" || len(perm.Owners) != 1 {
+		t.Errorf("got permission %v", perm)
+	}
+
+	if _, err := c.CreateRole(alice, &rbacpb.CreateRoleRequest{Name: "readers", Permissions: []string{"docs.read"}}); err != nil {
+		t.Fatalf("CreateRole: %s", err)
+	}
+	if _, err := c.UpdateRole(alice, &rbacpb.UpdateRoleRequest{Name: "readers", Description: "doc readers"}); err != nil {
+		t.Fatalf("UpdateRole: %s", err)
+	}
+	if _, err := c.AddToRole(alice, &rbacpb.ModifyRoleRequest{Name: "readers", Users: []string{"carol"}}); err != nil {
+		t.Fatalf("AddToRole: %s", err)
+	}
+	role, err := c.GetRole(context.Background(), &rbacpb.GetRoleRequest{Name: "readers"})
+	if err != nil {
+		t.Fatalf("GetRole: %s", err)
+	}
+	if role.Description != "doc readers" || len(role.Users) != 1 || len(role.Permissions) != 1 {
+		t.Errorf("got role %v", role)
+	}
+	perm, _ = c.GetPermission(context.Background(), &rbacpb.GetPermissionRequest{Name: "docs.read"})
+	if len(perm.Roles) != 1 || perm.Roles[0] != "readers" {
+		t.Errorf("got roles %v for the permission, want the role granting it", perm.Roles)
+	}
+
+	if _, err := c.DeletePermission(alice, &rbacpb.DeletePermissionRequest{Name: "docs.read"}); err == nil {
+		t.Error("deleted a permission granted by a role")
+	} else if code, ec := grpcCode(err); code != codes.FailedPrecondition || ec != payloads.CodePermissionInUse {
+		t.Errorf("got %s %s deleting a permission in use", code, ec)
+	}
+
+	if _, err := c.RemoveFromRole(alice, &rbacpb.ModifyRoleRequest{Name: "readers", Permissions: []string{"docs.read"}}); err != nil {
+		t.Fatalf("RemoveFromRole: %s", err)
+	}
+	if _, err := c.DeleteRole(alice, &rbacpb.DeleteRoleRequest{Name: "readers"}); err != nil {
+		t.Fatalf("DeleteRole: %s", err)
+	}
+	if _, err := c.DeletePermission(alice, &rbacpb.DeletePermissionRequest{Name: "docs.read"}); err != nil {
+		t.Fatalf("DeletePermission: %s", err)
+	}
+	if _, err := c.GetRole(context.Background(), &rbacpb.GetRoleRequest{Name: "readers"}); err == nil {
+		t.Error("got a deleted role")
+	} else if code, ec := grpcCode(err); code != codes.NotFound || ec != payloads.CodeRoleNotFound {
+		t.Errorf("got %s %s for a deleted role", code, ec)
+	}
+}
+
+func TestGRPCDryRun(t *testing.T) {
+	c := newTestGRPC(t, newTestService(t))
+
+	if _, err := c.CreateRole(as("alice"), &rbacpb.CreateRoleRequest{Name: "readers", DryRun: true}); err != nil {
+		t.Fatalf("CreateRole: %s", err)
+	}
+	if _, err := c.GetRole(context.Background(), &rbacpb.GetRoleRequest{Name: "readers"}); status.Code(err) != codes.NotFound {
+		t.Errorf("got %v for a role created in a dry run, want NotFound", err)
+	}
+}
+
+func TestGRPCCheck(t *testing.T) {
+	c := newTestGRPC(t, newTestService(t))
+	alice := as("alice")
+
+	for _, name := range []string{"docs.read", "docs.write"} {
+		if _, err := c.CreatePermission(alice, &rbacpb.CreatePermissionRequest{Name: name}); err != nil {
+			t.Fatalf("CreatePermission: %s", err)
+		}
+	}
+	if _, err := c.CreateRole(alice, &rbacpb.CreateRoleRequest{Name: "readers", Permissions: []string{"docs.read"}, Groups: []string{"eng"}}); err != nil {
+		t.Fatalf("CreateRole: %s", err)
+	}
+	if _, err := c.CreateRole(alice, &rbacpb.CreateRoleRequest{Name: "writers", Permissions: []string{"docs.write"}, Users: []string{"carol"}}); err != nil {
+		t.Fatalf("CreateRole: %s", err)
+	}
+
+	tests := []struct {
+		user       string
+		permission string
+		allowed    bool
+	}{
+		{"bob", "docs.read", true}, // through the group
+		{"bob", "docs.write", false},
+		{"carol", "docs.write", true},
+		{"carol", "docs.read", false},
+		{"carol", "docs.unknown", false},
+	}
+	batch := &rbacpb.BatchCheckRequest{}
+	for _, test := range tests {
+		res, err := c.Check(context.Background(), &rbacpb.CheckRequest{User: test.user, Permission: test.permission})
+		if err != nil {
+			t.Fatalf("Check: %s", err)
+		}
+		if res.Allowed != test.allowed {
+			t.Errorf("got allowed %t for %s %s, want %t", res.Allowed, test.user, test.permission, test.allowed)
+		}
+		batch.Checks = append(batch.Checks, &rbacpb.CheckRequest{User: test.user, Permission: test.permission})
+	}
+
+	res, err := c.BatchCheck(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("BatchCheck: %s", err)
+	}
+	if len(res.Results) != len(tests) {
+		t.Fatalf("got %d results, want %d", len(res.Results), len(tests))
+	}
+	for i, test := range tests {
+		if res.Results[i].Allowed != test.allowed {
+			t.Errorf("got allowed %t for check %d (%s %s) in the batch, want %t", res.Results[i].Allowed, i, test.user, test.permission, test.allowed)
+		}
+	}
+
+	if _, err := c.Check(context.Background(), &rbacpb.CheckRequest{Permission: "docs.read"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("got %v checking without a user, want InvalidArgument", err)
+	}
+}
+
+// TestGRPCMatchesHTTP makes the same calls over both APIs of one service,
+// and checks they are refused with the same error codes
+func TestGRPCMatchesHTTP(t *testing.T) {
+	svc := newTestService(t)
+	c := newTestGRPC(t, svc)
+	alice := as("alice")
+
+	if _, err := c.CreatePermission(alice, &rbacpb.CreatePermissionRequest{Name: "docs.read"}); err != nil {
+		t.Fatalf("CreatePermission: %s", err)
+	}
+	if _, err := c.CreateRole(alice, &rbacpb.CreateRoleRequest{Name: "readers"}); err != nil {
+		t.Fatalf("CreateRole: %s", err)
+	}
+	if _, err := c.CreateRole(alice, &rbacpb.CreateRoleRequest{Name: "eng-readers", Owners: []string{"group:eng"}}); err != nil {
+		t.Fatalf("CreateRole: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		call   func() error
+		method string
+		path   string
+		user   string
+		body   any
+		code   string
+	}{
+		{
+			name: "not an owner of the role",
+			call: func() error {
+				_, err := c.DeleteRole(as("bob"), &rbacpb.DeleteRoleRequest{Name: "readers"})
+				return err
+			},
+			method: http.MethodDelete, path: "/role/readers", user: "bob",
+			code: payloads.CodeNotOwner,
+		},
+		{
+			name: "not an owner of the permission",
+			call: func() error {
+				_, err := c.AddToPermission(as("bob"), &rbacpb.ModifyPermissionRequest{Name: "docs.read", Owners: []string{"bob"}})
+				return err
+			},
+			method: http.MethodPatch, path: "/permission/docs.read/add", user: "bob", body: payloads.ModifyPermissionRequest{Owners: []string{"bob"}},
+			code: payloads.CodeNotOwner,
+		},
+		{
+			name: "granting a permission owned by someone else",
+			call: func() error {
+				_, err := c.CreateRole(as("carol"), &rbacpb.CreateRoleRequest{Name: "carols", Permissions: []string{"docs.read"}})
+				return err
+			},
+			method: http.MethodPost, path: "/role", user: "carol", body: payloads.CreateRoleRequest{Name: "carols", Permissions: []string{"docs.read"}},
+			code: payloads.CodeNotOwner,
+		},
+		{
+			name: "not in the owning group",
+			call: func() error {
+				_, err := c.UpdateRole(as("carol"), &rbacpb.UpdateRoleRequest{Name: "eng-readers", Description: "carol's"})
+				return err
+			},
+			method: http.MethodPatch, path: "/role/eng-readers", user: "carol", body: payloads.GenericUpdateDescriptionRequest{Description: "carol's"},
+			code: payloads.CodeNotOwner,
+		},
+		{
+			name: "unauthenticated",
+			call: func() error {
+				_, err := c.DeleteRole(context.Background(), &rbacpb.DeleteRoleRequest{Name: "readers"})
+				return err
+			},
+			method: http.MethodDelete, path: "/role/readers",
+			code: payloads.CodeUnauthenticated,
+		},
+		{
+			name: "unknown role",
+			call: func() error {
+				_, err := c.UpdateRole(alice, &rbacpb.UpdateRoleRequest{Name: "writers", Description: "writers"})
+				return err
+			},
+			method: http.MethodPatch, path: "/role/writers", user: "alice", body: payloads.GenericUpdateDescriptionRequest{Description: "writers"},
+			code: payloads.CodeRoleNotFound,
+		},
+		{
+			name: "reserved name",
+			call: func() error {
+				_, err := c.CreatePermission(alice, &rbacpb.CreatePermissionRequest{Name: "rbac.mine"})
+				return err
+			},
+			method: http.MethodPost, path: "/permission", user: "alice", body: payloads.CreatePermissionRequest{Name: "rbac.mine"},
+			code: payloads.CodeReservedName,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.call()
+			if err == nil {
+				t.Fatal("call over gRPC succeeded")
+			}
+			code, ec := grpcCode(err)
+			if ec != test.code || code != codeGRPC[test.code] {
+				t.Errorf("got %s %s over gRPC, want %s %s", code, ec, codeGRPC[test.code], test.code)
+			}
+
+			status, ec := httpCode(t, svc, test.user, test.method, test.path, test.body)
+			if ec != test.code || status != codeStatus[test.code] {
+				t.Errorf("got %d %s over HTTP, want %d %s", status, ec, codeStatus[test.code], test.code)
+			}
+		})
+	}
+
+	// a member of the owning group may modify the role over both
+	if _, err := c.UpdateRole(as("bob"), &rbacpb.UpdateRoleRequest{Name: "eng-readers", Description: "bob's"}); err != nil {
+		t.Errorf("group owner could not update the role over gRPC: %s", err)
+	}
+	if status, ec := httpCode(t, svc, "bob", http.MethodPatch, "/role/eng-readers", payloads.GenericUpdateDescriptionRequest{Description: "bob's"}); status != http.StatusOK {
+		t.Errorf("group owner got %d %s updating the role over HTTP", status, ec)
+	}
+}
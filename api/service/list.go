@@ -0,0 +1,57 @@
+package service
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/storage"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 1000
+)
+
+// parseListOptions reads the search filters and pagination of a list request
+// from its query parameters. Cursors are opaque to clients.
+func parseListOptions(r *http.Request) (storage.ListOptions, error) {
+	q := r.URL.Query()
+	opts := storage.ListOptions{
+		Prefix:     q.Get("prefix"),
+		Contains:   q.Get("contains"),
+		Owner:      q.Get("owner"),
+		User:       q.Get("user"),
+		Group:      q.Get("group"),
+		Permission: q.Get("permission"),
+		Limit:      defaultListLimit,
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return opts, newError(payloads.CodeInvalidRequest, "limit value \"%s\" is not a number between 1 and %d", v, maxListLimit)
+		}
+		opts.Limit = limit
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		after, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil || len(after) == 0 {
+			return opts, newError(payloads.CodeInvalidRequest, "cursor value \"%s\" is not valid", v)
+		}
+		opts.After = string(after)
+	}
+
+	return opts, nil
+}
+
+// encodeCursor returns the cursor for the page after the given name,
+// or an empty cursor if there are no more pages
+func encodeCursor(after string) string {
+	if after == "" {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(after))
+}
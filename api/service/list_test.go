@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+// list makes a list request and decodes its response into v
+func list(t *testing.T, svc *service, path string, v any) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d listing %s: %s", w.Code, path, w.Body)
+	}
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+}
+
+// roleNames lists the roles matching query, and returns their names
+// separated by commas and the cursor for the next page
+func roleNames(t *testing.T, svc *service, query string) (string, string) {
+	t.Helper()
+
+	var resp payloads.ListRolesResponse
+	list(t, svc, "/roles?"+query, &resp)
+	names := []string{}
+	for _, r := range resp.Roles {
+		names = append(names, r.Name)
+	}
+	return strings.Join(names, ","), resp.NextCursor
+}
+
+func TestListRoles(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.createPermission(ctx, "alice", &payloads.CreatePermissionRequest{Name: "docs.read"}, false); err != nil {
+		t.Fatalf("failed to create permission: %s", err)
+	}
+	for _, role := range []payloads.CreateRoleRequest{
+		{Name: "docs-writers", Users: []string{"carol"}},
+		{Name: "docs-readers", Groups: []string{"eng"}, Permissions: []string{"docs.read"}},
+		{Name: "Billing-Admins", Owners: []string{"bob"}},
+		{Name: "ops"},
+	} {
+		if _, err := svc.createRole(ctx, "alice", &role, false); err != nil {
+			t.Fatalf("failed to create role %s: %s", role.Name, err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "Billing-Admins,docs-readers,docs-writers,ops,rbac.admin"},
+		{"prefix=docs-", "docs-readers,docs-writers"},
+		{"contains=ADMIN", "Billing-Admins,rbac.admin"},
+		{"owner=bob", "Billing-Admins"},
+		{"owner=carol", ""},
+		{"user=carol", "docs-writers"},
+		{"group=eng", "docs-readers"},
+		{"permission=docs.read", "docs-readers"},
+		{"prefix=docs-&user=carol", "docs-writers"},
+		{"prefix=nope", ""},
+	}
+	for _, test := range tests {
+		if got, cursor := roleNames(t, svc, test.query); got != test.want || cursor != "" {
+			t.Errorf("got roles %q and cursor %q for %q, want %q and no cursor", got, cursor, test.query, test.want)
+		}
+	}
+
+	// pages follow each other in order, and the last page has no cursor
+	pages := []string{}
+	query := "limit=3"
+	for {
+		names, cursor := roleNames(t, svc, query)
+		pages = append(pages, names)
+		if cursor == "" {
+			break
+		}
+		query = "limit=3&cursor=" + cursor
+	}
+	if got := strings.Join(pages, "|"); got != "Billing-Admins,docs-readers,docs-writers|ops,rbac.admin" {
+		t.Errorf("got pages %q, want 3 roles then 2", got)
+	}
+
+	// a cursor stays valid when the role it names is deleted
+	_, cursor := roleNames(t, svc, "limit=1")
+	if err := svc.deleteRole(ctx, "bob", "Billing-Admins", false); err != nil {
+		t.Fatalf("failed to delete role: %s", err)
+	}
+	if got, _ := roleNames(t, svc, "limit=1&cursor="+cursor); got != "docs-readers" {
+		t.Errorf("got roles %q after a deleted role, want the next role", got)
+	}
+}
+
+func TestListPermissions(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	for _, perm := range []payloads.CreatePermissionRequest{
+		{Name: "docs.read"},
+		{Name: "docs.write", Owners: []string{"bob"}},
+		{Name: "billing.read"},
+	} {
+		if _, err := svc.createPermission(ctx, "alice", &perm, false); err != nil {
+			t.Fatalf("failed to create permission %s: %s", perm.Name, err)
+		}
+	}
+
+	var first, last payloads.ListPermissionsResponse
+	list(t, svc, "/permissions?prefix=docs.&limit=1", &first)
+	if len(first.Permissions) != 1 || first.Permissions[0].Name != "docs.read" || first.NextCursor == "" {
+		t.Fatalf("got permissions %+v and cursor %q, want the first page", first.Permissions, first.NextCursor)
+	}
+	list(t, svc, "/permissions?prefix=docs.&limit=1&cursor="+first.NextCursor, &last)
+	if len(last.Permissions) != 1 || last.Permissions[0].Name != "docs.write" || last.NextCursor != "" {
+		t.Errorf("got permissions %+v and cursor %q, want the last page", last.Permissions, last.NextCursor)
+	}
+
+	var owned payloads.ListPermissionsResponse
+	list(t, svc, "/permissions?owner=bob", &owned)
+	if len(owned.Permissions) != 1 || owned.Permissions[0].Name != "docs.write" {
+		t.Errorf("got permissions %+v, want the one bob owns", owned.Permissions)
+	}
+}
+
+func TestListOptionErrors(t *testing.T) {
+	svc := newTestService(t)
+
+	for _, query := range []string{"limit=0", "limit=1001", "limit=ten", "cursor=%21%21"} {
+		for _, path := range []string{"/roles", "/permissions"} {
+			if status, code := httpCode(t, svc, "", http.MethodGet, path+"?"+query, nil); status != http.StatusBadRequest || code != payloads.CodeInvalidRequest {
+				t.Errorf("got %d %s for %s?%s, want %d %s", status, code, path, query, http.StatusBadRequest, payloads.CodeInvalidRequest)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// Kinds of objects locked by objectLocks. Operations locking objects of
+// several kinds lock them in the order below, so that they can't deadlock.
+const (
+	lockNamespace      = "namespace"
+	lockRole           = "role"
+	lockPermission     = "permission"
+	lockServiceAccount = "serviceaccount"
+)
+
+// objectLocks serializes the operations which read an object, modify it,
+// and write it back, so that concurrent changes to the same object are not
+// lost. Changes to the bindings of a role are written to its permissions,
+// so operations on a role also lock the permissions they add or remove.
+type objectLocks struct {
+	sync.Mutex
+	held map[string]*objectLock
+}
+
+type objectLock struct {
+	sync.Mutex
+	refs int // operations holding or waiting for the lock
+}
+
+func newObjectLocks() *objectLocks {
+	return &objectLocks{held: make(map[string]*objectLock)}
+}
+
+// lock locks the named objects of a kind, and returns the function unlocking them
+func (l *objectLocks) lock(kind string, names ...string) func() {
+	keys := []string{}
+	for name := range set.NewSet(names...) {
+		keys = append(keys, kind+"/"+name)
+	}
+	sort.Strings(keys)
+
+	locks := make([]*objectLock, len(keys))
+	for i, key := range keys {
+		l.Lock()
+		ol, ok := l.held[key]
+		if !ok {
+			ol = &objectLock{}
+			l.held[key] = ol
+		}
+		ol.refs++
+		l.Unlock()
+
+		ol.Lock()
+		locks[i] = ol
+	}
+
+	return func() {
+		for i := len(keys) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+
+			l.Lock()
+			if locks[i].refs--; locks[i].refs == 0 {
+				delete(l.held, keys[i])
+			}
+			l.Unlock()
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/storage"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// slowStorage takes a while to return the roles and permissions it read,
+// so that concurrent changes to them interleave
+type slowStorage struct {
+	storage.Storage
+}
+
+func (s slowStorage) ReadRole(ctx context.Context, name string) (*model.Role, error) {
+	defer time.Sleep(time.Millisecond)
+	return s.Storage.ReadRole(ctx, name)
+}
+
+func (s slowStorage) ReadPermission(ctx context.Context, name string) (*model.Permission, error) {
+	defer time.Sleep(time.Millisecond)
+	return s.Storage.ReadPermission(ctx, name)
+}
+
+func TestConcurrentChanges(t *testing.T) {
+	svc, err := newService(Config{
+		Storage: slowStorage{storage.NewMemoryStorage()},
+		Groups:  groups.NewMemorySource(map[string][]string{"alice": {}}),
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	ctx := context.Background()
+	if _, err := svc.createRole(ctx, "alice", &payloads.CreateRoleRequest{Name: "readers"}, false); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+	names := []string{}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("docs.read%d", i)
+		if _, err := svc.createPermission(ctx, "alice", &payloads.CreatePermissionRequest{Name: name}, false); err != nil {
+			t.Fatalf("failed to create permission: %s", err)
+		}
+		names = append(names, name)
+	}
+
+	// every change reads the role and writes it back
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(2)
+		go func(name, owner string) {
+			defer wg.Done()
+			if _, err := svc.addToRole(ctx, "alice", "readers", &payloads.ModifyRoleRequest{Permissions: []string{name}}, false); err != nil {
+				t.Errorf("failed to add permission to role: %s", err)
+			}
+		}(name, fmt.Sprintf("user%d", i))
+		go func(name, owner string) {
+			defer wg.Done()
+			if _, err := svc.addToPermission(ctx, "alice", name, &payloads.ModifyPermissionRequest{Owners: []string{owner}}, false); err != nil {
+				t.Errorf("failed to add owner to permission: %s", err)
+			}
+		}(name, fmt.Sprintf("user%d", i))
+	}
+	wg.Wait()
+
+	role, err := svc.readRole(ctx, "readers")
+	if err != nil {
+		t.Fatalf("failed to read role: %s", err)
+	}
+	if got := set.NewSet(role.Permissions...); len(got) != len(names) {
+		t.Errorf("got %d permissions in the role, want all %d added", len(got), len(names))
+	}
+	for i, name := range names {
+		perm, err := svc.readPermission(ctx, name)
+		if err != nil {
+			t.Fatalf("failed to read permission: %s", err)
+		}
+		if !set.NewSet(perm.Roles...).Has("readers") || !set.NewSet(perm.Owners...).Has(fmt.Sprintf("user%d", i)) {
+			t.Errorf("got permission %s with roles %v and owners %v, want both changes kept", name, perm.Roles, perm.Owners)
+		}
+	}
+}
+
+func TestObjectLocks(t *testing.T) {
+	l := newObjectLocks()
+
+	unlock := l.lock(lockRole, "a", "b")
+	locked := make(chan struct{})
+	go func() {
+		l.lock(lockRole, "b")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("locked an object which is already locked")
+	default:
+	}
+	l.lock(lockPermission, "a")() // other kinds are not locked
+
+	unlock()
+	<-locked
+	l.Lock()
+	defer l.Unlock()
+	if len(l.held) != 0 {
+		t.Errorf("got %d locks held after unlocking, want none", len(l.held))
+	}
+}
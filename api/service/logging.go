@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDHeader is the header which carries the ID of a request. A valid
+// ID sent by the client is kept, so that it can be correlated with its logs.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDMetadataKey is the gRPC equivalent of the X-Request-ID header
+const requestIDMetadataKey = "x-request-id"
+
+var (
+	requestLogContextKey = "request-log"
+
+	requestIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9._:-]{1,128}$`)
+)
+
+// requestLog holds the ID of a request and the fields
+// handlers attach to the log entry of the request
+type requestLog struct {
+	sync.Mutex
+	id    string
+	attrs []slog.Attr
+}
+
+// logFields attaches fields to the log entry of the request in ctx.
+// When there is none, the fields are logged right away.
+func logFields(ctx context.Context, attrs ...slog.Attr) {
+	rl, ok := ctx.Value(requestLogContextKey).(*requestLog)
+	if !ok {
+		slog.LogAttrs(ctx, slog.LevelInfo, "request event", attrs...)
+		return
+	}
+	rl.Lock()
+	defer rl.Unlock()
+	rl.attrs = append(rl.attrs, attrs...)
+}
+
+// requestID returns the ID of the request in ctx, if any
+func requestID(ctx context.Context) string {
+	if rl, ok := ctx.Value(requestLogContextKey).(*requestLog); ok {
+		return rl.id
+	}
+	return ""
+}
+
+// withRequestLog returns ctx with a new request log for a request ID,
+// which is generated unless the given one is valid
+func withRequestLog(ctx context.Context, id string) (context.Context, *requestLog) {
+	if !requestIDRegexp.MatchString(id) {
+		id = newRequestID()
+	}
+	rl := &requestLog{id: id}
+	return context.WithValue(ctx, requestLogContextKey, rl), rl
+}
+
+// traceID returns the ID of the trace in ctx, if any
+func traceID(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// logRequests wraps a handler, writing one structured log entry for every
+// request with its method, route template, status, latency, authenticated
+// user, request ID, and any fields attached by handlers
+func (s *service) logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, rl := withRequestLog(r.Context(), r.Header.Get(requestIDHeader))
+		w.Header().Set(requestIDHeader, rl.id)
+
+		rec := newStatusRecorder(w)
+		h.ServeHTTP(rec, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("request_id", rl.id),
+			slog.String("method", r.Method),
+			slog.String("route", routeTemplate(r)),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if id := traceID(ctx); id != "" {
+			attrs = append(attrs, slog.String("trace_id", id))
+		}
+		rl.Lock()
+		attrs = append(attrs, rl.attrs...)
+		rl.Unlock()
+		s.logger.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
+
+// logGRPC is a gRPC interceptor which writes one structured
+// log entry for every call, like logRequests does for requests
+func (s *service) logGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx, rl := withRequestLog(ctx, metadataCarrier(md).Get(requestIDMetadataKey))
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadataKey, rl.id))
+
+	resp, err := handler(ctx, req)
+
+	st, _ := status.FromError(err)
+	level := slog.LevelInfo
+	switch st.Code() {
+	case codes.Internal, codes.Unknown, codes.Unavailable, codes.DataLoss:
+		level = slog.LevelError
+	}
+	attrs := []slog.Attr{
+		slog.String("request_id", rl.id),
+		slog.String("method", info.FullMethod),
+		slog.String("code", st.Code().String()),
+		slog.Duration("latency", time.Since(start)),
+	}
+	if id := traceID(ctx); id != "" {
+		attrs = append(attrs, slog.String("trace_id", id))
+	}
+	rl.Lock()
+	attrs = append(attrs, rl.attrs...)
+	rl.Unlock()
+	s.logger.LogAttrs(ctx, level, "grpc call", attrs...)
+	return resp, err
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/rbacpb"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// failingSource is a groups.Source which fails every lookup
+type failingSource struct {
+	err error
+}
+
+func (fs *failingSource) GetForUser(ctx context.Context, id string) ([]string, error) {
+	return nil, fs.err
+}
+
+func (fs *failingSource) UserActive(ctx context.Context, id string) (bool, error) {
+	return false, fs.err
+}
+
+func (fs *failingSource) Ping(ctx context.Context) error {
+	return fs.err
+}
+
+// newLoggingTestService returns a service with the given groups source
+// which writes its logs as JSON to the returned buffer
+func newLoggingTestService(t *testing.T, src groups.Source) (*service, *bytes.Buffer) {
+	t.Helper()
+
+	var logs bytes.Buffer
+	svc, err := newService(Config{
+		Groups: src,
+		Logger: slog.New(slog.NewJSONHandler(&logs, nil)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	logs.Reset()
+	return svc, &logs
+}
+
+// lastLogEntry returns the last entry written to logs
+func lastLogEntry(t *testing.T, logs *bytes.Buffer) map[string]any {
+	t.Helper()
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &entry); err != nil {
+		t.Fatalf("failed to decode log entry %s: %s", lines[len(lines)-1], err)
+	}
+	return entry
+}
+
+// serve makes a request as user with the given request ID
+func serve(svc *service, user, method, path, id string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("MOCK_AUTHENTICATED_USER", user)
+	if id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequestLog(t *testing.T) {
+	svc, logs := newLoggingTestService(t, groups.NewMemorySource(map[string][]string{"alice": {"eng"}}))
+
+	w := serve(svc, "alice", http.MethodPost, "/role", "deploy-42", `{"name":"readers"}`)
+	if w.Code != http.StatusOK || w.Header().Get(requestIDHeader) != "deploy-42" {
+		t.Fatalf("got %d with request ID %q, want %d with the client's ID", w.Code, w.Header().Get(requestIDHeader), http.StatusOK)
+	}
+	entry := lastLogEntry(t, logs)
+	for key, want := range map[string]any{
+		"level":       "INFO",
+		"msg":         "request",
+		"request_id":  "deploy-42",
+		"method":      http.MethodPost,
+		"route":       "/role",
+		"path":        "/role",
+		"status":      float64(http.StatusOK),
+		"user":        "alice",
+		"auth_method": authMethodHeader,
+	} {
+		if entry[key] != want {
+			t.Errorf("got %s %v in log entry, want %v", key, entry[key], want)
+		}
+	}
+	if _, ok := entry["latency"]; !ok {
+		t.Error("got no latency in log entry")
+	}
+
+	// the route template is logged next to the path
+	serve(svc, "alice", http.MethodGet, "/role/readers", "", "")
+	if entry := lastLogEntry(t, logs); entry["route"] != "/role/{name}" || entry["path"] != "/role/readers" {
+		t.Errorf("got route %v and path %v, want the template and the path", entry["route"], entry["path"])
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	svc, logs := newLoggingTestService(t, groups.NewMemorySource(map[string][]string{"alice": {"eng"}}))
+
+	for _, id := range []string{"", "not valid!", strings.Repeat("a", 129)} {
+		w := serve(svc, "alice", http.MethodGet, "/role/missing", id, "")
+		got := w.Header().Get(requestIDHeader)
+		if len(got) != 32 || got == id {
+			t.Errorf("got request ID %q for %q, want a generated one", got, id)
+		}
+
+		// errors include the request ID to correlate them with the logs
+		var e payloads.ErrorResponse
+		json.NewDecoder(w.Body).Decode(&e)
+		if e.Code != payloads.CodeRoleNotFound || e.RequestID != got {
+			t.Errorf("got error %s with request ID %q, want %s with %q", e.Code, e.RequestID, payloads.CodeRoleNotFound, got)
+		}
+		if entry := lastLogEntry(t, logs); entry["request_id"] != got {
+			t.Errorf("got request ID %v in log entry, want %q", entry["request_id"], got)
+		}
+	}
+}
+
+func TestInternalErrorLog(t *testing.T) {
+	svc, logs := newLoggingTestService(t, &failingSource{err: errors.New("okta is down")})
+
+	w := serve(svc, "alice", http.MethodGet, "/user/alice", "lookup-1", "")
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "okta is down") {
+		t.Errorf("got %d %s, want %d without the cause", w.Code, w.Body, http.StatusInternalServerError)
+	}
+
+	// the cause is only logged, at the error level
+	entry := lastLogEntry(t, logs)
+	if entry["level"] != "ERROR" || entry["request_id"] != "lookup-1" || !strings.Contains(entry["error"].(string), "okta is down") {
+		t.Errorf("got log entry %v, want an error with the cause", entry)
+	}
+}
+
+func TestGRPCLog(t *testing.T) {
+	svc, logs := newLoggingTestService(t, groups.NewMemorySource(map[string][]string{"alice": {"eng"}}))
+	c := newTestGRPC(t, svc)
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(as("alice"), requestIDMetadataKey, "deploy-42")
+	if _, err := c.CreatePermission(ctx, &rbacpb.CreatePermissionRequest{Name: "docs.read"}, grpc.Header(&header)); err != nil {
+		t.Fatalf("failed to create permission: %s", err)
+	}
+	if got := header.Get(requestIDMetadataKey); len(got) != 1 || got[0] != "deploy-42" {
+		t.Errorf("got request ID %v in response header, want the client's ID", got)
+	}
+
+	entry := lastLogEntry(t, logs)
+	for key, want := range map[string]any{
+		"msg":        "grpc call",
+		"request_id": "deploy-42",
+		"method":     rbacpb.RBAC_CreatePermission_FullMethodName,
+		"code":       "OK",
+		"user":       "alice",
+	} {
+		if entry[key] != want {
+			t.Errorf("got %s %v in log entry, want %v", key, entry[key], want)
+		}
+	}
+}
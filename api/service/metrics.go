@@ -0,0 +1,39 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// unmatchedRoute is the route of requests which match no route
+const unmatchedRoute = "unmatched"
+
+func (s *service) setMetricsEndpoints() {
+	s.router.Methods(http.MethodGet).Path("/metrics").Handler(s.metrics.Handler())
+}
+
+// instrument wraps a handler, recording the route template,
+// status code, and latency of every request in the metrics
+func (s *service) instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := newStatusRecorder(w)
+		h.ServeHTTP(rec, r)
+		s.metrics.ObserveRequest(routeTemplate(r), r.Method, rec.status, time.Since(start))
+	})
+}
+
+// routeTemplate returns the path template of the route a request matched
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return unmatchedRoute
+	}
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return unmatchedRoute
+	}
+	return tmpl
+}
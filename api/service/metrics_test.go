@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	if _, err := svc.createRole(ctx, "alice", &payloads.CreateRoleRequest{Name: "readers", Users: []string{"bob"}}, false); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+	httpCode(t, svc, "alice", http.MethodGet, "/role/readers", nil)
+	httpCode(t, svc, "alice", http.MethodGet, "/role/writers", nil)
+	httpCode(t, svc, "alice", http.MethodGet, "/nope/nope", nil)
+	if _, err := svc.check(ctx, "bob", []string{"rbac.roles.admin", "docs.read"}); err != nil {
+		t.Fatalf("failed to check permissions: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d scraping metrics", w.Code)
+	}
+	body := w.Body.String()
+
+	// requests are labeled by route template, never by path
+	for _, sample := range []string{
+		`rbac_http_requests_total{method="GET",route="/role/{name}",status="200"} 1`,
+		`rbac_http_requests_total{method="GET",route="/role/{name}",status="404"} 1`,
+		`rbac_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`rbac_permission_checks_total{decision="deny"} 2`,
+		`rbac_storage_operation_duration_seconds_count{operation="CreateRole"} 2`, // with the bootstrapped admin role
+		`rbac_groups_lookup_duration_seconds_count 1`,
+	} {
+		if !strings.Contains(body, sample+"\n") {
+			t.Errorf("got no sample %s", sample)
+		}
+	}
+	if strings.Contains(body, "/role/readers") || strings.Contains(body, "/nope") {
+		t.Error("got a request path in the labels of a metric")
+	}
+}
@@ -2,31 +2,153 @@ package service
 
 import (
 	"context"
+	"crypto/tls"
+	"log/slog"
 	"net/http"
+	"strings"
+
+	"github.com/adrianosela/rbac/api/apikeys"
+	"github.com/adrianosela/rbac/api/certs"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
 )
 
 var (
 	authenticatedUserContextKey = "authenticated-user"
 )
 
-// auth wraps a handler function with authenicated
+const (
+	authMethodClientCert = "client_cert"
+	authMethodAPIKey     = "api_key"
+	authMethodHeader     = "header"
+)
+
+// auth wraps a handler function with authenicated. A verified client
+// certificate authenticates its identity, so that services calling over
+// mutual TLS need no token. Service accounts authenticate with an API key
+// as the bearer token of the "Authorization" header, and only that way.
 func (s *service) auth(h http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// FIXME: Get JWT from "Authorization" header, validate it, inject user into context
-
-		username := r.Header.Get("MOCK_AUTHENTICATED_USER")
+		username, method := clientCertificateIdentity(r.TLS), authMethodClientCert
+		if key := bearerToken(r.Header.Get("Authorization")); username == "" && isAPIKey(key) {
+			principal, err := s.authenticateAPIKey(r.Context(), key)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			username, method = principal, authMethodAPIKey
+		}
 		if username == "" {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte("No user in \"MOCK_AUTHENTICATED_USER\" header"))
+			// FIXME: Get JWT from "Authorization" header, validate it, inject user into context
+			username, method = r.Header.Get("MOCK_AUTHENTICATED_USER"), authMethodHeader
+		}
+		if username == "" {
+			writeError(w, r, newError(payloads.CodeUnauthenticated, "No user in \"MOCK_AUTHENTICATED_USER\" header"))
 			return
 		}
+		if method != authMethodAPIKey {
+			if err := checkAssertedIdentity(username); err != nil {
+				writeError(w, r, err)
+				return
+			}
+		}
+
+		logFields(r.Context(), slog.String("user", username), slog.String("auth_method", method))
 
 		// run handler with auth values in context
 		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authenticatedUserContextKey, username)))
 	})
 }
 
+// clientCertificateIdentity returns the identity in the client certificate
+// of a connection, or empty if the client presented no verified certificate
+func clientCertificateIdentity(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return certs.Identity(state.VerifiedChains[0][0])
+}
+
+// checkAssertedIdentity rejects an identity from a client certificate or
+// header which is a service account, since only the API keys of a service
+// account authenticate it
+func checkAssertedIdentity(user string) error {
+	if name, ok := model.ServiceAccountName(user); ok {
+		return newError(payloads.CodeUnauthenticated, "Service account \"%s\" must authenticate with an API key", name)
+	}
+	return nil
+}
+
+// bearerToken returns the token of a bearer "Authorization" header, or
+// empty if the header is not a bearer token
+func bearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// isAPIKey returns whether a bearer token is an API key, other
+// tokens are left for other authentication methods
+func isAPIKey(token string) bool {
+	_, _, ok := apikeys.Parse(token)
+	return ok
+}
+
 // getAuthenticatedUser returns the authenticated user in the context object
 func getAuthenticatedUser(r *http.Request) string {
 	return r.Context().Value(authenticatedUserContextKey).(string)
 }
+
+// admin wraps a handler function with authentication, only allowing
+// users with the model.PermissionSnapshotsAdmin meta-permission through
+func (s *service) admin(h http.HandlerFunc) http.Handler {
+	return s.auth(func(w http.ResponseWriter, r *http.Request) {
+		authenticatedUser := getAuthenticatedUser(r)
+		allowed, err := s.hasPermission(r.Context(), authenticatedUser, model.PermissionSnapshotsAdmin)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if !allowed {
+			writeError(w, r, newError(payloads.CodeNotAdmin, "User \"%s\" is not an admin, lacks permission \"%s\"", authenticatedUser, model.PermissionSnapshotsAdmin))
+			return
+		}
+		h(w, r)
+	})
+}
+
+// statusRecorder is a http.ResponseWriter which records the status code
+// of the response. It is a http.Flusher, for streaming responses.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// WriteHeader records and writes the status code
+func (sr *statusRecorder) WriteHeader(status int) {
+	if !sr.wroteHeader {
+		sr.status = status
+		sr.wroteHeader = true
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes to the response, which has status 200 unless already set
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	sr.wroteHeader = true
+	return sr.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered data to the client, if supported
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/rbac/api/rbacpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testServerName is the name in the certificate of the test servers
+const testServerName = "rbac.test"
+
+// testCA issues certificates in memory
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse CA certificate: %s", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate signed by the CA with the subject and SANs of template
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serverTLS returns the TLS configuration of a server which verifies client
+// certificates issued by the CA when they are presented
+func (ca *testCA) serverTLS(t *testing.T) *tls.Config {
+	t.Helper()
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, &x509.Certificate{DNSNames: []string{testServerName}})},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+}
+
+// clientTLS returns the TLS configuration of a client presenting certs
+func (ca *testCA) clientTLS(certs ...tls.Certificate) *tls.Config {
+	return &tls.Config{RootCAs: ca.pool, ServerName: testServerName, Certificates: certs}
+}
+
+func TestClientCertificateIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	spiffe, _ := url.Parse("spiffe://example.com/billing")
+
+	tests := []struct {
+		name   string
+		certs  []tls.Certificate
+		header string
+		want   string
+	}{
+		{
+			name:   "DNS name",
+			certs:  []tls.Certificate{ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ignored"}, DNSNames: []string{"billing.example.com"}})},
+			header: "mallory",
+			want:   "billing.example.com",
+		},
+		{
+			name:  "URI",
+			certs: []tls.Certificate{ca.issue(t, &x509.Certificate{URIs: []*url.URL{spiffe}})},
+			want:  "spiffe://example.com/billing",
+		},
+		{
+			name:  "email address",
+			certs: []tls.Certificate{ca.issue(t, &x509.Certificate{EmailAddresses: []string{"billing@example.com"}})},
+			want:  "billing@example.com",
+		},
+		{
+			name:  "common name",
+			certs: []tls.Certificate{ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}})},
+			want:  "billing",
+		},
+		{
+			name:   "no certificate",
+			header: "alice",
+			want:   "alice",
+		},
+	}
+
+	t.Run("HTTP", func(t *testing.T) {
+		srv := httptest.NewUnstartedServer(newTestService(t).router)
+		srv.TLS = ca.serverTLS(t)
+		srv.StartTLS()
+		defer srv.Close()
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				c := &http.Client{Transport: &http.Transport{TLSClientConfig: ca.clientTLS(test.certs...)}}
+				req, _ := http.NewRequest(http.MethodGet, srv.URL+"/authcheck", nil)
+				if test.header != "" {
+					req.Header.Set("MOCK_AUTHENTICATED_USER", test.header)
+				}
+				resp, err := c.Do(req)
+				if err != nil {
+					t.Fatalf("request failed: %s", err)
+				}
+				defer resp.Body.Close()
+				body, _ := io.ReadAll(resp.Body)
+				if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"`+test.want+`"`) {
+					t.Errorf("got %d %s, want %q authenticated", resp.StatusCode, body, test.want)
+				}
+			})
+		}
+	})
+
+	t.Run("gRPC", func(t *testing.T) {
+		lis := bufconn.Listen(1 << 20)
+		server := newTestService(t).newGRPCServer(grpc.Creds(credentials.NewTLS(ca.serverTLS(t))))
+		go server.Serve(lis)
+		defer server.Stop()
+
+		for i, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				conn, err := grpc.NewClient("passthrough:///bufnet",
+					grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+					grpc.WithTransportCredentials(credentials.NewTLS(ca.clientTLS(test.certs...))),
+				)
+				if err != nil {
+					t.Fatalf("failed to dial: %s", err)
+				}
+				defer conn.Close()
+
+				ctx := context.Background()
+				if test.header != "" {
+					ctx = metadata.AppendToOutgoingContext(ctx, authenticatedUserMetadataKey, test.header)
+				}
+				// the caller becomes the owner of the permission
+				perm, err := rbacpb.NewRBACClient(conn).CreatePermission(ctx, &rbacpb.CreatePermissionRequest{Name: fmt.Sprintf("docs.read%d", i)})
+				if err != nil {
+					t.Fatalf("CreatePermission: %s", err)
+				}
+				if len(perm.Owners) != 1 || perm.Owners[0] != test.want {
+					t.Errorf("got owners %v, want %q authenticated", perm.Owners, test.want)
+				}
+			})
+		}
+	})
+}
+
+func TestUntrustedClientCertificate(t *testing.T) {
+	ca, other := newTestCA(t), newTestCA(t)
+
+	srv := httptest.NewUnstartedServer(newTestService(t).router)
+	srv.TLS = ca.serverTLS(t)
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // the failed handshake
+	srv.StartTLS()
+	defer srv.Close()
+
+	// trusts the server, but presents a certificate the server does not trust
+	config := ca.clientTLS(other.issue(t, &x509.Certificate{DNSNames: []string{"alice"}}))
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	if resp, err := c.Get(srv.URL + "/authcheck"); err == nil {
+		resp.Body.Close()
+		t.Errorf("got status %d with an untrusted client certificate, want the handshake to fail", resp.StatusCode)
+	}
+}
+
+func TestServiceAccountClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	sa, _ := url.Parse("sa:ci")
+
+	srv := httptest.NewUnstartedServer(newTestService(t).router)
+	srv.TLS = ca.serverTLS(t)
+	srv.StartTLS()
+	defer srv.Close()
+
+	config := ca.clientTLS(ca.issue(t, &x509.Certificate{URIs: []*url.URL{sa}}))
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	resp, err := c.Get(srv.URL + "/authcheck")
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got status %d with a service account certificate, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/gorilla/mux"
+)
+
+func (s *service) setNamespaceEndpoints() {
+	s.router.Methods(http.MethodPost).Path("/namespace").Handler(s.auth(s.createNamespaceHandler))
+	s.router.Methods(http.MethodGet).Path("/namespace/{name}").HandlerFunc(s.readNamespaceHandler)
+	s.router.Methods(http.MethodGet).Path("/namespaces").HandlerFunc(s.listNamespacesHandler)
+	s.router.Methods(http.MethodPatch).Path("/namespace/{name}/add").Handler(s.auth(s.addToNamespaceHandler))         // add owners
+	s.router.Methods(http.MethodPatch).Path("/namespace/{name}/remove").Handler(s.auth(s.removeFromNamespaceHandler)) // rm owners
+	s.router.Methods(http.MethodDelete).Path("/namespace/{name}").Handler(s.auth(s.deleteNamespaceHandler))
+}
+
+func (s *service) createNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	var pl *payloads.CreateNamespaceRequest
+	if err := unmarshalRequestBody(r, &pl); err != nil {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a namespace: %s", err))
+		return
+	}
+
+	ns, err := s.createNamespace(r.Context(), authenticatedUser, pl)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Namespace \"%s\" created successfully!", ns.Name)))
+	return
+}
+
+func (s *service) readNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no namespace name in request URL"))
+		return
+	}
+
+	ns, err := s.readNamespace(r.Context(), name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	nsBytes, err := json.Marshal(&ns)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(nsBytes)
+	return
+}
+
+func (s *service) listNamespacesHandler(w http.ResponseWriter, r *http.Request) {
+	namespaces, err := s.listNamespaces(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	respBytes, err := json.Marshal(&payloads.ListNamespacesResponse{Namespaces: namespaces})
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return
+}
+
+func (s *service) addToNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no namespace name in request URL"))
+		return
+	}
+
+	var pl *payloads.ModifyNamespaceRequest
+	if err := unmarshalRequestBody(r, &pl); err != nil {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a namespace modification: %s", err))
+		return
+	}
+
+	if _, err := s.addToNamespace(r.Context(), authenticatedUser, name, pl); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Namespace \"%s\" updated successfully!", name)))
+	return
+}
+
+func (s *service) removeFromNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no namespace name in request URL"))
+		return
+	}
+
+	var pl *payloads.ModifyNamespaceRequest
+	if err := unmarshalRequestBody(r, &pl); err != nil {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a namespace modification: %s", err))
+		return
+	}
+
+	if _, err := s.removeFromNamespace(r.Context(), authenticatedUser, name, pl); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Namespace \"%s\" updated successfully!", name)))
+	return
+}
+
+func (s *service) deleteNamespaceHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no namespace name in request URL"))
+		return
+	}
+
+	if err := s.deleteNamespace(r.Context(), authenticatedUser, name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Namespace \"%s\" deleted successfully!", name)))
+	return
+}
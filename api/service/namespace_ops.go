@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/storage"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// createNamespace creates a new namespace owned by the actor. Namespaces
+// inside another namespace can only be created by its owners, so that no one
+// can take over part of a namespace owned by another team, and top-level
+// namespaces only by users with the model.PermissionNamespacesCreate
+// meta-permission. Existing permissions in the namespace with owners outside
+// of it are conflicts, which fail the request unless the actor takes them over.
+func (s *service) createNamespace(ctx context.Context, actor string, pl *payloads.CreateNamespaceRequest) (*model.Namespace, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+	if model.IsReserved(pl.Name) {
+		return nil, newError(payloads.CodeReservedName, "Namespace \"%s\" is reserved for meta-permissions", pl.Name)
+	}
+
+	defer s.locks.lock(lockNamespace, pl.Name)()
+
+	existing, err := s.store.ReadNamespace(ctx, pl.Name)
+	if err != nil {
+		return nil, internalError(err, "failed to read namespace from storage")
+	}
+	if existing != nil {
+		return nil, newError(payloads.CodeNamespaceExists, "Namespace \"%s\" already exists!", pl.Name)
+	}
+
+	parent, err := s.namespaceOf(ctx, pl.Name)
+	if err != nil {
+		return nil, err
+	}
+	if parent != nil {
+		reason := fmt.Sprintf("Only the owners of namespace \"%s\" can create namespaces in it", parent.Name)
+		if err := s.checkOwner(ctx, actor, parent.Owners, model.PermissionNamespacesAdmin, reason); err != nil {
+			return nil, err
+		}
+	} else {
+		// top-level namespaces lock everyone else out of permission names anyone
+		// could create, so they require the meta-permission even when creation
+		// is not restricted
+		allowed, err := s.hasPermission(ctx, actor, model.PermissionNamespacesCreate)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, newError(payloads.CodeMissingPermission, "Only users allowed to create namespaces can create top-level namespaces. User \"%s\" lacks permission \"%s\".", actor, model.PermissionNamespacesCreate)
+		}
+	}
+
+	if err := s.checkPrincipalsExist(ctx, pl.Owners); err != nil {
+		return nil, err
+	}
+
+	ns := &model.Namespace{
+		Name:        pl.Name,
+		Description: pl.Description,
+		Owners:      set.NewSet(pl.Owners...).Add(actor).Slice(),
+	}
+
+	conflicts, err := s.namespaceConflicts(ctx, ns)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, perm := range conflicts {
+		names = append(names, perm.Name)
+	}
+	if len(conflicts) > 0 && !pl.Takeover {
+		return nil, newError(payloads.CodeNamespaceConflict, "Permissions %v in namespace \"%s\" have owners outside of the namespace. Take them over or transfer them first", names, ns.Name)
+	}
+
+	// read again once locked, as they may have changed since
+	defer s.locks.lock(lockPermission, names...)()
+	conflicts = conflicts[:0]
+	for _, name := range names {
+		perm, err := s.store.ReadPermission(ctx, name)
+		if err != nil {
+			return nil, internalError(err, "failed to read permission from storage")
+		}
+		if perm != nil {
+			conflicts = append(conflicts, perm)
+		}
+	}
+	for _, perm := range conflicts {
+		reason := fmt.Sprintf("Only the owners of permission \"%s\" can take it over into a namespace", perm.Name)
+		if err := s.checkOwner(ctx, actor, perm.Owners, model.PermissionPermissionsAdmin, reason); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.store.CreateNamespace(ctx, ns); err != nil {
+		return nil, internalError(err, "failed to create new namespace in storage")
+	}
+	s.publish(events.New(events.NamespaceCreated, ns.Name, actor))
+
+	for _, perm := range conflicts {
+		perm.Owners = ns.Owners
+		if err := s.store.UpdatePermission(ctx, perm); err != nil {
+			return nil, internalError(err, "failed to update permission in storage")
+		}
+		s.publish(events.New(events.PermissionUpdated, perm.Name, actor))
+	}
+	return ns, nil
+}
+
+// namespaceConflicts returns the existing permissions in a new namespace
+// which are owned by anyone other than the owners of the namespace
+func (s *service) namespaceConflicts(ctx context.Context, ns *model.Namespace) ([]*model.Permission, error) {
+	perms, _, err := s.store.ScanPermissions(ctx, storage.ListOptions{Prefix: ns.Name + "."})
+	if err != nil {
+		return nil, internalError(err, "failed to list permissions in storage")
+	}
+
+	owners := set.NewSet(ns.Owners...)
+	conflicts := []*model.Permission{}
+	for _, perm := range perms {
+		for _, owner := range perm.Owners {
+			if !owners.Has(owner) {
+				conflicts = append(conflicts, perm)
+				break
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// readNamespace returns a namespace, or an error if it does not exist
+func (s *service) readNamespace(ctx context.Context, name string) (*model.Namespace, error) {
+	ns, err := s.store.ReadNamespace(ctx, name)
+	if err != nil {
+		return nil, internalError(err, "failed to read namespace from storage")
+	}
+	if ns == nil {
+		return nil, newError(payloads.CodeNamespaceNotFound, "Namespace \"%s\" does not exist!", name)
+	}
+	return ns, nil
+}
+
+// readOwnedNamespace returns a namespace if it exists and the actor owns it
+func (s *service) readOwnedNamespace(ctx context.Context, actor, name string) (*model.Namespace, error) {
+	ns, err := s.readNamespace(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkOwner(ctx, actor, ns.Owners, model.PermissionNamespacesAdmin, "Only the owners of a namespace can modify the namespace"); err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// listNamespaces returns all namespaces, sorted by name
+func (s *service) listNamespaces(ctx context.Context) ([]*model.Namespace, error) {
+	namespaces, err := s.store.ListNamespaces(ctx)
+	if err != nil {
+		return nil, internalError(err, "failed to list namespaces in storage")
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Name < namespaces[j].Name })
+	return namespaces, nil
+}
+
+// addToNamespace adds owners to a namespace
+func (s *service) addToNamespace(ctx context.Context, actor, name string, pl *payloads.ModifyNamespaceRequest) (*model.Namespace, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+
+	defer s.locks.lock(lockNamespace, name)()
+
+	ns, err := s.readOwnedNamespace(ctx, actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkPrincipalsExist(ctx, pl.Owners); err != nil {
+		return nil, err
+	}
+
+	ns.Owners = set.NewSet(ns.Owners...).Add(pl.Owners...).Slice()
+	if err := s.store.UpdateNamespace(ctx, ns); err != nil {
+		return nil, internalError(err, "failed to update namespace in storage")
+	}
+
+	s.publish(events.New(events.NamespaceUpdated, name, actor))
+	return ns, nil
+}
+
+// removeFromNamespace removes owners from a namespace
+func (s *service) removeFromNamespace(ctx context.Context, actor, name string, pl *payloads.ModifyNamespaceRequest) (*model.Namespace, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+
+	if set.NewSet(pl.Owners...).Has(actor) {
+		return nil, newError(payloads.CodeCannotRemoveSelf, "Removing yourself as an owner is not allowed")
+	}
+
+	defer s.locks.lock(lockNamespace, name)()
+
+	ns, err := s.readOwnedNamespace(ctx, actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ns.Owners = set.NewSet(ns.Owners...).Remove(pl.Owners...).Slice()
+	if err := s.store.UpdateNamespace(ctx, ns); err != nil {
+		return nil, internalError(err, "failed to update namespace in storage")
+	}
+
+	s.publish(events.New(events.NamespaceUpdated, name, actor))
+	return ns, nil
+}
+
+// deleteNamespace deletes a namespace. The permissions in it are kept,
+// but anyone allowed to create permissions can create them in it again.
+func (s *service) deleteNamespace(ctx context.Context, actor, name string) error {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	defer s.locks.lock(lockNamespace, name)()
+
+	ns, err := s.store.ReadNamespace(ctx, name)
+	if err != nil {
+		return internalError(err, "failed to read namespace from storage")
+	}
+	if ns == nil { // (not in store already)
+		return nil
+	}
+
+	if err := s.checkOwner(ctx, actor, ns.Owners, model.PermissionNamespacesAdmin, "only the owners of a namespace can delete the namespace"); err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteNamespace(ctx, name); err != nil {
+		return internalError(err, "failed to delete namespace from storage")
+	}
+
+	s.publish(events.New(events.NamespaceDeleted, name, actor))
+	return nil
+}
+
+// namespaceOf returns the most specific namespace a name is in,
+// or nil if it is in no namespace
+func (s *service) namespaceOf(ctx context.Context, name string) (*model.Namespace, error) {
+	for _, candidate := range model.NamespaceCandidates(name) {
+		ns, err := s.store.ReadNamespace(ctx, candidate)
+		if err != nil {
+			return nil, internalError(err, "failed to read namespace from storage")
+		}
+		if ns != nil {
+			return ns, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkCanCreatePermission returns an error unless the actor may create a
+// permission with the given name. Only the owners of the namespace of a
+// permission may create it, permissions in no namespace can be created by
+// users with the model.PermissionPermissionsCreate meta-permission.
+func (s *service) checkCanCreatePermission(ctx context.Context, actor, name string) error {
+	ns, err := s.namespaceOf(ctx, name)
+	if err != nil {
+		return err
+	}
+	if ns == nil {
+		return s.checkMetaPermission(ctx, actor, model.PermissionPermissionsCreate, "Only users allowed to create permissions can create permissions")
+	}
+
+	reason := fmt.Sprintf("Only the owners of namespace \"%s\" can create permissions in it", ns.Name)
+	return s.checkOwner(ctx, actor, ns.Owners, model.PermissionNamespacesAdmin, reason)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+func TestCreateNamespace(t *testing.T) {
+	svc := newAdminTestService(t)
+	ctx := context.Background()
+
+	// top-level namespaces require the meta-permission even though
+	// creation is not restricted
+	if _, err := svc.createNamespace(ctx, "alice", &payloads.CreateNamespaceRequest{Name: "payments"}); !hasCode(err, payloads.CodeMissingPermission) {
+		t.Errorf("got error %v creating a top-level namespace as a non-admin, want %s", err, payloads.CodeMissingPermission)
+	}
+	if _, err := svc.createNamespace(ctx, "dave", &payloads.CreateNamespaceRequest{Name: "payments", Owners: []string{"alice"}}); err != nil {
+		t.Fatalf("failed to create namespace as an admin: %s", err)
+	}
+
+	// only the owners of a namespace create permissions and namespaces in it
+	if _, err := svc.createPermission(ctx, "bob", &payloads.CreatePermissionRequest{Name: "payments.read"}, false); !hasCode(err, payloads.CodeNotOwner) {
+		t.Errorf("got error %v creating a permission in someone else's namespace, want %s", err, payloads.CodeNotOwner)
+	}
+	if _, err := svc.createPermission(ctx, "alice", &payloads.CreatePermissionRequest{Name: "payments.read"}, false); err != nil {
+		t.Errorf("failed to create a permission in an owned namespace: %s", err)
+	}
+	if _, err := svc.createNamespace(ctx, "bob", &payloads.CreateNamespaceRequest{Name: "payments.loans"}); !hasCode(err, payloads.CodeNotOwner) {
+		t.Errorf("got error %v creating a namespace in someone else's namespace, want %s", err, payloads.CodeNotOwner)
+	}
+	if _, err := svc.createNamespace(ctx, "alice", &payloads.CreateNamespaceRequest{Name: "payments.loans"}); err != nil {
+		t.Errorf("failed to create a namespace in an owned namespace: %s", err)
+	}
+	if _, err := svc.createNamespace(ctx, "alice", &payloads.CreateNamespaceRequest{Name: "payments.loans"}); !hasCode(err, payloads.CodeNamespaceExists) {
+		t.Errorf("got error %v creating an existing namespace, want %s", err, payloads.CodeNamespaceExists)
+	}
+}
+
+func TestNamespaceTakeover(t *testing.T) {
+	svc := newAdminTestService(t)
+	ctx := context.Background()
+
+	// bob owns a permission in a namespace alice creates
+	if _, err := svc.createNamespace(ctx, "dave", &payloads.CreateNamespaceRequest{Name: "payments", Owners: []string{"alice"}}); err != nil {
+		t.Fatalf("failed to create namespace: %s", err)
+	}
+	if _, err := svc.createPermission(ctx, "alice", &payloads.CreatePermissionRequest{Name: "payments.cards.read"}, false); err != nil {
+		t.Fatalf("failed to create permission: %s", err)
+	}
+	if _, err := svc.transferPermission(ctx, "alice", "payments.cards.read", &payloads.TransferOwnershipRequest{To: []string{"bob"}, Exclusive: true}, false); err != nil {
+		t.Fatalf("failed to transfer permission: %s", err)
+	}
+
+	nested := &payloads.CreateNamespaceRequest{Name: "payments.cards"}
+	if _, err := svc.createNamespace(ctx, "alice", nested); !hasCode(err, payloads.CodeNamespaceConflict) {
+		t.Errorf("got error %v creating a namespace around someone else's permission, want %s", err, payloads.CodeNamespaceConflict)
+	}
+	nested.Takeover = true
+	if _, err := svc.createNamespace(ctx, "alice", nested); !hasCode(err, payloads.CodeNotOwner) {
+		t.Errorf("got error %v taking over someone else's permission, want %s", err, payloads.CodeNotOwner)
+	}
+	if _, err := svc.readNamespace(ctx, "payments.cards"); !hasCode(err, payloads.CodeNamespaceNotFound) {
+		t.Errorf("got error %v, want the namespace not created when the takeover fails", err)
+	}
+
+	// admins take over permissions they don't own
+	if _, err := svc.createPermission(ctx, "bob", &payloads.CreatePermissionRequest{Name: "billing.read"}, false); err != nil {
+		t.Fatalf("failed to create permission: %s", err)
+	}
+	if _, err := svc.createNamespace(ctx, "dave", &payloads.CreateNamespaceRequest{Name: "billing", Owners: []string{"alice"}, Takeover: true}); err != nil {
+		t.Fatalf("failed to take over permission as an admin: %s", err)
+	}
+	perm, err := svc.readPermission(ctx, "billing.read")
+	if err != nil {
+		t.Fatalf("failed to read permission: %s", err)
+	}
+	sort.Strings(perm.Owners)
+	if len(perm.Owners) != 2 || perm.Owners[0] != "alice" || perm.Owners[1] != "dave" {
+		t.Errorf("got owners %v, want the owners of the namespace", perm.Owners)
+	}
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/manifest"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/openapi"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/snapshot"
+	"github.com/adrianosela/rbac/api/webhooks"
+	"github.com/gorilla/mux"
+)
+
+// apiVersion is the version of the API in the OpenAPI document
+const apiVersion = "1.0.0"
+
+// routeSpec describes a route for the OpenAPI document
+type routeSpec struct {
+	id       string
+	summary  string
+	tag      string
+	auth     bool
+	dryRun   bool        // accepts ?dry_run=true, which returns a payloads.DryRunResponse
+	query    []string    // names of query parameters, with descriptions after a colon
+	request  interface{} // type of the JSON request body, if any
+	response interface{} // type of the JSON response body, plain text if nil
+	stream   bool        // responds with a text/event-stream
+}
+
+var listQuery = []string{
+	"prefix:only names starting with this",
+	"contains:only names containing this, case insensitive",
+	"owner:only objects owned by this user",
+	"cursor:next_cursor of the previous page",
+	"limit:maximum number of results, 1 to 1000, defaults to 50",
+}
+
+// routeSpecs holds the description of every route, by method and path template.
+// Every registered route must have an entry, which is checked when the service starts.
+var routeSpecs = map[string]routeSpec{
+	"GET /healthcheck": {id: "healthcheck", summary: "Check that the service is alive", tag: "debug"},
+	"GET /readyz": {id: "readyz", summary: "Check that storage and the groups source are reachable, responds 503 when not", tag: "debug",
+		response: payloads.ReadinessResponse{}},
+	"GET /authcheck": {id: "authcheck", summary: "Check that the caller is authenticated", tag: "debug", auth: true},
+	"GET /openapi.json": {id: "getOpenAPI", summary: "Get this OpenAPI document", tag: "debug",
+		response: map[string]interface{}{}},
+	"GET /metrics": {id: "getMetrics", summary: "Get metrics in the Prometheus text format", tag: "debug"},
+
+	"POST /permission":                  {id: "createPermission", summary: "Create a permission owned by the caller", tag: "permissions", auth: true, dryRun: true, request: payloads.CreatePermissionRequest{}},
+	"GET /permission/{name}":            {id: "getPermission", summary: "Get a permission", tag: "permissions", response: model.Permission{}},
+	"GET /permissions":                  {id: "listPermissions", summary: "List and search permissions", tag: "permissions", query: listQuery, response: payloads.ListPermissionsResponse{}},
+	"PATCH /permission/{name}":          {id: "updatePermission", summary: "Update the description of a permission", tag: "permissions", auth: true, dryRun: true, request: payloads.GenericUpdateDescriptionRequest{}},
+	"PATCH /permission/{name}/add":      {id: "addToPermission", summary: "Add owners to a permission", tag: "permissions", auth: true, dryRun: true, request: payloads.ModifyPermissionRequest{}},
+	"PATCH /permission/{name}/remove":   {id: "removeFromPermission", summary: "Remove owners from a permission", tag: "permissions", auth: true, dryRun: true, request: payloads.ModifyPermissionRequest{}},
+	"PATCH /permission/{name}/transfer": {id: "transferPermission", summary: "Hand a permission over to new owners", tag: "permissions", auth: true, dryRun: true, request: payloads.TransferOwnershipRequest{}},
+	"DELETE /permission/{name}":         {id: "deletePermission", summary: "Delete a permission which is not in use", tag: "permissions", auth: true, dryRun: true},
+
+	"POST /namespace":                {id: "createNamespace", summary: "Create a permission namespace owned by the caller", tag: "namespaces", auth: true, request: payloads.CreateNamespaceRequest{}},
+	"GET /namespace/{name}":          {id: "getNamespace", summary: "Get a permission namespace", tag: "namespaces", response: model.Namespace{}},
+	"GET /namespaces":                {id: "listNamespaces", summary: "List permission namespaces", tag: "namespaces", response: payloads.ListNamespacesResponse{}},
+	"PATCH /namespace/{name}/add":    {id: "addToNamespace", summary: "Add owners to a permission namespace", tag: "namespaces", auth: true, request: payloads.ModifyNamespaceRequest{}},
+	"PATCH /namespace/{name}/remove": {id: "removeFromNamespace", summary: "Remove owners from a permission namespace", tag: "namespaces", auth: true, request: payloads.ModifyNamespaceRequest{}},
+	"DELETE /namespace/{name}":       {id: "deleteNamespace", summary: "Delete a permission namespace, keeping the permissions in it", tag: "namespaces", auth: true},
+
+	"POST /role":         {id: "createRole", summary: "Create a role owned by the caller", tag: "roles", auth: true, dryRun: true, request: payloads.CreateRoleRequest{}},
+	"GET /role/{name}":   {id: "getRole", summary: "Get a role", tag: "roles", response: model.Role{}},
+	"GET /roles":         {id: "listRoles", summary: "List and search roles", tag: "roles", response: payloads.ListRolesResponse{}, query: append(append([]string{}, listQuery...), "user:only roles bound to this user", "group:only roles bound to this group", "permission:only roles with this permission")},
+	"PATCH /role/{name}": {id: "updateRole", summary: "Update the description of a role", tag: "roles", auth: true, dryRun: true, request: payloads.GenericUpdateDescriptionRequest{}},
+	"PATCH /role/{name}/add": {id: "addToRole", summary: "Add permissions, users, groups, or owners to a role", tag: "roles", auth: true, dryRun: true,
+		request: payloads.ModifyRoleRequest{}},
+	"PATCH /role/{name}/remove": {id: "removeFromRole", summary: "Remove permissions, users, groups, or owners from a role", tag: "roles", auth: true, dryRun: true,
+		request: payloads.ModifyRoleRequest{}},
+	"PATCH /role/{name}/transfer": {id: "transferRole", summary: "Hand a role over to new owners", tag: "roles", auth: true, dryRun: true, request: payloads.TransferOwnershipRequest{}},
+	"DELETE /role/{name}":         {id: "deleteRole", summary: "Delete a role and all its bindings", tag: "roles", auth: true, dryRun: true},
+
+	"GET /user/{name}":       {id: "getUserPermissions", summary: "Get the effective permissions of a user", tag: "users", response: payloads.GetUserPermissionsResponse{}},
+	"GET /user/{name}/roles": {id: "getUserRoles", summary: "Get the direct, group, and effective roles of a user", tag: "users", response: payloads.GetUserRolesResponse{}},
+
+	"GET /group/{id}":               {id: "getGroup", summary: "Get a group and the roles bound to it", tag: "groups", response: model.Group{}},
+	"GET /group/{id}/members-roles": {id: "getGroupMembersRoles", summary: "Get the roles and permissions members of a group receive through it", tag: "groups", response: payloads.GetGroupMembersRolesResponse{}},
+
+	"POST /serviceaccount":                        {id: "createServiceAccount", summary: "Create a service account owned by the caller", tag: "service accounts", auth: true, request: payloads.CreateServiceAccountRequest{}},
+	"GET /serviceaccount/{name}":                  {id: "getServiceAccount", summary: "Get a service account and the metadata of its API keys", tag: "service accounts", response: model.ServiceAccount{}},
+	"DELETE /serviceaccount/{name}":               {id: "deleteServiceAccount", summary: "Delete a service account which is not in use", tag: "service accounts", auth: true},
+	"POST /serviceaccount/{name}/key":             {id: "createAPIKey", summary: "Create an API key for a service account", tag: "service accounts", auth: true, request: payloads.CreateAPIKeyRequest{}, response: payloads.CreateAPIKeyResponse{}},
+	"POST /serviceaccount/{name}/key/{id}/rotate": {id: "rotateAPIKey", summary: "Replace an API key of a service account", tag: "service accounts", auth: true, request: payloads.RotateAPIKeyRequest{}, response: payloads.CreateAPIKeyResponse{}},
+	"DELETE /serviceaccount/{name}/key/{id}":      {id: "revokeAPIKey", summary: "Revoke an API key of a service account", tag: "service accounts", auth: true},
+
+	"GET /orphans": {id: "listOrphans", summary: "List roles and permissions none of whose owners resolve, for admins", tag: "ownership", auth: true, response: payloads.OrphansResponse{}},
+	"POST /orphans/reassign": {id: "reassignOrphans", summary: "Make a fallback owner the owner of every orphaned role and permission", tag: "ownership", auth: true, dryRun: true,
+		request: payloads.ReassignOrphansRequest{}, response: payloads.OrphansResponse{}},
+
+	"POST /webhook":                 {id: "createWebhook", summary: "Register a webhook owned by the caller", tag: "webhooks", auth: true, request: payloads.CreateWebhookRequest{}, response: webhooks.Subscription{}},
+	"GET /webhook/{id}":             {id: "getWebhook", summary: "Get a webhook", tag: "webhooks", auth: true, response: webhooks.Subscription{}},
+	"GET /webhook/{id}/deadletters": {id: "getWebhookDeadLetters", summary: "Get the abandoned deliveries of a webhook", tag: "webhooks", auth: true, response: []webhooks.DeadLetter{}},
+	"DELETE /webhook/{id}":          {id: "deleteWebhook", summary: "Delete a webhook", tag: "webhooks", auth: true},
+
+	"GET /watch": {id: "watch", summary: "Stream change events as server-sent events", tag: "events", auth: true, stream: true,
+		query: []string{"revision:resume after this revision, defaults to the current revision"}, response: events.Event{}},
+
+	"POST /apply": {id: "apply", summary: "Converge to the state described by a manifest", tag: "manifests", auth: true,
+		query: []string{"prune:delete owned or administered objects missing from the manifest", "dry_run:only return the planned changes"}, request: manifest.Manifest{}, response: payloads.ApplyResponse{}},
+
+	"GET /admin/export": {id: "export", summary: "Export a snapshot of all data", tag: "admin", auth: true, response: snapshot.Snapshot{}},
+	"POST /admin/import": {id: "import", summary: "Import a snapshot of all data", tag: "admin", auth: true,
+		query: []string{"mode:\"replace\" or \"merge\", defaults to \"merge\""}, request: snapshot.Snapshot{}},
+}
+
+var pathParamRegexp = regexp.MustCompile(`\{([^}]+)\}`)
+
+func (s *service) setOpenAPIEndpoints() {
+	s.router.Methods(http.MethodGet).Path("/openapi.json").HandlerFunc(s.openAPIHandler)
+}
+
+func (s *service) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(s.openAPI)
+	return
+}
+
+// buildOpenAPI builds the OpenAPI document of every route in the router.
+// Routes missing from routeSpecs are left out of the document, and are
+// reported in the error along with entries of routeSpecs which are not
+// routes. The document is complete when the error is nil.
+func buildOpenAPI(router *mux.Router) (*openapi.Document, error) {
+	doc := openapi.NewDocument("RBAC", apiVersion)
+	doc.Components.SecuritySchemes = map[string]*openapi.SecurityScheme{
+		"user": {Type: "apiKey", In: "header", Name: "MOCK_AUTHENTICATED_USER", Description: "the authenticated user"},
+	}
+	errorSchema := doc.SchemaFor(payloads.ErrorResponse{})
+
+	problems := []string{}
+	documented := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil // (not an endpoint)
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("route %s has no methods", path))
+			return nil
+		}
+		for _, method := range methods {
+			key := fmt.Sprintf("%s %s", method, path)
+			spec, ok := routeSpecs[key]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("route %s has no OpenAPI spec entry, add one to routeSpecs", key))
+				continue
+			}
+			documented[key] = true
+
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = &openapi.PathItem{}
+			}
+			(*doc.Paths[path])[strings.ToLower(method)] = spec.operation(doc, path, errorSchema)
+		}
+		return nil
+	})
+	if err != nil {
+		return doc, err
+	}
+
+	stale := []string{}
+	for key := range routeSpecs {
+		if !documented[key] {
+			stale = append(stale, key)
+		}
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		problems = append(problems, fmt.Sprintf("routeSpecs has entries for routes which do not exist: %v", stale))
+	}
+	if len(problems) > 0 {
+		return doc, errors.New(strings.Join(problems, "; "))
+	}
+	return doc, nil
+}
+
+func (spec routeSpec) operation(doc *openapi.Document, path string, errorSchema *openapi.Schema) *openapi.Operation {
+	op := &openapi.Operation{
+		OperationID: spec.id,
+		Summary:     spec.summary,
+		Tags:        []string{spec.tag},
+		Responses: map[string]*openapi.Response{
+			"default": {
+				Description: "error",
+				Content:     map[string]*openapi.MediaType{"application/json": {Schema: errorSchema}},
+			},
+		},
+	}
+	if spec.auth {
+		op.Security = []map[string][]string{{"user": {}}}
+	}
+
+	for _, match := range pathParamRegexp.FindAllStringSubmatch(path, -1) {
+		op.Parameters = append(op.Parameters, openapi.Parameter{Name: match[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}})
+	}
+	query := spec.query
+	if spec.dryRun {
+		query = append(append([]string{}, query...), "dry_run:only compute the effects of the request, without making changes")
+	}
+	for _, q := range query {
+		parts := strings.SplitN(q, ":", 2)
+		op.Parameters = append(op.Parameters, openapi.Parameter{Name: parts[0], In: "query", Description: parts[1], Schema: &openapi.Schema{Type: "string"}})
+	}
+
+	if spec.request != nil {
+		op.RequestBody = &openapi.RequestBody{
+			Required: true,
+			Content:  map[string]*openapi.MediaType{"application/json": {Schema: doc.SchemaFor(spec.request)}},
+		}
+	}
+
+	ok := &openapi.Response{Description: "success", Content: map[string]*openapi.MediaType{}}
+	switch {
+	case spec.stream:
+		ok.Description = "a stream of server-sent events, each with a JSON event as data"
+		ok.Content["text/event-stream"] = &openapi.MediaType{Schema: doc.SchemaFor(spec.response)}
+	case spec.response != nil:
+		ok.Content["application/json"] = &openapi.MediaType{Schema: doc.SchemaFor(spec.response)}
+	default:
+		ok.Content["text/plain"] = &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}}
+	}
+	if spec.dryRun {
+		ok.Description = "success, or the effects of the request for a dry run"
+		ok.Content["application/json"] = &openapi.MediaType{Schema: doc.SchemaFor(payloads.DryRunResponse{})}
+	}
+	op.Responses["200"] = ok
+	return op
+}
+
+// encodeOpenAPI returns the JSON encoding of the OpenAPI document of a
+// router. Routes missing from routeSpecs are logged rather than failing
+// the service, openapi_test.go makes sure there are none.
+func encodeOpenAPI(router *mux.Router, logger *slog.Logger) ([]byte, error) {
+	doc, err := buildOpenAPI(router)
+	if err != nil {
+		logger.Warn("OpenAPI document is incomplete", slog.String("error", err.Error()))
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
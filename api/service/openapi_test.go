@@ -0,0 +1,22 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/adrianosela/rbac/api/groups"
+)
+
+func TestOpenAPICoversEveryRoute(t *testing.T) {
+	svc, err := newService(Config{Groups: groups.NewMemorySource(map[string][]string{})})
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+
+	doc, err := buildOpenAPI(svc.router)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Paths) == 0 {
+		t.Error("OpenAPI document has no paths")
+	}
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// transferOwners returns the owners after a transfer of ownership by the actor
+func transferOwners(owners []string, actor string, pl *payloads.TransferOwnershipRequest) []string {
+	after := set.NewSet(owners...).Remove(actor)
+	if pl.Exclusive {
+		after = set.NewSet()
+	}
+	return after.Add(pl.To...).Slice()
+}
+
+// checkTransfer returns an error unless the actor may make a transfer of
+// ownership. Exclusive transfers remove every other owner, so only admins
+// can make them unless the actor is the only owner.
+func (s *service) checkTransfer(ctx context.Context, actor string, owners []string, admin string, pl *payloads.TransferOwnershipRequest) error {
+	if !pl.Exclusive || (len(owners) == 1 && owners[0] == actor) {
+		return nil
+	}
+	return s.checkMetaPermission(ctx, actor, admin, "Only admins can exclusively transfer objects with other owners")
+}
+
+// listOrphans returns the orphaned roles and permissions. Finding them looks
+// up every owner, so the actor must be an admin of both.
+func (s *service) listOrphans(ctx context.Context, actor string) (*payloads.OrphansResponse, error) {
+	if err := s.checkOrphansAdmin(ctx, actor); err != nil {
+		return nil, err
+	}
+	return s.findOrphans(ctx)
+}
+
+// checkOrphansAdmin returns an error unless the actor is an admin of every role and permission
+func (s *service) checkOrphansAdmin(ctx context.Context, actor string) error {
+	if err := s.checkMetaPermission(ctx, actor, model.PermissionRolesAdmin, "Only role admins can manage orphaned roles"); err != nil {
+		return err
+	}
+	return s.checkMetaPermission(ctx, actor, model.PermissionPermissionsAdmin, "Only permission admins can manage orphaned permissions")
+}
+
+// findOrphans returns the roles and permissions none of whose owners
+// resolve, e.g. because they were all deactivated in the directory
+func (s *service) findOrphans(ctx context.Context) (*payloads.OrphansResponse, error) {
+	roles, err := s.store.ListRoles(ctx)
+	if err != nil {
+		return nil, internalError(err, "failed to list roles in storage")
+	}
+	perms, err := s.store.ListPermissions(ctx)
+	if err != nil {
+		return nil, internalError(err, "failed to list permissions in storage")
+	}
+
+	// owners are often shared, so each is only looked up once
+	resolved := make(map[string]bool)
+	isOrphan := func(owners []string) (bool, error) {
+		for _, owner := range owners {
+			ok, seen := resolved[owner]
+			if !seen {
+				var err error
+				if ok, err = s.ownerResolves(ctx, owner); err != nil {
+					return false, err
+				}
+				resolved[owner] = ok
+			}
+			if ok {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	resp := &payloads.OrphansResponse{Roles: []payloads.Orphan{}, Permissions: []payloads.Orphan{}}
+	for _, role := range roles {
+		orphan, err := isOrphan(role.Owners)
+		if err != nil {
+			return nil, err
+		}
+		if orphan {
+			resp.Roles = append(resp.Roles, payloads.Orphan{Name: role.Name, Owners: role.Owners})
+		}
+	}
+	for _, perm := range perms {
+		orphan, err := isOrphan(perm.Owners)
+		if err != nil {
+			return nil, err
+		}
+		if orphan {
+			resp.Permissions = append(resp.Permissions, payloads.Orphan{Name: perm.Name, Owners: perm.Owners})
+		}
+	}
+
+	sort.Slice(resp.Roles, func(i, j int) bool { return resp.Roles[i].Name < resp.Roles[j].Name })
+	sort.Slice(resp.Permissions, func(i, j int) bool { return resp.Permissions[i].Name < resp.Permissions[j].Name })
+	return resp, nil
+}
+
+// ownerResolves returns whether an owner still refers to someone. Users must
+// be active in the groups source, and service accounts and roles must exist.
+// Groups always resolve, since the groups source can't look them up.
+func (s *service) ownerResolves(ctx context.Context, owner string) (bool, error) {
+	if name, ok := model.ServiceAccountName(owner); ok {
+		sa, err := s.store.ReadServiceAccount(ctx, name)
+		if err != nil {
+			return false, internalError(err, "failed to read service account from storage")
+		}
+		return sa != nil, nil
+	}
+	if name, ok := model.OwnerRole(owner); ok {
+		role, err := s.store.ReadRole(ctx, name)
+		if err != nil {
+			return false, internalError(err, "failed to read role from storage")
+		}
+		return role != nil, nil
+	}
+	if _, ok := model.OwnerGroup(owner); ok {
+		return true, nil
+	}
+
+	active, err := s.groups.UserActive(ctx, owner)
+	if err != nil {
+		return false, internalError(err, "failed to look up owner in the groups source")
+	}
+	return active, nil
+}
+
+// reassignOrphans makes the fallback owner the only owner of every orphaned
+// role and permission, and returns what was orphaned. Since it may change
+// any role and permission, the actor must be an admin of both.
+func (s *service) reassignOrphans(ctx context.Context, actor string, pl *payloads.ReassignOrphansRequest, dryRun bool) (*payloads.OrphansResponse, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+
+	if err := s.checkOrphansAdmin(ctx, actor); err != nil {
+		return nil, err
+	}
+
+	fallback := []string{pl.Owner}
+	if err := s.checkPrincipalsExist(ctx, fallback); err != nil {
+		return nil, err
+	}
+	if ok, err := s.ownerResolves(ctx, pl.Owner); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, newError(payloads.CodeInvalidRequest, "Fallback owner \"%s\" does not resolve either", pl.Owner)
+	}
+
+	orphans, err := s.findOrphans(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return orphans, nil
+	}
+
+	roles, perms := []string{}, []string{}
+	for _, orphan := range orphans.Roles {
+		roles = append(roles, orphan.Name)
+	}
+	for _, orphan := range orphans.Permissions {
+		perms = append(perms, orphan.Name)
+	}
+	defer s.locks.lock(lockRole, roles...)()
+	defer s.locks.lock(lockPermission, perms...)()
+
+	for _, orphan := range orphans.Roles {
+		role, err := s.store.ReadRole(ctx, orphan.Name)
+		if err != nil {
+			return nil, internalError(err, "failed to read role from storage")
+		}
+		if role == nil { // (deleted since)
+			continue
+		}
+		role.Owners = fallback
+		if err := s.store.UpdateRole(ctx, role); err != nil {
+			return nil, internalError(err, "failed to update role in storage")
+		}
+		s.publish(events.New(events.RoleUpdated, role.Name, actor))
+	}
+	for _, orphan := range orphans.Permissions {
+		perm, err := s.store.ReadPermission(ctx, orphan.Name)
+		if err != nil {
+			return nil, internalError(err, "failed to read permission from storage")
+		}
+		if perm == nil { // (deleted since)
+			continue
+		}
+		perm.Owners = fallback
+		if err := s.store.UpdatePermission(ctx, perm); err != nil {
+			return nil, internalError(err, "failed to update permission in storage")
+		}
+		s.publish(events.New(events.PermissionUpdated, perm.Name, actor))
+	}
+	return orphans, nil
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+func (s *service) setOrphanEndpoints() {
+	s.router.Methods(http.MethodGet).Path("/orphans").Handler(s.auth(s.orphansHandler))
+	s.router.Methods(http.MethodPost).Path("/orphans/reassign").Handler(s.auth(s.reassignOrphansHandler)) // ?dry_run
+}
+
+func (s *service) orphansHandler(w http.ResponseWriter, r *http.Request) {
+	orphans, err := s.listOrphans(r.Context(), getAuthenticatedUser(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeOrphans(w, r, orphans)
+}
+
+func (s *service) reassignOrphansHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	var pl *payloads.ReassignOrphansRequest
+	if err := unmarshalRequestBody(r, &pl); err != nil {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not an orphan reassignment: %s", err))
+		return
+	}
+
+	orphans, err := s.reassignOrphans(r.Context(), authenticatedUser, pl, dryRun)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	logFields(r.Context(), slog.Int("roles", len(orphans.Roles)), slog.Int("permissions", len(orphans.Permissions)), slog.Bool("dry_run", dryRun))
+
+	writeOrphans(w, r, orphans)
+}
+
+// writeOrphans writes the response listing orphaned roles and permissions
+func writeOrphans(w http.ResponseWriter, r *http.Request, orphans *payloads.OrphansResponse) {
+	respBytes, err := json.Marshal(orphans)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+}
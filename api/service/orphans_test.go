@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// newAdminTestService returns a service like newTestService,
+// where dave is an admin
+func newAdminTestService(t *testing.T) *service {
+	t.Helper()
+
+	svc, err := newService(Config{
+		Groups: groups.NewMemorySource(map[string][]string{"alice": {"eng"}, "bob": {"eng"}, "carol": {}, "dave": {}}),
+		Admins: []string{"dave"},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	return svc
+}
+
+func TestOrphans(t *testing.T) {
+	svc := newAdminTestService(t)
+	ctx := context.Background()
+
+	// owned by someone who left, and by a group which always resolves
+	if _, err := svc.createRole(ctx, "alice", &payloads.CreateRoleRequest{Name: "abandoned"}, false); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+	if _, err := svc.transferRole(ctx, "alice", "abandoned", &payloads.TransferOwnershipRequest{To: []string{"mallory"}}, false); err != nil {
+		t.Fatalf("failed to transfer role: %s", err)
+	}
+	if _, err := svc.createRole(ctx, "alice", &payloads.CreateRoleRequest{Name: "eng-owned", Owners: []string{"group:eng"}}, false); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+
+	if status, code := httpCode(t, svc, "alice", http.MethodGet, "/orphans", nil); status != http.StatusForbidden || code != payloads.CodeMissingPermission {
+		t.Errorf("got %d %s listing orphans as a non-admin, want %d %s", status, code, http.StatusForbidden, payloads.CodeMissingPermission)
+	}
+	orphans, err := svc.listOrphans(ctx, "dave")
+	if err != nil {
+		t.Fatalf("failed to list orphans: %s", err)
+	}
+	if len(orphans.Roles) != 1 || orphans.Roles[0].Name != "abandoned" || len(orphans.Permissions) != 0 {
+		t.Errorf("got orphans %+v, want the abandoned role", orphans)
+	}
+
+	if _, err := svc.reassignOrphans(ctx, "alice", &payloads.ReassignOrphansRequest{Owner: "alice"}, false); !hasCode(err, payloads.CodeMissingPermission) {
+		t.Errorf("got error %v reassigning orphans as a non-admin, want %s", err, payloads.CodeMissingPermission)
+	}
+	if _, err := svc.reassignOrphans(ctx, "dave", &payloads.ReassignOrphansRequest{Owner: "mallory"}, false); !hasCode(err, payloads.CodeInvalidRequest) {
+		t.Errorf("got error %v reassigning orphans to an owner who left, want %s", err, payloads.CodeInvalidRequest)
+	}
+	if _, err := svc.reassignOrphans(ctx, "dave", &payloads.ReassignOrphansRequest{Owner: "carol"}, false); err != nil {
+		t.Fatalf("failed to reassign orphans: %s", err)
+	}
+	role, err := svc.readRole(ctx, "abandoned")
+	if err != nil || strings.Join(role.Owners, ",") != "carol" {
+		t.Errorf("got role %+v, %v, want it owned by the fallback owner", role, err)
+	}
+}
+
+func TestExclusiveTransfer(t *testing.T) {
+	svc := newAdminTestService(t)
+	ctx := context.Background()
+
+	for _, role := range []payloads.CreateRoleRequest{
+		{Name: "shared", Owners: []string{"bob"}},
+		{Name: "alices"},
+	} {
+		if _, err := svc.createRole(ctx, "alice", &role, false); err != nil {
+			t.Fatalf("failed to create role %s: %s", role.Name, err)
+		}
+	}
+	exclusive := &payloads.TransferOwnershipRequest{To: []string{"carol"}, Exclusive: true}
+
+	if _, err := svc.transferRole(ctx, "bob", "shared", exclusive, false); !hasCode(err, payloads.CodeMissingPermission) {
+		t.Errorf("got error %v for a co-owner removing the other owners, want %s", err, payloads.CodeMissingPermission)
+	}
+	if role, err := svc.transferRole(ctx, "bob", "shared", &payloads.TransferOwnershipRequest{To: []string{"carol"}}, true); err != nil || len(role.Owners) != 2 || set.NewSet(role.Owners...).Has("bob") {
+		t.Errorf("got role %+v, %v, want bob replaced by carol", role, err)
+	}
+	if role, err := svc.transferRole(ctx, "alice", "alices", exclusive, false); err != nil || strings.Join(role.Owners, ",") != "carol" {
+		t.Errorf("got role %+v, %v, want the only owner allowed to transfer exclusively", role, err)
+	}
+	if role, err := svc.transferRole(ctx, "dave", "shared", exclusive, false); err != nil || strings.Join(role.Owners, ",") != "carol" {
+		t.Errorf("got role %+v, %v, want an admin allowed to transfer exclusively", role, err)
+	}
+}
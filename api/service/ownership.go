@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/resolver"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// checkOwner returns an error with the reason unless the actor is one of the
+// owners of an object, or has the admin meta-permission which overrides
+// ownership of such objects. Every ownership check goes through here.
+func (s *service) checkOwner(ctx context.Context, actor string, owners []string, admin, reason string) error {
+	owns, err := s.isOwner(ctx, actor, owners)
+	if err != nil {
+		return err
+	}
+	if owns {
+		return nil
+	}
+
+	isAdmin, err := s.hasPermission(ctx, actor, admin)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return newError(payloads.CodeNotOwner, "%s. User \"%s\" not in %v and lacks permission \"%s\".", reason, actor, owners, admin)
+	}
+	return nil
+}
+
+// checkMetaPermission returns an error with the reason unless the actor has
+// the meta-permission. The create meta-permissions are only enforced when
+// the service restricts creation.
+func (s *service) checkMetaPermission(ctx context.Context, actor, permission, reason string) error {
+	if !s.restrictCreation && set.NewSet(model.CreatePermissions...).Has(permission) {
+		return nil
+	}
+
+	allowed, err := s.hasPermission(ctx, actor, permission)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return newError(payloads.CodeMissingPermission, "%s. User \"%s\" lacks permission \"%s\".", reason, actor, permission)
+	}
+	return nil
+}
+
+// hasPermission returns whether the actor has a permission. Unlike check,
+// it is for the service's own decisions, which are not counted in metrics.
+func (s *service) hasPermission(ctx context.Context, actor, permission string) (bool, error) {
+	roles, err := s.actorRoles(ctx, actor)
+	if err != nil {
+		return false, err
+	}
+	perms, err := resolver.RolePermissions(ctx, s.store, roles.Effective(), nil)
+	if err != nil {
+		return false, internalError(err, "failed to resolve permissions for user")
+	}
+	return perms.Has(permission), nil
+}
+
+// actorRoles returns the roles of the actor for the service's own decisions.
+// Actors unknown to the groups source are in no groups, so that they are
+// denied for lacking ownership or permissions rather than failing.
+func (s *service) actorRoles(ctx context.Context, actor string) (*resolver.Roles, error) {
+	roles, err := resolver.ResolveRoles(ctx, s.store, s.groups, actor)
+	if errors.Is(err, groups.ErrUserNotFound) {
+		roles, err = resolver.ResolveRolesInGroups(ctx, s.store, actor, []string{})
+	}
+	if err != nil {
+		return nil, internalError(err, "failed to resolve groups and roles of user")
+	}
+	return roles, nil
+}
+
+// isOwner returns whether the actor is one of the owners, either directly,
+// as a member of an owner group, or by having an owner role
+func (s *service) isOwner(ctx context.Context, actor string, owners []string) (bool, error) {
+	ownerGroups, ownerRoles := set.NewSet(), set.NewSet()
+	for _, owner := range owners {
+		if owner == actor {
+			return true, nil
+		}
+		if id, ok := model.OwnerGroup(owner); ok {
+			ownerGroups.Add(id)
+		} else if name, ok := model.OwnerRole(owner); ok {
+			ownerRoles.Add(name)
+		}
+	}
+	if len(ownerGroups) == 0 && len(ownerRoles) == 0 {
+		return false, nil
+	}
+
+	// only resolve the actor when the owners call for it
+	roles, err := s.actorRoles(ctx, actor)
+	if err != nil {
+		return false, err
+	}
+	for _, group := range roles.Groups {
+		if ownerGroups.Has(group) {
+			return true, nil
+		}
+	}
+	for role := range roles.Effective() {
+		if ownerRoles.Has(role) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkPrincipalsExist returns an error unless every service account and
+// role among the principals exists, so that roles and ownership can't be
+// granted to a service account or role which someone could create later
+func (s *service) checkPrincipalsExist(ctx context.Context, principals []string) error {
+	for _, principal := range principals {
+		if name, ok := model.ServiceAccountName(principal); ok {
+			if _, err := s.readServiceAccount(ctx, name); err != nil {
+				return err
+			}
+		}
+		if name, ok := model.OwnerRole(principal); ok {
+			if _, err := s.readRole(ctx, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
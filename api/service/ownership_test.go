@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+func TestOwnership(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	// carol leads through a role, alice and bob are in the eng group
+	for _, role := range []payloads.CreateRoleRequest{
+		{Name: "leads", Users: []string{"carol"}},
+		{Name: "eng-owned", Owners: []string{"group:eng"}},
+		{Name: "leads-owned", Owners: []string{"role:leads"}},
+	} {
+		if _, err := svc.createRole(ctx, "alice", &role, false); err != nil {
+			t.Fatalf("failed to create role %s: %s", role.Name, err)
+		}
+	}
+	if _, err := svc.createPermission(ctx, "alice", &payloads.CreatePermissionRequest{Name: "docs.read", Owners: []string{"role:leads"}}, false); err != nil {
+		t.Fatalf("failed to create permission: %s", err)
+	}
+
+	tests := []struct {
+		name  string
+		actor string
+		role  string
+		code  string
+	}{
+		{"direct owner", "alice", "leads", ""},
+		{"not an owner", "bob", "leads", payloads.CodeNotOwner},
+		{"member of owner group", "bob", "eng-owned", ""},
+		{"not in owner group", "carol", "eng-owned", payloads.CodeNotOwner},
+		{"bound to owner role", "carol", "leads-owned", ""},
+		{"not bound to owner role", "bob", "leads-owned", payloads.CodeNotOwner},
+		{"unknown to the groups source", "mallory", "leads", payloads.CodeNotOwner},
+		{"unknown to the groups source with owner group", "mallory", "eng-owned", payloads.CodeNotOwner},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := svc.updateRole(ctx, test.actor, test.role, &payloads.GenericUpdateDescriptionRequest{Description: "updated"}, true)
+			if test.code == "" && err != nil {
+				t.Errorf("got error %s, want the owner allowed", err)
+			}
+			if test.code != "" && !hasCode(err, test.code) {
+				t.Errorf("got error %v, want %s", err, test.code)
+			}
+		})
+	}
+
+	// the owner role grants ownership of permissions too
+	if _, err := svc.updatePermission(ctx, "carol", "docs.read", &payloads.GenericUpdateDescriptionRequest{Description: "updated"}, false); err != nil {
+		t.Errorf("got error %s, want a member of the owner role allowed", err)
+	}
+	if _, err := svc.updatePermission(ctx, "mallory", "docs.read", &payloads.GenericUpdateDescriptionRequest{Description: "updated"}, false); !hasCode(err, payloads.CodeNotOwner) {
+		t.Errorf("got error %v, want %s", err, payloads.CodeNotOwner)
+	}
+}
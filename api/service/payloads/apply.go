@@ -0,0 +1,8 @@
+package payloads
+
+import "github.com/adrianosela/rbac/api/manifest"
+
+type ApplyResponse struct {
+	DryRun  bool              `json:"dry_run,omitempty"`
+	Changes []manifest.Change `json:"changes"`
+}
@@ -0,0 +1,31 @@
+package payloads
+
+import "github.com/adrianosela/rbac/api/model"
+
+type DryRunResponse struct {
+	DryRun         bool                     `json:"dry_run"`
+	Role           *model.Role              `json:"role,omitempty"`
+	Permission     *model.Permission        `json:"permission,omitempty"`
+	Deleted        bool                     `json:"deleted,omitempty"`
+	AffectedUsers  []UserPermissionsChange  `json:"affected_users"`
+	AffectedGroups []GroupPermissionsChange `json:"affected_groups"`
+
+	// users whose groups couldn't be looked up, e.g. because they are unknown
+	// to the groups source. Their changes only account for the roles bound to
+	// them directly.
+	UnresolvedUsers []string `json:"unresolved_users,omitempty"`
+}
+
+type UserPermissionsChange struct {
+	User    string   `json:"user"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// GroupPermissionsChange describes the permissions a group gains or loses
+// through a role. Members may still hold them through other roles.
+type GroupPermissionsChange struct {
+	Group   string   `json:"group"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
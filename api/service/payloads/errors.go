@@ -0,0 +1,46 @@
+package payloads
+
+import (
+	"github.com/adrianosela/rbac/api/manifest"
+	"github.com/adrianosela/rbac/api/validation"
+)
+
+// Error codes identify the reason a request failed. They are
+// stable, so clients can rely on them unlike on error messages.
+const (
+	CodeInvalidRequest         = "INVALID_REQUEST"
+	CodeValidationFailed       = "VALIDATION_FAILED"
+	CodeInvalidSnapshot        = "INVALID_SNAPSHOT"
+	CodeCannotRemoveSelf       = "CANNOT_REMOVE_SELF"
+	CodeUnknownPermission      = "UNKNOWN_PERMISSION"
+	CodeUnauthenticated        = "UNAUTHENTICATED"
+	CodeNotOwner               = "NOT_OWNER"
+	CodeNotAdmin               = "NOT_ADMIN"
+	CodeMissingPermission      = "MISSING_PERMISSION"
+	CodeReservedName           = "RESERVED_NAME"
+	CodeNotFound               = "NOT_FOUND"
+	CodeRoleNotFound           = "ROLE_NOT_FOUND"
+	CodePermissionNotFound     = "PERMISSION_NOT_FOUND"
+	CodeWebhookNotFound        = "WEBHOOK_NOT_FOUND"
+	CodeServiceAccountNotFound = "SERVICE_ACCOUNT_NOT_FOUND"
+	CodeAPIKeyNotFound         = "API_KEY_NOT_FOUND"
+	CodeNamespaceNotFound      = "NAMESPACE_NOT_FOUND"
+	CodeMethodNotAllowed       = "METHOD_NOT_ALLOWED"
+	CodeRoleExists             = "ROLE_ALREADY_EXISTS"
+	CodePermissionExists       = "PERMISSION_ALREADY_EXISTS"
+	CodeServiceAccountExists   = "SERVICE_ACCOUNT_ALREADY_EXISTS"
+	CodeNamespaceExists        = "NAMESPACE_ALREADY_EXISTS"
+	CodePermissionInUse        = "PERMISSION_IN_USE"
+	CodeNamespaceConflict      = "NAMESPACE_CONFLICT"
+	CodeServiceAccountInUse    = "SERVICE_ACCOUNT_IN_USE"
+	CodeRevisionCompacted      = "REVISION_COMPACTED"
+	CodeInternal               = "INTERNAL"
+)
+
+type ErrorResponse struct {
+	Code      string                  `json:"code"`
+	Message   string                  `json:"message"`
+	Fields    []validation.FieldError `json:"fields,omitempty"`  // only for VALIDATION_FAILED
+	Applied   []manifest.Change       `json:"applied,omitempty"` // only for a failed apply, the changes made before it failed
+	RequestID string                  `json:"request_id,omitempty"`
+}
@@ -1,5 +1,14 @@
 package payloads
 
+import "github.com/adrianosela/rbac/api/validation"
+
 type GenericUpdateDescriptionRequest struct {
 	Description string `json:"description"`
 }
+
+// Validate returns the field errors of the request, if any
+func (r *GenericUpdateDescriptionRequest) Validate() error {
+	var errs validation.Errors
+	errs.Description("description", r.Description)
+	return errs.Err()
+}
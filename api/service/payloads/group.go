@@ -0,0 +1,13 @@
+package payloads
+
+type GroupRole struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type GetGroupMembersRolesResponse struct {
+	Group       string       `json:"group"`
+	Roles       []*GroupRole `json:"roles"`       // roles every member of the group receives
+	Permissions []string     `json:"permissions"` // permissions every member of the group receives
+}
@@ -0,0 +1,15 @@
+package payloads
+
+// ReadinessResponse represents the result of a readiness probe. The
+// service is ready when all of its dependencies are healthy.
+type ReadinessResponse struct {
+	Ready        bool                        `json:"ready"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// DependencyStatus represents the result of checking a single dependency
+type DependencyStatus struct {
+	Healthy bool   `json:"healthy"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
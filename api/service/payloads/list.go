@@ -0,0 +1,13 @@
+package payloads
+
+import "github.com/adrianosela/rbac/api/model"
+
+type ListRolesResponse struct {
+	Roles      []*model.Role `json:"roles"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+type ListPermissionsResponse struct {
+	Permissions []*model.Permission `json:"permissions"`
+	NextCursor  string              `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,44 @@
+package payloads
+
+import (
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/validation"
+)
+
+type CreateNamespaceRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Owners      []string `json:"owners,omitempty"`
+
+	// Takeover makes the namespace owners the only owners of existing
+	// permissions in the namespace which others also own. The namespace
+	// is not created when there are such permissions without it.
+	Takeover bool `json:"takeover,omitempty"`
+}
+
+// Validate returns the field errors of the request, if any
+func (r *CreateNamespaceRequest) Validate() error {
+	var errs validation.Errors
+	errs.Name("name", r.Name)
+	errs.Description("description", r.Description)
+	errs.Owners("owners", r.Owners)
+	return errs.Err()
+}
+
+type ModifyNamespaceRequest struct {
+	Owners []string `json:"owners,omitempty"`
+}
+
+// Validate returns the field errors of the request, if any
+func (r *ModifyNamespaceRequest) Validate() error {
+	var errs validation.Errors
+	if len(r.Owners) == 0 {
+		errs.Add("owners", "is required")
+	}
+	errs.Owners("owners", r.Owners)
+	return errs.Err()
+}
+
+type ListNamespacesResponse struct {
+	Namespaces []*model.Namespace `json:"namespaces"`
+}
@@ -0,0 +1,44 @@
+package payloads
+
+import "github.com/adrianosela/rbac/api/validation"
+
+type TransferOwnershipRequest struct {
+	To        []string `json:"to"`                  // the new owners
+	Exclusive bool     `json:"exclusive,omitempty"` // removes every current owner rather than only the caller, only admins can unless the caller is the only owner
+}
+
+// Validate returns the field errors of the request, if any
+func (r *TransferOwnershipRequest) Validate() error {
+	var errs validation.Errors
+	if len(r.To) == 0 {
+		errs.Add("to", "is required")
+	}
+	errs.Owners("to", r.To)
+	return errs.Err()
+}
+
+type ReassignOrphansRequest struct {
+	Owner string `json:"owner"` // the fallback owner of every orphaned role and permission
+}
+
+// Validate returns the field errors of the request, if any
+func (r *ReassignOrphansRequest) Validate() error {
+	var errs validation.Errors
+	if r.Owner == "" {
+		errs.Add("owner", "is required")
+	} else {
+		errs.Owner("owner", r.Owner)
+	}
+	return errs.Err()
+}
+
+// Orphan is a role or permission none of whose owners resolve
+type Orphan struct {
+	Name   string   `json:"name"`
+	Owners []string `json:"owners"`
+}
+
+type OrphansResponse struct {
+	Roles       []Orphan `json:"roles"`
+	Permissions []Orphan `json:"permissions"`
+}
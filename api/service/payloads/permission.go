@@ -1,11 +1,32 @@
 package payloads
 
+import "github.com/adrianosela/rbac/api/validation"
+
 type CreatePermissionRequest struct {
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
 	Owners      []string `json:"owners,omitempty"`
 }
 
+// Validate returns the field errors of the request, if any
+func (r *CreatePermissionRequest) Validate() error {
+	var errs validation.Errors
+	errs.Name("name", r.Name)
+	errs.Description("description", r.Description)
+	errs.Owners("owners", r.Owners)
+	return errs.Err()
+}
+
 type ModifyPermissionRequest struct {
 	Owners []string `json:"owners,omitempty"`
 }
+
+// Validate returns the field errors of the request, if any
+func (r *ModifyPermissionRequest) Validate() error {
+	var errs validation.Errors
+	if len(r.Owners) == 0 {
+		errs.Add("owners", "is required")
+	}
+	errs.Owners("owners", r.Owners)
+	return errs.Err()
+}
@@ -1,5 +1,7 @@
 package payloads
 
+import "github.com/adrianosela/rbac/api/validation"
+
 type CreateRoleRequest struct {
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
@@ -9,9 +11,34 @@ type CreateRoleRequest struct {
 	Owners      []string `json:"owners,omitempty"`
 }
 
+// Validate returns the field errors of the request, if any
+func (r *CreateRoleRequest) Validate() error {
+	var errs validation.Errors
+	errs.Name("name", r.Name)
+	errs.Description("description", r.Description)
+	errs.Names("permissions", r.Permissions)
+	errs.Principals("users", r.Users)
+	errs.Subjects("groups", r.Groups)
+	errs.Owners("owners", r.Owners)
+	return errs.Err()
+}
+
 type ModifyRoleRequest struct {
 	Permissions []string `json:"permissions,omitempty"`
 	Users       []string `json:"users,omitempty"`
 	Groups      []string `json:"groups,omitempty"`
 	Owners      []string `json:"owners,omitempty"`
 }
+
+// Validate returns the field errors of the request, if any
+func (r *ModifyRoleRequest) Validate() error {
+	var errs validation.Errors
+	if len(r.Permissions)+len(r.Users)+len(r.Groups)+len(r.Owners) == 0 {
+		errs.Add("request", "at least one of permissions, users, groups, or owners is required")
+	}
+	errs.Names("permissions", r.Permissions)
+	errs.Principals("users", r.Users)
+	errs.Subjects("groups", r.Groups)
+	errs.Owners("owners", r.Owners)
+	return errs.Err()
+}
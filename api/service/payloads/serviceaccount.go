@@ -0,0 +1,62 @@
+package payloads
+
+import (
+	"time"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/validation"
+)
+
+type CreateServiceAccountRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Owners      []string `json:"owners,omitempty"`
+}
+
+// Validate returns the field errors of the request, if any
+func (r *CreateServiceAccountRequest) Validate() error {
+	var errs validation.Errors
+	errs.Name("name", r.Name)
+	errs.Description("description", r.Description)
+	errs.Owners("owners", r.Owners)
+	return errs.Err()
+}
+
+type CreateAPIKeyRequest struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // the key never expires when unset
+}
+
+// Validate returns the field errors of the request, if any
+func (r *CreateAPIKeyRequest) Validate() error {
+	var errs validation.Errors
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		errs.Add("expires_at", "must be in the future")
+	}
+	return errs.Err()
+}
+
+type RotateAPIKeyRequest struct {
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`   // of the new key, which never expires when unset
+	GracePeriod string     `json:"grace_period,omitempty"` // how long the old key keeps working, e.g. "24h", defaults to none
+}
+
+// Validate returns the field errors of the request, if any
+func (r *RotateAPIKeyRequest) Validate() error {
+	var errs validation.Errors
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		errs.Add("expires_at", "must be in the future")
+	}
+	if r.GracePeriod != "" {
+		if d, err := time.ParseDuration(r.GracePeriod); err != nil || d < 0 {
+			errs.Add("grace_period", "must be a non-negative duration, e.g. \"30m\" or \"24h\"")
+		}
+	}
+	return errs.Err()
+}
+
+// CreateAPIKeyResponse holds a new API key. The key can't be read
+// again, only its hash is stored.
+type CreateAPIKeyResponse struct {
+	Key string `json:"key"`
+	*model.APIKey
+}
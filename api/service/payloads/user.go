@@ -3,3 +3,11 @@ package payloads
 type GetUserPermissionsResponse struct {
 	Persmissions []string `json:"permissions"`
 }
+
+type GetUserRolesResponse struct {
+	User      string              `json:"user"`
+	Groups    []string            `json:"groups"`     // groups the user is a member of
+	Direct    []string            `json:"direct"`     // roles bound to the user directly
+	ViaGroups map[string][]string `json:"via_groups"` // roles bound to each group the user is in
+	Effective []string            `json:"effective"`  // all roles of the user
+}
@@ -0,0 +1,32 @@
+package payloads
+
+import (
+	"net/url"
+
+	"github.com/adrianosela/rbac/api/validation"
+	"github.com/adrianosela/rbac/api/webhooks"
+)
+
+type CreateWebhookRequest struct {
+	URL     string            `json:"url"`
+	Secret  string            `json:"secret"`
+	Filters []webhooks.Filter `json:"filters"`
+}
+
+// Validate returns the field errors of the request, if any
+func (r *CreateWebhookRequest) Validate() error {
+	var errs validation.Errors
+	if u, err := url.Parse(r.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.Add("url", "must be an absolute http(s) url")
+	}
+	if r.Secret == "" {
+		errs.Add("secret", "is required")
+	}
+	if len(r.Filters) == 0 {
+		errs.Add("filters", "at least one event filter is required")
+	}
+	if len(r.Filters) > validation.MaxListLength {
+		errs.Add("filters", "must have at most %d items", validation.MaxListLength)
+	}
+	return errs.Err()
+}
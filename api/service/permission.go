@@ -5,44 +5,46 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/adrianosela/rbac/api/model"
 	"github.com/adrianosela/rbac/api/service/payloads"
-	"github.com/adrianosela/rbac/utils/set"
 	"github.com/gorilla/mux"
 )
 
 func (s *service) setPermissionEndpoints() {
 	s.router.Methods(http.MethodPost).Path("/permission").Handler(s.auth(s.createPermissionHandler))
 	s.router.Methods(http.MethodGet).Path("/permission/{name}").HandlerFunc(s.readPermissionHandler)
+	s.router.Methods(http.MethodGet).Path("/permissions").HandlerFunc(s.listPermissionsHandler) // ?prefix, contains, owner, cursor, limit
 	s.router.Methods(http.MethodPatch).Path("/permission/{name}").Handler(s.auth(s.updatePermissionHandler))
 	s.router.Methods(http.MethodPatch).Path("/permission/{name}/add").Handler(s.auth(s.addToPermissionHandler))         // add owners
 	s.router.Methods(http.MethodPatch).Path("/permission/{name}/remove").Handler(s.auth(s.removeFromPermissionHandler)) // rm owners
+	s.router.Methods(http.MethodPatch).Path("/permission/{name}/transfer").Handler(s.auth(s.transferPermissionHandler)) // hand over to new owners
 	s.router.Methods(http.MethodDelete).Path("/permission/{name}").Handler(s.auth(s.deletePermissionHandler))
 }
 
 func (s *service) createPermissionHandler(w http.ResponseWriter, r *http.Request) {
 	authenticatedUser := getAuthenticatedUser(r)
 
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
 	var pl *payloads.CreatePermissionRequest
 	if err := unmarshalRequestBody(r, &pl); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("request body is not a permission"))
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a permission: %s", err))
 		return
 	}
 
-	// TODO: validate payload (e.g. for required fields, length limits, etc)
-
-	permission := &model.Permission{
-		Name:        pl.Name,
-		Description: pl.Description,
-		Owners:      set.NewSet(pl.Owners...).Add(authenticatedUser).Slice(),
+	permission, err := s.createPermission(r.Context(), authenticatedUser, pl, dryRun)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
-	// TODO: validate role has mandatory fields populated
-	if err := s.store.CreatePermission(permission); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to create new permission in storage"))
+	if dryRun {
+		s.writePermissionDryRun(w, r, permission.Name, permission)
 		return
 	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(fmt.Sprintf("Permission \"%s\" created successfuly!", permission.Name)))
 	return
@@ -51,27 +53,19 @@ func (s *service) createPermissionHandler(w http.ResponseWriter, r *http.Request
 func (s *service) readPermissionHandler(w http.ResponseWriter, r *http.Request) {
 	name := mux.Vars(r)["name"]
 	if name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("no permission name in request URL"))
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no permission name in request URL"))
 		return
 	}
 
-	permission, err := s.store.ReadPermission(name)
+	permission, err := s.readPermission(r.Context(), name)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to read permission from storage"))
-		return
-	}
-	if permission == nil {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(fmt.Sprintf("Permission \"%s\" does not exist!", name)))
+		writeError(w, r, err)
 		return
 	}
 
 	permissionBytes, err := json.Marshal(&permission)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to encode response"))
+		writeError(w, r, internalError(err, "failed to encode response"))
 		return
 	}
 
@@ -80,47 +74,62 @@ func (s *service) readPermissionHandler(w http.ResponseWriter, r *http.Request)
 	return
 }
 
-func (s *service) updatePermissionHandler(w http.ResponseWriter, r *http.Request) {
-	authenticatedUser := getAuthenticatedUser(r)
+func (s *service) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if opts.User != "" || opts.Group != "" || opts.Permission != "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "permissions can only be filtered by prefix, contains, and owner"))
+		return
+	}
 
-	name := mux.Vars(r)["name"]
-	if name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("no permission name in request URL"))
+	perms, after, err := s.store.ScanPermissions(r.Context(), opts)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to list permissions from storage"))
 		return
 	}
 
-	var pl *payloads.GenericUpdateDescriptionRequest
-	if err := unmarshalRequestBody(r, &pl); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("could not decode request body onto an GenericUpdateDescriptionRequest")) // FIXME: don't expose internals
+	respBytes, err := json.Marshal(&payloads.ListPermissionsResponse{Permissions: perms, NextCursor: encodeCursor(after)})
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
 		return
 	}
 
-	// TODO: validate payload (e.g. for required fields, length limits, etc)
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return
+}
 
-	perm, err := s.store.ReadPermission(name)
+func (s *service) updatePermissionHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	dryRun, err := isDryRun(r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to read permission from storage"))
+		writeError(w, r, err)
 		return
 	}
-	if perm == nil {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(fmt.Sprintf("Permission \"%s\" does not exist!", name)))
+
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no permission name in request URL"))
 		return
 	}
 
-	if !set.NewSet(perm.Owners...).Has(authenticatedUser) {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(fmt.Sprintf("Only the owners of a permission can modify the permission. User \"%s\" not in %v.", authenticatedUser, perm.Owners)))
+	var pl *payloads.GenericUpdateDescriptionRequest
+	if err := unmarshalRequestBody(r, &pl); err != nil {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a description update: %s", err))
 		return
 	}
 
-	perm.Description = pl.Description
-	if err := s.store.UpdatePermission(perm); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to update permission in storage"))
+	after, err := s.updatePermission(r.Context(), authenticatedUser, name, pl, dryRun)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if dryRun {
+		s.writePermissionDryRun(w, r, name, after)
 		return
 	}
 
@@ -132,45 +141,31 @@ func (s *service) updatePermissionHandler(w http.ResponseWriter, r *http.Request
 func (s *service) addToPermissionHandler(w http.ResponseWriter, r *http.Request) {
 	authenticatedUser := getAuthenticatedUser(r)
 
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
 	name := mux.Vars(r)["name"]
 	if name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("no permission name in request URL"))
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no permission name in request URL"))
 		return
 	}
 
 	var pl *payloads.ModifyPermissionRequest
 	if err := unmarshalRequestBody(r, &pl); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("could not decode request body onto an ModifyPermissionRequest")) // FIXME: don't expose internals
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a permission modification: %s", err))
 		return
 	}
 
-	// TODO: validate payload (e.g. for required fields, length limits, etc)
-
-	perm, err := s.store.ReadPermission(name)
+	after, err := s.addToPermission(r.Context(), authenticatedUser, name, pl, dryRun)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to read permission from storage"))
+		writeError(w, r, err)
 		return
 	}
-	if perm == nil {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(fmt.Sprintf("Permission \"%s\" does not exist!", name)))
-		return
-	}
-
-	permOwners := set.NewSet(perm.Owners...)
-	if !permOwners.Has(authenticatedUser) {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(fmt.Sprintf("Only the owners of a permission can modify the permission. User \"%s\" not in %v.", authenticatedUser, perm.Owners)))
-		return
-	}
-
-	perm.Owners = permOwners.Add(pl.Owners...).Slice()
-	if err := s.store.UpdatePermission(perm); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to update permission in storage"))
+	if dryRun {
+		s.writePermissionDryRun(w, r, name, after)
 		return
 	}
 
@@ -179,54 +174,70 @@ func (s *service) addToPermissionHandler(w http.ResponseWriter, r *http.Request)
 	return
 }
 
-func (s *service) removeFromPermissionHandler(w http.ResponseWriter, r *http.Request) {
+func (s *service) transferPermissionHandler(w http.ResponseWriter, r *http.Request) {
 	authenticatedUser := getAuthenticatedUser(r)
 
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
 	name := mux.Vars(r)["name"]
 	if name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("no permission name in request URL"))
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no permission name in request URL"))
 		return
 	}
 
-	var pl *payloads.ModifyPermissionRequest
+	var pl *payloads.TransferOwnershipRequest
 	if err := unmarshalRequestBody(r, &pl); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("could not decode request body onto an ModifyPermissionRequest")) // FIXME: don't expose internals
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not an ownership transfer: %s", err))
 		return
 	}
 
-	// TODO: validate payload (e.g. for required fields, length limits, etc)
-
-	if set.NewSet(pl.Owners...).Has(authenticatedUser) {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Removing yourself as an owner is not allowed"))
+	after, err := s.transferPermission(r.Context(), authenticatedUser, name, pl, dryRun)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if dryRun {
+		s.writePermissionDryRun(w, r, name, after)
 		return
 	}
 
-	perm, err := s.store.ReadPermission(name)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Permission \"%s\" transferred successfully to %v!", name, pl.To)))
+	return
+}
+
+func (s *service) removeFromPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	dryRun, err := isDryRun(r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to read permission from storage"))
+		writeError(w, r, err)
 		return
 	}
-	if perm == nil {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(fmt.Sprintf("Permission \"%s\" does not exist!", name)))
+
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no permission name in request URL"))
 		return
 	}
 
-	permOwners := set.NewSet(perm.Owners...)
-	if !permOwners.Has(authenticatedUser) {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(fmt.Sprintf("Only the owners of a permission can modify the permission. User \"%s\" not in %v.", authenticatedUser, perm.Owners)))
+	var pl *payloads.ModifyPermissionRequest
+	if err := unmarshalRequestBody(r, &pl); err != nil {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a permission modification: %s", err))
 		return
 	}
 
-	perm.Owners = permOwners.Remove(pl.Owners...).Slice()
-	if err := s.store.UpdatePermission(perm); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to update permission in storage"))
+	after, err := s.removeFromPermission(r.Context(), authenticatedUser, name, pl, dryRun)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if dryRun {
+		s.writePermissionDryRun(w, r, name, after)
 		return
 	}
 
@@ -238,40 +249,24 @@ func (s *service) removeFromPermissionHandler(w http.ResponseWriter, r *http.Req
 func (s *service) deletePermissionHandler(w http.ResponseWriter, r *http.Request) {
 	authenticatedUser := getAuthenticatedUser(r)
 
-	name := mux.Vars(r)["name"]
-	if name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("no permission name in request URL"))
-		return
-	}
-
-	perm, err := s.store.ReadPermission(name)
+	dryRun, err := isDryRun(r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to read permission from storage"))
-		return
-	}
-	if perm == nil { // (not in store already)
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(fmt.Sprintf("Permission \"%s\" deleted successfully!", name)))
+		writeError(w, r, err)
 		return
 	}
 
-	if !set.NewSet(perm.Owners...).Has(authenticatedUser) {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(fmt.Sprintf("only the owners of a permission can delete the permission. User \"%s\" not in %v.", authenticatedUser, perm.Owners)))
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no permission name in request URL"))
 		return
 	}
 
-	if len(perm.Roles) > 0 {
-		w.WriteHeader(http.StatusForbidden)
-		w.Write([]byte(fmt.Sprintf("Permission \"%s\" is in use. Must first remove it from roles %v ", perm.Name, perm.Roles)))
+	if err := s.deletePermission(r.Context(), authenticatedUser, name, dryRun); err != nil {
+		writeError(w, r, err)
 		return
 	}
-
-	if err := s.store.DeletePermission(name); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to delete permission from storage"))
+	if dryRun {
+		s.writePermissionDryRun(w, r, name, nil)
 		return
 	}
 
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// createPermission creates a new permission owned by the actor.
+// When dryRun is set, all checks are made but nothing is written.
+func (s *service) createPermission(ctx context.Context, actor string, pl *payloads.CreatePermissionRequest, dryRun bool) (*model.Permission, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+	if model.IsReserved(pl.Name) {
+		return nil, newError(payloads.CodeReservedName, "Permission names starting with \"%s\" are reserved for meta-permissions", model.ReservedPrefix)
+	}
+
+	if err := s.checkCanCreatePermission(ctx, actor, pl.Name); err != nil {
+		return nil, err
+	}
+
+	permission := &model.Permission{
+		Name:        pl.Name,
+		Description: pl.Description,
+		Owners:      set.NewSet(pl.Owners...).Add(actor).Slice(),
+	}
+
+	defer s.locks.lock(lockPermission, pl.Name)()
+
+	existing, err := s.store.ReadPermission(ctx, pl.Name)
+	if err != nil {
+		return nil, internalError(err, "failed to read permission from storage")
+	}
+	if existing != nil {
+		return nil, newError(payloads.CodePermissionExists, "Permission \"%s\" already exists!", pl.Name)
+	}
+
+	if err := s.checkPrincipalsExist(ctx, pl.Owners); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return permission, nil
+	}
+
+	if err := s.store.CreatePermission(ctx, permission); err != nil {
+		return nil, internalError(err, "failed to create new permission in storage")
+	}
+
+	s.publish(events.New(events.PermissionCreated, permission.Name, actor))
+	return permission, nil
+}
+
+// readPermission returns a permission, or an error if it does not exist
+func (s *service) readPermission(ctx context.Context, name string) (*model.Permission, error) {
+	perm, err := s.store.ReadPermission(ctx, name)
+	if err != nil {
+		return nil, internalError(err, "failed to read permission from storage")
+	}
+	if perm == nil {
+		return nil, newError(payloads.CodePermissionNotFound, "Permission \"%s\" does not exist!", name)
+	}
+	return perm, nil
+}
+
+// readOwnedPermission returns a permission if it exists and the actor owns it
+func (s *service) readOwnedPermission(ctx context.Context, actor, name string) (*model.Permission, error) {
+	perm, err := s.readPermission(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkOwner(ctx, actor, perm.Owners, model.PermissionPermissionsAdmin, "Only the owners of a permission can modify the permission"); err != nil {
+		return nil, err
+	}
+	return perm, nil
+}
+
+// updatePermission modifies the description of a permission
+func (s *service) updatePermission(ctx context.Context, actor, name string, pl *payloads.GenericUpdateDescriptionRequest, dryRun bool) (*model.Permission, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+
+	defer s.locks.lock(lockPermission, name)()
+
+	perm, err := s.readOwnedPermission(ctx, actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	perm.Description = pl.Description
+	if dryRun {
+		return perm, nil
+	}
+
+	if err := s.store.UpdatePermission(ctx, perm); err != nil {
+		return nil, internalError(err, "failed to update permission in storage")
+	}
+
+	s.publish(events.New(events.PermissionUpdated, name, actor))
+	return perm, nil
+}
+
+// addToPermission adds owners to a permission
+func (s *service) addToPermission(ctx context.Context, actor, name string, pl *payloads.ModifyPermissionRequest, dryRun bool) (*model.Permission, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+	if model.IsReserved(name) {
+		return nil, newError(payloads.CodeReservedName, "Permission \"%s\" is a built-in meta-permission and always owned by the admin role", name)
+	}
+
+	defer s.locks.lock(lockPermission, name)()
+
+	perm, err := s.readOwnedPermission(ctx, actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkPrincipalsExist(ctx, pl.Owners); err != nil {
+		return nil, err
+	}
+
+	perm.Owners = set.NewSet(perm.Owners...).Add(pl.Owners...).Slice()
+	if dryRun {
+		return perm, nil
+	}
+
+	if err := s.store.UpdatePermission(ctx, perm); err != nil {
+		return nil, internalError(err, "failed to update permission in storage")
+	}
+
+	s.publish(events.New(events.PermissionUpdated, name, actor))
+	return perm, nil
+}
+
+// transferPermission hands a permission over to new owners, replacing the
+// actor among its owners, or every current owner when the transfer is exclusive,
+// see checkTransfer
+func (s *service) transferPermission(ctx context.Context, actor, name string, pl *payloads.TransferOwnershipRequest, dryRun bool) (*model.Permission, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+	if model.IsReserved(name) {
+		return nil, newError(payloads.CodeReservedName, "Permission \"%s\" is a built-in meta-permission and always owned by the admin role", name)
+	}
+
+	defer s.locks.lock(lockPermission, name)()
+
+	perm, err := s.readOwnedPermission(ctx, actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkTransfer(ctx, actor, perm.Owners, model.PermissionPermissionsAdmin, pl); err != nil {
+		return nil, err
+	}
+	if err := s.checkPrincipalsExist(ctx, pl.To); err != nil {
+		return nil, err
+	}
+
+	perm.Owners = transferOwners(perm.Owners, actor, pl)
+	if dryRun {
+		return perm, nil
+	}
+
+	if err := s.store.UpdatePermission(ctx, perm); err != nil {
+		return nil, internalError(err, "failed to update permission in storage")
+	}
+
+	s.publish(events.New(events.PermissionUpdated, name, actor))
+	return perm, nil
+}
+
+// removeFromPermission removes owners from a permission
+func (s *service) removeFromPermission(ctx context.Context, actor, name string, pl *payloads.ModifyPermissionRequest, dryRun bool) (*model.Permission, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+
+	if set.NewSet(pl.Owners...).Has(actor) {
+		return nil, newError(payloads.CodeCannotRemoveSelf, "Removing yourself as an owner is not allowed, transfer ownership instead")
+	}
+	if model.IsReserved(name) {
+		return nil, newError(payloads.CodeReservedName, "Permission \"%s\" is a built-in meta-permission and always owned by the admin role", name)
+	}
+
+	defer s.locks.lock(lockPermission, name)()
+
+	perm, err := s.readOwnedPermission(ctx, actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	perm.Owners = set.NewSet(perm.Owners...).Remove(pl.Owners...).Slice()
+	if dryRun {
+		return perm, nil
+	}
+
+	if err := s.store.UpdatePermission(ctx, perm); err != nil {
+		return nil, internalError(err, "failed to update permission in storage")
+	}
+
+	s.publish(events.New(events.PermissionUpdated, name, actor))
+	return perm, nil
+}
+
+// deletePermission deletes a permission which is not in use by any role
+func (s *service) deletePermission(ctx context.Context, actor, name string, dryRun bool) error {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	defer s.locks.lock(lockPermission, name)()
+
+	perm, err := s.store.ReadPermission(ctx, name)
+	if err != nil {
+		return internalError(err, "failed to read permission from storage")
+	}
+	if perm == nil { // (not in store already)
+		return nil
+	}
+
+	if model.IsReserved(perm.Name) {
+		return newError(payloads.CodeReservedName, "Permission \"%s\" is a built-in meta-permission and can't be deleted", perm.Name)
+	}
+
+	if err := s.checkOwner(ctx, actor, perm.Owners, model.PermissionPermissionsAdmin, "only the owners of a permission can delete the permission"); err != nil {
+		return err
+	}
+
+	if len(perm.Roles) > 0 {
+		return newError(payloads.CodePermissionInUse, "Permission \"%s\" is in use. Must first remove it from roles %v ", perm.Name, perm.Roles)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	if err := s.store.DeletePermission(ctx, name); err != nil {
+		return internalError(err, "failed to delete permission from storage")
+	}
+
+	s.publish(events.New(events.PermissionDeleted, name, actor))
+	return nil
+}
@@ -5,9 +5,7 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/adrianosela/rbac/api/model"
 	"github.com/adrianosela/rbac/api/service/payloads"
-	"github.com/adrianosela/rbac/utils/set"
 	"github.com/gorilla/mux"
 )
 
@@ -15,10 +13,12 @@ func (s *service) setRoleEndpoints() {
 	s.router.Methods(http.MethodPost).Path("/role").Handler(s.auth(s.createRoleHandler))
 
 	s.router.Methods(http.MethodGet).Path("/role/{name}").HandlerFunc(s.readRoleHandler)
+	s.router.Methods(http.MethodGet).Path("/roles").HandlerFunc(s.listRolesHandler) // ?prefix, contains, owner, user, group, permission, cursor, limit
 
 	s.router.Methods(http.MethodPatch).Path("/role/{name}").Handler(s.auth(s.updateRoleHandler))            // modify description
 	s.router.Methods(http.MethodPatch).Path("/role/{name}/add").Handler(s.auth(s.addToRoleHandler))         // add permissions, assumers, or owners
 	s.router.Methods(http.MethodPatch).Path("/role/{name}/remove").Handler(s.auth(s.removeFromRoleHandler)) // rm permissions, assumers, or owners
+	s.router.Methods(http.MethodPatch).Path("/role/{name}/transfer").Handler(s.auth(s.transferRoleHandler)) // hand over to new owners
 
 	s.router.Methods(http.MethodDelete).Path("/role/{name}").Handler(s.auth(s.deleteRoleHandler))
 }
@@ -26,59 +26,25 @@ func (s *service) setRoleEndpoints() {
 func (s *service) createRoleHandler(w http.ResponseWriter, r *http.Request) {
 	authenticatedUser := getAuthenticatedUser(r)
 
-	var pl *payloads.CreateRoleRequest
-	if err := unmarshalRequestBody(r, &pl); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("could not decode request body onto a CreateRoleRequest")) // FIXME: don't expose internals
-		return
-	}
-
-	// TODO: validate payload (e.g. for required fields, length limits, etc)
-
-	role := &model.Role{
-		Name:        pl.Name,
-		Description: pl.Description,
-		Permissions: set.NewSet(pl.Permissions...).Slice(),
-		Users:       set.NewSet(pl.Users...).Slice(),
-		Groups:      set.NewSet(pl.Groups...).Slice(),
-		Owners:      set.NewSet(pl.Owners...).Add(authenticatedUser).Slice(),
-	}
-
-	perms, err := s.store.BulkReadPermissions(pl.Permissions)
+	dryRun, err := isDryRun(r)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(err.Error())) // FIXME: do not expose internals
+		writeError(w, r, err)
 		return
 	}
 
-	for _, perm := range perms {
-		if !set.NewSet(perm.Owners...).Has(authenticatedUser) {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(fmt.Sprintf("Only the owners of a permission can add it to a role. User \"%s\" not in %v.", authenticatedUser, perm.Owners)))
-			return
-		}
-	}
-
-	if err := s.store.CreateRole(role); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to create new role in storage"))
+	var pl *payloads.CreateRoleRequest
+	if err := unmarshalRequestBody(r, &pl); err != nil {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a role: %s", err))
 		return
 	}
 
-	// FIXME: move three below to eventual consistence model
-	if err := s.store.AddRoleToPermissions(pl.Name, pl.Permissions); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to add role to permissions in storage"))
-		return
-	}
-	if err := s.store.AddRoleToUsers(pl.Name, pl.Users); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to add role to users in storage"))
+	role, err := s.createRole(r.Context(), authenticatedUser, pl, dryRun)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	if err := s.store.AddRoleToGroups(pl.Name, pl.Groups); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to add role to groups in storage"))
+	if dryRun {
+		s.writeRoleDryRun(w, r, role.Name, role)
 		return
 	}
 
@@ -90,27 +56,19 @@ func (s *service) createRoleHandler(w http.ResponseWriter, r *http.Request) {
 func (s *service) readRoleHandler(w http.ResponseWriter, r *http.Request) {
 	name := mux.Vars(r)["name"]
 	if name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("no role name in request URL"))
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no role name in request URL"))
 		return
 	}
 
-	role, err := s.store.ReadRole(name)
+	role, err := s.readRole(r.Context(), name)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to read role from storage"))
-		return
-	}
-	if role == nil {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(fmt.Sprintf("Role \"%s\" does not exist!", name)))
+		writeError(w, r, err)
 		return
 	}
 
 	roleBytes, err := json.Marshal(&role)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to encode response"))
+		writeError(w, r, internalError(err, "failed to encode response"))
 		return
 	}
 
@@ -119,47 +77,58 @@ func (s *service) readRoleHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func (s *service) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
-	authenticatedUser := getAuthenticatedUser(r)
+func (s *service) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
-	name := mux.Vars(r)["name"]
-	if name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("no role name in request URL"))
+	roles, after, err := s.store.ScanRoles(r.Context(), opts)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to list roles from storage"))
 		return
 	}
 
-	var pl *payloads.GenericUpdateDescriptionRequest
-	if err := unmarshalRequestBody(r, &pl); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("could not decode request body onto an UpdateRoleRequest")) // FIXME: don't expose internals
+	respBytes, err := json.Marshal(&payloads.ListRolesResponse{Roles: roles, NextCursor: encodeCursor(after)})
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
 		return
 	}
 
-	// TODO: validate payload (e.g. for required fields, length limits, etc)
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return
+}
 
-	role, err := s.store.ReadRole(name)
+func (s *service) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	dryRun, err := isDryRun(r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to read role from storage"))
+		writeError(w, r, err)
 		return
 	}
-	if role == nil {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(fmt.Sprintf("Role \"%s\" does not exist!", name)))
+
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no role name in request URL"))
 		return
 	}
 
-	if !set.NewSet(role.Owners...).Has(authenticatedUser) {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(fmt.Sprintf("Only the owners of a role can modify the role. User \"%s\" not in %v.", authenticatedUser, role.Owners)))
+	var pl *payloads.GenericUpdateDescriptionRequest
+	if err := unmarshalRequestBody(r, &pl); err != nil {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a description update: %s", err))
 		return
 	}
 
-	role.Description = pl.Description
-	if err := s.store.UpdateRole(role); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to update role in storage"))
+	after, err := s.updateRole(r.Context(), authenticatedUser, name, pl, dryRun)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if dryRun {
+		s.writeRoleDryRun(w, r, name, after)
 		return
 	}
 
@@ -171,157 +140,103 @@ func (s *service) updateRoleHandler(w http.ResponseWriter, r *http.Request) {
 func (s *service) addToRoleHandler(w http.ResponseWriter, r *http.Request) {
 	authenticatedUser := getAuthenticatedUser(r)
 
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
 	name := mux.Vars(r)["name"]
 	if name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("no role name in request URL"))
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no role name in request URL"))
 		return
 	}
 
 	var pl *payloads.ModifyRoleRequest
 	if err := unmarshalRequestBody(r, &pl); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("could not decode request body onto an ModifyRoleRequest")) // FIXME: don't expose internals
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a role modification: %s", err))
 		return
 	}
 
-	// TODO: validate payload (e.g. for required fields, length limits, etc)
-
-	role, err := s.store.ReadRole(name)
+	after, err := s.addToRole(r.Context(), authenticatedUser, name, pl, dryRun)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to read role from storage"))
+		writeError(w, r, err)
 		return
 	}
-	if role == nil {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(fmt.Sprintf("Role \"%s\" does not exist!", name)))
+	if dryRun {
+		s.writeRoleDryRun(w, r, name, after)
 		return
 	}
 
-	roleOwners := set.NewSet(role.Owners...)
-	if !roleOwners.Has(authenticatedUser) {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(fmt.Sprintf("Only the owners of a role can modify the role. User \"%s\" not in %v.", authenticatedUser, role.Owners)))
-		return
-	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Role \"%s\" updated successfully!", name)))
+	return
+}
 
-	perms, err := s.store.BulkReadPermissions(pl.Permissions)
+func (s *service) transferRoleHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	dryRun, err := isDryRun(r)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(err.Error())) // FIXME: do not expose internals
+		writeError(w, r, err)
 		return
 	}
-	for _, perm := range perms {
-		if !set.NewSet(perm.Owners...).Has(authenticatedUser) {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write([]byte(fmt.Sprintf("Only the owners of a permission can add it to a role. User \"%s\" not in %v.", authenticatedUser, perm.Owners)))
-			return
-		}
-	}
-
-	role.Owners = roleOwners.Add(pl.Owners...).Slice()
-	role.Users = set.NewSet(role.Users...).Add(pl.Users...).Slice()
-	role.Groups = set.NewSet(role.Groups...).Add(pl.Groups...).Slice()
-	role.Permissions = set.NewSet(role.Permissions...).Add(pl.Permissions...).Slice()
 
-	if err := s.store.UpdateRole(role); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to update role in storage"))
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no role name in request URL"))
 		return
 	}
 
-	// FIXME: move three below to eventual consistence model
-	if err := s.store.AddRoleToPermissions(name, pl.Permissions); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to add role to permissions in storage"))
+	var pl *payloads.TransferOwnershipRequest
+	if err := unmarshalRequestBody(r, &pl); err != nil {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not an ownership transfer: %s", err))
 		return
 	}
-	if err := s.store.AddRoleToUsers(name, pl.Users); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to add role to users in storage"))
+
+	after, err := s.transferRole(r.Context(), authenticatedUser, name, pl, dryRun)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	if err := s.store.AddRoleToGroups(name, pl.Groups); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to add role to groups in storage"))
+	if dryRun {
+		s.writeRoleDryRun(w, r, name, after)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(fmt.Sprintf("Role \"%s\" updated successfully!", name)))
+	w.Write([]byte(fmt.Sprintf("Role \"%s\" transferred successfully to %v!", name, pl.To)))
 	return
 }
 
 func (s *service) removeFromRoleHandler(w http.ResponseWriter, r *http.Request) {
 	authenticatedUser := getAuthenticatedUser(r)
 
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
 	name := mux.Vars(r)["name"]
 	if name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("no role name in request URL"))
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no role name in request URL"))
 		return
 	}
 
 	var pl *payloads.ModifyRoleRequest
 	if err := unmarshalRequestBody(r, &pl); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("could not decode request body onto an ModifyRoleRequest")) // FIXME: don't expose internals
-		return
-	}
-
-	// TODO: validate payload (e.g. for required fields, length limits, etc)
-
-	if set.NewSet(pl.Owners...).Has(authenticatedUser) {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Removing yourself as an owner is not allowed"))
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a role modification: %s", err))
 		return
 	}
 
-	role, err := s.store.ReadRole(name)
+	after, err := s.removeFromRole(r.Context(), authenticatedUser, name, pl, dryRun)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to read role from storage"))
-		return
-	}
-	if role == nil {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(fmt.Sprintf("Role \"%s\" does not exist!", name)))
-		return
-	}
-
-	owners := set.NewSet(role.Owners...)
-	if !owners.Has(authenticatedUser) {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(fmt.Sprintf("Only the owners of a role can modify the role. User \"%s\" not in %v.", authenticatedUser, role.Owners)))
+		writeError(w, r, err)
 		return
 	}
-
-	role.Owners = owners.Remove(pl.Owners...).Slice()
-	role.Users = set.NewSet(role.Users...).Remove(pl.Users...).Slice()
-	role.Groups = set.NewSet(role.Groups...).Remove(pl.Groups...).Slice()
-	role.Permissions = set.NewSet(role.Permissions...).Remove(pl.Permissions...).Slice()
-
-	if err := s.store.UpdateRole(role); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to update role in storage"))
-		return
-	}
-
-	// FIXME: move three below to eventual consistence model
-	if err := s.store.RemoveRoleFromPermissions(name, pl.Permissions); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to remove role from permissions in storage"))
-		return
-	}
-	if err := s.store.RemoveRoleFromUsers(name, pl.Users); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to remove role from users in storage"))
-		return
-	}
-	if err := s.store.RemoveRoleFromGroups(name, pl.Groups); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to remove role from groups in storage"))
+	if dryRun {
+		s.writeRoleDryRun(w, r, name, after)
 		return
 	}
 
@@ -333,52 +248,24 @@ func (s *service) removeFromRoleHandler(w http.ResponseWriter, r *http.Request)
 func (s *service) deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
 	authenticatedUser := getAuthenticatedUser(r)
 
-	name := mux.Vars(r)["name"]
-	if name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("no role name in request URL"))
-		return
-	}
-
-	role, err := s.store.ReadRole(name)
+	dryRun, err := isDryRun(r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to read role from storage"))
-		return
-	}
-
-	if role == nil { // (not in store already)
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(fmt.Sprintf("Role \"%s\" deleted successfully!", name)))
+		writeError(w, r, err)
 		return
 	}
 
-	if !set.NewSet(role.Owners...).Has(authenticatedUser) {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(fmt.Sprintf("only the owners of a role can delete the role. User \"%s\" not in %v.", authenticatedUser, role.Owners)))
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no role name in request URL"))
 		return
 	}
 
-	// FIXME: move three below to eventual consistence model
-	if err := s.store.RemoveRoleFromPermissions(name, role.Permissions); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to remove role from permissions in storage"))
-		return
-	}
-	if err := s.store.RemoveRoleFromUsers(name, role.Users); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to remove role from users in storage"))
+	if err := s.deleteRole(r.Context(), authenticatedUser, name, dryRun); err != nil {
+		writeError(w, r, err)
 		return
 	}
-	if err := s.store.RemoveRoleFromGroups(name, role.Groups); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to remove role from groups in storage"))
-		return
-	}
-
-	if err := s.store.DeleteRole(name); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed to delete role from storage"))
+	if dryRun {
+		s.writeRoleDryRun(w, r, name, nil)
 		return
 	}
 
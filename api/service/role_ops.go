@@ -0,0 +1,355 @@
+package service
+
+import (
+	"context"
+
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// createRole creates a new role owned by the actor.
+// When dryRun is set, all checks are made but nothing is written.
+func (s *service) createRole(ctx context.Context, actor string, pl *payloads.CreateRoleRequest, dryRun bool) (*model.Role, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+	if model.IsReserved(pl.Name) {
+		return nil, newError(payloads.CodeReservedName, "Role names starting with \"%s\" are reserved for built-in roles", model.ReservedPrefix)
+	}
+
+	if err := s.checkMetaPermission(ctx, actor, model.PermissionRolesCreate, "Only users allowed to create roles can create roles"); err != nil {
+		return nil, err
+	}
+
+	defer s.locks.lock(lockRole, pl.Name)()
+	defer s.locks.lock(lockPermission, pl.Permissions...)()
+
+	role := &model.Role{
+		Name:        pl.Name,
+		Description: pl.Description,
+		Permissions: set.NewSet(pl.Permissions...).Slice(),
+		Users:       set.NewSet(pl.Users...).Slice(),
+		Groups:      set.NewSet(pl.Groups...).Slice(),
+		Owners:      set.NewSet(pl.Owners...).Add(actor).Slice(),
+	}
+
+	existing, err := s.store.ReadRole(ctx, pl.Name)
+	if err != nil {
+		return nil, internalError(err, "failed to read role from storage")
+	}
+	if existing != nil {
+		return nil, newError(payloads.CodeRoleExists, "Role \"%s\" already exists!", pl.Name)
+	}
+
+	if err := s.checkCanGrantPermissions(ctx, actor, pl.Permissions); err != nil {
+		return nil, err
+	}
+	if err := s.checkPrincipalsExist(ctx, append(append([]string{}, pl.Users...), pl.Owners...)); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return role, nil
+	}
+
+	if err := s.store.CreateRole(ctx, role); err != nil {
+		return nil, internalError(err, "failed to create new role in storage")
+	}
+
+	// FIXME: move three below to eventual consistence model
+	if err := s.store.AddRoleToPermissions(ctx, pl.Name, pl.Permissions); err != nil {
+		return nil, internalError(err, "failed to add role to permissions in storage")
+	}
+	if err := s.store.AddRoleToUsers(ctx, pl.Name, pl.Users); err != nil {
+		return nil, internalError(err, "failed to add role to users in storage")
+	}
+	if err := s.store.AddRoleToGroups(ctx, pl.Name, pl.Groups); err != nil {
+		return nil, internalError(err, "failed to add role to groups in storage")
+	}
+
+	s.publish(events.New(events.RoleCreated, role.Name, actor))
+	s.publishBindings(events.UserRoleAdded, role.Users, role.Name, actor)
+	s.publishBindings(events.GroupRoleAdded, role.Groups, role.Name, actor)
+	return role, nil
+}
+
+// checkCanGrantPermissions returns an error unless all the
+// permissions exist and the actor owns every one of them
+func (s *service) checkCanGrantPermissions(ctx context.Context, actor string, names []string) error {
+	perms, err := s.store.BulkReadPermissions(ctx, names)
+	if err != nil {
+		return newError(payloads.CodeUnknownPermission, "Permissions %v must all exist", names).withCause(err)
+	}
+	for _, perm := range perms {
+		if err := s.checkOwner(ctx, actor, perm.Owners, model.PermissionPermissionsAdmin, "Only the owners of a permission can add it to a role"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRole returns a role, or an error if it does not exist
+func (s *service) readRole(ctx context.Context, name string) (*model.Role, error) {
+	role, err := s.store.ReadRole(ctx, name)
+	if err != nil {
+		return nil, internalError(err, "failed to read role from storage")
+	}
+	if role == nil {
+		return nil, newError(payloads.CodeRoleNotFound, "Role \"%s\" does not exist!", name)
+	}
+	return role, nil
+}
+
+// readOwnedRole returns a role if it exists and the actor owns it
+func (s *service) readOwnedRole(ctx context.Context, actor, name string) (*model.Role, error) {
+	role, err := s.readRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkOwner(ctx, actor, role.Owners, model.PermissionRolesAdmin, "Only the owners of a role can modify the role"); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// updateRole modifies the description of a role
+func (s *service) updateRole(ctx context.Context, actor, name string, pl *payloads.GenericUpdateDescriptionRequest, dryRun bool) (*model.Role, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+
+	defer s.locks.lock(lockRole, name)()
+
+	role, err := s.readOwnedRole(ctx, actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Description = pl.Description
+	if dryRun {
+		return role, nil
+	}
+
+	if err := s.store.UpdateRole(ctx, role); err != nil {
+		return nil, internalError(err, "failed to update role in storage")
+	}
+
+	s.publish(events.New(events.RoleUpdated, name, actor))
+	return role, nil
+}
+
+// addToRole adds permissions, users, groups, or owners to a role
+func (s *service) addToRole(ctx context.Context, actor, name string, pl *payloads.ModifyRoleRequest, dryRun bool) (*model.Role, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+	if model.IsReserved(name) && len(pl.Owners) > 0 {
+		return nil, newError(payloads.CodeReservedName, "Role \"%s\" is built-in and always owned by its members", name)
+	}
+
+	defer s.locks.lock(lockRole, name)()
+	defer s.locks.lock(lockPermission, pl.Permissions...)()
+
+	role, err := s.readOwnedRole(ctx, actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkCanGrantPermissions(ctx, actor, pl.Permissions); err != nil {
+		return nil, err
+	}
+	if err := s.checkPrincipalsExist(ctx, append(append([]string{}, pl.Users...), pl.Owners...)); err != nil {
+		return nil, err
+	}
+
+	role.Owners = set.NewSet(role.Owners...).Add(pl.Owners...).Slice()
+	role.Users = set.NewSet(role.Users...).Add(pl.Users...).Slice()
+	role.Groups = set.NewSet(role.Groups...).Add(pl.Groups...).Slice()
+	role.Permissions = set.NewSet(role.Permissions...).Add(pl.Permissions...).Slice()
+	if dryRun {
+		return role, nil
+	}
+
+	if err := s.store.UpdateRole(ctx, role); err != nil {
+		return nil, internalError(err, "failed to update role in storage")
+	}
+
+	// FIXME: move three below to eventual consistence model
+	if err := s.store.AddRoleToPermissions(ctx, name, pl.Permissions); err != nil {
+		return nil, internalError(err, "failed to add role to permissions in storage")
+	}
+	if err := s.store.AddRoleToUsers(ctx, name, pl.Users); err != nil {
+		return nil, internalError(err, "failed to add role to users in storage")
+	}
+	if err := s.store.AddRoleToGroups(ctx, name, pl.Groups); err != nil {
+		return nil, internalError(err, "failed to add role to groups in storage")
+	}
+
+	s.publish(events.New(events.RoleUpdated, name, actor))
+	s.publishBindings(events.UserRoleAdded, pl.Users, name, actor)
+	s.publishBindings(events.GroupRoleAdded, pl.Groups, name, actor)
+	return role, nil
+}
+
+// transferRole hands a role over to new owners, replacing the actor among
+// its owners, or every current owner when the transfer is exclusive, see checkTransfer
+func (s *service) transferRole(ctx context.Context, actor, name string, pl *payloads.TransferOwnershipRequest, dryRun bool) (*model.Role, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+	if model.IsReserved(name) {
+		return nil, newError(payloads.CodeReservedName, "Role \"%s\" is built-in and always owned by its members", name)
+	}
+
+	defer s.locks.lock(lockRole, name)()
+
+	role, err := s.readOwnedRole(ctx, actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkTransfer(ctx, actor, role.Owners, model.PermissionRolesAdmin, pl); err != nil {
+		return nil, err
+	}
+	if err := s.checkPrincipalsExist(ctx, pl.To); err != nil {
+		return nil, err
+	}
+
+	role.Owners = transferOwners(role.Owners, actor, pl)
+	if dryRun {
+		return role, nil
+	}
+
+	if err := s.store.UpdateRole(ctx, role); err != nil {
+		return nil, internalError(err, "failed to update role in storage")
+	}
+
+	s.publish(events.New(events.RoleUpdated, name, actor))
+	return role, nil
+}
+
+// removeFromRole removes permissions, users, groups, or owners from a role
+func (s *service) removeFromRole(ctx context.Context, actor, name string, pl *payloads.ModifyRoleRequest, dryRun bool) (*model.Role, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+
+	if set.NewSet(pl.Owners...).Has(actor) {
+		return nil, newError(payloads.CodeCannotRemoveSelf, "Removing yourself as an owner is not allowed, transfer ownership instead")
+	}
+	if model.IsReserved(name) && len(pl.Owners) > 0 {
+		return nil, newError(payloads.CodeReservedName, "Role \"%s\" is built-in and always owned by its members", name)
+	}
+	if name == model.AdminRole {
+		for _, perm := range pl.Permissions {
+			if model.IsReserved(perm) {
+				return nil, newError(payloads.CodeReservedName, "Role \"%s\" is built-in and always holds meta-permission \"%s\"", name, perm)
+			}
+		}
+	}
+
+	defer s.locks.lock(lockRole, name)()
+	defer s.locks.lock(lockPermission, pl.Permissions...)()
+
+	role, err := s.readOwnedRole(ctx, actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Owners = set.NewSet(role.Owners...).Remove(pl.Owners...).Slice()
+	role.Users = set.NewSet(role.Users...).Remove(pl.Users...).Slice()
+	role.Groups = set.NewSet(role.Groups...).Remove(pl.Groups...).Slice()
+	role.Permissions = set.NewSet(role.Permissions...).Remove(pl.Permissions...).Slice()
+	if dryRun {
+		return role, nil
+	}
+
+	if err := s.store.UpdateRole(ctx, role); err != nil {
+		return nil, internalError(err, "failed to update role in storage")
+	}
+
+	// FIXME: move three below to eventual consistence model
+	if err := s.store.RemoveRoleFromPermissions(ctx, name, pl.Permissions); err != nil {
+		return nil, internalError(err, "failed to remove role from permissions in storage")
+	}
+	if err := s.store.RemoveRoleFromUsers(ctx, name, pl.Users); err != nil {
+		return nil, internalError(err, "failed to remove role from users in storage")
+	}
+	if err := s.store.RemoveRoleFromGroups(ctx, name, pl.Groups); err != nil {
+		return nil, internalError(err, "failed to remove role from groups in storage")
+	}
+
+	s.publish(events.New(events.RoleUpdated, name, actor))
+	s.publishBindings(events.UserRoleRemoved, pl.Users, name, actor)
+	s.publishBindings(events.GroupRoleRemoved, pl.Groups, name, actor)
+	return role, nil
+}
+
+// deleteRole deletes a role and all its bindings
+func (s *service) deleteRole(ctx context.Context, actor, name string, dryRun bool) error {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	defer s.locks.lock(lockRole, name)()
+
+	role, err := s.store.ReadRole(ctx, name)
+	if err != nil {
+		return internalError(err, "failed to read role from storage")
+	}
+
+	if role == nil { // (not in store already)
+		return nil
+	}
+
+	if role.Name == model.AdminRole {
+		return newError(payloads.CodeReservedName, "Role \"%s\" is built-in and can't be deleted", role.Name)
+	}
+
+	if err := s.checkOwner(ctx, actor, role.Owners, model.PermissionRolesAdmin, "only the owners of a role can delete the role"); err != nil {
+		return err
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	defer s.locks.lock(lockPermission, role.Permissions...)()
+
+	// FIXME: move three below to eventual consistence model
+	if err := s.store.RemoveRoleFromPermissions(ctx, name, role.Permissions); err != nil {
+		return internalError(err, "failed to remove role from permissions in storage")
+	}
+	if err := s.store.RemoveRoleFromUsers(ctx, name, role.Users); err != nil {
+		return internalError(err, "failed to remove role from users in storage")
+	}
+	if err := s.store.RemoveRoleFromGroups(ctx, name, role.Groups); err != nil {
+		return internalError(err, "failed to remove role from groups in storage")
+	}
+
+	if err := s.store.DeleteRole(ctx, name); err != nil {
+		return internalError(err, "failed to delete role from storage")
+	}
+
+	s.publish(events.New(events.RoleDeleted, name, actor))
+	s.publishBindings(events.UserRoleRemoved, role.Users, name, actor)
+	s.publishBindings(events.GroupRoleRemoved, role.Groups, name, actor)
+	return nil
+}
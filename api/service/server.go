@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// traceFlushTimeout is how long buffered spans have to be exported on shutdown
+const traceFlushTimeout = time.Second * 5
+
+// Server holds the HTTP and gRPC servers of a service, which share
+// the same storage, groups source, and operations
+type Server struct {
+	HTTP *http.Server
+	GRPC *grpc.Server
+
+	svc *service
+}
+
+// NewServer returns the servers for a new service. The caller serves them on
+// its listeners, e.g. with HTTP.Serve and GRPC.Serve, until Shutdown.
+func NewServer(c Config) (*Server, error) {
+	svc, err := newService(c)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []grpc.ServerOption{}
+	if c.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(c.TLS)))
+	}
+	return &Server{
+		HTTP: &http.Server{Handler: svc.router, TLSConfig: c.TLS},
+		GRPC: svc.newGRPCServer(opts...),
+		svc:  svc,
+	}, nil
+}
+
+// Shutdown stops both servers once their in-flight requests finish, then
+// finishes queued webhook deliveries and exports buffered spans. Watch streams
+// never finish on their own, so they are ended right away. Requests and
+// webhook deliveries still in flight when ctx expires are cut off.
+func (s *Server) Shutdown(ctx context.Context) error {
+	close(s.svc.shutdown)
+
+	grpcStopped := make(chan struct{})
+	go func() {
+		s.GRPC.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	err := s.HTTP.Shutdown(ctx)
+	if err != nil {
+		s.HTTP.Close()
+	}
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		s.GRPC.Stop()
+		<-grpcStopped
+	}
+
+	// no more events are published once both servers stopped
+	if werr := s.svc.webhooks.Close(ctx); err == nil {
+		err = werr
+	}
+
+	// spans are exported even when ctx expired, for the requests which were cut off
+	flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), traceFlushTimeout)
+	defer cancel()
+	if terr := s.svc.tracing.Shutdown(flushCtx); err == nil {
+		err = terr
+	}
+	return err
+}
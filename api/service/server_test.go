@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/rbac/api/groups"
+)
+
+func TestShutdown(t *testing.T) {
+	s, err := NewServer(Config{
+		Groups: groups.NewMemorySource(map[string][]string{"alice": {"eng"}}),
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %s", err)
+	}
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config = s.HTTP
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	resp, err := srv.Client().Get(srv.URL + "/watch")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("got %v, %v opening a watch stream, want it open", resp, err)
+	}
+	defer resp.Body.Close()
+	ended := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, resp.Body)
+		close(ended)
+	}()
+
+	// watch streams never finish, so they must not hold up the shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("failed to shut down: %s", err)
+	}
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		t.Error("got the watch stream open after shutting down")
+	}
+	if _, err := srv.Client().Get(srv.URL + "/healthcheck"); err == nil {
+		t.Error("got a request served after shutting down")
+	}
+}
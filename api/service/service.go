@@ -1,10 +1,21 @@
 package service
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"sync"
+	"time"
 
+	"github.com/adrianosela/rbac/api/events"
 	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/metrics"
 	"github.com/adrianosela/rbac/api/storage"
+	"github.com/adrianosela/rbac/api/tracing"
+	"github.com/adrianosela/rbac/api/webhooks"
 	"github.com/gorilla/mux"
 )
 
@@ -14,29 +25,150 @@ var (
 
 // Config represents configuration for the service
 type Config struct {
+	Storage storage.Storage // defaults to in-memory storage
+	Groups  groups.Source   // source of group memberships, defaults to Okta with the settings below
+
+	// OktaOrgDomain and OktaAPIToken configure the default Okta groups
+	// source, they are ignored when Groups is set
 	OktaOrgDomain string
 	OktaAPIToken  string
+
+	WebhookMaxAttempts    int           // defaults to 5
+	WebhookInitialBackoff time.Duration // defaults to 1s, doubles on every retry
+	WebhookAllowPrivate   bool          // allows webhooks to loopback, link-local, and private addresses
+
+	WatchHistorySize int // number of change events retained for resuming watches, defaults to 10000
+
+	Admins []string // users bound to the built-in admin role on start, see bootstrap
+
+	// RestrictCreation requires the model.CreatePermissions meta-permissions
+	// to create objects. Anyone may create them when unset, except for
+	// top-level namespaces, which always require the meta-permission.
+	RestrictCreation bool
+
+	GroupsCacheTTL time.Duration // how long group memberships are cached, defaults to 1m, negative disables caching
+
+	Tracing tracing.Config
+
+	Logger *slog.Logger // defaults to JSON on standard error
+
+	TLS *tls.Config // serves HTTPS and gRPC over TLS when set, only used by NewServer
 }
 
 type service struct {
 	router *mux.Router
 	store  storage.Storage
 	groups groups.Source
+	admins []string
+
+	restrictCreation     bool // see Config.RestrictCreation
+	allowPrivateWebhooks bool // see Config.WebhookAllowPrivate
+
+	// writes is held for reading by every operation which modifies storage,
+	// and for writing by operations which need a consistent view of all of it.
+	// It doesn't serialize the operations modifying storage, locks does.
+	writes sync.RWMutex
+	locks  *objectLocks
+
+	changes  *events.Log
+	webhooks *webhooks.Dispatcher
+	metrics  *metrics.Metrics
+	tracing  *tracing.Tracing
+	logger   *slog.Logger
+
+	openAPI []byte // the JSON OpenAPI document of all routes
+
+	shutdown chan struct{} // closed when the service shuts down, ending watch streams
 }
 
 // New returns the handler for a new service
 func New(c Config) (http.Handler, error) {
+	svc, err := newService(c)
+	if err != nil {
+		return nil, err
+	}
+	return svc.router, nil
+}
+
+func newService(c Config) (*service, error) {
+	if c.Groups == nil {
+		if c.OktaOrgDomain == "" || c.OktaAPIToken == "" {
+			return nil, fmt.Errorf("no groups source configured, and no Okta org domain and API token for the default one")
+		}
+		c.Groups = groups.NewOktaSource(c.OktaOrgDomain, c.OktaAPIToken)
+	}
+	if c.Storage == nil {
+		c.Storage = storage.NewMemoryStorage()
+	}
+	if c.Logger == nil {
+		c.Logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	}
+
+	m := metrics.New()
+	t, err := tracing.New(c.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up tracing: %s", err)
+	}
+
+	// storage and groups lookups are instrumented, lookups served
+	// from the groups cache are traced but not timed in the metrics
+	var src groups.Source = m.InstrumentGroups(c.Groups)
+	if c.GroupsCacheTTL == 0 {
+		c.GroupsCacheTTL = time.Minute
+	}
+	if c.GroupsCacheTTL > 0 {
+		cache := groups.NewCachingSource(src, c.GroupsCacheTTL)
+		m.RegisterGroupsCache(cache)
+		src = cache
+	}
+	src = t.InstrumentGroups(src)
 
 	svc := &service{
 		router: mux.NewRouter(),
-		store:  storage.NewMemoryStorage(), // FIXME: use remote storage
-		groups: groups.NewOktaSource(c.OktaOrgDomain, c.OktaAPIToken),
+		store:  t.InstrumentStorage(m.InstrumentStorage(c.Storage)),
+		groups: src,
+		admins: c.Admins,
+
+		restrictCreation:     c.RestrictCreation,
+		allowPrivateWebhooks: c.WebhookAllowPrivate,
+
+		locks:    newObjectLocks(),
+		changes:  events.NewLog(c.WatchHistorySize),
+		webhooks: webhooks.NewDispatcher(c.WebhookMaxAttempts, c.WebhookInitialBackoff, c.WebhookAllowPrivate),
+		metrics:  m,
+		tracing:  t,
+		logger:   c.Logger,
+		shutdown: make(chan struct{}),
 	}
 
+	svc.router.Use(svc.trace, svc.logRequests, svc.instrument)
+	svc.router.NotFoundHandler = svc.trace(svc.logRequests(svc.instrument(http.HandlerFunc(notFoundHandler))))
+	svc.router.MethodNotAllowedHandler = svc.trace(svc.logRequests(svc.instrument(http.HandlerFunc(methodNotAllowedHandler))))
+
 	svc.setDebugEndpoints()
 	svc.setPermissionEndpoints()
+	svc.setNamespaceEndpoints()
 	svc.setRoleEndpoints()
 	svc.setUserEndpoints()
+	svc.setGroupEndpoints()
+	svc.setServiceAccountEndpoints()
+	svc.setOrphanEndpoints()
+	svc.setWebhookEndpoints()
+	svc.setWatchEndpoints()
+	svc.setApplyEndpoints()
+	svc.setAdminEndpoints()
+	svc.setMetricsEndpoints()
+	svc.setOpenAPIEndpoints()
 
-	return svc.router, nil
+	openAPI, err := encodeOpenAPI(svc.router, svc.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI document: %s", err)
+	}
+	svc.openAPI = openAPI
+
+	if err := svc.bootstrap(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to bootstrap the admin role: %s", err)
+	}
+
+	return svc, nil
 }
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/groups"
+)
+
+// hasCode returns whether err is an API error with the code
+func hasCode(err error, code string) bool {
+	var ae *apiError
+	return errors.As(err, &ae) && ae.code == code
+}
+
+func TestNewDefaultsToOkta(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if _, err := newService(Config{OktaOrgDomain: "example.okta", Logger: logger}); err == nil {
+		t.Error("created a service without an Okta API token or groups source")
+	}
+	if _, err := newService(Config{Groups: groups.NewMemorySource(nil), OktaOrgDomain: "ignored", Logger: logger}); err != nil {
+		t.Errorf("failed to create service with a groups source: %s", err)
+	}
+
+	svc, err := newService(Config{OktaOrgDomain: "example.okta", OktaAPIToken: "token", Logger: logger})
+	if err != nil {
+		t.Fatalf("failed to create service with Okta settings: %s", err)
+	}
+
+	outgoing := []*http.Request{}
+	defer func(rt http.RoundTripper) { http.DefaultTransport = rt }(http.DefaultTransport)
+	http.DefaultTransport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		outgoing = append(outgoing, r)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`[{"profile":{"name":"eng"}}]`)), Header: http.Header{}, Request: r}, nil
+	})
+	got, err := svc.groups.GetForUser(context.Background(), "alice")
+	if err != nil || len(got) != 1 || got[0] != "eng" {
+		t.Errorf("got groups %v, %v, want the groups from Okta", got, err)
+	}
+	if len(outgoing) != 1 || outgoing[0].URL.Host != "example.okta.com" || outgoing[0].Header.Get("Authorization") != "SSWS token" {
+		t.Errorf("got requests %v, want one to the configured Okta org with its token", outgoing)
+	}
+}
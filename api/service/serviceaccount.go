@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/gorilla/mux"
+)
+
+func (s *service) setServiceAccountEndpoints() {
+	s.router.Methods(http.MethodPost).Path("/serviceaccount").Handler(s.auth(s.createServiceAccountHandler))
+	s.router.Methods(http.MethodGet).Path("/serviceaccount/{name}").HandlerFunc(s.readServiceAccountHandler)
+	s.router.Methods(http.MethodDelete).Path("/serviceaccount/{name}").Handler(s.auth(s.deleteServiceAccountHandler))
+
+	s.router.Methods(http.MethodPost).Path("/serviceaccount/{name}/key").Handler(s.auth(s.createAPIKeyHandler))
+	s.router.Methods(http.MethodPost).Path("/serviceaccount/{name}/key/{id}/rotate").Handler(s.auth(s.rotateAPIKeyHandler))
+	s.router.Methods(http.MethodDelete).Path("/serviceaccount/{name}/key/{id}").Handler(s.auth(s.revokeAPIKeyHandler))
+}
+
+func (s *service) createServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	var pl *payloads.CreateServiceAccountRequest
+	if err := unmarshalRequestBody(r, &pl); err != nil {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a service account: %s", err))
+		return
+	}
+
+	sa, err := s.createServiceAccount(r.Context(), authenticatedUser, pl)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Service account \"%s\" created successfully!", sa.Name)))
+	return
+}
+
+func (s *service) readServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no service account name in request URL"))
+		return
+	}
+
+	sa, err := s.readServiceAccount(r.Context(), name)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	saBytes, err := json.Marshal(&sa)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(saBytes)
+	return
+}
+
+func (s *service) deleteServiceAccountHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no service account name in request URL"))
+		return
+	}
+
+	if err := s.deleteServiceAccount(r.Context(), authenticatedUser, name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Service account \"%s\" deleted successfully!", name)))
+	return
+}
+
+func (s *service) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no service account name in request URL"))
+		return
+	}
+
+	// the body is optional, a key which never expires is created without one
+	pl := &payloads.CreateAPIKeyRequest{}
+	if r.ContentLength != 0 {
+		if err := unmarshalRequestBody(r, &pl); err != nil {
+			writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not an API key request: %s", err))
+			return
+		}
+	}
+
+	resp, err := s.createAPIKey(r.Context(), authenticatedUser, name, pl)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeAPIKey(w, r, resp)
+}
+
+func (s *service) rotateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	vars := mux.Vars(r)
+	name, id := vars["name"], vars["id"]
+	if name == "" || id == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no service account name or key id in request URL"))
+		return
+	}
+
+	// the body is optional, the old key stops working right away without one
+	pl := &payloads.RotateAPIKeyRequest{}
+	if r.ContentLength != 0 {
+		if err := unmarshalRequestBody(r, &pl); err != nil {
+			writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not an API key rotation: %s", err))
+			return
+		}
+	}
+
+	resp, err := s.rotateAPIKey(r.Context(), authenticatedUser, name, id, pl)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	writeAPIKey(w, r, resp)
+}
+
+func (s *service) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	vars := mux.Vars(r)
+	name, id := vars["name"], vars["id"]
+	if name == "" || id == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no service account name or key id in request URL"))
+		return
+	}
+
+	if err := s.revokeAPIKey(r.Context(), authenticatedUser, name, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("API key \"%s\" of service account \"%s\" revoked successfully!", id, name)))
+	return
+}
+
+// writeAPIKey writes the response for a new API key
+func writeAPIKey(w http.ResponseWriter, r *http.Request, resp *payloads.CreateAPIKeyResponse) {
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+}
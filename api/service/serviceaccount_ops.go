@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/adrianosela/rbac/api/apikeys"
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/storage"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+const (
+	// maxAPIKeys is the maximum number of keys of a service account, which
+	// leaves room for rotating a few keys at once without keys piling up
+	maxAPIKeys = 10
+
+	// apiKeyTouchInterval is how often the last use of an API key is
+	// written, so that authenticating doesn't write to storage every time
+	apiKeyTouchInterval = time.Minute
+)
+
+// createServiceAccount creates a new service account owned by the actor
+func (s *service) createServiceAccount(ctx context.Context, actor string, pl *payloads.CreateServiceAccountRequest) (*model.ServiceAccount, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+
+	if err := s.checkMetaPermission(ctx, actor, model.PermissionServiceAccountsCreate, "Only users allowed to create service accounts can create service accounts"); err != nil {
+		return nil, err
+	}
+
+	sa := &model.ServiceAccount{
+		Name:        pl.Name,
+		Description: pl.Description,
+		Owners:      set.NewSet(pl.Owners...).Add(actor).Slice(),
+		Keys:        []*model.APIKey{},
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	defer s.locks.lock(lockServiceAccount, pl.Name)()
+
+	existing, err := s.store.ReadServiceAccount(ctx, pl.Name)
+	if err != nil {
+		return nil, internalError(err, "failed to read service account from storage")
+	}
+	if existing != nil {
+		return nil, newError(payloads.CodeServiceAccountExists, "Service account \"%s\" already exists!", pl.Name)
+	}
+
+	if err := s.checkPrincipalsExist(ctx, pl.Owners); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.CreateServiceAccount(ctx, sa); err != nil {
+		return nil, internalError(err, "failed to create new service account in storage")
+	}
+
+	s.publish(events.New(events.ServiceAccountCreated, sa.Name, actor))
+	return sa, nil
+}
+
+// readServiceAccount returns a service account, or an error if it does not exist
+func (s *service) readServiceAccount(ctx context.Context, name string) (*model.ServiceAccount, error) {
+	sa, err := s.store.ReadServiceAccount(ctx, name)
+	if err != nil {
+		return nil, internalError(err, "failed to read service account from storage")
+	}
+	if sa == nil {
+		return nil, newError(payloads.CodeServiceAccountNotFound, "Service account \"%s\" does not exist!", name)
+	}
+	return sa, nil
+}
+
+// readOwnedServiceAccount returns a service account if it exists and the actor owns it
+func (s *service) readOwnedServiceAccount(ctx context.Context, actor, name string) (*model.ServiceAccount, error) {
+	sa, err := s.readServiceAccount(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkOwner(ctx, actor, sa.Owners, model.PermissionServiceAccountsAdmin, "Only the owners of a service account can modify the service account"); err != nil {
+		return nil, err
+	}
+	return sa, nil
+}
+
+// deleteServiceAccount deletes a service account and all its keys. Service
+// accounts bound to roles or owning objects can't be deleted, since whoever
+// creates one with the same name later would inherit its access.
+func (s *service) deleteServiceAccount(ctx context.Context, actor, name string) error {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	defer s.locks.lock(lockServiceAccount, name)()
+
+	sa, err := s.store.ReadServiceAccount(ctx, name)
+	if err != nil {
+		return internalError(err, "failed to read service account from storage")
+	}
+
+	if sa == nil { // (not in store already)
+		return nil
+	}
+
+	if err := s.checkOwner(ctx, actor, sa.Owners, model.PermissionServiceAccountsAdmin, "only the owners of a service account can delete the service account"); err != nil {
+		return err
+	}
+
+	principal := model.ServiceAccountPrincipal(name)
+	user, err := s.store.ReadUser(ctx, principal)
+	if err != nil {
+		return internalError(err, "failed to read user from storage")
+	}
+	if user != nil && len(user.Roles) > 0 {
+		return newError(payloads.CodeServiceAccountInUse, "Service account \"%s\" is in use. Must first remove it from roles %v", name, user.Roles)
+	}
+	ownedRoles, _, err := s.store.ScanRoles(ctx, storage.ListOptions{Owner: principal, Limit: 1})
+	if err != nil {
+		return internalError(err, "failed to list roles in storage")
+	}
+	ownedPermissions, _, err := s.store.ScanPermissions(ctx, storage.ListOptions{Owner: principal, Limit: 1})
+	if err != nil {
+		return internalError(err, "failed to list permissions in storage")
+	}
+	if len(ownedRoles) > 0 || len(ownedPermissions) > 0 {
+		return newError(payloads.CodeServiceAccountInUse, "Service account \"%s\" is in use. Must first remove it from the owners of the roles and permissions it owns", name)
+	}
+
+	if err := s.store.DeleteServiceAccount(ctx, name); err != nil {
+		return internalError(err, "failed to delete service account from storage")
+	}
+
+	s.publish(events.New(events.ServiceAccountDeleted, name, actor))
+	return nil
+}
+
+// createAPIKey creates a new API key for a service account
+func (s *service) createAPIKey(ctx context.Context, actor, name string, pl *payloads.CreateAPIKeyRequest) (*payloads.CreateAPIKeyResponse, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+
+	defer s.locks.lock(lockServiceAccount, name)()
+
+	sa, err := s.readOwnedServiceAccount(ctx, actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := addAPIKey(sa, pl.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.UpdateServiceAccount(ctx, sa); err != nil {
+		return nil, internalError(err, "failed to update service account in storage")
+	}
+
+	s.publish(events.New(events.ServiceAccountUpdated, name, actor))
+	return resp, nil
+}
+
+// rotateAPIKey replaces an API key of a service account with a new one. The
+// old key keeps working for the grace period, so that callers can switch over.
+func (s *service) rotateAPIKey(ctx context.Context, actor, name, id string, pl *payloads.RotateAPIKeyRequest) (*payloads.CreateAPIKeyResponse, error) {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+
+	defer s.locks.lock(lockServiceAccount, name)()
+
+	sa, err := s.readOwnedServiceAccount(ctx, actor, name)
+	if err != nil {
+		return nil, err
+	}
+
+	i := apiKeyIndex(sa, id)
+	if i < 0 {
+		return nil, newError(payloads.CodeAPIKeyNotFound, "Service account \"%s\" has no API key \"%s\"", name, id)
+	}
+
+	var grace time.Duration
+	if pl.GracePeriod != "" {
+		grace, _ = time.ParseDuration(pl.GracePeriod) // validated
+	}
+	old := sa.Keys[i]
+	if grace == 0 {
+		sa.Keys = append(sa.Keys[:i], sa.Keys[i+1:]...)
+	} else if expires := time.Now().UTC().Add(grace); !old.Expired(expires) {
+		old.ExpiresAt = &expires
+	}
+
+	resp, err := addAPIKey(sa, pl.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.UpdateServiceAccount(ctx, sa); err != nil {
+		return nil, internalError(err, "failed to update service account in storage")
+	}
+
+	s.publish(events.New(events.ServiceAccountUpdated, name, actor))
+	return resp, nil
+}
+
+// revokeAPIKey deletes an API key of a service account, which stops working right away
+func (s *service) revokeAPIKey(ctx context.Context, actor, name, id string) error {
+	s.writes.RLock()
+	defer s.writes.RUnlock()
+
+	defer s.locks.lock(lockServiceAccount, name)()
+
+	sa, err := s.readOwnedServiceAccount(ctx, actor, name)
+	if err != nil {
+		return err
+	}
+
+	i := apiKeyIndex(sa, id)
+	if i < 0 {
+		return newError(payloads.CodeAPIKeyNotFound, "Service account \"%s\" has no API key \"%s\"", name, id)
+	}
+	sa.Keys = append(sa.Keys[:i], sa.Keys[i+1:]...)
+
+	if err := s.store.UpdateServiceAccount(ctx, sa); err != nil {
+		return internalError(err, "failed to update service account in storage")
+	}
+
+	s.publish(events.New(events.ServiceAccountUpdated, name, actor))
+	return nil
+}
+
+// authenticateAPIKey returns the principal of the service account an API key
+// belongs to, or an error if the key is not a valid and unexpired key
+func (s *service) authenticateAPIKey(ctx context.Context, key string) (string, error) {
+	name, id, ok := apikeys.Parse(key)
+	if !ok {
+		return "", newError(payloads.CodeUnauthenticated, "Bearer token is not an API key")
+	}
+
+	sa, err := s.store.ReadServiceAccount(ctx, name)
+	if err != nil {
+		return "", internalError(err, "failed to read service account from storage")
+	}
+	// the same error for every failure, so that keys can't be probed
+	invalid := newError(payloads.CodeUnauthenticated, "API key is invalid, revoked, or expired")
+	if sa == nil {
+		return "", invalid
+	}
+	i := apiKeyIndex(sa, id)
+	if i < 0 {
+		return "", invalid
+	}
+	now := time.Now().UTC()
+	if k := sa.Keys[i]; !apikeys.Verify(key, k.Hash) || k.Expired(now) {
+		return "", invalid
+	}
+
+	if last := sa.Keys[i].LastUsed; last == nil || now.Sub(*last) > apiKeyTouchInterval {
+		if err := s.store.TouchAPIKey(ctx, name, id, now); err != nil {
+			// the key is valid regardless, only its last use is out of date
+			logFields(ctx, slog.String("error", fmt.Sprintf("failed to record use of API key: %s", err)))
+		}
+	}
+	return model.ServiceAccountPrincipal(name), nil
+}
+
+// addAPIKey generates a new API key and adds it to a service account
+func addAPIKey(sa *model.ServiceAccount, expiresAt *time.Time) (*payloads.CreateAPIKeyResponse, error) {
+	if len(sa.Keys) >= maxAPIKeys {
+		return nil, newError(payloads.CodeInvalidRequest, "Service account \"%s\" already has %d API keys, must first revoke one", sa.Name, maxAPIKeys)
+	}
+
+	key, id, hash, err := apikeys.Generate(sa.Name)
+	if err != nil {
+		return nil, internalError(err, "failed to generate API key")
+	}
+
+	apiKey := &model.APIKey{ID: id, Hash: hash, CreatedAt: time.Now().UTC()}
+	if expiresAt != nil {
+		expires := expiresAt.UTC()
+		apiKey.ExpiresAt = &expires
+	}
+	sa.Keys = append(sa.Keys, apiKey)
+	return &payloads.CreateAPIKeyResponse{Key: key, APIKey: apiKey}, nil
+}
+
+// apiKeyIndex returns the index of a key of a service account, or -1 if it has no such key
+func apiKeyIndex(sa *model.ServiceAccount, id string) int {
+	for i, key := range sa.Keys {
+		if key.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/rbac/api/rbacpb"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// authenticate makes a request to /authcheck with the API key as bearer
+// token and the user in the header, and returns the status and the body
+func authenticate(t *testing.T, svc *service, key, user string) (int, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/authcheck", nil)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	if user != "" {
+		req.Header.Set("MOCK_AUTHENTICATED_USER", user)
+	}
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+// newTestServiceAccount creates the service account "ci" owned by alice,
+// and returns a new key of it
+func newTestServiceAccount(t *testing.T, svc *service) *payloads.CreateAPIKeyResponse {
+	t.Helper()
+
+	ctx := context.Background()
+	if _, err := svc.createServiceAccount(ctx, "alice", &payloads.CreateServiceAccountRequest{Name: "ci"}); err != nil {
+		t.Fatalf("failed to create service account: %s", err)
+	}
+	key, err := svc.createAPIKey(ctx, "alice", "ci", &payloads.CreateAPIKeyRequest{})
+	if err != nil {
+		t.Fatalf("failed to create API key: %s", err)
+	}
+	return key
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	svc := newTestService(t)
+	key := newTestServiceAccount(t, svc)
+
+	if status, body := authenticate(t, svc, key.Key, "mallory"); status != http.StatusOK || !strings.Contains(body, `"sa:ci"`) {
+		t.Errorf("got %d %s, want the service account authenticated by its key", status, body)
+	}
+	if status, _ := authenticate(t, svc, key.Key+"x", ""); status != http.StatusUnauthorized {
+		t.Errorf("got status %d with a wrong secret, want %d", status, http.StatusUnauthorized)
+	}
+
+	last, err := svc.readServiceAccount(context.Background(), "ci")
+	if err != nil {
+		t.Fatalf("failed to read service account: %s", err)
+	}
+	if last.Keys[0].LastUsed == nil {
+		t.Error("got no last use of a key which authenticated")
+	}
+}
+
+func TestServiceAccountOnlyAuthenticatesWithKey(t *testing.T) {
+	svc := newTestService(t)
+	newTestServiceAccount(t, svc)
+
+	if status, body := authenticate(t, svc, "", "sa:ci"); status != http.StatusUnauthorized {
+		t.Errorf("got %d %s with a service account in the header, want %d", status, body, http.StatusUnauthorized)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), authenticatedUserMetadataKey, "sa:ci")
+	_, err := newTestGRPC(t, svc).CreatePermission(ctx, &rbacpb.CreatePermissionRequest{Name: "docs.read"})
+	if code, _ := grpcCode(err); code != codes.Unauthenticated {
+		t.Errorf("got %v with a service account in the metadata, want %s", err, codes.Unauthenticated)
+	}
+}
+
+func TestExpiredAPIKey(t *testing.T) {
+	svc := newTestService(t)
+	key := newTestServiceAccount(t, svc)
+	ctx := context.Background()
+
+	sa, err := svc.readServiceAccount(ctx, "ci")
+	if err != nil {
+		t.Fatalf("failed to read service account: %s", err)
+	}
+	expired := time.Now().UTC().Add(-time.Second)
+	sa.Keys[0].ExpiresAt = &expired
+	if err := svc.store.UpdateServiceAccount(ctx, sa); err != nil {
+		t.Fatalf("failed to update service account: %s", err)
+	}
+
+	if status, _ := authenticate(t, svc, key.Key, ""); status != http.StatusUnauthorized {
+		t.Errorf("got status %d with an expired key, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	svc := newTestService(t)
+	old := newTestServiceAccount(t, svc)
+	ctx := context.Background()
+
+	// the old key keeps working for the grace period
+	graced, err := svc.rotateAPIKey(ctx, "alice", "ci", old.ID, &payloads.RotateAPIKeyRequest{GracePeriod: "1h"})
+	if err != nil {
+		t.Fatalf("failed to rotate key: %s", err)
+	}
+	for _, key := range []string{old.Key, graced.Key} {
+		if status, _ := authenticate(t, svc, key, ""); status != http.StatusOK {
+			t.Errorf("got status %d within the grace period, want both keys working", status)
+		}
+	}
+	sa, err := svc.readServiceAccount(ctx, "ci")
+	if err != nil {
+		t.Fatalf("failed to read service account: %s", err)
+	}
+	if k := sa.Keys[apiKeyIndex(sa, old.ID)]; k.ExpiresAt == nil || k.ExpiresAt.After(time.Now().Add(time.Hour)) {
+		t.Errorf("got old key expiring at %v, want within the grace period", k.ExpiresAt)
+	}
+
+	// without a grace period the old key stops working right away
+	rotated, err := svc.rotateAPIKey(ctx, "alice", "ci", graced.ID, &payloads.RotateAPIKeyRequest{})
+	if err != nil {
+		t.Fatalf("failed to rotate key: %s", err)
+	}
+	if status, _ := authenticate(t, svc, graced.Key, ""); status != http.StatusUnauthorized {
+		t.Errorf("got status %d with a key rotated without grace, want %d", status, http.StatusUnauthorized)
+	}
+	if status, _ := authenticate(t, svc, rotated.Key, ""); status != http.StatusOK {
+		t.Errorf("got status %d with the new key, want %d", status, http.StatusOK)
+	}
+
+	if _, err := svc.rotateAPIKey(ctx, "bob", "ci", rotated.ID, &payloads.RotateAPIKeyRequest{}); !hasCode(err, payloads.CodeNotOwner) {
+		t.Errorf("got error %v rotating someone else's key, want %s", err, payloads.CodeNotOwner)
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	svc := newTestService(t)
+	key := newTestServiceAccount(t, svc)
+	ctx := context.Background()
+
+	if err := svc.revokeAPIKey(ctx, "alice", "ci", key.ID); err != nil {
+		t.Fatalf("failed to revoke key: %s", err)
+	}
+	if status, _ := authenticate(t, svc, key.Key, ""); status != http.StatusUnauthorized {
+		t.Errorf("got status %d with a revoked key, want %d", status, http.StatusUnauthorized)
+	}
+	if err := svc.revokeAPIKey(ctx, "alice", "ci", key.ID); !hasCode(err, payloads.CodeAPIKeyNotFound) {
+		t.Errorf("got error %v revoking a revoked key, want %s", err, payloads.CodeAPIKeyNotFound)
+	}
+}
+
+func TestAPIKeyLimit(t *testing.T) {
+	svc := newTestService(t)
+	newTestServiceAccount(t, svc)
+	ctx := context.Background()
+
+	for i := 1; i < maxAPIKeys; i++ {
+		if _, err := svc.createAPIKey(ctx, "alice", "ci", &payloads.CreateAPIKeyRequest{}); err != nil {
+			t.Fatalf("failed to create key %d: %s", i+1, err)
+		}
+	}
+	if _, err := svc.createAPIKey(ctx, "alice", "ci", &payloads.CreateAPIKeyRequest{}); !hasCode(err, payloads.CodeInvalidRequest) {
+		t.Errorf("got error %v creating key %d, want %s", err, maxAPIKeys+1, payloads.CodeInvalidRequest)
+	}
+}
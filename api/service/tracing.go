@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// trace wraps a handler, running every request in a server span which
+// continues the trace of the caller when W3C trace context headers are set
+func (s *service) trace(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := s.tracing.Tracer().Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		rec := newStatusRecorder(w)
+		h.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// traceGRPC is a gRPC interceptor which runs every call in a server span which
+// continues the trace of the caller when W3C trace context metadata is set
+func (s *service) traceGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	ctx, span := s.tracing.Tracer().Start(ctx, info.FullMethod,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.RPCSystemGRPC),
+	)
+	defer span.End()
+
+	resp, err := handler(ctx, req)
+	st, _ := status.FromError(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(st.Code())))
+	if err != nil {
+		span.SetStatus(codes.Error, st.Message())
+	}
+	return resp, err
+}
+
+// metadataCarrier adapts gRPC metadata to a propagation.TextMapCarrier
+type metadataCarrier metadata.MD
+
+// Get returns the first value of a key
+func (mc metadataCarrier) Get(key string) string {
+	if values := metadata.MD(mc).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Set sets the value of a key
+func (mc metadataCarrier) Set(key, value string) {
+	metadata.MD(mc).Set(key, value)
+}
+
+// Keys returns all the keys
+func (mc metadataCarrier) Keys() []string {
+	keys := []string{}
+	for key := range mc {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/rbacpb"
+	"github.com/adrianosela/rbac/api/tracing"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	callerTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	callerSpanID  = "00f067aa0ba902b7"
+	traceparent   = "00-" + callerTraceID + "-" + callerSpanID + "-01"
+)
+
+// roundTripFunc is an http.RoundTripper made of a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func newTracedService(t *testing.T, src groups.Source) *service {
+	t.Helper()
+
+	svc, err := newService(Config{
+		Groups:  src,
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Tracing: tracing.Config{Exporter: tracing.ExporterMemory},
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	svc.tracing.Memory().Reset() // spans of bootstrapping the admin role
+	return svc
+}
+
+// findSpan fails the test unless there is exactly one span with the name
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+
+	found := []tracetest.SpanStub{}
+	for _, span := range spans {
+		if span.Name == name {
+			found = append(found, span)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("got %d %q spans, want 1", len(found), name)
+	}
+	return found[0]
+}
+
+// checkParent fails the test unless child is a child span of parent
+func checkParent(t *testing.T, child, parent tracetest.SpanStub) {
+	t.Helper()
+
+	if child.Parent.SpanID() != parent.SpanContext.SpanID() || child.SpanContext.TraceID() != parent.SpanContext.TraceID() {
+		t.Errorf("%q span has parent %s, want %q span %s", child.Name, child.Parent.SpanID(), parent.Name, parent.SpanContext.SpanID())
+	}
+}
+
+func TestTraceHTTP(t *testing.T) {
+	svc := newTracedService(t, groups.NewOktaSource("example.okta", "token"))
+
+	// every request to Okta is answered with no groups
+	outgoing := []*http.Request{}
+	defer func(rt http.RoundTripper) { http.DefaultTransport = rt }(http.DefaultTransport)
+	http.DefaultTransport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		outgoing = append(outgoing, r)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("[]")), Header: http.Header{}, Request: r}, nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/user/alice", nil)
+	req.Header.Set("traceparent", traceparent)
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+
+	spans := svc.tracing.Memory().GetSpans()
+	server := findSpan(t, spans, "GET /user/{name}")
+	if server.SpanKind != trace.SpanKindServer {
+		t.Errorf("got span kind %s for the request, want server", server.SpanKind)
+	}
+	if server.SpanContext.TraceID().String() != callerTraceID || server.Parent.SpanID().String() != callerSpanID || !server.Parent.IsRemote() {
+		t.Errorf("request span is in trace %s under %s, want the caller's trace %s under %s",
+			server.SpanContext.TraceID(), server.Parent.SpanID(), callerTraceID, callerSpanID)
+	}
+
+	checkParent(t, findSpan(t, spans, "storage.ReadUser"), server)
+	getForUser := findSpan(t, spans, "groups.GetForUser")
+	checkParent(t, getForUser, server)
+
+	if len(outgoing) != 1 || !strings.HasSuffix(outgoing[0].URL.Path, "/users/alice/groups") {
+		t.Fatalf("got requests %v to Okta, want the groups of alice", outgoing)
+	}
+	want := "00-" + callerTraceID + "-" + getForUser.SpanContext.SpanID().String() + "-01"
+	if got := outgoing[0].Header.Get("traceparent"); got != want {
+		t.Errorf("got traceparent %q to Okta, want %q from the groups.GetForUser span", got, want)
+	}
+}
+
+func TestTraceErrors(t *testing.T) {
+	svc := newTracedService(t, groups.NewMemorySource(map[string][]string{}))
+
+	// unknown to the memory source, so resolving the user fails
+	req := httptest.NewRequest(http.MethodGet, "/user/alice", nil)
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	spans := svc.tracing.Memory().GetSpans()
+	server := findSpan(t, spans, "GET /user/{name}")
+	if server.Parent.IsValid() {
+		t.Errorf("request span has parent %s without a traceparent header, want a new trace", server.Parent.SpanID())
+	}
+	getForUser := findSpan(t, spans, "groups.GetForUser")
+	checkParent(t, getForUser, server)
+	if getForUser.Status.Code != codes.Error || len(getForUser.Events) == 0 {
+		t.Errorf("got status %v and events %v for a failed lookup, want the error recorded", getForUser.Status, getForUser.Events)
+	}
+	if server.Status.Code != codes.Error {
+		t.Errorf("got status %v for a 500 response, want an error", server.Status)
+	}
+}
+
+func TestTraceGRPC(t *testing.T) {
+	svc := newTracedService(t, groups.NewMemorySource(map[string][]string{"alice": {}}))
+	c := newTestGRPC(t, svc)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), authenticatedUserMetadataKey, "alice", "traceparent", traceparent)
+	if _, err := c.CreatePermission(ctx, &rbacpb.CreatePermissionRequest{Name: "docs.read"}); err != nil {
+		t.Fatalf("CreatePermission: %s", err)
+	}
+
+	spans := svc.tracing.Memory().GetSpans()
+	server := findSpan(t, spans, rbacpb.RBAC_CreatePermission_FullMethodName)
+	if server.SpanKind != trace.SpanKindServer || server.SpanContext.TraceID().String() != callerTraceID || server.Parent.SpanID().String() != callerSpanID {
+		t.Errorf("got call span %s in trace %s under %s, want a server span in the caller's trace",
+			server.SpanKind, server.SpanContext.TraceID(), server.Parent.SpanID())
+	}
+	checkParent(t, findSpan(t, spans, "storage.CreatePermission"), server)
+}
@@ -2,9 +2,9 @@ package service
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 
+	"github.com/adrianosela/rbac/api/resolver"
 	"github.com/adrianosela/rbac/api/service/payloads"
 	"github.com/adrianosela/rbac/utils/set"
 	"github.com/gorilla/mux"
@@ -12,63 +12,60 @@ import (
 
 func (s *service) setUserEndpoints() {
 	s.router.Methods(http.MethodGet).Path("/user/{name}").HandlerFunc(s.getUserPermissionsHandler)
+	s.router.Methods(http.MethodGet).Path("/user/{name}/roles").HandlerFunc(s.getUserRolesHandler)
 }
 
 func (s *service) getUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
 	name := mux.Vars(r)["name"]
 	if name == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("no role name in request URL"))
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no user name in request URL"))
 		return
 	}
 
-	groups, err := s.groups.GetForUser(name)
+	perms, err := resolver.UserPermissions(r.Context(), s.store, s.groups, name)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("failed to get groups for user: %s", err))) // FIXME: do not expose internals
+		writeError(w, r, internalError(err, "failed to resolve permissions for user"))
 		return
 	}
 
-	roles := set.NewSet()
-
-	// collect roles tied to groups
-	gs, err := s.store.ReadGroups(groups)
+	respBytes, err := json.Marshal(&payloads.GetUserPermissionsResponse{Persmissions: perms.Slice()})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("failed to bulk-get groups from store: %s", err))) // FIXME: do not expose internals
+		writeError(w, r, internalError(err, "failed to encode response"))
 		return
 	}
-	for _, group := range gs {
-		roles.Add(group.Roles...)
-	}
 
-	// collect roles tied to user
-	user, err := s.store.ReadUser(name)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("failed to get user from store: %s", err))) // FIXME: do not expose internals
+	w.WriteHeader(http.StatusOK)
+	w.Write(respBytes)
+	return
+}
+
+func (s *service) getUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no user name in request URL"))
 		return
 	}
-	if user != nil {
-		roles.Add(user.Roles...)
-	}
 
-	rs, err := s.store.BulkReadRoles(roles.Slice())
+	roles, err := resolver.ResolveRoles(r.Context(), s.store, s.groups, name)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("failed to bulk-get roles from store: %s", err))) // FIXME: do not expose internals
+		writeError(w, r, internalError(err, "failed to resolve roles for user"))
 		return
 	}
 
-	perms := set.NewSet()
-	for _, role := range rs {
-		perms.Add(role.Permissions...)
+	viaGroups := make(map[string][]string)
+	for group, groupRoles := range roles.ViaGroups {
+		viaGroups[group] = sorted(groupRoles)
 	}
 
-	respBytes, err := json.Marshal(&payloads.GetUserPermissionsResponse{Persmissions: perms.Slice()})
+	respBytes, err := json.Marshal(&payloads.GetUserRolesResponse{
+		User:      name,
+		Groups:    sorted(set.NewSet(roles.Groups...)),
+		Direct:    sorted(roles.Direct),
+		ViaGroups: viaGroups,
+		Effective: sorted(roles.Effective()),
+	})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("failed to marshal response: %s", err)))
+		writeError(w, r, internalError(err, "failed to encode response"))
 		return
 	}
 
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+func TestGetUserRoles(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	for _, role := range []payloads.CreateRoleRequest{
+		{Name: "readers", Users: []string{"alice"}, Groups: []string{"eng"}},
+		{Name: "writers", Groups: []string{"eng"}},
+		{Name: "oncall", Users: []string{"alice"}},
+		{Name: "ops", Users: []string{"carol"}},
+	} {
+		if _, err := svc.createRole(ctx, "alice", &role, false); err != nil {
+			t.Fatalf("failed to create role %s: %s", role.Name, err)
+		}
+	}
+
+	var resp payloads.GetUserRolesResponse
+	list(t, svc, "/user/alice/roles", &resp)
+	if resp.User != "alice" || strings.Join(resp.Groups, ",") != "eng" {
+		t.Errorf("got user %s in groups %v, want alice in eng", resp.User, resp.Groups)
+	}
+	if got := strings.Join(resp.Direct, ","); got != "oncall,readers" {
+		t.Errorf("got direct roles %q, want oncall,readers", got)
+	}
+	if got := strings.Join(resp.ViaGroups["eng"], ","); len(resp.ViaGroups) != 1 || got != "readers,writers" {
+		t.Errorf("got roles via groups %v, want readers,writers via eng", resp.ViaGroups)
+	}
+	// a role bound both ways counts once
+	if got := strings.Join(resp.Effective, ","); got != "oncall,readers,writers" {
+		t.Errorf("got effective roles %q, want oncall,readers,writers", got)
+	}
+
+	var none payloads.GetUserRolesResponse
+	list(t, svc, "/user/bob/roles", &none)
+	if len(none.Direct) != 0 || strings.Join(none.Effective, ",") != "readers,writers" {
+		t.Errorf("got direct roles %v and effective roles %v, want only the roles of eng", none.Direct, none.Effective)
+	}
+}
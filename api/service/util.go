@@ -2,18 +2,37 @@ package service
 
 import (
 	"encoding/json"
-	"io/ioutil"
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
 )
 
+// maxRequestBodySize is the largest request body unmarshalRequestBody
+// decodes, well above what the longest valid request needs
+const maxRequestBodySize = 1 << 20
+
+// unmarshalRequestBody decodes a JSON request body onto intf, which must be
+// a pointer. Unknown fields, trailing data, empty bodies, and bodies larger
+// than maxRequestBodySize are rejected.
 func unmarshalRequestBody(r *http.Request, intf interface{}) error {
-	bodyBytes, err := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
-	if err != nil {
+
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxRequestBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(intf); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return fmt.Errorf("body must be at most %d bytes", maxRequestBodySize)
+		}
 		return err
 	}
-	if err = json.Unmarshal(bodyBytes, intf); err != nil {
-		return err
+	if dec.More() {
+		return errors.New("unexpected data after the JSON value")
+	}
+
+	if v := reflect.ValueOf(intf).Elem(); v.Kind() == reflect.Ptr && v.IsNil() {
+		return errors.New("body must be a JSON object")
 	}
 	return nil
 }
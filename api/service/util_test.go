@@ -0,0 +1,89 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/validation"
+)
+
+// post makes a request with a raw body as alice, and returns
+// the status and the decoded error response
+func post(t *testing.T, svc *service, path, body string) (int, payloads.ErrorResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("MOCK_AUTHENTICATED_USER", "alice")
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, req)
+
+	var e payloads.ErrorResponse
+	json.NewDecoder(w.Body).Decode(&e)
+	return w.Code, e
+}
+
+func TestUnmarshalRequestBody(t *testing.T) {
+	svc := newTestService(t)
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"unknown field", `{"name":"docs.read","nmae":"docs.read"}`, "unknown field"},
+		{"trailing data", `{"name":"docs.read"}{}`, "unexpected data after the JSON value"},
+		{"null body", `null`, "body must be a JSON object"},
+		{"empty body", ``, "EOF"},
+		{"too large", `{"name":"docs.read","description":"` + strings.Repeat("a", maxRequestBodySize) + `"}`, "body must be at most"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, e := post(t, svc, "/permission", test.body)
+			if status != http.StatusBadRequest || e.Code != payloads.CodeInvalidRequest || !strings.Contains(e.Message, test.want) {
+				t.Errorf("got %d %s: %s, want %d %s with %q", status, e.Code, e.Message, http.StatusBadRequest, payloads.CodeInvalidRequest, test.want)
+			}
+		})
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	svc := newTestService(t)
+
+	owners := []string{}
+	for i := 0; i <= validation.MaxListLength; i++ {
+		owners = append(owners, "alice")
+	}
+	tooMany, _ := json.Marshal(owners)
+
+	tests := []struct {
+		name  string
+		path  string
+		body  string
+		field string
+	}{
+		{"missing name", "/permission", `{}`, "name"},
+		{"malformed name", "/permission", `{"name":"docs/read"}`, "name"},
+		{"long name", "/permission", `{"name":"` + strings.Repeat("a", validation.MaxNameLength+1) + `"}`, "name"},
+		{"long description", "/permission", `{"name":"docs.read","description":"` + strings.Repeat("a", validation.MaxDescriptionLength+1) + `"}`, "description"},
+		{"malformed owner", "/permission", `{"name":"docs.read","owners":["group:"]}`, "owners[0]"},
+		{"duplicate owner", "/permission", `{"name":"docs.read","owners":["bob","bob"]}`, "owners[1]"},
+		{"too many owners", "/permission", `{"name":"docs.read","owners":` + string(tooMany) + `}`, "owners"},
+		{"group user", "/role", `{"name":"readers","users":["group:eng"]}`, "users[0]"},
+		{"malformed permission", "/role", `{"name":"readers","permissions":["docs read"]}`, "permissions[0]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, e := post(t, svc, test.path, test.body)
+			if status != http.StatusBadRequest || e.Code != payloads.CodeValidationFailed {
+				t.Fatalf("got %d %s: %s, want %d %s", status, e.Code, e.Message, http.StatusBadRequest, payloads.CodeValidationFailed)
+			}
+			if len(e.Fields) != 1 || e.Fields[0].Field != test.field {
+				t.Errorf("got field errors %+v, want one for %s", e.Fields, test.field)
+			}
+		})
+	}
+}
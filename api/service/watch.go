@@ -0,0 +1,104 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+const watchHeartbeatInterval = time.Second * 15
+
+func (s *service) setWatchEndpoints() {
+	s.router.Methods(http.MethodGet).Path("/watch").HandlerFunc(s.watchHandler)
+}
+
+// watchHandler streams change events as server-sent events. Clients resume
+// after a reconnect by sending the last revision they saw, either in the
+// "revision" query parameter or in the standard "Last-Event-ID" header.
+// When no revision is given, only events after the current revision are sent.
+func (s *service) watchHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, internalError(nil, "streaming is not supported"))
+		return
+	}
+
+	since := s.changes.Revision()
+	rev := r.URL.Query().Get("revision")
+	if rev == "" {
+		rev = r.Header.Get("Last-Event-ID")
+	}
+	if rev != "" {
+		parsed, err := strconv.ParseUint(rev, 10, 64)
+		if err != nil {
+			writeError(w, r, newError(payloads.CodeInvalidRequest, "revision \"%s\" is not a valid revision number", rev))
+			return
+		}
+		since = parsed
+	}
+
+	backlog, ch, cancel, err := s.changes.Watch(since)
+	if err == events.ErrCompacted {
+		writeError(w, r, newError(payloads.CodeRevisionCompacted, "Revision %d is not available, re-read state and watch from the current revision", since))
+		return
+	}
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to watch change log"))
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for _, e := range backlog {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(watchHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.shutdown:
+			// the client reconnects, and re-reads state if its revision is gone
+			return
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e, ok := <-ch:
+			if !ok {
+				// dropped for falling behind, the client resumes from its last revision
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	eventBytes, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", e.Revision, e.Type, eventBytes)))
+	return err
+}
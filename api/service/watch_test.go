@@ -0,0 +1,121 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+func TestWatchRevisions(t *testing.T) {
+	svc := newTestService(t)
+	current := svc.changes.Revision()
+
+	tests := []struct {
+		name     string
+		revision string
+		status   int
+		code     string
+	}{
+		{"not a number", "latest", http.StatusBadRequest, payloads.CodeInvalidRequest},
+		{"before the log", "1", http.StatusGone, payloads.CodeRevisionCompacted},
+		{"ahead of the log", fmt.Sprint(current + 1), http.StatusGone, payloads.CodeRevisionCompacted},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, code := httpCode(t, svc, "", http.MethodGet, "/watch?revision="+test.revision, nil)
+			if status != test.status || code != test.code {
+				t.Errorf("got %d %s, want %d %s", status, code, test.status, test.code)
+			}
+		})
+	}
+}
+
+// watch opens a watch stream, and returns a function reading its next event
+func watch(t *testing.T, srv *httptest.Server, lastEventID string) func() events.Event {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/watch", nil)
+	if err != nil {
+		t.Fatalf("failed to build request: %s", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to watch: %s", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got status %d and content type %q, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	return func() events.Event {
+		t.Helper()
+
+		var id, typ string
+		var e events.Event
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				typ = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+					t.Fatalf("failed to decode event %s: %s", line, err)
+				}
+			case line == "" && typ != "":
+				if id != fmt.Sprint(e.Revision) || typ != e.Type {
+					t.Errorf("got id %s and event %s for %+v, want its revision and type", id, typ, e)
+				}
+				return e
+			}
+		}
+		t.Fatalf("stream ended: %v", scanner.Err())
+		return e
+	}
+}
+
+func TestWatchStream(t *testing.T) {
+	svc := newTestService(t)
+	srv := httptest.NewServer(svc.router)
+	t.Cleanup(srv.Close) // after the streams are cancelled, or it waits for them
+
+	next := watch(t, srv, "")
+	ctx := context.Background()
+	if _, err := svc.createRole(ctx, "alice", &payloads.CreateRoleRequest{Name: "readers", Users: []string{"bob"}}, false); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+	created := next()
+	if created.Type != events.RoleCreated || created.Name != "readers" || created.Actor != "alice" {
+		t.Errorf("got event %+v, want the role created by alice", created)
+	}
+	if bound := next(); bound.Type != events.UserRoleAdded || bound.Revision != created.Revision+1 {
+		t.Errorf("got event %+v, want bob bound to the role next", bound)
+	}
+
+	// a client reconnecting with the last event it saw gets the events after it
+	if _, err := svc.updateRole(ctx, "alice", "readers", &payloads.GenericUpdateDescriptionRequest{Description: "updated"}, false); err != nil {
+		t.Fatalf("failed to update role: %s", err)
+	}
+	resumed := watch(t, srv, fmt.Sprint(created.Revision))
+	if e := resumed(); e.Revision != created.Revision+1 {
+		t.Errorf("got event %+v after resuming, want the one after the last seen", e)
+	}
+	if e := resumed(); e.Type != events.RoleUpdated {
+		t.Errorf("got event %+v after resuming, want the update", e)
+	}
+}
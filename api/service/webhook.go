@@ -0,0 +1,116 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/webhooks"
+	"github.com/gorilla/mux"
+)
+
+func (s *service) setWebhookEndpoints() {
+	s.router.Methods(http.MethodPost).Path("/webhook").Handler(s.auth(s.createWebhookHandler))
+	s.router.Methods(http.MethodGet).Path("/webhook/{id}").Handler(s.auth(s.readWebhookHandler))
+	s.router.Methods(http.MethodGet).Path("/webhook/{id}/deadletters").Handler(s.auth(s.readWebhookDeadLettersHandler))
+	s.router.Methods(http.MethodDelete).Path("/webhook/{id}").Handler(s.auth(s.deleteWebhookHandler))
+}
+
+func (s *service) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	var pl *payloads.CreateWebhookRequest
+	if err := unmarshalRequestBody(r, &pl); err != nil {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "request body is not a webhook: %s", err))
+		return
+	}
+
+	sub, err := s.createWebhook(r.Context(), authenticatedUser, pl)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	subBytes, err := json.Marshal(&sub)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(subBytes)
+	return
+}
+
+func (s *service) readWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := s.getOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	subBytes, err := json.Marshal(&sub)
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(subBytes)
+	return
+}
+
+func (s *service) readWebhookDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := s.getOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	dlBytes, err := json.Marshal(s.webhooks.DeadLetters(sub.ID))
+	if err != nil {
+		writeError(w, r, internalError(err, "failed to encode response"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(dlBytes)
+	return
+}
+
+func (s *service) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := s.getOwnedWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	s.webhooks.Unsubscribe(sub.ID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Webhook \"%s\" deleted successfully!", sub.ID)))
+	return
+}
+
+// getOwnedWebhook returns the webhook in the request URL if the authenticated
+// user owns it. Otherwise it writes an error response and returns false.
+func (s *service) getOwnedWebhook(w http.ResponseWriter, r *http.Request) (*webhooks.Subscription, bool) {
+	authenticatedUser := getAuthenticatedUser(r)
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		writeError(w, r, newError(payloads.CodeInvalidRequest, "no webhook id in request URL"))
+		return nil, false
+	}
+
+	sub := s.webhooks.Get(id)
+	if sub == nil {
+		writeError(w, r, newError(payloads.CodeWebhookNotFound, "Webhook \"%s\" does not exist!", id))
+		return nil, false
+	}
+
+	if sub.Owner != authenticatedUser {
+		writeError(w, r, newError(payloads.CodeNotOwner, "Only the owner of a webhook can manage the webhook. User \"%s\" is not \"%s\".", authenticatedUser, sub.Owner))
+		return nil, false
+	}
+
+	return sub, true
+}
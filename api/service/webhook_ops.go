@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/validation"
+	"github.com/adrianosela/rbac/api/webhooks"
+)
+
+// createWebhook registers a new webhook owned by the actor. Filters naming
+// an object are only allowed for its owners and admins, and the destination
+// must be a public address unless private ones are allowed.
+func (s *service) createWebhook(ctx context.Context, actor string, pl *payloads.CreateWebhookRequest) (*webhooks.Subscription, error) {
+	if err := pl.Validate(); err != nil {
+		return nil, invalidPayload(err)
+	}
+
+	for _, f := range pl.Filters {
+		if err := s.checkCanWatch(ctx, actor, f); err != nil {
+			return nil, err
+		}
+	}
+
+	if !s.allowPrivateWebhooks {
+		if err := webhooks.CheckDestination(ctx, pl.URL); err != nil {
+			var errs validation.Errors
+			errs.Add("url", "%s", err)
+			return nil, invalidPayload(errs.Err())
+		}
+	}
+
+	sub, err := s.webhooks.Subscribe(&webhooks.Subscription{
+		URL:     pl.URL,
+		Secret:  pl.Secret,
+		Filters: pl.Filters,
+		Owner:   actor,
+	})
+	if err != nil {
+		return nil, internalError(err, "failed to register webhook")
+	}
+	return sub, nil
+}
+
+// checkCanWatch returns an error unless the actor owns the object a filter
+// names, or has the admin meta-permission over it. Objects which don't exist
+// have no owners. Filters for every object of a type are always allowed.
+func (s *service) checkCanWatch(ctx context.Context, actor string, f webhooks.Filter) error {
+	if f.Name == "" {
+		return nil
+	}
+
+	var owners []string
+	var admin string
+	switch kind, _, _ := strings.Cut(f.Event, "."); kind {
+	case "role":
+		role, err := s.store.ReadRole(ctx, f.Name)
+		if err != nil {
+			return internalError(err, "failed to read role from storage")
+		}
+		if role != nil {
+			owners = role.Owners
+		}
+		admin = model.PermissionRolesAdmin
+	case "permission":
+		perm, err := s.store.ReadPermission(ctx, f.Name)
+		if err != nil {
+			return internalError(err, "failed to read permission from storage")
+		}
+		if perm != nil {
+			owners = perm.Owners
+		}
+		admin = model.PermissionPermissionsAdmin
+	case "service_account":
+		sa, err := s.store.ReadServiceAccount(ctx, f.Name)
+		if err != nil {
+			return internalError(err, "failed to read service account from storage")
+		}
+		if sa != nil {
+			owners = sa.Owners
+		}
+		admin = model.PermissionServiceAccountsAdmin
+	case "namespace":
+		ns, err := s.store.ReadNamespace(ctx, f.Name)
+		if err != nil {
+			return internalError(err, "failed to read namespace from storage")
+		}
+		if ns != nil {
+			owners = ns.Owners
+		}
+		admin = model.PermissionNamespacesAdmin
+	case "user":
+		// users watch their own bindings
+		owners, admin = []string{f.Name}, model.PermissionRolesAdmin
+	case "group":
+		// members watch the bindings of their groups
+		owners, admin = []string{model.GroupOwnerPrefix + f.Name}, model.PermissionRolesAdmin
+	case "snapshot":
+		admin = model.PermissionSnapshotsAdmin
+	default:
+		return nil // (matches no events)
+	}
+
+	reason := fmt.Sprintf("Only the owners of \"%s\" can watch it with a webhook", f.Name)
+	return s.checkOwner(ctx, actor, owners, admin, reason)
+}
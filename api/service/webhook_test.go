@@ -0,0 +1,122 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/webhooks"
+)
+
+// createWebhook registers a webhook as user, and returns the status
+// of the response and the created webhook
+func createWebhook(t *testing.T, svc *service, user string, pl *payloads.CreateWebhookRequest) (int, *webhooks.Subscription) {
+	t.Helper()
+
+	b, err := json.Marshal(pl)
+	if err != nil {
+		t.Fatalf("failed to encode webhook: %s", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(b))
+	req.Header.Set("MOCK_AUTHENTICATED_USER", user)
+	w := httptest.NewRecorder()
+	svc.router.ServeHTTP(w, req)
+
+	var sub webhooks.Subscription
+	json.NewDecoder(w.Body).Decode(&sub)
+	return w.Code, &sub
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	svc, err := newService(Config{
+		Groups:                groups.NewMemorySource(map[string][]string{"alice": {"eng"}, "bob": {"eng"}}),
+		WebhookInitialBackoff: time.Millisecond,
+		WebhookAllowPrivate:   true,
+		Logger:                slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	t.Cleanup(func() { svc.webhooks.Close(context.Background()) })
+
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	t.Cleanup(receiver.Close)
+
+	status, sub := createWebhook(t, svc, "alice", &payloads.CreateWebhookRequest{
+		URL:     receiver.URL,
+		Secret:  "secret",
+		Filters: []webhooks.Filter{{Event: events.RoleCreated}},
+	})
+	if status != http.StatusOK || sub.ID == "" || sub.Owner != "alice" {
+		t.Fatalf("got %d %+v creating webhook, want it owned by alice", status, sub)
+	}
+
+	if _, err := svc.createRole(context.Background(), "bob", &payloads.CreateRoleRequest{Name: "readers"}, false); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+	select {
+	case r := <-received:
+		body := <-bodies
+		if r.Header.Get(webhooks.EventHeader) != events.RoleCreated || !webhooks.Verify("secret", body, r.Header.Get(webhooks.SignatureHeader)) {
+			t.Errorf("got delivery %v with body %s, want a signed %s event", r.Header, body, events.RoleCreated)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("got no delivery for the created role")
+	}
+
+	// only the owner manages the webhook
+	if status, code := httpCode(t, svc, "bob", http.MethodGet, "/webhook/"+sub.ID, nil); code != payloads.CodeNotOwner {
+		t.Errorf("got %d %s reading someone else's webhook, want %s", status, code, payloads.CodeNotOwner)
+	}
+	if status, code := httpCode(t, svc, "alice", http.MethodGet, "/webhook/"+sub.ID+"/deadletters", nil); status != http.StatusOK {
+		t.Errorf("got %d %s reading dead letters, want %d", status, code, http.StatusOK)
+	}
+	if status, code := httpCode(t, svc, "alice", http.MethodDelete, "/webhook/"+sub.ID, nil); status != http.StatusOK {
+		t.Errorf("got %d %s deleting webhook, want %d", status, code, http.StatusOK)
+	}
+	if _, code := httpCode(t, svc, "alice", http.MethodGet, "/webhook/"+sub.ID, nil); code != payloads.CodeWebhookNotFound {
+		t.Errorf("got %s reading a deleted webhook, want %s", code, payloads.CodeWebhookNotFound)
+	}
+}
+
+func TestCreateWebhookErrors(t *testing.T) {
+	svc := newTestService(t)
+
+	if _, err := svc.createRole(context.Background(), "alice", &payloads.CreateRoleRequest{Name: "readers"}, false); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		pl   *payloads.CreateWebhookRequest
+		code string
+	}{
+		{"no filters", &payloads.CreateWebhookRequest{URL: "https://example.com/hook", Secret: "secret"}, payloads.CodeValidationFailed},
+		{"relative url", &payloads.CreateWebhookRequest{URL: "/hook", Secret: "secret", Filters: []webhooks.Filter{{Event: events.RoleCreated}}}, payloads.CodeValidationFailed},
+		{"private destination", &payloads.CreateWebhookRequest{URL: "http://127.0.0.1/hook", Secret: "secret", Filters: []webhooks.Filter{{Event: events.RoleCreated}}}, payloads.CodeValidationFailed},
+		{"someone else's role", &payloads.CreateWebhookRequest{URL: "http://127.0.0.1/hook", Secret: "secret", Filters: []webhooks.Filter{{Event: events.RoleUpdated, Name: "readers"}}}, payloads.CodeNotOwner},
+		{"someone else's bindings", &payloads.CreateWebhookRequest{URL: "http://127.0.0.1/hook", Secret: "secret", Filters: []webhooks.Filter{{Event: events.UserRoleAdded, Name: "alice"}}}, payloads.CodeNotOwner},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := svc.createWebhook(context.Background(), "bob", test.pl); !hasCode(err, test.code) {
+				t.Errorf("got error %v, want %s", err, test.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/storage"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+const (
+	// ModeReplace replaces the full contents of storage with the snapshot
+	ModeReplace = "replace"
+	// ModeMerge adds the snapshot's objects to storage, overwriting
+	// any existing objects with the same name
+	ModeMerge = "merge"
+)
+
+// Load writes a snapshot to storage in the given mode. The snapshot and the
+// resulting dataset are validated before anything is written, and the
+// previous contents of storage are restored if writing fails. Callers must
+// prevent other writes while it runs.
+func Load(ctx context.Context, store storage.Storage, snap *Snapshot, mode string) error {
+	if mode != ModeReplace && mode != ModeMerge {
+		return fmt.Errorf("%w: import mode \"%s\" is not one of \"%s\" or \"%s\"", ErrInvalid, mode, ModeReplace, ModeMerge)
+	}
+	if err := snap.Validate(); err != nil {
+		return err
+	}
+
+	current, err := Read(ctx, store, 0)
+	if err != nil {
+		return err
+	}
+
+	target := snap
+	if mode == ModeMerge {
+		target = merge(current, snap)
+		if err := target.Validate(); err != nil {
+			return fmt.Errorf("merged dataset is invalid: %w", err)
+		}
+	}
+
+	if err := write(ctx, store, current, target); err != nil {
+		// storage has no transactions, so put back what it held before
+		// rather than leave it half written
+		partial, rerr := Read(ctx, store, 0)
+		if rerr == nil {
+			rerr = write(ctx, store, partial, current)
+		}
+		if rerr != nil {
+			return fmt.Errorf("%s, and failed to restore the previous contents: %s", err, rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// merge returns the union of two snapshots, with objects in the incoming
+// snapshot taking precedence. Back-references on permissions, users, and
+// groups are recomputed from the merged roles, on copies so that the current
+// snapshot can still be restored.
+func merge(current, incoming *Snapshot) *Snapshot {
+	perms := make(map[string]*model.Permission)
+	for _, p := range append(append([]*model.Permission{}, current.Permissions...), incoming.Permissions...) {
+		copied := *p
+		perms[p.Name] = &copied
+	}
+	roles := make(map[string]*model.Role)
+	for _, r := range current.Roles {
+		roles[r.Name] = r
+	}
+	for _, r := range incoming.Roles {
+		roles[r.Name] = r
+	}
+	users := make(map[string]*model.User)
+	for _, u := range append(append([]*model.User{}, current.Users...), incoming.Users...) {
+		copied := *u
+		users[u.ID] = &copied
+	}
+	groups := make(map[string]*model.Group)
+	for _, g := range append(append([]*model.Group{}, current.Groups...), incoming.Groups...) {
+		copied := *g
+		groups[g.ID] = &copied
+	}
+	serviceAccounts := make(map[string]*ServiceAccount)
+	for _, sa := range current.ServiceAccounts {
+		serviceAccounts[sa.Name] = sa
+	}
+	for _, sa := range incoming.ServiceAccounts {
+		serviceAccounts[sa.Name] = sa
+	}
+	namespaces := make(map[string]*model.Namespace)
+	for _, ns := range current.Namespaces {
+		namespaces[ns.Name] = ns
+	}
+	for _, ns := range incoming.Namespaces {
+		namespaces[ns.Name] = ns
+	}
+
+	merged := &Snapshot{Version: Version}
+	for _, p := range perms {
+		p.Roles = nil
+	}
+	for _, u := range users {
+		u.Roles = nil
+	}
+	for _, g := range groups {
+		g.Roles = nil
+	}
+	for _, r := range sortedRoles(roles) {
+		for _, name := range r.Permissions {
+			if p, ok := perms[name]; ok {
+				p.Roles = set.NewSet(p.Roles...).Add(r.Name).Slice()
+			}
+			// missing permissions are left for validation to report
+		}
+		for _, id := range r.Users {
+			if _, ok := users[id]; !ok {
+				users[id] = &model.User{ID: id}
+			}
+			users[id].Roles = set.NewSet(users[id].Roles...).Add(r.Name).Slice()
+		}
+		for _, id := range r.Groups {
+			if _, ok := groups[id]; !ok {
+				groups[id] = &model.Group{ID: id}
+			}
+			groups[id].Roles = set.NewSet(groups[id].Roles...).Add(r.Name).Slice()
+		}
+		merged.Roles = append(merged.Roles, r)
+	}
+	for _, p := range perms {
+		merged.Permissions = append(merged.Permissions, p)
+	}
+	for _, u := range users {
+		merged.Users = append(merged.Users, u)
+	}
+	for _, g := range groups {
+		merged.Groups = append(merged.Groups, g)
+	}
+	for _, sa := range serviceAccounts {
+		merged.ServiceAccounts = append(merged.ServiceAccounts, sa)
+	}
+	for _, ns := range namespaces {
+		merged.Namespaces = append(merged.Namespaces, ns)
+	}
+	return merged
+}
+
+// write makes the contents of storage match the target snapshot,
+// using only the methods of the storage interface. It is not atomic,
+// see Load for restoring storage when it fails.
+func write(ctx context.Context, store storage.Storage, current, target *Snapshot) error {
+	// remove objects which are not in the target first,
+	// so that nothing references them once they are gone
+	keepRoles := set.NewSet()
+	for _, r := range target.Roles {
+		keepRoles.Add(r.Name)
+	}
+	for _, r := range current.Roles {
+		if !keepRoles.Has(r.Name) {
+			if err := store.DeleteRole(ctx, r.Name); err != nil {
+				return fmt.Errorf("failed to delete role \"%s\": %s", r.Name, err)
+			}
+		}
+	}
+	keepPerms := set.NewSet()
+	for _, p := range target.Permissions {
+		keepPerms.Add(p.Name)
+	}
+	for _, p := range current.Permissions {
+		if !keepPerms.Has(p.Name) {
+			if err := store.DeletePermission(ctx, p.Name); err != nil {
+				return fmt.Errorf("failed to delete permission \"%s\": %s", p.Name, err)
+			}
+		}
+	}
+	keepUsers := set.NewSet()
+	for _, u := range target.Users {
+		keepUsers.Add(u.ID)
+	}
+	for _, u := range current.Users {
+		if !keepUsers.Has(u.ID) {
+			if err := store.DeleteUser(ctx, u.ID); err != nil {
+				return fmt.Errorf("failed to delete user \"%s\": %s", u.ID, err)
+			}
+		}
+	}
+	keepGroups := set.NewSet()
+	for _, g := range target.Groups {
+		keepGroups.Add(g.ID)
+	}
+	for _, g := range current.Groups {
+		if !keepGroups.Has(g.ID) {
+			if err := store.DeleteGroup(ctx, g.ID); err != nil {
+				return fmt.Errorf("failed to delete group \"%s\": %s", g.ID, err)
+			}
+		}
+	}
+	keepServiceAccounts := set.NewSet()
+	for _, sa := range target.ServiceAccounts {
+		keepServiceAccounts.Add(sa.Name)
+	}
+	for _, sa := range current.ServiceAccounts {
+		if !keepServiceAccounts.Has(sa.Name) {
+			if err := store.DeleteServiceAccount(ctx, sa.Name); err != nil {
+				return fmt.Errorf("failed to delete service account \"%s\": %s", sa.Name, err)
+			}
+		}
+	}
+	keepNamespaces := set.NewSet()
+	for _, ns := range target.Namespaces {
+		keepNamespaces.Add(ns.Name)
+	}
+	for _, ns := range current.Namespaces {
+		if !keepNamespaces.Has(ns.Name) {
+			if err := store.DeleteNamespace(ctx, ns.Name); err != nil {
+				return fmt.Errorf("failed to delete namespace \"%s\": %s", ns.Name, err)
+			}
+		}
+	}
+
+	// then create or update everything in the target
+	existingPerms := set.NewSet()
+	for _, p := range current.Permissions {
+		existingPerms.Add(p.Name)
+	}
+	for _, p := range target.Permissions {
+		var err error
+		if existingPerms.Has(p.Name) {
+			err = store.UpdatePermission(ctx, p)
+		} else {
+			err = store.CreatePermission(ctx, p)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write permission \"%s\": %s", p.Name, err)
+		}
+	}
+	existingRoles := set.NewSet()
+	for _, r := range current.Roles {
+		existingRoles.Add(r.Name)
+	}
+	for _, r := range target.Roles {
+		var err error
+		if existingRoles.Has(r.Name) {
+			err = store.UpdateRole(ctx, r)
+		} else {
+			err = store.CreateRole(ctx, r)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write role \"%s\": %s", r.Name, err)
+		}
+	}
+	for _, u := range target.Users {
+		if err := store.UpdateUser(ctx, u); err != nil {
+			return fmt.Errorf("failed to write user \"%s\": %s", u.ID, err)
+		}
+	}
+	for _, g := range target.Groups {
+		if err := store.UpdateGroup(ctx, g); err != nil {
+			return fmt.Errorf("failed to write group \"%s\": %s", g.ID, err)
+		}
+	}
+	existingServiceAccounts := set.NewSet()
+	for _, sa := range current.ServiceAccounts {
+		existingServiceAccounts.Add(sa.Name)
+	}
+	for _, sa := range target.ServiceAccounts {
+		var err error
+		if existingServiceAccounts.Has(sa.Name) {
+			err = store.UpdateServiceAccount(ctx, sa.toModel())
+		} else {
+			err = store.CreateServiceAccount(ctx, sa.toModel())
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write service account \"%s\": %s", sa.Name, err)
+		}
+	}
+	existingNamespaces := set.NewSet()
+	for _, ns := range current.Namespaces {
+		existingNamespaces.Add(ns.Name)
+	}
+	for _, ns := range target.Namespaces {
+		var err error
+		if existingNamespaces.Has(ns.Name) {
+			err = store.UpdateNamespace(ctx, ns)
+		} else {
+			err = store.CreateNamespace(ctx, ns)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write namespace \"%s\": %s", ns.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,460 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/storage"
+	"github.com/adrianosela/rbac/api/validation"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// Version is the version of the snapshot format. Version 2 added service
+// accounts and version 3 added namespaces, snapshots of earlier versions
+// are rejected as importing them would delete all of either.
+const Version = 3
+
+// ErrInvalid is returned (wrapped) when a snapshot fails integrity validation
+var ErrInvalid = errors.New("snapshot failed integrity validation")
+
+// maxReportedProblems caps the number of integrity problems in an error
+const maxReportedProblems = 20
+
+// Snapshot represents the full contents of RBAC storage at a point in time
+type Snapshot struct {
+	Version     int                 `json:"version"`
+	ExportedAt  time.Time           `json:"exported_at"`
+	Revision    uint64              `json:"revision"`
+	Permissions []*model.Permission `json:"permissions"`
+	Roles       []*model.Role       `json:"roles"`
+	Users       []*model.User       `json:"users"`
+	Groups      []*model.Group      `json:"groups"`
+
+	ServiceAccounts []*ServiceAccount  `json:"service_accounts"`
+	Namespaces      []*model.Namespace `json:"namespaces"`
+}
+
+// ServiceAccount is a service account in a snapshot. Unlike
+// model.ServiceAccount it keeps the hashes of its API keys,
+// so that the keys keep working once the snapshot is imported.
+type ServiceAccount struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Owners      []string  `json:"owners"`
+	Keys        []*APIKey `json:"keys"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// APIKey is an API key of a service account in a snapshot
+type APIKey struct {
+	ID        string     `json:"id"`
+	Hash      string     `json:"hash"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+func fromServiceAccount(sa *model.ServiceAccount) *ServiceAccount {
+	s := &ServiceAccount{Name: sa.Name, Description: sa.Description, Owners: sa.Owners, Keys: []*APIKey{}, CreatedAt: sa.CreatedAt}
+	for _, k := range sa.Keys {
+		s.Keys = append(s.Keys, &APIKey{ID: k.ID, Hash: k.Hash, CreatedAt: k.CreatedAt, ExpiresAt: k.ExpiresAt, LastUsed: k.LastUsed})
+	}
+	return s
+}
+
+func (s *ServiceAccount) toModel() *model.ServiceAccount {
+	sa := &model.ServiceAccount{Name: s.Name, Description: s.Description, Owners: s.Owners, Keys: []*model.APIKey{}, CreatedAt: s.CreatedAt}
+	for _, k := range s.Keys {
+		sa.Keys = append(sa.Keys, &model.APIKey{ID: k.ID, Hash: k.Hash, CreatedAt: k.CreatedAt, ExpiresAt: k.ExpiresAt, LastUsed: k.LastUsed})
+	}
+	return sa
+}
+
+// Read reads the full contents of storage into a snapshot, with all objects
+// sorted by name. Callers must prevent writes while it runs for the snapshot
+// to be consistent.
+func Read(ctx context.Context, store storage.Storage, revision uint64) (*Snapshot, error) {
+	perms, err := store.ListPermissions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list permissions: %s", err)
+	}
+	roles, err := store.ListRoles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %s", err)
+	}
+	users, err := store.ListUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %s", err)
+	}
+	groups, err := store.ListGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %s", err)
+	}
+	serviceAccounts, err := store.ListServiceAccounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %s", err)
+	}
+	namespaces, err := store.ListNamespaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %s", err)
+	}
+
+	sort.Slice(perms, func(i, j int) bool { return perms[i].Name < perms[j].Name })
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	sort.Slice(serviceAccounts, func(i, j int) bool { return serviceAccounts[i].Name < serviceAccounts[j].Name })
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Name < namespaces[j].Name })
+
+	snap := &Snapshot{
+		Version:         Version,
+		ExportedAt:      time.Now().UTC(),
+		Revision:        revision,
+		Permissions:     perms,
+		Roles:           roles,
+		Users:           users,
+		Groups:          groups,
+		ServiceAccounts: []*ServiceAccount{},
+		Namespaces:      namespaces,
+	}
+	for _, sa := range serviceAccounts {
+		snap.ServiceAccounts = append(snap.ServiceAccounts, fromServiceAccount(sa))
+	}
+	return snap, nil
+}
+
+// Encode writes a snapshot as JSON, marshaling one object at a time so that
+// the encoded snapshot is never buffered whole. The snapshot itself is fully
+// in memory, see Read.
+func (s *Snapshot) Encode(w io.Writer) error {
+	header, err := json.Marshal(&struct {
+		Version    int       `json:"version"`
+		ExportedAt time.Time `json:"exported_at"`
+		Revision   uint64    `json:"revision"`
+	}{s.Version, s.ExportedAt, s.Revision})
+	if err != nil {
+		return err
+	}
+	// open the object, leaving out the header's closing brace
+	if _, err = w.Write(header[:len(header)-1]); err != nil {
+		return err
+	}
+
+	sections := []struct {
+		key   string
+		items []interface{}
+	}{
+		{"permissions", toItems(s.Permissions)},
+		{"roles", toItems(s.Roles)},
+		{"users", toItems(s.Users)},
+		{"groups", toItems(s.Groups)},
+		{"service_accounts", toItems(s.ServiceAccounts)},
+		{"namespaces", toItems(s.Namespaces)},
+	}
+	for _, section := range sections {
+		if _, err = fmt.Fprintf(w, ",\"%s\":[", section.key); err != nil {
+			return err
+		}
+		for i, item := range section.items {
+			itemBytes, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				if _, err = w.Write([]byte(",")); err != nil {
+					return err
+				}
+			}
+			if _, err = w.Write(itemBytes); err != nil {
+				return err
+			}
+		}
+		if _, err = w.Write([]byte("]")); err != nil {
+			return err
+		}
+	}
+
+	_, err = w.Write([]byte("}\n"))
+	return err
+}
+
+func toItems(v interface{}) []interface{} {
+	items := []interface{}{}
+	switch objs := v.(type) {
+	case []*model.Permission:
+		for _, o := range objs {
+			items = append(items, o)
+		}
+	case []*model.Role:
+		for _, o := range objs {
+			items = append(items, o)
+		}
+	case []*model.User:
+		for _, o := range objs {
+			items = append(items, o)
+		}
+	case []*model.Group:
+		for _, o := range objs {
+			items = append(items, o)
+		}
+	case []*ServiceAccount:
+		for _, o := range objs {
+			items = append(items, o)
+		}
+	case []*model.Namespace:
+		for _, o := range objs {
+			items = append(items, o)
+		}
+	}
+	return items
+}
+
+// Validate checks the integrity of all cross-references in the snapshot:
+// every object must be unique and named as the API would accept it, with
+// reserved names only on the built-in objects, roles may only reference existing
+// permissions, the roles listed on permissions, users, and groups must
+// match the permissions, users, and groups listed on roles, and the users
+// and owners of all objects must be well formed principals whose service
+// accounts and roles exist.
+func (s *Snapshot) Validate() error {
+	problems := []string{}
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if s.Version != Version {
+		report("unsupported snapshot version %d, must be %d", s.Version, Version)
+	}
+
+	// checkName reports names which the API would refuse, so that an import
+	// can't create objects which could not be created otherwise. Only
+	// built-in objects, users, groups, and service accounts may have
+	// reserved names, as the API doesn't check the latter three for them.
+	checkName := func(kind, name string, mayBeReserved bool) {
+		var errs validation.Errors
+		switch kind {
+		case "user":
+			errs.Principal(kind, name)
+		case "group":
+			errs.Subject(kind, name)
+		default:
+			errs.Name(kind, name)
+		}
+		if len(errs) > 0 {
+			report("%s \"%s\" is malformed: %s", kind, name, errs[0].Message)
+			return
+		}
+		if model.IsReserved(name) && !mayBeReserved {
+			report("%s \"%s\" has a name reserved for built-in objects", kind, name)
+		}
+	}
+
+	perms := make(map[string]*model.Permission)
+	for _, p := range s.Permissions {
+		if p == nil || p.Name == "" {
+			report("permission with no name")
+			continue
+		}
+		if _, ok := perms[p.Name]; ok {
+			report("permission \"%s\" appears more than once", p.Name)
+		}
+		_, builtin := model.MetaPermissions[p.Name]
+		checkName("permission", p.Name, builtin)
+		perms[p.Name] = p
+	}
+	roles := make(map[string]*model.Role)
+	for _, r := range s.Roles {
+		if r == nil || r.Name == "" {
+			report("role with no name")
+			continue
+		}
+		if _, ok := roles[r.Name]; ok {
+			report("role \"%s\" appears more than once", r.Name)
+		}
+		checkName("role", r.Name, r.Name == model.AdminRole)
+		roles[r.Name] = r
+	}
+	users := make(map[string]*model.User)
+	for _, u := range s.Users {
+		if u == nil || u.ID == "" {
+			report("user with no id")
+			continue
+		}
+		if _, ok := users[u.ID]; ok {
+			report("user \"%s\" appears more than once", u.ID)
+		}
+		checkName("user", u.ID, true)
+		users[u.ID] = u
+	}
+	groups := make(map[string]*model.Group)
+	for _, g := range s.Groups {
+		if g == nil || g.ID == "" {
+			report("group with no id")
+			continue
+		}
+		if _, ok := groups[g.ID]; ok {
+			report("group \"%s\" appears more than once", g.ID)
+		}
+		checkName("group", g.ID, true)
+		groups[g.ID] = g
+	}
+	serviceAccounts := make(map[string]*ServiceAccount)
+	for _, sa := range s.ServiceAccounts {
+		if sa == nil || sa.Name == "" {
+			report("service account with no name")
+			continue
+		}
+		if _, ok := serviceAccounts[sa.Name]; ok {
+			report("service account \"%s\" appears more than once", sa.Name)
+		}
+		checkName("service account", sa.Name, true)
+		serviceAccounts[sa.Name] = sa
+
+		keys := set.NewSet()
+		for _, k := range sa.Keys {
+			if k == nil || k.ID == "" || k.Hash == "" {
+				report("service account \"%s\" has an API key with no id or hash", sa.Name)
+				continue
+			}
+			if keys.Has(k.ID) {
+				report("service account \"%s\" has API key \"%s\" more than once", sa.Name, k.ID)
+			}
+			keys.Add(k.ID)
+		}
+	}
+
+	namespaces := set.NewSet()
+	for _, ns := range s.Namespaces {
+		if ns == nil || ns.Name == "" {
+			report("namespace with no name")
+			continue
+		}
+		if namespaces.Has(ns.Name) {
+			report("namespace \"%s\" appears more than once", ns.Name)
+		}
+		checkName("namespace", ns.Name, false)
+		namespaces.Add(ns.Name)
+	}
+
+	// checkPrincipal reports principals of an object which are malformed,
+	// and the service accounts and roles they reference which are not in
+	// the snapshot. Owners may also be groups and roles, users may not.
+	checkPrincipal := func(object, kind, principal string) {
+		var errs validation.Errors
+		if kind == "owner" {
+			errs.Owner(kind, principal)
+		} else {
+			errs.Principal(kind, principal)
+		}
+		if len(errs) > 0 {
+			report("%s has malformed %s \"%s\": %s", object, kind, principal, errs[0].Message)
+			return
+		}
+		if name, ok := model.ServiceAccountName(principal); ok {
+			if _, ok := serviceAccounts[name]; !ok {
+				report("%s references service account \"%s\" which does not exist", object, name)
+			}
+		}
+		if name, ok := model.OwnerRole(principal); ok {
+			if _, ok := roles[name]; !ok {
+				report("%s references role \"%s\" which does not exist", object, name)
+			}
+		}
+	}
+	for _, p := range s.Permissions {
+		if p != nil {
+			for _, owner := range p.Owners {
+				checkPrincipal(fmt.Sprintf("permission \"%s\"", p.Name), "owner", owner)
+			}
+		}
+	}
+	for _, sa := range s.ServiceAccounts {
+		if sa != nil {
+			for _, owner := range sa.Owners {
+				checkPrincipal(fmt.Sprintf("service account \"%s\"", sa.Name), "owner", owner)
+			}
+		}
+	}
+	for _, ns := range s.Namespaces {
+		if ns != nil {
+			for _, owner := range ns.Owners {
+				checkPrincipal(fmt.Sprintf("namespace \"%s\"", ns.Name), "owner", owner)
+			}
+		}
+	}
+
+	for _, r := range sortedRoles(roles) {
+		for _, owner := range r.Owners {
+			checkPrincipal(fmt.Sprintf("role \"%s\"", r.Name), "owner", owner)
+		}
+		for _, user := range r.Users {
+			checkPrincipal(fmt.Sprintf("role \"%s\"", r.Name), "user", user)
+		}
+		for _, name := range r.Permissions {
+			p, ok := perms[name]
+			if !ok {
+				report("role \"%s\" references permission \"%s\" which does not exist", r.Name, name)
+				continue
+			}
+			if !set.NewSet(p.Roles...).Has(r.Name) {
+				report("permission \"%s\" does not list role \"%s\" which uses it", name, r.Name)
+			}
+		}
+		for _, id := range r.Users {
+			if u, ok := users[id]; !ok || !set.NewSet(u.Roles...).Has(r.Name) {
+				report("user \"%s\" does not list role \"%s\" which it is bound to", id, r.Name)
+			}
+		}
+		for _, id := range r.Groups {
+			if g, ok := groups[id]; !ok || !set.NewSet(g.Roles...).Has(r.Name) {
+				report("group \"%s\" does not list role \"%s\" which it is bound to", id, r.Name)
+			}
+		}
+	}
+
+	for _, p := range perms {
+		for _, name := range p.Roles {
+			if r, ok := roles[name]; !ok || !set.NewSet(r.Permissions...).Has(p.Name) {
+				report("permission \"%s\" lists role \"%s\" which does not use it", p.Name, name)
+			}
+		}
+	}
+	for _, u := range users {
+		for _, name := range u.Roles {
+			if r, ok := roles[name]; !ok || !set.NewSet(r.Users...).Has(u.ID) {
+				report("user \"%s\" lists role \"%s\" which is not bound to it", u.ID, name)
+			}
+		}
+	}
+	for _, g := range groups {
+		for _, name := range g.Roles {
+			if r, ok := roles[name]; !ok || !set.NewSet(r.Groups...).Has(g.ID) {
+				report("group \"%s\" lists role \"%s\" which is not bound to it", g.ID, name)
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	if len(problems) > maxReportedProblems {
+		problems = append(problems[:maxReportedProblems], fmt.Sprintf("and %d more problems", len(problems)-maxReportedProblems))
+	}
+	return fmt.Errorf("%w: %s", ErrInvalid, strings.Join(problems, "; "))
+}
+
+func sortedRoles(roles map[string]*model.Role) []*model.Role {
+	sorted := []*model.Role{}
+	for _, r := range roles {
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
@@ -0,0 +1,288 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/storage"
+)
+
+func TestValidatePrincipals(t *testing.T) {
+	tests := []struct {
+		name   string
+		owners []string
+		users  []string
+		want   string
+	}{
+		{
+			name:   "well formed",
+			owners: []string{"alice", "group:eng", "role:leads", "sa:ci"},
+			users:  []string{"alice", "sa:ci"},
+		},
+		{
+			name:   "group owner without id",
+			owners: []string{"group:"},
+			want:   "role \"docs\" has malformed owner \"group:\"",
+		},
+		{
+			name:   "role owner with bad name",
+			owners: []string{"role:-leads"},
+			want:   "role \"docs\" has malformed owner \"role:-leads\"",
+		},
+		{
+			name:   "unknown role owner",
+			owners: []string{"role:admins"},
+			want:   "role \"docs\" references role \"admins\" which does not exist",
+		},
+		{
+			name:  "service account user without name",
+			users: []string{"sa:"},
+			want:  "role \"docs\" has malformed user \"sa:\"",
+		},
+		{
+			name:  "unknown service account user",
+			users: []string{"sa:deploy"},
+			want:  "role \"docs\" references service account \"deploy\" which does not exist",
+		},
+		{
+			name:  "group user",
+			users: []string{"group:eng"},
+			want:  "role \"docs\" has malformed user \"group:eng\"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &Snapshot{
+				Version: Version,
+				Roles: []*model.Role{
+					{Name: "docs", Owners: test.owners, Users: test.users},
+					{Name: "leads"},
+				},
+				ServiceAccounts: []*ServiceAccount{{Name: "ci"}},
+			}
+			for _, id := range test.users {
+				s.Users = append(s.Users, &model.User{ID: id, Roles: []string{"docs"}})
+			}
+
+			err := s.Validate()
+			if test.want == "" {
+				if err != nil {
+					t.Errorf("got error %s, want the snapshot valid", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateNames(t *testing.T) {
+	tests := []struct {
+		name string
+		snap *Snapshot
+		want string
+	}{
+		{
+			name: "built-in objects",
+			snap: &Snapshot{
+				Permissions: []*model.Permission{{Name: model.PermissionRolesAdmin, Roles: []string{model.AdminRole}}},
+				Roles:       []*model.Role{{Name: model.AdminRole, Permissions: []string{model.PermissionRolesAdmin}}},
+			},
+		},
+		{
+			name: "malformed permission",
+			snap: &Snapshot{Permissions: []*model.Permission{{Name: "docs/read"}}},
+			want: "permission \"docs/read\" is malformed",
+		},
+		{
+			name: "reserved permission",
+			snap: &Snapshot{Permissions: []*model.Permission{{Name: "rbac.docs.read"}}},
+			want: "permission \"rbac.docs.read\" has a name reserved for built-in objects",
+		},
+		{
+			name: "reserved role",
+			snap: &Snapshot{Roles: []*model.Role{{Name: "rbac.readers"}}},
+			want: "role \"rbac.readers\" has a name reserved for built-in objects",
+		},
+		{
+			name: "reserved namespace",
+			snap: &Snapshot{Namespaces: []*model.Namespace{{Name: "rbac"}}},
+			want: "namespace \"rbac\" has a name reserved for built-in objects",
+		},
+		{
+			name: "malformed service account",
+			snap: &Snapshot{ServiceAccounts: []*ServiceAccount{{Name: "-ci"}}},
+			want: "service account \"-ci\" is malformed",
+		},
+		{
+			name: "malformed group",
+			snap: &Snapshot{Groups: []*model.Group{{ID: "eng team"}}},
+			want: "group \"eng team\" is malformed",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.snap.Version = Version
+			err := test.snap.Validate()
+			if test.want == "" {
+				if err != nil {
+					t.Errorf("got error %s, want the snapshot valid", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+// testSnapshot returns a valid snapshot with one object of each kind
+func testSnapshot() *Snapshot {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	return &Snapshot{
+		Version: Version,
+		Permissions: []*model.Permission{
+			{Name: "docs.read", Description: "read docs", Owners: []string{"alice"}, Roles: []string{"readers"}},
+		},
+		Roles: []*model.Role{
+			{Name: "readers", Description: "read things", Owners: []string{"group:eng"}, Users: []string{"bob", "sa:ci"}, Groups: []string{"eng"}, Permissions: []string{"docs.read"}},
+		},
+		Users: []*model.User{
+			{ID: "bob", Roles: []string{"readers"}},
+			{ID: "sa:ci", Roles: []string{"readers"}},
+		},
+		Groups: []*model.Group{{ID: "eng", Roles: []string{"readers"}}},
+		ServiceAccounts: []*ServiceAccount{
+			{Name: "ci", Owners: []string{"alice"}, Keys: []*APIKey{{ID: "k1", Hash: "hash", CreatedAt: created}}, CreatedAt: created},
+		},
+		Namespaces: []*model.Namespace{{Name: "docs", Owners: []string{"alice"}}},
+	}
+}
+
+// export reads a snapshot of storage and encodes it, as the export endpoint does
+func export(t *testing.T, store storage.Storage) []byte {
+	t.Helper()
+
+	snap, err := Read(context.Background(), store, 0)
+	if err != nil {
+		t.Fatalf("failed to read snapshot: %s", err)
+	}
+	snap.ExportedAt = time.Time{}
+	var buf bytes.Buffer
+	if err := snap.Encode(&buf); err != nil {
+		t.Fatalf("failed to encode snapshot: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// decode decodes an exported snapshot, as the import endpoint does
+func decode(t *testing.T, exported []byte) *Snapshot {
+	t.Helper()
+
+	var snap *Snapshot
+	dec := json.NewDecoder(bytes.NewReader(exported))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&snap); err != nil {
+		t.Fatalf("failed to decode snapshot: %s", err)
+	}
+	return snap
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source := storage.NewMemoryStorage()
+	if err := Load(ctx, source, testSnapshot(), ModeReplace); err != nil {
+		t.Fatalf("failed to load snapshot: %s", err)
+	}
+	exported := export(t, source)
+
+	// replacing restores the exact contents, and drops everything else
+	target := storage.NewMemoryStorage()
+	if err := target.CreateRole(ctx, &model.Role{Name: "stale"}); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+	if err := Load(ctx, target, decode(t, exported), ModeReplace); err != nil {
+		t.Fatalf("failed to import in replace mode: %s", err)
+	}
+	if got := export(t, target); !bytes.Equal(got, exported) {
+		t.Errorf("got %s after replacing, want %s", got, exported)
+	}
+
+	// merging keeps other objects, and overwrites those in the snapshot
+	target = storage.NewMemoryStorage()
+	for _, perm := range []*model.Permission{{Name: "docs.read", Description: "old"}, {Name: "ops.deploy", Roles: []string{"deployers"}}} {
+		if err := target.CreatePermission(ctx, perm); err != nil {
+			t.Fatalf("failed to create permission: %s", err)
+		}
+	}
+	if err := target.CreateRole(ctx, &model.Role{Name: "deployers", Users: []string{"bob"}, Permissions: []string{"ops.deploy"}}); err != nil {
+		t.Fatalf("failed to create role: %s", err)
+	}
+	if err := target.UpdateUser(ctx, &model.User{ID: "bob", Roles: []string{"deployers"}}); err != nil {
+		t.Fatalf("failed to update user: %s", err)
+	}
+	if err := Load(ctx, target, decode(t, exported), ModeMerge); err != nil {
+		t.Fatalf("failed to import in merge mode: %s", err)
+	}
+	merged, err := Read(ctx, target, 0)
+	if err != nil {
+		t.Fatalf("failed to read snapshot: %s", err)
+	}
+	if err := merged.Validate(); err != nil {
+		t.Errorf("got invalid merged dataset: %s", err)
+	}
+	if len(merged.Roles) != 2 || len(merged.Permissions) != 2 || merged.Permissions[0].Description != "read docs" {
+		t.Errorf("got roles %+v and permissions %+v, want both datasets with the snapshot's objects", merged.Roles, merged.Permissions)
+	}
+	for _, u := range merged.Users {
+		if u.ID == "bob" {
+			sort.Strings(u.Roles)
+			if len(u.Roles) != 2 || u.Roles[0] != "deployers" || u.Roles[1] != "readers" {
+				t.Errorf("got roles %v of bob, want the roles of both datasets", u.Roles)
+			}
+		}
+	}
+}
+
+// failingStorage fails to create namespaces
+type failingStorage struct {
+	*storage.MemoryStorage
+}
+
+func (s *failingStorage) CreateNamespace(context.Context, *model.Namespace) error {
+	return errors.New("unavailable")
+}
+
+func TestLoadRestoresOnFailure(t *testing.T) {
+	ctx := context.Background()
+	store := &failingStorage{storage.NewMemoryStorage()}
+	before := &Snapshot{
+		Version:     Version,
+		Permissions: []*model.Permission{{Name: "ops.deploy", Roles: []string{"deployers"}}},
+		Roles:       []*model.Role{{Name: "deployers", Users: []string{"bob"}, Permissions: []string{"ops.deploy"}}},
+		Users:       []*model.User{{ID: "bob", Roles: []string{"deployers"}}},
+	}
+	if err := Load(ctx, store, before, ModeReplace); err != nil {
+		t.Fatalf("failed to load snapshot: %s", err)
+	}
+	exported := export(t, store)
+
+	for _, mode := range []string{ModeReplace, ModeMerge} {
+		if err := Load(ctx, store, testSnapshot(), mode); err == nil || errors.Is(err, ErrInvalid) {
+			t.Errorf("got error %v importing in %s mode, want the write failure", err, mode)
+		}
+		if got := export(t, store); !bytes.Equal(got, exported) {
+			t.Errorf("got %s after a failed import in %s mode, want %s", got, mode, exported)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/adrianosela/rbac/api/model"
 	"github.com/adrianosela/rbac/utils/set"
@@ -9,10 +13,14 @@ import (
 
 // MemoryStorage is an in-memory implementation of the Storage interface
 type MemoryStorage struct {
+	sync.RWMutex
 	permissions map[string]*model.Permission
 	roles       map[string]*model.Role
 	users       map[string]*model.User
 	groups      map[string]*model.Group
+
+	serviceAccounts map[string]*model.ServiceAccount
+	namespaces      map[string]*model.Namespace
 }
 
 // NewMemoryStorage returns a new MemoryStorage
@@ -22,42 +30,95 @@ func NewMemoryStorage() *MemoryStorage {
 		roles:       make(map[string]*model.Role),
 		users:       make(map[string]*model.User),
 		groups:      make(map[string]*model.Group),
+
+		serviceAccounts: make(map[string]*model.ServiceAccount),
+		namespaces:      make(map[string]*model.Namespace),
 	}
 	return ms
 }
 
 // CreatePermission creates a new permission in storage
-func (ms *MemoryStorage) CreatePermission(p *model.Permission) error {
+func (ms *MemoryStorage) CreatePermission(ctx context.Context, p *model.Permission) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	if _, ok := ms.permissions[p.Name]; ok {
 		return fmt.Errorf("permission \"%s\" already exists", p.Name)
 	}
-	ms.permissions[p.Name] = p
+	ms.permissions[p.Name] = copyPermission(p)
 	return nil
 }
 
 // ReadPermission retrieves a permission in storage
-func (ms *MemoryStorage) ReadPermission(name string) (*model.Permission, error) {
+func (ms *MemoryStorage) ReadPermission(ctx context.Context, name string) (*model.Permission, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
 	if p, ok := ms.permissions[name]; ok {
-		return p, nil
+		return copyPermission(p), nil
 	}
 	return nil, nil
 }
 
 // BulkReadPermissions retrieves a list of permission in storage
-func (ms *MemoryStorage) BulkReadPermissions(names []string) ([]*model.Permission, error) {
+func (ms *MemoryStorage) BulkReadPermissions(ctx context.Context, names []string) ([]*model.Permission, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
 	perms := []*model.Permission{}
 	for _, name := range names {
 		p, ok := ms.permissions[name]
 		if !ok {
 			return nil, fmt.Errorf("permission \"%s\" does not exist", name)
 		}
-		perms = append(perms, p)
+		perms = append(perms, copyPermission(p))
+	}
+	return perms, nil
+}
+
+// ListPermissions retrieves all permissions in storage
+func (ms *MemoryStorage) ListPermissions(ctx context.Context) ([]*model.Permission, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	perms := []*model.Permission{}
+	for _, p := range ms.permissions {
+		perms = append(perms, copyPermission(p))
 	}
 	return perms, nil
 }
 
+// ScanPermissions retrieves a page of the permissions in storage which match the
+// given options, and the After value for the next page if there are more
+func (ms *MemoryStorage) ScanPermissions(ctx context.Context, opts ListOptions) ([]*model.Permission, string, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	names := []string{}
+	for name := range ms.permissions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	perms := []*model.Permission{}
+	for _, name := range names {
+		p := ms.permissions[name]
+		if !opts.matchName(name) || !matchMember(opts.Owner, p.Owners) {
+			continue
+		}
+		if opts.Limit > 0 && len(perms) == opts.Limit {
+			return perms, perms[len(perms)-1].Name, nil
+		}
+		perms = append(perms, copyPermission(p))
+	}
+	return perms, "", nil
+}
+
 // AddRoleToPermissions adds a role to the list of roles for permissions in storage.
-func (ms *MemoryStorage) AddRoleToPermissions(role string, perms []string) error {
+func (ms *MemoryStorage) AddRoleToPermissions(ctx context.Context, role string, perms []string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	for _, perm := range perms {
 		if p, ok := ms.permissions[perm]; ok {
 			p.Roles = set.NewSet(p.Roles...).Add(role).Slice()
@@ -67,7 +128,10 @@ func (ms *MemoryStorage) AddRoleToPermissions(role string, perms []string) error
 }
 
 // RemoveRoleFromPermissions removes a role from the list of roles for permissions in storage.
-func (ms *MemoryStorage) RemoveRoleFromPermissions(role string, perms []string) error {
+func (ms *MemoryStorage) RemoveRoleFromPermissions(ctx context.Context, role string, perms []string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	for _, perm := range perms {
 		if p, ok := ms.permissions[perm]; ok {
 			p.Roles = set.NewSet(p.Roles...).Remove(role).Slice()
@@ -77,76 +141,157 @@ func (ms *MemoryStorage) RemoveRoleFromPermissions(role string, perms []string)
 }
 
 // UpdatePermission updates a permission in storage
-func (ms *MemoryStorage) UpdatePermission(p *model.Permission) error {
+func (ms *MemoryStorage) UpdatePermission(ctx context.Context, p *model.Permission) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	if _, ok := ms.permissions[p.Name]; !ok {
 		return fmt.Errorf("permission \"%s\" does not exist", p.Name)
 	}
-	ms.permissions[p.Name] = p
+	ms.permissions[p.Name] = copyPermission(p)
 	return nil
 }
 
 // DeletePermission deletes a permission in storage
-func (ms *MemoryStorage) DeletePermission(name string) error {
+func (ms *MemoryStorage) DeletePermission(ctx context.Context, name string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	delete(ms.permissions, name)
 	return nil
 }
 
 // CreateRole creates a new role in storage
-func (ms *MemoryStorage) CreateRole(r *model.Role) error {
+func (ms *MemoryStorage) CreateRole(ctx context.Context, r *model.Role) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	if _, ok := ms.roles[r.Name]; ok {
 		return fmt.Errorf("role \"%s\" already exists", r.Name)
 	}
-	ms.roles[r.Name] = r
+	ms.roles[r.Name] = copyRole(r)
 	return nil
 }
 
 // ReadRole retrieves a role in storage
-func (ms *MemoryStorage) ReadRole(name string) (*model.Role, error) {
+func (ms *MemoryStorage) ReadRole(ctx context.Context, name string) (*model.Role, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
 	if r, ok := ms.roles[name]; ok {
-		return r, nil
+		return copyRole(r), nil
 	}
 	return nil, nil
 }
 
 // BulkReadRoles retrieves a list of roles in storage
-func (ms *MemoryStorage) BulkReadRoles(names []string) ([]*model.Role, error) {
+func (ms *MemoryStorage) BulkReadRoles(ctx context.Context, names []string) ([]*model.Role, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
 	roles := []*model.Role{}
 	for _, name := range names {
 		r, ok := ms.roles[name]
 		if !ok {
 			return nil, fmt.Errorf("role \"%s\" does not exist", name)
 		}
-		roles = append(roles, r)
+		roles = append(roles, copyRole(r))
 	}
 	return roles, nil
 }
 
+// ListRoles retrieves all roles in storage
+func (ms *MemoryStorage) ListRoles(ctx context.Context) ([]*model.Role, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	roles := []*model.Role{}
+	for _, r := range ms.roles {
+		roles = append(roles, copyRole(r))
+	}
+	return roles, nil
+}
+
+// ScanRoles retrieves a page of the roles in storage which match the
+// given options, and the After value for the next page if there are more
+func (ms *MemoryStorage) ScanRoles(ctx context.Context, opts ListOptions) ([]*model.Role, string, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	names := []string{}
+	for name := range ms.roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	roles := []*model.Role{}
+	for _, name := range names {
+		r := ms.roles[name]
+		if !opts.matchName(name) ||
+			!matchMember(opts.Owner, r.Owners) ||
+			!matchMember(opts.User, r.Users) ||
+			!matchMember(opts.Group, r.Groups) ||
+			!matchMember(opts.Permission, r.Permissions) {
+			continue
+		}
+		if opts.Limit > 0 && len(roles) == opts.Limit {
+			return roles, roles[len(roles)-1].Name, nil
+		}
+		roles = append(roles, copyRole(r))
+	}
+	return roles, "", nil
+}
+
 // UpdateRole updates a role in storage
-func (ms *MemoryStorage) UpdateRole(r *model.Role) error {
+func (ms *MemoryStorage) UpdateRole(ctx context.Context, r *model.Role) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	if _, ok := ms.roles[r.Name]; !ok {
 		return fmt.Errorf("role \"%s\" does not exist", r.Name)
 	}
-	ms.roles[r.Name] = r
+	ms.roles[r.Name] = copyRole(r)
 	return nil
 }
 
 // DeleteRole deletes a role in storage
-func (ms *MemoryStorage) DeleteRole(name string) error {
+func (ms *MemoryStorage) DeleteRole(ctx context.Context, name string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	delete(ms.roles, name)
 	return nil
 }
 
 // ReadUser retrieves a user in storage
-func (ms *MemoryStorage) ReadUser(name string) (*model.User, error) {
+func (ms *MemoryStorage) ReadUser(ctx context.Context, name string) (*model.User, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
 	if r, ok := ms.users[name]; ok {
-		return r, nil
+		return copyUser(r), nil
 	}
 	return nil, nil
 }
 
+// ListUsers retrieves all users in storage
+func (ms *MemoryStorage) ListUsers(ctx context.Context) ([]*model.User, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	users := []*model.User{}
+	for _, u := range ms.users {
+		users = append(users, copyUser(u))
+	}
+	return users, nil
+}
+
 // AddRoleToUsers adds a role to the list of roles for users in storage.
 // If the user does not exist, it is created
-func (ms *MemoryStorage) AddRoleToUsers(role string, users []string) error {
+func (ms *MemoryStorage) AddRoleToUsers(ctx context.Context, role string, users []string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	for _, user := range users {
 		if u, ok := ms.users[user]; ok {
 			u.Roles = set.NewSet(u.Roles...).Add(role).Slice()
@@ -158,7 +303,10 @@ func (ms *MemoryStorage) AddRoleToUsers(role string, users []string) error {
 }
 
 // RemoveRoleFromUsers removes a role from the list of roles for users in storage.
-func (ms *MemoryStorage) RemoveRoleFromUsers(role string, users []string) error {
+func (ms *MemoryStorage) RemoveRoleFromUsers(ctx context.Context, role string, users []string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	for _, user := range users {
 		if u, ok := ms.users[user]; ok {
 			u.Roles = set.NewSet(u.Roles...).Remove(role).Slice()
@@ -167,43 +315,70 @@ func (ms *MemoryStorage) RemoveRoleFromUsers(role string, users []string) error
 	return nil
 }
 
-// UpdateUser updates a user in storage
-func (ms *MemoryStorage) UpdateUser(u *model.User) error {
-	ms.users[u.ID] = u
+// UpdateUser creates or updates a user in storage
+func (ms *MemoryStorage) UpdateUser(ctx context.Context, u *model.User) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	ms.users[u.ID] = copyUser(u)
 	return nil
 }
 
 // DeleteUser deletes a user in storage
-func (ms *MemoryStorage) DeleteUser(id string) error {
+func (ms *MemoryStorage) DeleteUser(ctx context.Context, id string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	delete(ms.users, id)
 	return nil
 }
 
 // ReadGroup retrieves a group in storage
-func (ms *MemoryStorage) ReadGroup(id string) (*model.Group, error) {
+func (ms *MemoryStorage) ReadGroup(ctx context.Context, id string) (*model.Group, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
 	if r, ok := ms.groups[id]; ok {
-		return r, nil
+		return copyGroup(r), nil
 	}
 	return nil, nil
 }
 
 // ReadGroups retrieves a list of groups in storage
 // NOTE: behavior for not found groups differs than from not found in bulk roles/perms
-func (ms *MemoryStorage) ReadGroups(names []string) ([]*model.Group, error) {
+func (ms *MemoryStorage) ReadGroups(ctx context.Context, names []string) ([]*model.Group, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
 	groups := []*model.Group{}
 	for _, name := range names {
 		g, ok := ms.groups[name]
 		if !ok {
 			continue
 		}
-		groups = append(groups, g)
+		groups = append(groups, copyGroup(g))
+	}
+	return groups, nil
+}
+
+// ListGroups retrieves all groups in storage
+func (ms *MemoryStorage) ListGroups(ctx context.Context) ([]*model.Group, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	groups := []*model.Group{}
+	for _, g := range ms.groups {
+		groups = append(groups, copyGroup(g))
 	}
 	return groups, nil
 }
 
 // AddRoleToGroups adds a role to the list of roles for groups in storage.
 // If the group does not exist, it is created
-func (ms *MemoryStorage) AddRoleToGroups(role string, groups []string) error {
+func (ms *MemoryStorage) AddRoleToGroups(ctx context.Context, role string, groups []string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	for _, group := range groups {
 		if g, ok := ms.groups[group]; ok {
 			g.Roles = set.NewSet(g.Roles...).Add(role).Slice()
@@ -215,7 +390,10 @@ func (ms *MemoryStorage) AddRoleToGroups(role string, groups []string) error {
 }
 
 // RemoveRoleFromGroups removes a role from the list of roles for groups in storage.
-func (ms *MemoryStorage) RemoveRoleFromGroups(role string, groups []string) error {
+func (ms *MemoryStorage) RemoveRoleFromGroups(ctx context.Context, role string, groups []string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	for _, group := range groups {
 		if g, ok := ms.groups[group]; ok {
 			g.Roles = set.NewSet(g.Roles...).Remove(role).Slice()
@@ -224,14 +402,210 @@ func (ms *MemoryStorage) RemoveRoleFromGroups(role string, groups []string) erro
 	return nil
 }
 
-// UpdateGroup updates a group in storage
-func (ms *MemoryStorage) UpdateGroup(g *model.Group) error {
-	ms.groups[g.ID] = g
+// UpdateGroup creates or updates a group in storage
+func (ms *MemoryStorage) UpdateGroup(ctx context.Context, g *model.Group) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	ms.groups[g.ID] = copyGroup(g)
 	return nil
 }
 
 // DeleteGroup deletes a group in storage
-func (ms *MemoryStorage) DeleteGroup(id string) error {
+func (ms *MemoryStorage) DeleteGroup(ctx context.Context, id string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
 	delete(ms.groups, id)
 	return nil
 }
+
+// CreateServiceAccount creates a new service account in storage
+func (ms *MemoryStorage) CreateServiceAccount(ctx context.Context, sa *model.ServiceAccount) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.serviceAccounts[sa.Name]; ok {
+		return fmt.Errorf("service account \"%s\" already exists", sa.Name)
+	}
+	ms.serviceAccounts[sa.Name] = copyServiceAccount(sa)
+	return nil
+}
+
+// ReadServiceAccount retrieves a service account in storage
+func (ms *MemoryStorage) ReadServiceAccount(ctx context.Context, name string) (*model.ServiceAccount, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	if sa, ok := ms.serviceAccounts[name]; ok {
+		return copyServiceAccount(sa), nil
+	}
+	return nil, nil
+}
+
+// ListServiceAccounts retrieves all service accounts in storage
+func (ms *MemoryStorage) ListServiceAccounts(ctx context.Context) ([]*model.ServiceAccount, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	serviceAccounts := []*model.ServiceAccount{}
+	for _, sa := range ms.serviceAccounts {
+		serviceAccounts = append(serviceAccounts, copyServiceAccount(sa))
+	}
+	return serviceAccounts, nil
+}
+
+// UpdateServiceAccount updates a service account in storage
+func (ms *MemoryStorage) UpdateServiceAccount(ctx context.Context, sa *model.ServiceAccount) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.serviceAccounts[sa.Name]; !ok {
+		return fmt.Errorf("service account \"%s\" does not exist", sa.Name)
+	}
+	ms.serviceAccounts[sa.Name] = copyServiceAccount(sa)
+	return nil
+}
+
+// DeleteServiceAccount deletes a service account in storage
+func (ms *MemoryStorage) DeleteServiceAccount(ctx context.Context, name string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	delete(ms.serviceAccounts, name)
+	return nil
+}
+
+// TouchAPIKey sets the last time an API key of a service account was used
+func (ms *MemoryStorage) TouchAPIKey(ctx context.Context, name, id string, t time.Time) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	sa, ok := ms.serviceAccounts[name]
+	if !ok {
+		return fmt.Errorf("service account \"%s\" does not exist", name)
+	}
+	for _, key := range sa.Keys {
+		if key.ID == id {
+			key.LastUsed = &t
+			return nil
+		}
+	}
+	return fmt.Errorf("service account \"%s\" has no key \"%s\"", name, id)
+}
+
+// CreateNamespace creates a new namespace in storage
+func (ms *MemoryStorage) CreateNamespace(ctx context.Context, ns *model.Namespace) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.namespaces[ns.Name]; ok {
+		return fmt.Errorf("namespace \"%s\" already exists", ns.Name)
+	}
+	ms.namespaces[ns.Name] = copyNamespace(ns)
+	return nil
+}
+
+// ReadNamespace retrieves a namespace in storage
+func (ms *MemoryStorage) ReadNamespace(ctx context.Context, name string) (*model.Namespace, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	if ns, ok := ms.namespaces[name]; ok {
+		return copyNamespace(ns), nil
+	}
+	return nil, nil
+}
+
+// ListNamespaces retrieves all namespaces in storage
+func (ms *MemoryStorage) ListNamespaces(ctx context.Context) ([]*model.Namespace, error) {
+	ms.RLock()
+	defer ms.RUnlock()
+
+	namespaces := []*model.Namespace{}
+	for _, ns := range ms.namespaces {
+		namespaces = append(namespaces, copyNamespace(ns))
+	}
+	return namespaces, nil
+}
+
+// UpdateNamespace updates a namespace in storage
+func (ms *MemoryStorage) UpdateNamespace(ctx context.Context, ns *model.Namespace) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	if _, ok := ms.namespaces[ns.Name]; !ok {
+		return fmt.Errorf("namespace \"%s\" does not exist", ns.Name)
+	}
+	ms.namespaces[ns.Name] = copyNamespace(ns)
+	return nil
+}
+
+// DeleteNamespace deletes a namespace in storage
+func (ms *MemoryStorage) DeleteNamespace(ctx context.Context, name string) error {
+	ms.Lock()
+	defer ms.Unlock()
+
+	delete(ms.namespaces, name)
+	return nil
+}
+
+// Ping checks that storage is reachable, which memory always is
+func (ms *MemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+// copies are stored and returned so that callers can't modify storage
+// contents by mutating objects without going through the storage methods
+
+func copyStrings(ss []string) []string {
+	if ss == nil {
+		return nil
+	}
+	return append([]string{}, ss...)
+}
+
+func copyPermission(p *model.Permission) *model.Permission {
+	c := *p
+	c.Owners = copyStrings(p.Owners)
+	c.Roles = copyStrings(p.Roles)
+	return &c
+}
+
+func copyRole(r *model.Role) *model.Role {
+	c := *r
+	c.Owners = copyStrings(r.Owners)
+	c.Users = copyStrings(r.Users)
+	c.Groups = copyStrings(r.Groups)
+	c.Permissions = copyStrings(r.Permissions)
+	return &c
+}
+
+func copyUser(u *model.User) *model.User {
+	c := *u
+	c.Roles = copyStrings(u.Roles)
+	return &c
+}
+
+func copyGroup(g *model.Group) *model.Group {
+	c := *g
+	c.Roles = copyStrings(g.Roles)
+	return &c
+}
+
+func copyServiceAccount(sa *model.ServiceAccount) *model.ServiceAccount {
+	c := *sa
+	c.Owners = copyStrings(sa.Owners)
+	c.Keys = make([]*model.APIKey, 0, len(sa.Keys))
+	for _, key := range sa.Keys {
+		k := *key
+		c.Keys = append(c.Keys, &k)
+	}
+	return &c
+}
+
+func copyNamespace(ns *model.Namespace) *model.Namespace {
+	c := *ns
+	c.Owners = copyStrings(ns.Owners)
+	return &c
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+// ListOptions represents the filters and pagination for a scan of storage.
+// Objects are always scanned in ascending order of name.
+type ListOptions struct {
+	Prefix   string // name starts with
+	Contains string // name contains, case insensitive
+	Owner    string // owners include
+
+	// only applicable to roles
+	User       string // users include
+	Group      string // groups include
+	Permission string // permissions include
+
+	After string // only objects named after this, for pagination
+	Limit int    // maximum number of objects, zero for no limit
+}
+
+// matchName returns true if a name passes the name filters and pagination
+func (o ListOptions) matchName(name string) bool {
+	if o.After != "" && name <= o.After {
+		return false
+	}
+	if !strings.HasPrefix(name, o.Prefix) {
+		return false
+	}
+	return strings.Contains(strings.ToLower(name), strings.ToLower(o.Contains))
+}
+
+// matchMember returns true if a filter is unset or the members include it
+func matchMember(filter string, members []string) bool {
+	return filter == "" || set.NewSet(members...).Has(filter)
+}
@@ -1,30 +1,59 @@
 package storage
 
 import (
+	"context"
+	"time"
+
 	"github.com/adrianosela/rbac/api/model"
 )
 
-// Storage represents the storage needs of the api
+// Storage represents the storage needs of the api. Every operation takes
+// the context of the request it is made for, for cancellation and tracing.
 type Storage interface {
-	CreatePermission(*model.Permission) error
-	ReadPermission(string) (*model.Permission, error)
-	BulkReadPermissions([]string) ([]*model.Permission, error)
-	UpdatePermission(*model.Permission) error
-	DeletePermission(string) error
-	AddRoleToPermissions(string, []string) error      // FIXME: move to eventual consistence
-	RemoveRoleFromPermissions(string, []string) error // FIXME: move to eventual consistence
-
-	CreateRole(*model.Role) error
-	ReadRole(string) (*model.Role, error)
-	BulkReadRoles([]string) ([]*model.Role, error)
-	UpdateRole(*model.Role) error
-	DeleteRole(string) error
-
-	ReadUser(string) (*model.User, error)
-	AddRoleToUsers(string, []string) error      // FIXME: move to eventual consistence
-	RemoveRoleFromUsers(string, []string) error // FIXME: move to eventual consistence
-
-	ReadGroups([]string) ([]*model.Group, error)
-	AddRoleToGroups(string, []string) error      // FIXME: move to eventual consistence
-	RemoveRoleFromGroups(string, []string) error // FIXME: move to eventual consistence
+	CreatePermission(context.Context, *model.Permission) error
+	ReadPermission(context.Context, string) (*model.Permission, error)
+	BulkReadPermissions(context.Context, []string) ([]*model.Permission, error)
+	ListPermissions(context.Context) ([]*model.Permission, error)
+	ScanPermissions(context.Context, ListOptions) ([]*model.Permission, string, error) // also returns the After value for the next page, empty on the last
+	UpdatePermission(context.Context, *model.Permission) error
+	DeletePermission(context.Context, string) error
+	AddRoleToPermissions(context.Context, string, []string) error      // FIXME: move to eventual consistence
+	RemoveRoleFromPermissions(context.Context, string, []string) error // FIXME: move to eventual consistence
+
+	CreateRole(context.Context, *model.Role) error
+	ReadRole(context.Context, string) (*model.Role, error)
+	BulkReadRoles(context.Context, []string) ([]*model.Role, error)
+	ListRoles(context.Context) ([]*model.Role, error)
+	ScanRoles(context.Context, ListOptions) ([]*model.Role, string, error) // also returns the After value for the next page, empty on the last
+	UpdateRole(context.Context, *model.Role) error
+	DeleteRole(context.Context, string) error
+
+	ReadUser(context.Context, string) (*model.User, error)
+	ListUsers(context.Context) ([]*model.User, error)
+	UpdateUser(context.Context, *model.User) error
+	DeleteUser(context.Context, string) error
+	AddRoleToUsers(context.Context, string, []string) error      // FIXME: move to eventual consistence
+	RemoveRoleFromUsers(context.Context, string, []string) error // FIXME: move to eventual consistence
+
+	ReadGroups(context.Context, []string) ([]*model.Group, error)
+	ListGroups(context.Context) ([]*model.Group, error)
+	UpdateGroup(context.Context, *model.Group) error
+	DeleteGroup(context.Context, string) error
+	AddRoleToGroups(context.Context, string, []string) error      // FIXME: move to eventual consistence
+	RemoveRoleFromGroups(context.Context, string, []string) error // FIXME: move to eventual consistence
+
+	CreateServiceAccount(context.Context, *model.ServiceAccount) error
+	ReadServiceAccount(context.Context, string) (*model.ServiceAccount, error)
+	ListServiceAccounts(context.Context) ([]*model.ServiceAccount, error)
+	UpdateServiceAccount(context.Context, *model.ServiceAccount) error
+	DeleteServiceAccount(context.Context, string) error
+	TouchAPIKey(context.Context, string, string, time.Time) error // sets the last time a key of a service account was used
+
+	CreateNamespace(context.Context, *model.Namespace) error
+	ReadNamespace(context.Context, string) (*model.Namespace, error)
+	ListNamespaces(context.Context) ([]*model.Namespace, error)
+	UpdateNamespace(context.Context, *model.Namespace) error
+	DeleteNamespace(context.Context, string) error
+
+	Ping(context.Context) error // checks that storage is reachable, for readiness probes
 }
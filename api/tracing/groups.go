@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tracedSource is a groups.Source which records
+// a span for every lookup in another
+type tracedSource struct {
+	src     groups.Source
+	tracing *Tracing
+}
+
+// InstrumentGroups returns a groups.Source which records a span for every
+// lookup in the given one, as a child of the span in its context
+func (t *Tracing) InstrumentGroups(src groups.Source) groups.Source {
+	return &tracedSource{src: src, tracing: t}
+}
+
+// GetForUser calls GetForUser of the traced source, in a child span
+func (ts *tracedSource) GetForUser(ctx context.Context, id string) (groups []string, err error) {
+	ctx, span := ts.tracing.start(ctx, "groups.GetForUser", attribute.String("rbac.user", id))
+	defer end(span, &err)
+	groups, err = ts.src.GetForUser(ctx, id)
+	span.SetAttributes(attribute.Int("rbac.groups", len(groups)))
+	return groups, err
+}
+
+// UserActive calls UserActive of the traced source, in a child span
+func (ts *tracedSource) UserActive(ctx context.Context, id string) (active bool, err error) {
+	ctx, span := ts.tracing.start(ctx, "groups.UserActive", attribute.String("rbac.user", id))
+	defer end(span, &err)
+	active, err = ts.src.UserActive(ctx, id)
+	span.SetAttributes(attribute.Bool("rbac.active", active))
+	return active, err
+}
+
+// Ping calls Ping of the traced source, in a child span
+func (ts *tracedSource) Ping(ctx context.Context) (err error) {
+	ctx, span := ts.tracing.start(ctx, "groups.Ping")
+	defer end(span, &err)
+	return ts.src.Ping(ctx)
+}
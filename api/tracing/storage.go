@@ -0,0 +1,302 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/storage"
+)
+
+// tracedStorage is a storage.Storage which records a
+// span for every operation of another
+type tracedStorage struct {
+	store   storage.Storage
+	tracing *Tracing
+}
+
+// InstrumentStorage returns a storage.Storage which records a span for
+// every operation of the given one, as a child of the span in its context
+func (t *Tracing) InstrumentStorage(store storage.Storage) storage.Storage {
+	return &tracedStorage{store: store, tracing: t}
+}
+
+// CreatePermission calls CreatePermission of the traced storage, in a child span
+func (ts *tracedStorage) CreatePermission(ctx context.Context, p *model.Permission) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.CreatePermission")
+	defer end(span, &err)
+	return ts.store.CreatePermission(ctx, p)
+}
+
+// ReadPermission calls ReadPermission of the traced storage, in a child span
+func (ts *tracedStorage) ReadPermission(ctx context.Context, name string) (permission *model.Permission, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ReadPermission")
+	defer end(span, &err)
+	return ts.store.ReadPermission(ctx, name)
+}
+
+// BulkReadPermissions calls BulkReadPermissions of the traced storage, in a child span
+func (ts *tracedStorage) BulkReadPermissions(ctx context.Context, names []string) (permissions []*model.Permission, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.BulkReadPermissions")
+	defer end(span, &err)
+	return ts.store.BulkReadPermissions(ctx, names)
+}
+
+// ListPermissions calls ListPermissions of the traced storage, in a child span
+func (ts *tracedStorage) ListPermissions(ctx context.Context) (permissions []*model.Permission, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ListPermissions")
+	defer end(span, &err)
+	return ts.store.ListPermissions(ctx)
+}
+
+// ScanPermissions calls ScanPermissions of the traced storage, in a child span
+func (ts *tracedStorage) ScanPermissions(ctx context.Context, opts storage.ListOptions) (permissions []*model.Permission, after string, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ScanPermissions")
+	defer end(span, &err)
+	return ts.store.ScanPermissions(ctx, opts)
+}
+
+// UpdatePermission calls UpdatePermission of the traced storage, in a child span
+func (ts *tracedStorage) UpdatePermission(ctx context.Context, p *model.Permission) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.UpdatePermission")
+	defer end(span, &err)
+	return ts.store.UpdatePermission(ctx, p)
+}
+
+// DeletePermission calls DeletePermission of the traced storage, in a child span
+func (ts *tracedStorage) DeletePermission(ctx context.Context, name string) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.DeletePermission")
+	defer end(span, &err)
+	return ts.store.DeletePermission(ctx, name)
+}
+
+// AddRoleToPermissions calls AddRoleToPermissions of the traced storage, in a child span
+func (ts *tracedStorage) AddRoleToPermissions(ctx context.Context, role string, names []string) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.AddRoleToPermissions")
+	defer end(span, &err)
+	return ts.store.AddRoleToPermissions(ctx, role, names)
+}
+
+// RemoveRoleFromPermissions calls RemoveRoleFromPermissions of the traced storage, in a child span
+func (ts *tracedStorage) RemoveRoleFromPermissions(ctx context.Context, role string, names []string) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.RemoveRoleFromPermissions")
+	defer end(span, &err)
+	return ts.store.RemoveRoleFromPermissions(ctx, role, names)
+}
+
+// CreateRole calls CreateRole of the traced storage, in a child span
+func (ts *tracedStorage) CreateRole(ctx context.Context, r *model.Role) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.CreateRole")
+	defer end(span, &err)
+	return ts.store.CreateRole(ctx, r)
+}
+
+// ReadRole calls ReadRole of the traced storage, in a child span
+func (ts *tracedStorage) ReadRole(ctx context.Context, name string) (role *model.Role, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ReadRole")
+	defer end(span, &err)
+	return ts.store.ReadRole(ctx, name)
+}
+
+// BulkReadRoles calls BulkReadRoles of the traced storage, in a child span
+func (ts *tracedStorage) BulkReadRoles(ctx context.Context, names []string) (roles []*model.Role, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.BulkReadRoles")
+	defer end(span, &err)
+	return ts.store.BulkReadRoles(ctx, names)
+}
+
+// ListRoles calls ListRoles of the traced storage, in a child span
+func (ts *tracedStorage) ListRoles(ctx context.Context) (roles []*model.Role, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ListRoles")
+	defer end(span, &err)
+	return ts.store.ListRoles(ctx)
+}
+
+// ScanRoles calls ScanRoles of the traced storage, in a child span
+func (ts *tracedStorage) ScanRoles(ctx context.Context, opts storage.ListOptions) (roles []*model.Role, after string, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ScanRoles")
+	defer end(span, &err)
+	return ts.store.ScanRoles(ctx, opts)
+}
+
+// UpdateRole calls UpdateRole of the traced storage, in a child span
+func (ts *tracedStorage) UpdateRole(ctx context.Context, r *model.Role) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.UpdateRole")
+	defer end(span, &err)
+	return ts.store.UpdateRole(ctx, r)
+}
+
+// DeleteRole calls DeleteRole of the traced storage, in a child span
+func (ts *tracedStorage) DeleteRole(ctx context.Context, name string) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.DeleteRole")
+	defer end(span, &err)
+	return ts.store.DeleteRole(ctx, name)
+}
+
+// ReadUser calls ReadUser of the traced storage, in a child span
+func (ts *tracedStorage) ReadUser(ctx context.Context, id string) (user *model.User, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ReadUser")
+	defer end(span, &err)
+	return ts.store.ReadUser(ctx, id)
+}
+
+// ListUsers calls ListUsers of the traced storage, in a child span
+func (ts *tracedStorage) ListUsers(ctx context.Context) (users []*model.User, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ListUsers")
+	defer end(span, &err)
+	return ts.store.ListUsers(ctx)
+}
+
+// UpdateUser calls UpdateUser of the traced storage, in a child span
+func (ts *tracedStorage) UpdateUser(ctx context.Context, u *model.User) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.UpdateUser")
+	defer end(span, &err)
+	return ts.store.UpdateUser(ctx, u)
+}
+
+// DeleteUser calls DeleteUser of the traced storage, in a child span
+func (ts *tracedStorage) DeleteUser(ctx context.Context, id string) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.DeleteUser")
+	defer end(span, &err)
+	return ts.store.DeleteUser(ctx, id)
+}
+
+// AddRoleToUsers calls AddRoleToUsers of the traced storage, in a child span
+func (ts *tracedStorage) AddRoleToUsers(ctx context.Context, role string, ids []string) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.AddRoleToUsers")
+	defer end(span, &err)
+	return ts.store.AddRoleToUsers(ctx, role, ids)
+}
+
+// RemoveRoleFromUsers calls RemoveRoleFromUsers of the traced storage, in a child span
+func (ts *tracedStorage) RemoveRoleFromUsers(ctx context.Context, role string, ids []string) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.RemoveRoleFromUsers")
+	defer end(span, &err)
+	return ts.store.RemoveRoleFromUsers(ctx, role, ids)
+}
+
+// ReadGroups calls ReadGroups of the traced storage, in a child span
+func (ts *tracedStorage) ReadGroups(ctx context.Context, ids []string) (groups []*model.Group, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ReadGroups")
+	defer end(span, &err)
+	return ts.store.ReadGroups(ctx, ids)
+}
+
+// ListGroups calls ListGroups of the traced storage, in a child span
+func (ts *tracedStorage) ListGroups(ctx context.Context) (groups []*model.Group, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ListGroups")
+	defer end(span, &err)
+	return ts.store.ListGroups(ctx)
+}
+
+// UpdateGroup calls UpdateGroup of the traced storage, in a child span
+func (ts *tracedStorage) UpdateGroup(ctx context.Context, g *model.Group) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.UpdateGroup")
+	defer end(span, &err)
+	return ts.store.UpdateGroup(ctx, g)
+}
+
+// DeleteGroup calls DeleteGroup of the traced storage, in a child span
+func (ts *tracedStorage) DeleteGroup(ctx context.Context, id string) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.DeleteGroup")
+	defer end(span, &err)
+	return ts.store.DeleteGroup(ctx, id)
+}
+
+// AddRoleToGroups calls AddRoleToGroups of the traced storage, in a child span
+func (ts *tracedStorage) AddRoleToGroups(ctx context.Context, role string, ids []string) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.AddRoleToGroups")
+	defer end(span, &err)
+	return ts.store.AddRoleToGroups(ctx, role, ids)
+}
+
+// RemoveRoleFromGroups calls RemoveRoleFromGroups of the traced storage, in a child span
+func (ts *tracedStorage) RemoveRoleFromGroups(ctx context.Context, role string, ids []string) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.RemoveRoleFromGroups")
+	defer end(span, &err)
+	return ts.store.RemoveRoleFromGroups(ctx, role, ids)
+}
+
+// CreateServiceAccount calls CreateServiceAccount of the traced storage, in a child span
+func (ts *tracedStorage) CreateServiceAccount(ctx context.Context, sa *model.ServiceAccount) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.CreateServiceAccount")
+	defer end(span, &err)
+	return ts.store.CreateServiceAccount(ctx, sa)
+}
+
+// ReadServiceAccount calls ReadServiceAccount of the traced storage, in a child span
+func (ts *tracedStorage) ReadServiceAccount(ctx context.Context, name string) (sa *model.ServiceAccount, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ReadServiceAccount")
+	defer end(span, &err)
+	return ts.store.ReadServiceAccount(ctx, name)
+}
+
+// ListServiceAccounts calls ListServiceAccounts of the traced storage, in a child span
+func (ts *tracedStorage) ListServiceAccounts(ctx context.Context) (serviceAccounts []*model.ServiceAccount, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ListServiceAccounts")
+	defer end(span, &err)
+	return ts.store.ListServiceAccounts(ctx)
+}
+
+// UpdateServiceAccount calls UpdateServiceAccount of the traced storage, in a child span
+func (ts *tracedStorage) UpdateServiceAccount(ctx context.Context, sa *model.ServiceAccount) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.UpdateServiceAccount")
+	defer end(span, &err)
+	return ts.store.UpdateServiceAccount(ctx, sa)
+}
+
+// DeleteServiceAccount calls DeleteServiceAccount of the traced storage, in a child span
+func (ts *tracedStorage) DeleteServiceAccount(ctx context.Context, name string) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.DeleteServiceAccount")
+	defer end(span, &err)
+	return ts.store.DeleteServiceAccount(ctx, name)
+}
+
+// TouchAPIKey calls TouchAPIKey of the traced storage, in a child span
+func (ts *tracedStorage) TouchAPIKey(ctx context.Context, name, id string, t time.Time) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.TouchAPIKey")
+	defer end(span, &err)
+	return ts.store.TouchAPIKey(ctx, name, id, t)
+}
+
+// CreateNamespace calls CreateNamespace of the traced storage, in a child span
+func (ts *tracedStorage) CreateNamespace(ctx context.Context, ns *model.Namespace) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.CreateNamespace")
+	defer end(span, &err)
+	return ts.store.CreateNamespace(ctx, ns)
+}
+
+// ReadNamespace calls ReadNamespace of the traced storage, in a child span
+func (ts *tracedStorage) ReadNamespace(ctx context.Context, name string) (ns *model.Namespace, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ReadNamespace")
+	defer end(span, &err)
+	return ts.store.ReadNamespace(ctx, name)
+}
+
+// ListNamespaces calls ListNamespaces of the traced storage, in a child span
+func (ts *tracedStorage) ListNamespaces(ctx context.Context) (namespaces []*model.Namespace, err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.ListNamespaces")
+	defer end(span, &err)
+	return ts.store.ListNamespaces(ctx)
+}
+
+// UpdateNamespace calls UpdateNamespace of the traced storage, in a child span
+func (ts *tracedStorage) UpdateNamespace(ctx context.Context, ns *model.Namespace) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.UpdateNamespace")
+	defer end(span, &err)
+	return ts.store.UpdateNamespace(ctx, ns)
+}
+
+// DeleteNamespace calls DeleteNamespace of the traced storage, in a child span
+func (ts *tracedStorage) DeleteNamespace(ctx context.Context, name string) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.DeleteNamespace")
+	defer end(span, &err)
+	return ts.store.DeleteNamespace(ctx, name)
+}
+
+// Ping calls Ping of the traced storage, in a child span
+func (ts *tracedStorage) Ping(ctx context.Context) (err error) {
+	ctx, span := ts.tracing.start(ctx, "storage.Ping")
+	defer end(span, &err)
+	return ts.store.Ping(ctx)
+}
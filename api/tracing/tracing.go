@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	// ExporterNone disables tracing, trace context is still propagated
+	ExporterNone = "none"
+	// ExporterStdout writes spans to standard output as JSON
+	ExporterStdout = "stdout"
+	// ExporterOTLP sends spans to an OpenTelemetry collector over OTLP/HTTP
+	ExporterOTLP = "otlp"
+	// ExporterMemory keeps spans in memory, for tests
+	ExporterMemory = "memory"
+)
+
+const instrumentationName = "github.com/adrianosela/rbac"
+
+// Config represents configuration for tracing
+type Config struct {
+	Exporter     string  `yaml:"exporter"`      // one of the Exporter constants, defaults to ExporterNone
+	OTLPEndpoint string  `yaml:"otlp_endpoint"` // host:port of the collector, defaults to the OTEL_EXPORTER_OTLP_* environment
+	SampleRatio  float64 `yaml:"sample_ratio"`  // ratio of traces started here which are sampled, defaults to 1
+	ServiceName  string  `yaml:"service_name"`  // defaults to "rbac"
+}
+
+// Tracing holds the tracer of the service and the provider which exports its spans
+type Tracing struct {
+	tracer   trace.Tracer
+	shutdown func(context.Context) error
+	memory   *tracetest.InMemoryExporter
+}
+
+// New returns a new Tracing with the configured exporter. It also sets the
+// global propagator to W3C trace context, which outgoing requests use.
+func New(c Config) (*Tracing, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if c.Exporter == "" || c.Exporter == ExporterNone {
+		return &Tracing{
+			tracer:   noop.NewTracerProvider().Tracer(instrumentationName),
+			shutdown: func(context.Context) error { return nil },
+		}, nil
+	}
+
+	if c.SampleRatio == 0 {
+		c.SampleRatio = 1
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return nil, fmt.Errorf("trace sample ratio %v is not between 0 and 1", c.SampleRatio)
+	}
+	if c.ServiceName == "" {
+		c.ServiceName = "rbac"
+	}
+
+	t := &Tracing{}
+	var exporter sdktrace.SpanExporter
+	switch c.Exporter {
+	case ExporterStdout:
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %s", err)
+		}
+		exporter = stdout
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{}
+		if c.OTLPEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(c.OTLPEndpoint))
+		}
+		otlp, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %s", err)
+		}
+		exporter = otlp
+	case ExporterMemory:
+		t.memory = tracetest.NewInMemoryExporter()
+		exporter = t.memory
+	default:
+		return nil, fmt.Errorf("trace exporter \"%s\" is not one of \"%s\", \"%s\", \"%s\", or \"%s\"",
+			c.Exporter, ExporterNone, ExporterStdout, ExporterOTLP, ExporterMemory)
+	}
+
+	processor := sdktrace.NewBatchSpanProcessor(exporter)
+	if t.memory != nil {
+		// export synchronously, so that spans can be inspected as soon as they end
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(c.ServiceName))),
+	)
+	t.tracer = provider.Tracer(instrumentationName)
+	t.shutdown = provider.Shutdown
+	return t, nil
+}
+
+// Tracer returns the tracer of the service
+func (t *Tracing) Tracer() trace.Tracer {
+	return t.tracer
+}
+
+// Memory returns the in-memory exporter, or nil unless it is the configured one
+func (t *Tracing) Memory() *tracetest.InMemoryExporter {
+	return t.memory
+}
+
+// Shutdown exports any buffered spans and stops the exporter
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	return t.shutdown(ctx)
+}
+
+// start starts a child span of the span in ctx, if any
+func (t *Tracing) start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// end ends a span, recording the error if there is one
+func end(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
@@ -0,0 +1,152 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/utils/set"
+)
+
+const (
+	// MaxNameLength is the maximum length of role and permission names
+	MaxNameLength = 128
+	// MaxSubjectLength is the maximum length of user and group identifiers
+	MaxSubjectLength = 256
+	// MaxDescriptionLength is the maximum length of descriptions
+	MaxDescriptionLength = 1024
+	// MaxListLength is the maximum number of items in a list in one request
+	MaxListLength = 100
+)
+
+var (
+	// names must be addressable as a single URL path segment
+	nameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._:-]*$`)
+	// subjects are user and group identifiers, e.g. logins or emails
+	subjectRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._@+-]*$`)
+)
+
+// FieldError represents a problem with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is a list of field errors, which is an error when non empty
+type Errors []FieldError
+
+// Error returns the string representation of the errors
+func (e Errors) Error() string {
+	msgs := []string{}
+	for _, fe := range e {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", fe.Field, fe.Message))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Err returns the errors as an error, or nil if there are none
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Add records an error for a field
+func (e *Errors) Add(field, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Name checks a role or permission name
+func (e *Errors) Name(field, value string) {
+	switch {
+	case value == "":
+		e.Add(field, "is required")
+	case len(value) > MaxNameLength:
+		e.Add(field, "must be at most %d characters long", MaxNameLength)
+	case !nameRegexp.MatchString(value):
+		e.Add(field, "must start with a letter or digit and only contain letters, digits, '.', '_', ':', and '-'")
+	}
+}
+
+// Subject checks a user or group identifier
+func (e *Errors) Subject(field, value string) {
+	switch {
+	case value == "":
+		e.Add(field, "must not be empty")
+	case len(value) > MaxSubjectLength:
+		e.Add(field, "must be at most %d characters long", MaxSubjectLength)
+	case !subjectRegexp.MatchString(value):
+		e.Add(field, "must start with a letter or digit and only contain letters, digits, '.', '_', '@', '+', and '-'")
+	}
+}
+
+// Principal checks a user identifier, or the name of a service account
+// after the model.ServiceAccountPrefix
+func (e *Errors) Principal(field, value string) {
+	if name, ok := model.ServiceAccountName(value); ok {
+		e.Name(field, name)
+		return
+	}
+	e.Subject(field, value)
+}
+
+// Owner checks a principal, the ID of a group after the
+// model.GroupOwnerPrefix, or the name of a role after the model.RoleOwnerPrefix
+func (e *Errors) Owner(field, value string) {
+	if id, ok := model.OwnerGroup(value); ok {
+		e.Subject(field, id)
+		return
+	}
+	if name, ok := model.OwnerRole(value); ok {
+		e.Name(field, name)
+		return
+	}
+	e.Principal(field, value)
+}
+
+// Description checks a description
+func (e *Errors) Description(field, value string) {
+	if utf8.RuneCountInString(value) > MaxDescriptionLength {
+		e.Add(field, "must be at most %d characters long", MaxDescriptionLength)
+	}
+}
+
+// Names checks a list of role or permission names
+func (e *Errors) Names(field string, values []string) {
+	e.list(field, values, e.Name)
+}
+
+// Subjects checks a list of user or group identifiers
+func (e *Errors) Subjects(field string, values []string) {
+	e.list(field, values, e.Subject)
+}
+
+// Principals checks a list of user identifiers and service accounts
+func (e *Errors) Principals(field string, values []string) {
+	e.list(field, values, e.Principal)
+}
+
+// Owners checks a list of principals, groups, and roles
+func (e *Errors) Owners(field string, values []string) {
+	e.list(field, values, e.Owner)
+}
+
+func (e *Errors) list(field string, values []string, check func(string, string)) {
+	if len(values) > MaxListLength {
+		e.Add(field, "must have at most %d items", MaxListLength)
+		return
+	}
+	seen := set.NewSet()
+	for i, value := range values {
+		itemField := fmt.Sprintf("%s[%d]", field, i)
+		if seen.Has(value) {
+			e.Add(itemField, "duplicates \"%s\"", value)
+			continue
+		}
+		seen.Add(value)
+		check(itemField, value)
+	}
+}
@@ -0,0 +1,65 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+)
+
+// ErrPrivateDestination is returned (wrapped) for destinations on loopback,
+// link-local, private, or unspecified addresses, e.g. the service's own
+// host or a cloud metadata endpoint
+var ErrPrivateDestination = errors.New("destination is not a public address")
+
+// IsPrivate returns true if an address is loopback, link-local,
+// private, or unspecified
+func IsPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsPrivate() || ip.IsUnspecified()
+}
+
+// CheckDestination resolves the host of a webhook URL, and returns an
+// error if it does not resolve or any of its addresses is private
+func CheckDestination(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	ips := []net.IP{}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+		if err != nil {
+			return fmt.Errorf("failed to resolve host \"%s\": %s", u.Hostname(), err)
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		if IsPrivate(ip) {
+			return fmt.Errorf("%w: host \"%s\" resolves to %s", ErrPrivateDestination, u.Hostname(), ip)
+		}
+	}
+	return nil
+}
+
+// dialPublicOnly refuses connections to private addresses, so that a
+// destination which passed CheckDestination can't be pointed at a
+// private address later on
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || IsPrivate(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateDestination, host)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/rbac/api/events"
+)
+
+func TestCheckDestination(t *testing.T) {
+	tests := []struct {
+		url     string
+		private bool
+	}{
+		{"https://93.184.216.34/hook", false},
+		{"https://[2606:4700::1111]/hook", false},
+		{"http://127.0.0.1:8080/hook", true},
+		{"http://localhost/hook", true},
+		{"http://[::1]/hook", true},
+		{"http://10.0.0.1/hook", true},
+		{"http://192.168.1.1/hook", true},
+		{"http://169.254.169.254/latest/meta-data", true},
+		{"http://0.0.0.0/hook", true},
+	}
+	for _, test := range tests {
+		err := CheckDestination(context.Background(), test.url)
+		if got := errors.Is(err, ErrPrivateDestination); got != test.private {
+			t.Errorf("CheckDestination(%s) returned %v", test.url, err)
+		}
+	}
+}
+
+func TestPrivateDestinationIsNotDialed(t *testing.T) {
+	srv, ch := newReceiver(t, func(int) int { return http.StatusOK })
+	d := NewDispatcher(1, time.Millisecond, false)
+	sub := subscribe(t, d, srv.URL)
+
+	d.Publish(events.New(events.RoleCreated, "readers", "alice"))
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	if len(ch) != 0 {
+		t.Errorf("got %d deliveries to a private address, want none", len(ch))
+	}
+	dls := d.DeadLetters(sub.ID)
+	if len(dls) != 1 || !strings.Contains(dls[0].LastError, ErrPrivateDestination.Error()) {
+		t.Errorf("got dead letters %+v, want a delivery refused for its private address", dls)
+	}
+}
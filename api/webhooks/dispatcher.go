@@ -0,0 +1,362 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/rbac/api/events"
+)
+
+const (
+	// SignatureHeader is the header carrying the HMAC-SHA256 signature of a delivery
+	SignatureHeader = "X-RBAC-Signature"
+	// EventHeader is the header carrying the type of the delivered event
+	EventHeader = "X-RBAC-Event"
+	// DeliveryHeader is the header carrying the unique id of a delivery
+	DeliveryHeader = "X-RBAC-Delivery"
+
+	defaultMaxAttempts    = 5
+	defaultInitialBackoff = time.Second
+	maxDeadLetters        = 1000
+
+	workers   = 8    // deliveries made concurrently
+	queueSize = 1000 // deliveries waiting for a worker, more are dead-lettered
+)
+
+// Filter selects the events a subscription is interested in.
+// An empty Name matches events for any object.
+type Filter struct {
+	Event string `json:"event"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Subscription represents a registered webhook receiver
+type Subscription struct {
+	ID      string   `json:"id"`
+	URL     string   `json:"url"`
+	Secret  string   `json:"-"`
+	Filters []Filter `json:"filters"`
+	Owner   string   `json:"owner"`
+}
+
+// DeadLetter represents a delivery that was abandoned after exhausting retries
+type DeadLetter struct {
+	DeliveryID     string       `json:"delivery_id"`
+	SubscriptionID string       `json:"subscription_id"`
+	Event          events.Event `json:"event"`
+	Attempts       int          `json:"attempts"`
+	LastError      string       `json:"last_error"`
+	FailedAt       time.Time    `json:"failed_at"`
+}
+
+// Dispatcher delivers events to the subscriptions whose filters match them.
+// Deliveries are asynchronous, signed, and retried with exponential backoff
+// by a fixed number of workers, until the Dispatcher is closed.
+type Dispatcher struct {
+	sync.RWMutex
+	subscriptions  map[string]*Subscription
+	deadLetters    []*DeadLetter
+	maxAttempts    int
+	initialBackoff time.Duration
+	httpClient     *http.Client
+
+	queue   chan delivery
+	closed  bool          // no deliveries are queued once set
+	closing chan struct{} // closed by Close, workers exit once the queue is empty
+	ctx     context.Context
+	cancel  context.CancelFunc // abandons retries and in flight requests
+	workers sync.WaitGroup
+}
+
+// delivery is an event queued for delivery to a subscription
+type delivery struct {
+	id    string
+	sub   Subscription
+	event events.Event
+}
+
+// NewDispatcher returns a new Dispatcher and starts its workers. Non positive
+// values for maxAttempts or initialBackoff are replaced with sensible defaults.
+// Deliveries to private addresses fail unless allowPrivate is set.
+func NewDispatcher(maxAttempts int, initialBackoff time.Duration, allowPrivate bool) *Dispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	if initialBackoff <= 0 {
+		initialBackoff = defaultInitialBackoff
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer := &net.Dialer{Timeout: time.Second * 30, KeepAlive: time.Second * 30, Control: dialPublicOnly}
+		transport.DialContext = dialer.DialContext
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		subscriptions:  make(map[string]*Subscription),
+		deadLetters:    []*DeadLetter{},
+		maxAttempts:    maxAttempts,
+		initialBackoff: initialBackoff,
+		httpClient: &http.Client{
+			Timeout:   time.Second * 10,
+			Transport: transport,
+		},
+		queue:   make(chan delivery, queueSize),
+		closing: make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	d.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+// Close stops queueing deliveries and waits for the queued ones to finish.
+// When ctx is done first, the remaining deliveries are abandoned and
+// dead-lettered, and ctx's error is returned.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.closing)
+	}
+	d.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Subscribe registers a new subscription and returns it with its id populated
+func (d *Dispatcher) Subscribe(sub *Subscription) (*Subscription, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate subscription id: %s", err)
+	}
+	sub.ID = id
+
+	d.Lock()
+	defer d.Unlock()
+
+	d.subscriptions[sub.ID] = sub
+	return sub, nil
+}
+
+// Unsubscribe removes a subscription
+func (d *Dispatcher) Unsubscribe(id string) {
+	d.Lock()
+	defer d.Unlock()
+
+	delete(d.subscriptions, id)
+}
+
+// Get returns a subscription by id, or nil if it does not exist
+func (d *Dispatcher) Get(id string) *Subscription {
+	d.RLock()
+	defer d.RUnlock()
+
+	return d.subscriptions[id]
+}
+
+// DeadLetters returns the abandoned deliveries for a subscription
+func (d *Dispatcher) DeadLetters(subscriptionID string) []*DeadLetter {
+	d.RLock()
+	defer d.RUnlock()
+
+	dls := []*DeadLetter{}
+	for _, dl := range d.deadLetters {
+		if dl.SubscriptionID == subscriptionID {
+			dls = append(dls, dl)
+		}
+	}
+	return dls
+}
+
+// Publish queues delivery of an event to every matching subscription.
+// Deliveries which can't be queued, because the queue is full or the
+// Dispatcher is closed, are dead-lettered right away.
+func (d *Dispatcher) Publish(e events.Event) {
+	type rejection struct {
+		dl  delivery
+		err error
+	}
+	rejected := []rejection{}
+
+	d.RLock()
+	for _, sub := range d.subscriptions {
+		if !sub.matches(e) {
+			continue
+		}
+		deliveryID, err := randomID()
+		if err != nil {
+			rejected = append(rejected, rejection{delivery{sub: *sub, event: e}, fmt.Errorf("failed to generate delivery id: %s", err)})
+			continue
+		}
+		dl := delivery{id: deliveryID, sub: *sub, event: e}
+		if d.closed {
+			rejected = append(rejected, rejection{dl, errors.New("webhooks are shutting down")})
+			continue
+		}
+		select {
+		case d.queue <- dl:
+		default:
+			rejected = append(rejected, rejection{dl, errors.New("delivery queue is full")})
+		}
+	}
+	d.RUnlock()
+
+	for _, r := range rejected {
+		d.deadLetter(r.dl, 0, r.err)
+	}
+}
+
+// work makes queued deliveries until the Dispatcher is closed
+// and the queue is empty
+func (d *Dispatcher) work() {
+	defer d.workers.Done()
+	for {
+		select {
+		case dl := <-d.queue:
+			d.deliver(dl)
+		case <-d.closing:
+			for {
+				select {
+				case dl := <-d.queue:
+					d.deliver(dl)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Subscription) matches(e events.Event) bool {
+	for _, f := range s.Filters {
+		if f.Event != e.Type {
+			continue
+		}
+		if f.Name == "" || f.Name == e.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver makes a delivery, retrying with exponential backoff
+// until it succeeds, attempts run out, or the Dispatcher gives up
+func (d *Dispatcher) deliver(dl delivery) {
+	body, err := json.Marshal(&dl.event)
+	if err != nil {
+		d.deadLetter(dl, 0, fmt.Errorf("failed to encode event: %s", err))
+		return
+	}
+
+	backoff := d.initialBackoff
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		if err = d.post(dl, body); err == nil {
+			return
+		}
+		if attempt == d.maxAttempts {
+			break
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+			backoff *= 2
+		case <-d.ctx.Done():
+			timer.Stop()
+			d.deadLetter(dl, attempt, fmt.Errorf("abandoned on shutdown, last error: %s", err))
+			return
+		}
+	}
+	d.deadLetter(dl, d.maxAttempts, err)
+}
+
+func (d *Dispatcher) post(dl delivery, body []byte) error {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, dl.sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build http request: %s", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, dl.event.Type)
+	req.Header.Set(DeliveryHeader, dl.id)
+	req.Header.Set(SignatureHeader, Sign(dl.sub.Secret, body))
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make http request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("got a non 2XX HTTP status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (d *Dispatcher) deadLetter(dl delivery, attempts int, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.deadLetters = append(d.deadLetters, &DeadLetter{
+		DeliveryID:     dl.id,
+		SubscriptionID: dl.sub.ID,
+		Event:          dl.event,
+		Attempts:       attempts,
+		LastError:      err.Error(),
+		FailedAt:       time.Now().UTC(),
+	})
+	// keep only the most recent dead letters
+	if len(d.deadLetters) > maxDeadLetters {
+		d.deadLetters = d.deadLetters[len(d.deadLetters)-maxDeadLetters:]
+	}
+}
+
+// Sign returns the value of the signature header for a payload
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return fmt.Sprintf("sha256=%s", hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Verify returns true if a signature header value is valid for a payload.
+// Receivers can use it to authenticate deliveries.
+func Verify(secret string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
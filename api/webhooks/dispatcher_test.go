@@ -0,0 +1,184 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/rbac/api/events"
+)
+
+// received is a request received by a test receiver
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// newReceiver returns a receiver which replies to each request with the
+// status returned by status, called with the number of the request
+func newReceiver(t *testing.T, status func(n int) int) (*httptest.Server, <-chan received) {
+	t.Helper()
+
+	var mu sync.Mutex
+	n := 0
+	ch := make(chan received, 100)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		n++
+		code := status(n)
+		mu.Unlock()
+		ch <- received{header: r.Header, body: body}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func subscribe(t *testing.T, d *Dispatcher, url string) *Subscription {
+	t.Helper()
+
+	sub, err := d.Subscribe(&Subscription{URL: url, Secret: "secret", Filters: []Filter{{Event: events.RoleCreated}}, Owner: "alice"})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %s", err)
+	}
+	return sub
+}
+
+func TestDeliveryIsSigned(t *testing.T) {
+	srv, ch := newReceiver(t, func(int) int { return http.StatusOK })
+	d := NewDispatcher(1, time.Millisecond, true)
+	subscribe(t, d, srv.URL)
+
+	d.Publish(events.New(events.RoleDeleted, "ignored", "alice")) // filtered out
+	d.Publish(events.New(events.RoleCreated, "readers", "alice"))
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	if len(ch) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(ch))
+	}
+	r := <-ch
+	if !Verify("secret", r.body, r.header.Get(SignatureHeader)) {
+		t.Errorf("signature %q does not verify", r.header.Get(SignatureHeader))
+	}
+	if Verify("other", r.body, r.header.Get(SignatureHeader)) {
+		t.Error("signature verifies with the wrong secret")
+	}
+	if r.header.Get(EventHeader) != events.RoleCreated || r.header.Get(DeliveryHeader) == "" {
+		t.Errorf("got headers %v", r.header)
+	}
+	var e events.Event
+	if err := json.Unmarshal(r.body, &e); err != nil || e.Name != "readers" {
+		t.Errorf("got body %s", r.body)
+	}
+}
+
+func TestDeliveryIsRetried(t *testing.T) {
+	srv, ch := newReceiver(t, func(n int) int {
+		if n < 3 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	d := NewDispatcher(5, time.Millisecond, true)
+	sub := subscribe(t, d, srv.URL)
+
+	d.Publish(events.New(events.RoleCreated, "readers", "alice"))
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	if len(ch) != 3 {
+		t.Fatalf("got %d attempts, want 3", len(ch))
+	}
+	deliveryID := (<-ch).header.Get(DeliveryHeader)
+	for len(ch) > 0 {
+		if id := (<-ch).header.Get(DeliveryHeader); id != deliveryID {
+			t.Errorf("got delivery id %s on a retry of %s", id, deliveryID)
+		}
+	}
+	if dls := d.DeadLetters(sub.ID); len(dls) != 0 {
+		t.Errorf("got dead letters %v for a delivery which succeeded", dls)
+	}
+}
+
+func TestDeliveryIsDeadLettered(t *testing.T) {
+	srv, ch := newReceiver(t, func(int) int { return http.StatusInternalServerError })
+	d := NewDispatcher(3, time.Millisecond, true)
+	sub := subscribe(t, d, srv.URL)
+
+	d.Publish(events.New(events.RoleCreated, "readers", "alice"))
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	if len(ch) != 3 {
+		t.Errorf("got %d attempts, want 3", len(ch))
+	}
+	dls := d.DeadLetters(sub.ID)
+	if len(dls) != 1 {
+		t.Fatalf("got %d dead letters, want 1", len(dls))
+	}
+	if dls[0].Attempts != 3 || dls[0].Event.Name != "readers" || !strings.Contains(dls[0].LastError, "500") {
+		t.Errorf("got dead letter %+v", dls[0])
+	}
+}
+
+func TestCloseAbandonsRetries(t *testing.T) {
+	srv, ch := newReceiver(t, func(int) int { return http.StatusInternalServerError })
+	d := NewDispatcher(5, time.Hour, true)
+	sub := subscribe(t, d, srv.URL)
+
+	d.Publish(events.New(events.RoleCreated, "readers", "alice"))
+	<-ch // first attempt, the retry waits for an hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if err := d.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close returned %v, want context.DeadlineExceeded", err)
+	}
+
+	dls := d.DeadLetters(sub.ID)
+	if len(dls) != 1 || dls[0].Attempts != 1 || !strings.Contains(dls[0].LastError, "shutdown") {
+		t.Errorf("got dead letters %+v, want one abandoned after one attempt", dls)
+	}
+
+	d.Publish(events.New(events.RoleCreated, "writers", "alice"))
+	if dls := d.DeadLetters(sub.ID); len(dls) != 2 || dls[1].Event.Name != "writers" {
+		t.Errorf("got dead letters %+v, want the event published after Close", dls)
+	}
+}
+
+func TestFullQueueIsDeadLettered(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher(1, time.Millisecond, true)
+	sub := subscribe(t, d, srv.URL)
+
+	// every worker blocks on the receiver, so the queue fills up
+	for i := 0; i < workers+queueSize+1; i++ {
+		d.Publish(events.New(events.RoleCreated, "readers", "alice"))
+	}
+	dls := d.DeadLetters(sub.ID)
+	if len(dls) == 0 || dls[0].LastError != "delivery queue is full" || dls[0].Attempts != 0 {
+		t.Errorf("got dead letters %+v, want deliveries rejected by the full queue", dls)
+	}
+
+	close(release)
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+const (
+	// authenticatedUserHeader is the header the service reads the caller from
+	// until token based authentication is in place
+	authenticatedUserHeader = "MOCK_AUTHENTICATED_USER"
+)
+
+// Client is a client for the RBAC service HTTP API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	user       string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the http client used to make requests
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithToken sets the bearer token sent in the "Authorization" header of every request
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithUser sets the user to authenticate requests as
+func WithUser(user string) Option {
+	return func(c *Client) { c.user = user }
+}
+
+// New returns a new Client for the RBAC service at baseURL (e.g. "http://localhost:8080")
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		httpClient: &http.Client{
+			Timeout: time.Second * 30,
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// newRequest builds an authenticated request with an optional JSON body
+func (c *Client) newRequest(ctx context.Context, method, path string, body interface{}) (*http.Request, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request body: %s", err)
+		}
+		reader = bytes.NewReader(bodyBytes)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build http request: %s", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.token))
+	}
+	if c.user != "" {
+		req.Header.Set(authenticatedUserHeader, c.user)
+	}
+	return req, nil
+}
+
+// do makes a request and decodes a JSON response body onto out, if non nil.
+// Non 2XX responses are returned as an *Error.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read http response body: %s", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newError(resp.StatusCode, respBodyBytes)
+	}
+
+	if out != nil {
+		if err = json.Unmarshal(respBodyBytes, out); err != nil {
+			return fmt.Errorf("failed to decode http response body: %s", err)
+		}
+	}
+	return nil
+}
+
+func newError(statusCode int, body []byte) *Error {
+	var resp payloads.ErrorResponse
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Code == "" {
+		// not an error from the service itself, e.g. from a proxy
+		return &Error{StatusCode: statusCode, Message: string(body)}
+	}
+	return &Error{StatusCode: statusCode, Code: resp.Code, Message: resp.Message, Fields: resp.Fields, Applied: resp.Applied, RequestID: resp.RequestID}
+}
@@ -0,0 +1,356 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/service"
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+// newTestService serves a new service with in-memory storage, where alice is
+// in group "eng" and bob in no group, and returns clients for both users
+func newTestService(t *testing.T, c service.Config) (alice, bob *Client, url string) {
+	t.Helper()
+
+	c.Groups = groups.NewMemorySource(map[string][]string{"alice": {"eng"}, "bob": {}})
+	c.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	h, err := service.New(c)
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	return New(srv.URL, WithUser("alice")), New(srv.URL, WithUser("bob")), srv.URL
+}
+
+func TestPermissionsAndRoles(t *testing.T) {
+	ctx := context.Background()
+	alice, bob, _ := newTestService(t, service.Config{})
+
+	if err := alice.CreatePermission(ctx, &payloads.CreatePermissionRequest{Name: "docs.read", Description: "read docs"}); err != nil {
+		t.Fatalf("CreatePermission: %s", err)
+	}
+	if err := alice.UpdatePermission(ctx, "docs.read", "read all docs"); err != nil {
+		t.Fatalf("UpdatePermission: %s", err)
+	}
+	if err := alice.AddToPermission(ctx, "docs.read", &payloads.ModifyPermissionRequest{Owners: []string{"bob"}}); err != nil {
+		t.Fatalf("AddToPermission: %s", err)
+	}
+	perm, err := bob.GetPermission(ctx, "docs.read")
+	if err != nil {
+		t.Fatalf("GetPermission: %s", err)
+	}
+	if perm.Description != "read all docs" || len(perm.Owners) != 2 {
+		t.Errorf("GetPermission returned %+v, want the updated description and two owners", perm)
+	}
+
+	if err := alice.CreateRole(ctx, &payloads.CreateRoleRequest{Name: "readers", Permissions: []string{"docs.read"}, Groups: []string{"eng"}}); err != nil {
+		t.Fatalf("CreateRole: %s", err)
+	}
+	if err := alice.AddToRole(ctx, "readers", &payloads.ModifyRoleRequest{Users: []string{"bob"}}); err != nil {
+		t.Fatalf("AddToRole: %s", err)
+	}
+	role, err := alice.GetRole(ctx, "readers")
+	if err != nil {
+		t.Fatalf("GetRole: %s", err)
+	}
+	if len(role.Users) != 1 || role.Users[0] != "bob" {
+		t.Errorf("GetRole returned users %v, want [bob]", role.Users)
+	}
+
+	perms, err := alice.GetUserPermissions(ctx, "bob")
+	if err != nil {
+		t.Fatalf("GetUserPermissions: %s", err)
+	}
+	if len(perms) != 1 || perms[0] != "docs.read" {
+		t.Errorf("GetUserPermissions returned %v, want [docs.read]", perms)
+	}
+	roles, err := alice.GetUserRoles(ctx, "alice")
+	if err != nil {
+		t.Fatalf("GetUserRoles: %s", err)
+	}
+	if len(roles.ViaGroups["eng"]) != 1 || len(roles.Direct) != 0 {
+		t.Errorf("GetUserRoles returned %+v, want role \"readers\" via group \"eng\" only", roles)
+	}
+	group, err := alice.GetGroup(ctx, "eng")
+	if err != nil {
+		t.Fatalf("GetGroup: %s", err)
+	}
+	if len(group.Roles) != 1 || group.Roles[0] != "readers" {
+		t.Errorf("GetGroup returned roles %v, want [readers]", group.Roles)
+	}
+
+	list, err := alice.ListRoles(ctx, &ListOptions{Prefix: "read"})
+	if err != nil {
+		t.Fatalf("ListRoles: %s", err)
+	}
+	if len(list.Roles) != 1 {
+		t.Errorf("ListRoles returned %d roles, want 1", len(list.Roles))
+	}
+
+	if err := alice.RemoveFromRole(ctx, "readers", &payloads.ModifyRoleRequest{Permissions: []string{"docs.read"}}); err != nil {
+		t.Fatalf("RemoveFromRole: %s", err)
+	}
+	if err := alice.DeleteRole(ctx, "readers"); err != nil {
+		t.Fatalf("DeleteRole: %s", err)
+	}
+	if err := alice.DeletePermission(ctx, "docs.read"); err != nil {
+		t.Fatalf("DeletePermission: %s", err)
+	}
+	if _, err := alice.GetPermission(ctx, "docs.read"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetPermission after DeletePermission returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestServiceAccountKeys(t *testing.T) {
+	ctx := context.Background()
+	alice, _, url := newTestService(t, service.Config{})
+
+	if err := alice.CreateServiceAccount(ctx, &payloads.CreateServiceAccountRequest{Name: "ci"}); err != nil {
+		t.Fatalf("CreateServiceAccount: %s", err)
+	}
+	key, err := alice.CreateAPIKey(ctx, "ci", nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %s", err)
+	}
+	if err := New(url, WithToken(key.Key)).Authcheck(ctx); err != nil {
+		t.Errorf("Authcheck with a new API key: %s", err)
+	}
+
+	rotated, err := alice.RotateAPIKey(ctx, "ci", key.ID, nil)
+	if err != nil {
+		t.Fatalf("RotateAPIKey: %s", err)
+	}
+	if err := New(url, WithToken(key.Key)).Authcheck(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Authcheck with a rotated API key returned %v, want ErrUnauthorized", err)
+	}
+
+	if err := alice.RevokeAPIKey(ctx, "ci", rotated.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %s", err)
+	}
+	if err := New(url, WithToken(rotated.Key)).Authcheck(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Authcheck with a revoked API key returned %v, want ErrUnauthorized", err)
+	}
+
+	sa, err := alice.GetServiceAccount(ctx, "ci")
+	if err != nil {
+		t.Fatalf("GetServiceAccount: %s", err)
+	}
+	if len(sa.Keys) != 0 {
+		t.Errorf("GetServiceAccount returned %d keys, want none", len(sa.Keys))
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	// keep a short change log, so that watching from the start is gone
+	alice, bob, url := newTestService(t, service.Config{WatchHistorySize: 2})
+
+	if err := alice.CreateRole(ctx, &payloads.CreateRoleRequest{Name: "owned"}); err != nil {
+		t.Fatalf("CreateRole: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		call     func() error
+		sentinel error
+		code     string
+	}{
+		{
+			name:     "validation",
+			call:     func() error { return alice.CreateRole(ctx, &payloads.CreateRoleRequest{Name: "has space"}) },
+			sentinel: ErrBadRequest,
+			code:     payloads.CodeValidationFailed,
+		},
+		{
+			name:     "unauthenticated",
+			call:     func() error { return New(url).Authcheck(ctx) },
+			sentinel: ErrUnauthorized,
+			code:     payloads.CodeUnauthenticated,
+		},
+		{
+			name:     "not owner",
+			call:     func() error { return bob.DeleteRole(ctx, "owned") },
+			sentinel: ErrForbidden,
+			code:     payloads.CodeNotOwner,
+		},
+		{
+			name:     "not found",
+			call:     func() error { _, err := alice.GetRole(ctx, "missing"); return err },
+			sentinel: ErrNotFound,
+			code:     payloads.CodeRoleNotFound,
+		},
+		{
+			name:     "conflict",
+			call:     func() error { return alice.CreateRole(ctx, &payloads.CreateRoleRequest{Name: "owned"}) },
+			sentinel: ErrConflict,
+			code:     payloads.CodeRoleExists,
+		},
+		{
+			name:     "gone",
+			call:     func() error { return alice.Watch(ctx, 1, func(events.Event) error { return nil }) },
+			sentinel: ErrGone,
+			code:     payloads.CodeRevisionCompacted,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.call()
+			if !errors.Is(err, test.sentinel) {
+				t.Errorf("got error %v, want %v", err, test.sentinel)
+			}
+			if !HasCode(err, test.code) {
+				t.Errorf("got error %v, want code %s", err, test.code)
+			}
+			var e *Error
+			if errors.As(err, &e) && e.RequestID == "" {
+				t.Errorf("got error %v with no request ID", err)
+			}
+		})
+	}
+
+	t.Run("validation fields", func(t *testing.T) {
+		var e *Error
+		err := alice.CreateRole(ctx, &payloads.CreateRoleRequest{Name: "has space"})
+		if !errors.As(err, &e) || len(e.Fields) != 1 || e.Fields[0].Field != "name" {
+			t.Errorf("got error %v, want a field error for \"name\"", err)
+		}
+	})
+}
+
+func TestErrorIs(t *testing.T) {
+	sentinels := []error{ErrBadRequest, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict, ErrGone, ErrServer}
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusBadRequest, ErrBadRequest},
+		{http.StatusUnauthorized, ErrUnauthorized},
+		{http.StatusForbidden, ErrForbidden},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusConflict, ErrConflict},
+		{http.StatusGone, ErrGone},
+		{http.StatusInternalServerError, ErrServer},
+		{http.StatusBadGateway, ErrServer},
+		{http.StatusTooManyRequests, nil},
+	}
+	for _, test := range tests {
+		err := newError(test.status, []byte(`{"code":"X","message":"m"}`))
+		for _, sentinel := range sentinels {
+			if got := errors.Is(err, sentinel); got != (sentinel == test.want) {
+				t.Errorf("errors.Is(%d, %v) = %t", test.status, sentinel, got)
+			}
+		}
+	}
+}
+
+func TestErrorNotFromService(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream unavailable", http.StatusBadGateway)
+	}))
+	defer proxy.Close()
+
+	err := New(proxy.URL).Healthcheck(context.Background())
+	var e *Error
+	if !errors.As(err, &e) || e.Code != "" || e.Message != "upstream unavailable\n" {
+		t.Errorf("got error %#v, want the plain text body with no code", err)
+	}
+	if !errors.Is(err, ErrServer) {
+		t.Errorf("got error %v, want ErrServer", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	alice, _, _ := newTestService(t, service.Config{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	// create the permissions once watching from the current revision
+	connected := func() {
+		go func() {
+			for _, name := range []string{"docs.read", "docs.write"} {
+				if err := alice.CreatePermission(ctx, &payloads.CreatePermissionRequest{Name: name}); err != nil {
+					t.Errorf("CreatePermission: %s", err)
+				}
+			}
+		}()
+	}
+	errFound := errors.New("found")
+	var first events.Event
+	err := alice.WatchConnected(ctx, 0, connected, func(e events.Event) error {
+		if e.Type == events.PermissionCreated && e.Name == "docs.read" {
+			first = e
+			return errFound
+		}
+		return nil
+	})
+	if !errors.Is(err, errFound) {
+		t.Fatalf("Watch returned %v before the permission was created", err)
+	}
+
+	// resume after the first permission, replaying the change log up to the second
+	last := first
+	err = alice.Watch(ctx, first.Revision, func(e events.Event) error {
+		if e.Revision <= last.Revision {
+			t.Errorf("got revision %d after %d", e.Revision, last.Revision)
+		}
+		last = e
+		if e.Type == events.PermissionCreated && e.Name == "docs.write" {
+			return errFound
+		}
+		return nil
+	})
+	if !errors.Is(err, errFound) {
+		t.Fatalf("Watch returned %v before the permission was created", err)
+	}
+	if last.Actor != "alice" {
+		t.Errorf("got actor %q, want alice", last.Actor)
+	}
+
+	// revisions from before a restart are not in the change log
+	if err := alice.Watch(ctx, 1, func(events.Event) error { return nil }); !errors.Is(err, ErrGone) {
+		t.Errorf("got error %v watching from a revision before the log, want ErrGone", err)
+	}
+}
+
+func TestWatchParsing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("got Accept header %q", r.Header.Get("Accept"))
+		}
+		if r.URL.Query().Get("revision") != "7" {
+			t.Errorf("got revision %q, want 7", r.URL.Query().Get("revision"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, ": heartbeat\n\n")
+		io.WriteString(w, "id: 8\nevent: role.created\ndata: {\"revision\":8,\"type\":\"role.created\",\"name\":\"a\"}\n\n")
+		io.WriteString(w, "\n")
+		io.WriteString(w, "id: 9\nevent: role.deleted\ndata:{\"revision\":9,\n")
+		io.WriteString(w, "data: \"type\":\"role.deleted\",\"name\":\"a\"}\n\n")
+	}))
+	defer srv.Close()
+
+	got := []events.Event{}
+	err := New(srv.URL).Watch(context.Background(), 7, func(e events.Event) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Watch returned %s at the end of the stream", err)
+	}
+	if len(got) != 2 || got[0].Type != events.RoleCreated || got[1].Revision != 9 || got[1].Type != events.RoleDeleted {
+		t.Errorf("got events %+v", got)
+	}
+}
@@ -0,0 +1,331 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/adrianosela/rbac/api/manifest"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/snapshot"
+	"github.com/adrianosela/rbac/api/webhooks"
+)
+
+// Healthcheck returns an error if the service is not alive
+func (c *Client) Healthcheck(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/healthcheck", nil, nil)
+}
+
+// Authcheck returns an error if the client's credentials are not accepted
+func (c *Client) Authcheck(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/authcheck", nil, nil)
+}
+
+// CreatePermission creates a new permission owned by the authenticated user
+func (c *Client) CreatePermission(ctx context.Context, pl *payloads.CreatePermissionRequest) error {
+	return c.do(ctx, http.MethodPost, "/permission", pl, nil)
+}
+
+// GetPermission retrieves a permission
+func (c *Client) GetPermission(ctx context.Context, name string) (*model.Permission, error) {
+	var perm *model.Permission
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/permission/%s", url.PathEscape(name)), nil, &perm); err != nil {
+		return nil, err
+	}
+	return perm, nil
+}
+
+// UpdatePermission modifies the description of a permission
+func (c *Client) UpdatePermission(ctx context.Context, name, description string) error {
+	pl := &payloads.GenericUpdateDescriptionRequest{Description: description}
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/permission/%s", url.PathEscape(name)), pl, nil)
+}
+
+// AddToPermission adds owners to a permission
+func (c *Client) AddToPermission(ctx context.Context, name string, pl *payloads.ModifyPermissionRequest) error {
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/permission/%s/add", url.PathEscape(name)), pl, nil)
+}
+
+// RemoveFromPermission removes owners from a permission
+func (c *Client) RemoveFromPermission(ctx context.Context, name string, pl *payloads.ModifyPermissionRequest) error {
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/permission/%s/remove", url.PathEscape(name)), pl, nil)
+}
+
+// TransferPermission hands a permission over to new owners
+func (c *Client) TransferPermission(ctx context.Context, name string, pl *payloads.TransferOwnershipRequest) error {
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/permission/%s/transfer", url.PathEscape(name)), pl, nil)
+}
+
+// DeletePermission deletes a permission
+func (c *Client) DeletePermission(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/permission/%s", url.PathEscape(name)), nil, nil)
+}
+
+// CreateNamespace creates a new permission namespace owned by the authenticated user
+func (c *Client) CreateNamespace(ctx context.Context, pl *payloads.CreateNamespaceRequest) error {
+	return c.do(ctx, http.MethodPost, "/namespace", pl, nil)
+}
+
+// GetNamespace retrieves a permission namespace
+func (c *Client) GetNamespace(ctx context.Context, name string) (*model.Namespace, error) {
+	var ns *model.Namespace
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/namespace/%s", url.PathEscape(name)), nil, &ns); err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// ListNamespaces retrieves all permission namespaces
+func (c *Client) ListNamespaces(ctx context.Context) ([]*model.Namespace, error) {
+	var resp *payloads.ListNamespacesResponse
+	if err := c.do(ctx, http.MethodGet, "/namespaces", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Namespaces, nil
+}
+
+// AddToNamespace adds owners to a permission namespace
+func (c *Client) AddToNamespace(ctx context.Context, name string, pl *payloads.ModifyNamespaceRequest) error {
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/namespace/%s/add", url.PathEscape(name)), pl, nil)
+}
+
+// RemoveFromNamespace removes owners from a permission namespace
+func (c *Client) RemoveFromNamespace(ctx context.Context, name string, pl *payloads.ModifyNamespaceRequest) error {
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/namespace/%s/remove", url.PathEscape(name)), pl, nil)
+}
+
+// DeleteNamespace deletes a permission namespace
+func (c *Client) DeleteNamespace(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/namespace/%s", url.PathEscape(name)), nil, nil)
+}
+
+// CreateRole creates a new role owned by the authenticated user
+func (c *Client) CreateRole(ctx context.Context, pl *payloads.CreateRoleRequest) error {
+	return c.do(ctx, http.MethodPost, "/role", pl, nil)
+}
+
+// GetRole retrieves a role
+func (c *Client) GetRole(ctx context.Context, name string) (*model.Role, error) {
+	var role *model.Role
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/role/%s", url.PathEscape(name)), nil, &role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// UpdateRole modifies the description of a role
+func (c *Client) UpdateRole(ctx context.Context, name, description string) error {
+	pl := &payloads.GenericUpdateDescriptionRequest{Description: description}
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/role/%s", url.PathEscape(name)), pl, nil)
+}
+
+// AddToRole adds permissions, users, groups, or owners to a role
+func (c *Client) AddToRole(ctx context.Context, name string, pl *payloads.ModifyRoleRequest) error {
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/role/%s/add", url.PathEscape(name)), pl, nil)
+}
+
+// RemoveFromRole removes permissions, users, groups, or owners from a role
+func (c *Client) RemoveFromRole(ctx context.Context, name string, pl *payloads.ModifyRoleRequest) error {
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/role/%s/remove", url.PathEscape(name)), pl, nil)
+}
+
+// TransferRole hands a role over to new owners
+func (c *Client) TransferRole(ctx context.Context, name string, pl *payloads.TransferOwnershipRequest) error {
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/role/%s/transfer", url.PathEscape(name)), pl, nil)
+}
+
+// DeleteRole deletes a role
+func (c *Client) DeleteRole(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/role/%s", url.PathEscape(name)), nil, nil)
+}
+
+// GetUserPermissions returns the effective permissions of a user
+func (c *Client) GetUserPermissions(ctx context.Context, user string) ([]string, error) {
+	var resp *payloads.GetUserPermissionsResponse
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/user/%s", url.PathEscape(user)), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Persmissions, nil
+}
+
+// GetUserRoles returns the roles of a user, split by whether
+// they are bound to the user directly or through a group
+func (c *Client) GetUserRoles(ctx context.Context, user string) (*payloads.GetUserRolesResponse, error) {
+	var resp *payloads.GetUserRolesResponse
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/user/%s/roles", url.PathEscape(user)), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetGroup retrieves a group and the roles bound to it
+func (c *Client) GetGroup(ctx context.Context, id string) (*model.Group, error) {
+	var group *model.Group
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/group/%s", url.PathEscape(id)), nil, &group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// GetGroupMembersRoles returns the roles and permissions
+// every member of a group receives through the group
+func (c *Client) GetGroupMembersRoles(ctx context.Context, id string) (*payloads.GetGroupMembersRolesResponse, error) {
+	var resp *payloads.GetGroupMembersRolesResponse
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/group/%s/members-roles", url.PathEscape(id)), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Apply converges the service to the state described by a manifest and
+// returns the changes made. When prune is set, objects which are not in the
+// manifest are deleted if the authenticated user owns them, directly or
+// through a group or role, or administers their kind.
+func (c *Client) Apply(ctx context.Context, m *manifest.Manifest, prune bool) (*payloads.ApplyResponse, error) {
+	var resp *payloads.ApplyResponse
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/apply?prune=%t", prune), m, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Plan returns the changes Apply would make for a manifest, without making them
+func (c *Client) Plan(ctx context.Context, m *manifest.Manifest, prune bool) (*payloads.ApplyResponse, error) {
+	var resp *payloads.ApplyResponse
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/apply?prune=%t&dry_run=true", prune), m, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetOrphans retrieves the roles and permissions none of whose owners
+// resolve. The caller must be an admin of both roles and permissions.
+func (c *Client) GetOrphans(ctx context.Context) (*payloads.OrphansResponse, error) {
+	var resp *payloads.OrphansResponse
+	if err := c.do(ctx, http.MethodGet, "/orphans", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ReassignOrphans makes a fallback owner the owner of every orphaned role
+// and permission, and returns what was orphaned
+func (c *Client) ReassignOrphans(ctx context.Context, owner string) (*payloads.OrphansResponse, error) {
+	var resp *payloads.OrphansResponse
+	if err := c.do(ctx, http.MethodPost, "/orphans/reassign", &payloads.ReassignOrphansRequest{Owner: owner}, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CreateWebhook registers a new webhook owned by the authenticated user
+func (c *Client) CreateWebhook(ctx context.Context, pl *payloads.CreateWebhookRequest) (*webhooks.Subscription, error) {
+	var sub *webhooks.Subscription
+	if err := c.do(ctx, http.MethodPost, "/webhook", pl, &sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// GetWebhook retrieves a webhook
+func (c *Client) GetWebhook(ctx context.Context, id string) (*webhooks.Subscription, error) {
+	var sub *webhooks.Subscription
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/webhook/%s", url.PathEscape(id)), nil, &sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// GetWebhookDeadLetters retrieves the abandoned deliveries of a webhook
+func (c *Client) GetWebhookDeadLetters(ctx context.Context, id string) ([]*webhooks.DeadLetter, error) {
+	var dls []*webhooks.DeadLetter
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/webhook/%s/deadletters", url.PathEscape(id)), nil, &dls); err != nil {
+		return nil, err
+	}
+	return dls, nil
+}
+
+// DeleteWebhook deletes a webhook
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/webhook/%s", url.PathEscape(id)), nil, nil)
+}
+
+// CreateServiceAccount creates a new service account owned by the authenticated user
+func (c *Client) CreateServiceAccount(ctx context.Context, pl *payloads.CreateServiceAccountRequest) error {
+	return c.do(ctx, http.MethodPost, "/serviceaccount", pl, nil)
+}
+
+// GetServiceAccount retrieves a service account and the metadata of its API keys
+func (c *Client) GetServiceAccount(ctx context.Context, name string) (*model.ServiceAccount, error) {
+	var sa *model.ServiceAccount
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/serviceaccount/%s", url.PathEscape(name)), nil, &sa); err != nil {
+		return nil, err
+	}
+	return sa, nil
+}
+
+// DeleteServiceAccount deletes a service account
+func (c *Client) DeleteServiceAccount(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/serviceaccount/%s", url.PathEscape(name)), nil, nil)
+}
+
+// CreateAPIKey creates a new API key for a service account, pl may be nil
+// for a key which never expires. The key is only ever returned here, the
+// service keeps nothing but its hash.
+func (c *Client) CreateAPIKey(ctx context.Context, name string, pl *payloads.CreateAPIKeyRequest) (*payloads.CreateAPIKeyResponse, error) {
+	if pl == nil {
+		pl = &payloads.CreateAPIKeyRequest{}
+	}
+	var resp *payloads.CreateAPIKeyResponse
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/serviceaccount/%s/key", url.PathEscape(name)), pl, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RotateAPIKey replaces an API key of a service account with a new one,
+// pl may be nil for the old key to stop working right away
+func (c *Client) RotateAPIKey(ctx context.Context, name, id string, pl *payloads.RotateAPIKeyRequest) (*payloads.CreateAPIKeyResponse, error) {
+	if pl == nil {
+		pl = &payloads.RotateAPIKeyRequest{}
+	}
+	var resp *payloads.CreateAPIKeyResponse
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/serviceaccount/%s/key/%s/rotate", url.PathEscape(name), url.PathEscape(id)), pl, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// RevokeAPIKey deletes an API key of a service account
+func (c *Client) RevokeAPIKey(ctx context.Context, name, id string) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/serviceaccount/%s/key/%s", url.PathEscape(name), url.PathEscape(id)), nil, nil)
+}
+
+// Export retrieves a snapshot of the full contents of the service.
+// Requires the "rbac.snapshots.admin" meta-permission.
+func (c *Client) Export(ctx context.Context) (*snapshot.Snapshot, error) {
+	var snap *snapshot.Snapshot
+	if err := c.do(ctx, http.MethodGet, "/admin/export", nil, &snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// Import loads a snapshot into the service, in either snapshot.ModeReplace
+// or snapshot.ModeMerge mode. Requires the "rbac.snapshots.admin"
+// meta-permission.
+func (c *Client) Import(ctx context.Context, snap *snapshot.Snapshot, mode string) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/admin/import?mode=%s", url.QueryEscape(mode)), snap, nil)
+}
+
+// readErrorResponse converts a non 2XX streaming response into an *Error
+func readErrorResponse(resp *http.Response) error {
+	respBodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read http response body: %s", err)
+	}
+	return newError(resp.StatusCode, respBodyBytes)
+}
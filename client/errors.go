@@ -0,0 +1,67 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/adrianosela/rbac/api/manifest"
+	"github.com/adrianosela/rbac/api/validation"
+)
+
+// Errors returned by the client can be matched against
+// these with errors.Is to handle classes of failures
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrGone         = errors.New("gone")
+	ErrServer       = errors.New("server error")
+)
+
+// Error represents a non 2XX response from the RBAC service
+type Error struct {
+	StatusCode int
+	Code       string // one of the payloads.Code* constants, empty if unknown
+	Message    string
+	Fields     []validation.FieldError // set when Code is payloads.CodeValidationFailed
+	Applied    []manifest.Change       // set when Apply failed part way, the changes made before it failed
+	RequestID  string                  // ID of the failed request in the service's logs
+}
+
+// Error returns the string representation of the error
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("rbac: %d %s: %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Code, e.Message)
+	}
+	return fmt.Sprintf("rbac: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// HasCode reports whether err is an *Error with the given code
+func HasCode(err error, code string) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
+
+// Is reports whether the error belongs to the class of a sentinel error
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrGone:
+		return e.StatusCode == http.StatusGone
+	case ErrServer:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+// ListOptions represents the search filters and pagination of a list request
+type ListOptions struct {
+	Prefix   string
+	Contains string
+	Owner    string
+
+	// only applicable to roles
+	User       string
+	Group      string
+	Permission string
+
+	Cursor string // NextCursor of the previous page
+	Limit  int    // zero for the service's default
+}
+
+func (o *ListOptions) query() string {
+	if o == nil {
+		return ""
+	}
+	q := url.Values{}
+	for key, value := range map[string]string{
+		"prefix":     o.Prefix,
+		"contains":   o.Contains,
+		"owner":      o.Owner,
+		"user":       o.User,
+		"group":      o.Group,
+		"permission": o.Permission,
+		"cursor":     o.Cursor,
+	} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
+
+// ListRoles retrieves a page of the roles matching the options
+func (c *Client) ListRoles(ctx context.Context, opts *ListOptions) (*payloads.ListRolesResponse, error) {
+	var resp *payloads.ListRolesResponse
+	if err := c.do(ctx, http.MethodGet, "/roles"+opts.query(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ListPermissions retrieves a page of the permissions matching the options
+func (c *Client) ListPermissions(ctx context.Context, opts *ListOptions) (*payloads.ListPermissionsResponse, error) {
+	var resp *payloads.ListPermissionsResponse
+	if err := c.do(ctx, http.MethodGet, "/permissions"+opts.query(), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/adrianosela/rbac/api/events"
+)
+
+// Watch streams change events after the given revision to fn until the
+// context is cancelled, the stream ends, or fn returns an error.
+// A zero revision watches from the current revision of the service.
+// Callers resuming after a disconnect should pass the revision of the last
+// event they processed; an error matching ErrGone means that revision is no
+// longer retained and state must be re-read before watching again.
+func (c *Client) Watch(ctx context.Context, revision uint64, fn func(events.Event) error) error {
+	return c.WatchConnected(ctx, revision, nil, fn)
+}
+
+// WatchConnected is Watch, calling connected (if non nil) once the stream is
+// established and before any event. No event after that point is missed, so
+// callers watching from the current revision can drop any state they derived
+// before it.
+func (c *Client) WatchConnected(ctx context.Context, revision uint64, connected func(), fn func(events.Event) error) error {
+	path := "/watch"
+	if revision > 0 {
+		path = fmt.Sprintf("/watch?revision=%d", revision)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// the stream is long lived, so it must not be subject to the client timeout
+	hc := *c.httpClient
+	hc.Timeout = 0
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readErrorResponse(resp)
+	}
+	if connected != nil {
+		connected()
+	}
+
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+			var e events.Event
+			if err := json.Unmarshal([]byte(data.String()), &e); err != nil {
+				return fmt.Errorf("failed to decode event: %s", err)
+			}
+			data.Reset()
+			if err := fn(e); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to read event stream: %s", err)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/adrianosela/rbac/api/manifest"
+	"github.com/adrianosela/rbac/client"
+)
+
+func (c *command) apply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	file := fs.String("f", "", "path to a YAML or JSON manifest")
+	prune := fs.Bool("prune", false, "delete owned or administered objects which are not in the manifest")
+	dryRun := fs.Bool("dry-run", false, "only show the changes that would be made")
+
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("a manifest file is required (-f)")
+	}
+
+	manifestBytes, err := ioutil.ReadFile(*file)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest file %s: %s", *file, err)
+	}
+
+	m, err := manifest.Parse(manifestBytes)
+	if err != nil {
+		return err
+	}
+
+	apply := c.client.Apply
+	if *dryRun {
+		apply = c.client.Plan
+	}
+	resp, err := apply(c.ctx, m, *prune)
+	var applyErr *client.Error
+	if errors.As(err, &applyErr) && len(applyErr.Applied) > 0 && c.print.format != outputJSON {
+		// the changes before the failed one were made regardless
+		if perr := c.printChanges(applyErr.Applied); perr != nil {
+			return perr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.print.format == outputJSON {
+		return c.print.json(resp)
+	}
+	if len(resp.Changes) == 0 {
+		return c.print.message("No changes, the service is up to date with the manifest")
+	}
+	return c.printChanges(resp.Changes)
+}
+
+func (c *command) printChanges(changes []manifest.Change) error {
+	tw := tabwriter.NewWriter(c.print.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tKIND\tNAME\tDETAILS")
+	for _, change := range changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", change.Action, change.Kind, change.Name, changeDetails(change))
+	}
+	return tw.Flush()
+}
+
+func changeDetails(change manifest.Change) string {
+	details := []string{}
+	if change.Action == manifest.ActionUpdate || (change.Action == manifest.ActionCreate && change.Description != "") {
+		details = append(details, fmt.Sprintf("description=%q", change.Description))
+	}
+	for _, field := range []struct {
+		name   string
+		values []string
+	}{
+		{"owners", change.Owners},
+		{"permissions", change.Permissions},
+		{"users", change.Users},
+		{"groups", change.Groups},
+	} {
+		if len(field.values) > 0 {
+			details = append(details, fmt.Sprintf("%s=%s", field.name, strings.Join(field.values, ",")))
+		}
+	}
+	return strings.Join(details, " ")
+}
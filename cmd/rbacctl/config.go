@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultURL = "http://localhost:8080"
+
+	envConfigPath = "RBACCTL_CONFIG"
+	envURL        = "RBAC_URL"
+	envUser       = "RBAC_USER"
+	envToken      = "RBAC_TOKEN"
+)
+
+// config represents rbacctl's connection settings. Values are taken from
+// flags, then environment variables, then the config file, in that order.
+type config struct {
+	URL   string `json:"url"`
+	User  string `json:"user"`
+	Token string `json:"token"`
+}
+
+// defaultConfigPath returns the path of the config file when none is given
+func defaultConfigPath() string {
+	if p := os.Getenv(envConfigPath); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".rbacctl.json")
+}
+
+// loadConfig reads the config file at path (if it exists) and
+// overrides its values with those set in the environment
+func loadConfig(path string) (*config, error) {
+	c := &config{}
+
+	if path != "" {
+		fileBytes, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read config file %s: %s", path, err)
+		}
+		if err == nil {
+			if err = json.Unmarshal(fileBytes, c); err != nil {
+				return nil, fmt.Errorf("failed to decode config file %s: %s", path, err)
+			}
+		}
+	}
+
+	if v := os.Getenv(envURL); v != "" {
+		c.URL = v
+	}
+	if v := os.Getenv(envUser); v != "" {
+		c.User = v
+	}
+	if v := os.Getenv(envToken); v != "" {
+		c.Token = v
+	}
+
+	if c.URL == "" {
+		c.URL = defaultURL
+	}
+	return c, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+func (c *command) group(verb string, args []string) error {
+	fs := flag.NewFlagSet(fmt.Sprintf("group %s", verb), flag.ContinueOnError)
+
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	id := positional[0]
+
+	switch verb {
+	case "roles":
+		roles, err := c.client.GetGroupMembersRoles(c.ctx, id)
+		if err != nil {
+			return err
+		}
+		return c.print.groupRoles(roles)
+	default:
+		return fmt.Errorf("unknown group command \"%s\"", verb)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/client"
+)
+
+// listFlags registers the search filters shared by list commands
+func listFlags(fs *flag.FlagSet, opts *client.ListOptions) {
+	fs.StringVar(&opts.Prefix, "prefix", "", "name prefix")
+	fs.StringVar(&opts.Contains, "contains", "", "name substring, case insensitive")
+	fs.StringVar(&opts.Owner, "owner", "", "owner")
+}
+
+func (c *command) listRoles(args []string) error {
+	fs := flag.NewFlagSet("role list", flag.ContinueOnError)
+	opts := &client.ListOptions{}
+	listFlags(fs, opts)
+	fs.StringVar(&opts.User, "user", "", "user bound to the role")
+	fs.StringVar(&opts.Group, "group", "", "group bound to the role")
+	fs.StringVar(&opts.Permission, "permission", "", "permission in the role")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	roles := []*model.Role{}
+	for {
+		page, err := c.client.ListRoles(c.ctx, opts)
+		if err != nil {
+			return err
+		}
+		roles = append(roles, page.Roles...)
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	return c.print.roles(roles)
+}
+
+func (c *command) listPermissions(args []string) error {
+	fs := flag.NewFlagSet("permission list", flag.ContinueOnError)
+	opts := &client.ListOptions{}
+	listFlags(fs, opts)
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	perms := []*model.Permission{}
+	for {
+		page, err := c.client.ListPermissions(c.ctx, opts)
+		if err != nil {
+			return err
+		}
+		perms = append(perms, page.Permissions...)
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	return c.print.permissions(perms)
+}
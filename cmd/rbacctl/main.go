@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/adrianosela/rbac/client"
+)
+
+const usage = `rbacctl manages roles and permissions in the RBAC service
+
+Usage:
+  rbacctl [global flags] <resource> <command> [flags] [args]
+
+Resources and commands:
+  role create NAME [--description D] [--permissions P,...] [--users U,...] [--groups G,...] [--owners O,...]
+  role get NAME
+  role list [--prefix P] [--contains S] [--owner O] [--user U] [--group G] [--permission P]
+  role update NAME --description D
+  role add NAME [--permissions P,...] [--users U,...] [--groups G,...] [--owners O,...]
+  role remove NAME [--permissions P,...] [--users U,...] [--groups G,...] [--owners O,...]
+  role delete NAME
+
+  permission create NAME [--description D] [--owners O,...]
+  permission get NAME
+  permission list [--prefix P] [--contains S] [--owner O]
+  permission update NAME --description D
+  permission add NAME --owners O,...
+  permission remove NAME --owners O,...
+  permission delete NAME
+
+  user permissions NAME
+  user roles NAME
+
+  group roles ID
+
+  apply -f FILE [--prune] [--dry-run]
+      converge to a YAML or JSON manifest, --prune deletes owned or
+      administered roles and permissions missing from it, --dry-run only
+      shows the planned changes
+
+Global flags:
+  --config PATH   config file (default $RBACCTL_CONFIG or ~/.rbacctl.json)
+  --url URL       RBAC service URL (env RBAC_URL)
+  --user USER     user to authenticate as (env RBAC_USER)
+  --token TOKEN   bearer token to authenticate with (env RBAC_TOKEN)
+  -o FORMAT       output format, one of "table" or "json" (default "table")
+`
+
+// command is the context shared by all subcommands
+type command struct {
+	ctx    context.Context
+	client *client.Client
+	print  *printer
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command in args, writing its results to out
+func run(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("rbacctl", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+
+	configPath := fs.String("config", defaultConfigPath(), "")
+	url := fs.String("url", "", "")
+	user := fs.String("user", "", "")
+	token := fs.String("token", "", "")
+	format := fs.String("o", outputTable, "")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != outputTable && *format != outputJSON {
+		return fmt.Errorf("unknown output format \"%s\"", *format)
+	}
+
+	c, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if *url != "" {
+		c.URL = *url
+	}
+	if *user != "" {
+		c.User = *user
+	}
+	if *token != "" {
+		c.Token = *token
+	}
+
+	cmd := &command{
+		ctx:    context.Background(),
+		client: client.New(c.URL, client.WithUser(c.User), client.WithToken(c.Token)),
+		print:  &printer{out: out, format: *format},
+	}
+
+	rest := fs.Args()
+	if len(rest) > 0 && rest[0] == "apply" {
+		return cmd.apply(rest[1:])
+	}
+	if len(rest) < 2 {
+		fs.Usage()
+		return fmt.Errorf("a resource and a command are required")
+	}
+
+	switch rest[0] {
+	case "role":
+		return cmd.role(rest[1], rest[2:])
+	case "permission":
+		return cmd.permission(rest[1], rest[2:])
+	case "user":
+		return cmd.user(rest[1], rest[2:])
+	case "group":
+		return cmd.group(rest[1], rest[2:])
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown resource \"%s\"", rest[0])
+	}
+}
+
+// parseArgs parses flags interleaved with positional arguments and
+// returns the positional arguments, which must be exactly n
+func parseArgs(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != n {
+		return nil, fmt.Errorf("expected %d argument(s) but got %d", n, len(positional))
+	}
+	return positional, nil
+}
+
+// listFlag is a flag holding a comma separated list of values
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
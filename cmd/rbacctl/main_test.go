@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/client"
+)
+
+// newTestService serves a new service with in-memory storage, where alice
+// is in group "eng" and bob in no group, and returns its URL
+func newTestService(t *testing.T) string {
+	t.Helper()
+
+	h, err := service.New(service.Config{
+		Groups: groups.NewMemorySource(map[string][]string{"alice": {"eng"}, "bob": {}}),
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// rbacctl runs a command against the service at url as alice,
+// without a config file, and returns its output
+func rbacctl(t *testing.T, url string, args ...string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	err := run(append([]string{"--config", "", "--url", url, "--user", "alice"}, args...), &out)
+	return out.String(), err
+}
+
+func TestRoleAndPermissionCommands(t *testing.T) {
+	url := newTestService(t)
+
+	for _, args := range [][]string{
+		{"permission", "create", "docs.read", "--description", "read docs"},
+		{"permission", "create", "docs.write"},
+		// flags may come after the name
+		{"role", "create", "readers", "--permissions", "docs.read", "--users", "bob", "--groups", "eng"},
+		{"role", "add", "readers", "--permissions", "docs.write"},
+		{"role", "update", "readers", "--description", "read and write docs"},
+	} {
+		if _, err := rbacctl(t, url, args...); err != nil {
+			t.Fatalf("rbacctl %s: %s", strings.Join(args, " "), err)
+		}
+	}
+
+	out, err := rbacctl(t, url, "-o", "json", "role", "get", "readers")
+	if err != nil {
+		t.Fatalf("failed to get role: %s", err)
+	}
+	var role model.Role
+	if err := json.Unmarshal([]byte(out), &role); err != nil {
+		t.Fatalf("failed to decode role %s: %s", out, err)
+	}
+	if role.Description != "read and write docs" || len(role.Permissions) != 2 || len(role.Users) != 1 || len(role.Groups) != 1 {
+		t.Errorf("got role %+v, want the created and updated role", role)
+	}
+
+	out, err = rbacctl(t, url, "user", "permissions", "bob")
+	if err != nil {
+		t.Fatalf("failed to get user permissions: %s", err)
+	}
+	if want := "PERMISSION\ndocs.read\ndocs.write\n"; out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+
+	out, err = rbacctl(t, url, "role", "list", "--prefix", "read")
+	if err != nil {
+		t.Fatalf("failed to list roles: %s", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], "NAME") || !strings.HasPrefix(lines[1], "readers ") {
+		t.Errorf("got output %q, want a table with the role", out)
+	}
+
+	out, err = rbacctl(t, url, "role", "remove", "readers", "--users", "bob")
+	if err != nil || out != "Role \"readers\" updated\n" {
+		t.Errorf("got output %q and error %v removing user", out, err)
+	}
+	if _, err := rbacctl(t, url, "role", "delete", "readers"); err != nil {
+		t.Errorf("failed to delete role: %s", err)
+	}
+	if _, err := rbacctl(t, url, "role", "get", "readers"); !client.HasCode(err, payloads.CodeRoleNotFound) {
+		t.Errorf("got error %v getting a deleted role, want %s", err, payloads.CodeRoleNotFound)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	url := newTestService(t)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"role"}, "a resource and a command are required"},
+		{[]string{"widget", "get", "w"}, "unknown resource \"widget\""},
+		{[]string{"role", "rename", "readers"}, "unknown role command \"rename\""},
+		{[]string{"role", "get"}, "expected 1 argument(s) but got 0"},
+		{[]string{"role", "get", "a", "b"}, "expected 1 argument(s) but got 2"},
+		{[]string{"-o", "yaml", "role", "get", "readers"}, "unknown output format \"yaml\""},
+		{[]string{"apply"}, "a manifest file is required (-f)"},
+	}
+	for _, test := range tests {
+		if _, err := rbacctl(t, url, test.args...); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("got error %v for %v, want %q", err, test.args, test.want)
+		}
+	}
+}
+
+func TestApplyCommand(t *testing.T) {
+	url := newTestService(t)
+
+	file := filepath.Join(t.TempDir(), "rbac.yaml")
+	manifest := "version: v1\npermissions:\n  - name: docs.read\n"
+	if err := os.WriteFile(file, []byte(manifest), 0o600); err != nil {
+		t.Fatalf("failed to write manifest: %s", err)
+	}
+
+	out, err := rbacctl(t, url, "apply", "-f", file, "--dry-run")
+	if err != nil || !strings.Contains(out, "docs.read") {
+		t.Errorf("got output %q and error %v planning, want the permission created", out, err)
+	}
+	if _, err := rbacctl(t, url, "permission", "get", "docs.read"); !client.HasCode(err, payloads.CodePermissionNotFound) {
+		t.Errorf("got error %v after a dry run, want nothing created", err)
+	}
+
+	if _, err := rbacctl(t, url, "apply", "-f", file); err != nil {
+		t.Fatalf("failed to apply: %s", err)
+	}
+	out, err = rbacctl(t, url, "apply", "-f", file)
+	if err != nil || !strings.Contains(out, "No changes") {
+		t.Errorf("got output %q and error %v applying again, want no changes", out, err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rbacctl.json")
+	if err := os.WriteFile(file, []byte(`{"url":"https://rbac.example.com","user":"alice","token":"secret"}`), 0o600); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+
+	// the environment overrides the file
+	t.Setenv(envUser, "bob")
+	c, err := loadConfig(file)
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+	if c.URL != "https://rbac.example.com" || c.User != "bob" || c.Token != "secret" {
+		t.Errorf("got config %+v, want the file with the user from the environment", c)
+	}
+
+	// a missing file is not an error
+	c, err = loadConfig(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || c.URL != defaultURL {
+		t.Errorf("got config %+v and error %v without a file, want the defaults", c, err)
+	}
+}
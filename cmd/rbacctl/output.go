@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/adrianosela/rbac/api/model"
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// printer writes command results in the selected output format
+type printer struct {
+	out    io.Writer
+	format string
+}
+
+func (p *printer) json(v interface{}) error {
+	enc := json.NewEncoder(p.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (p *printer) role(role *model.Role) error {
+	if p.format == outputJSON {
+		return p.json(role)
+	}
+	tw := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "NAME\t%s\n", role.Name)
+	fmt.Fprintf(tw, "DESCRIPTION\t%s\n", role.Description)
+	fmt.Fprintf(tw, "OWNERS\t%s\n", strings.Join(role.Owners, ", "))
+	fmt.Fprintf(tw, "PERMISSIONS\t%s\n", strings.Join(role.Permissions, ", "))
+	fmt.Fprintf(tw, "USERS\t%s\n", strings.Join(role.Users, ", "))
+	fmt.Fprintf(tw, "GROUPS\t%s\n", strings.Join(role.Groups, ", "))
+	return tw.Flush()
+}
+
+func (p *printer) permission(perm *model.Permission) error {
+	if p.format == outputJSON {
+		return p.json(perm)
+	}
+	tw := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "NAME\t%s\n", perm.Name)
+	fmt.Fprintf(tw, "DESCRIPTION\t%s\n", perm.Description)
+	fmt.Fprintf(tw, "OWNERS\t%s\n", strings.Join(perm.Owners, ", "))
+	fmt.Fprintf(tw, "ROLES\t%s\n", strings.Join(perm.Roles, ", "))
+	return tw.Flush()
+}
+
+func (p *printer) roles(roles []*model.Role) error {
+	if p.format == outputJSON {
+		return p.json(roles)
+	}
+	tw := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tOWNERS\tPERMISSIONS\tDESCRIPTION")
+	for _, role := range roles {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", role.Name, strings.Join(role.Owners, ", "), len(role.Permissions), role.Description)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) permissions(perms []*model.Permission) error {
+	if p.format == outputJSON {
+		return p.json(perms)
+	}
+	tw := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tOWNERS\tROLES\tDESCRIPTION")
+	for _, perm := range perms {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", perm.Name, strings.Join(perm.Owners, ", "), len(perm.Roles), perm.Description)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) userRoles(roles *payloads.GetUserRolesResponse) error {
+	if p.format == outputJSON {
+		return p.json(roles)
+	}
+	tw := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROLE\tVIA")
+	for _, role := range roles.Direct {
+		fmt.Fprintf(tw, "%s\tdirect\n", role)
+	}
+	for _, group := range roles.Groups {
+		for _, role := range roles.ViaGroups[group] {
+			fmt.Fprintf(tw, "%s\tgroup %s\n", role, group)
+		}
+	}
+	return tw.Flush()
+}
+
+func (p *printer) groupRoles(roles *payloads.GetGroupMembersRolesResponse) error {
+	if p.format == outputJSON {
+		return p.json(roles)
+	}
+	tw := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROLE\tPERMISSIONS\tDESCRIPTION")
+	for _, role := range roles.Roles {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", role.Name, strings.Join(role.Permissions, ", "), role.Description)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) list(header string, items []string) error {
+	if p.format == outputJSON {
+		return p.json(items)
+	}
+	tw := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, header)
+	for _, item := range items {
+		fmt.Fprintln(tw, item)
+	}
+	return tw.Flush()
+}
+
+func (p *printer) message(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if p.format == outputJSON {
+		return p.json(map[string]string{"message": msg})
+	}
+	_, err := fmt.Fprintln(p.out, msg)
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+func (c *command) permission(verb string, args []string) error {
+	if verb == "list" {
+		return c.listPermissions(args)
+	}
+
+	fs := flag.NewFlagSet(fmt.Sprintf("permission %s", verb), flag.ContinueOnError)
+	description := fs.String("description", "", "permission description")
+	var owners listFlag
+	fs.Var(&owners, "owners", "comma separated owners")
+
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	name := positional[0]
+
+	switch verb {
+	case "create":
+		err := c.client.CreatePermission(c.ctx, &payloads.CreatePermissionRequest{
+			Name:        name,
+			Description: *description,
+			Owners:      owners,
+		})
+		if err != nil {
+			return err
+		}
+		return c.print.message("Permission \"%s\" created", name)
+	case "get":
+		perm, err := c.client.GetPermission(c.ctx, name)
+		if err != nil {
+			return err
+		}
+		return c.print.permission(perm)
+	case "update":
+		if err := c.client.UpdatePermission(c.ctx, name, *description); err != nil {
+			return err
+		}
+		return c.print.message("Permission \"%s\" updated", name)
+	case "add":
+		if err := c.client.AddToPermission(c.ctx, name, &payloads.ModifyPermissionRequest{Owners: owners}); err != nil {
+			return err
+		}
+		return c.print.message("Permission \"%s\" updated", name)
+	case "remove":
+		if err := c.client.RemoveFromPermission(c.ctx, name, &payloads.ModifyPermissionRequest{Owners: owners}); err != nil {
+			return err
+		}
+		return c.print.message("Permission \"%s\" updated", name)
+	case "delete":
+		if err := c.client.DeletePermission(c.ctx, name); err != nil {
+			return err
+		}
+		return c.print.message("Permission \"%s\" deleted", name)
+	default:
+		return fmt.Errorf("unknown permission command \"%s\"", verb)
+	}
+}
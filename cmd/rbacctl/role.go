@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/adrianosela/rbac/api/service/payloads"
+)
+
+func (c *command) role(verb string, args []string) error {
+	if verb == "list" {
+		return c.listRoles(args)
+	}
+
+	fs := flag.NewFlagSet(fmt.Sprintf("role %s", verb), flag.ContinueOnError)
+	description := fs.String("description", "", "role description")
+	var permissions, users, groups, owners listFlag
+	fs.Var(&permissions, "permissions", "comma separated permissions")
+	fs.Var(&users, "users", "comma separated users")
+	fs.Var(&groups, "groups", "comma separated groups")
+	fs.Var(&owners, "owners", "comma separated owners")
+
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	name := positional[0]
+
+	modify := &payloads.ModifyRoleRequest{
+		Permissions: permissions,
+		Users:       users,
+		Groups:      groups,
+		Owners:      owners,
+	}
+
+	switch verb {
+	case "create":
+		err := c.client.CreateRole(c.ctx, &payloads.CreateRoleRequest{
+			Name:        name,
+			Description: *description,
+			Permissions: permissions,
+			Users:       users,
+			Groups:      groups,
+			Owners:      owners,
+		})
+		if err != nil {
+			return err
+		}
+		return c.print.message("Role \"%s\" created", name)
+	case "get":
+		role, err := c.client.GetRole(c.ctx, name)
+		if err != nil {
+			return err
+		}
+		return c.print.role(role)
+	case "update":
+		if err := c.client.UpdateRole(c.ctx, name, *description); err != nil {
+			return err
+		}
+		return c.print.message("Role \"%s\" updated", name)
+	case "add":
+		if err := c.client.AddToRole(c.ctx, name, modify); err != nil {
+			return err
+		}
+		return c.print.message("Role \"%s\" updated", name)
+	case "remove":
+		if err := c.client.RemoveFromRole(c.ctx, name, modify); err != nil {
+			return err
+		}
+		return c.print.message("Role \"%s\" updated", name)
+	case "delete":
+		if err := c.client.DeleteRole(c.ctx, name); err != nil {
+			return err
+		}
+		return c.print.message("Role \"%s\" deleted", name)
+	default:
+		return fmt.Errorf("unknown role command \"%s\"", verb)
+	}
+}
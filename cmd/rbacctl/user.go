@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+func (c *command) user(verb string, args []string) error {
+	fs := flag.NewFlagSet(fmt.Sprintf("user %s", verb), flag.ContinueOnError)
+
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	name := positional[0]
+
+	switch verb {
+	case "permissions":
+		perms, err := c.client.GetUserPermissions(c.ctx, name)
+		if err != nil {
+			return err
+		}
+		sort.Strings(perms)
+		return c.print.list("PERMISSION", perms)
+	case "roles":
+		roles, err := c.client.GetUserRoles(c.ctx, name)
+		if err != nil {
+			return err
+		}
+		return c.print.userRoles(roles)
+	default:
+		return fmt.Errorf("unknown user command \"%s\"", verb)
+	}
+}
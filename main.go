@@ -1,25 +1,106 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-	"net/http"
+	"log/slog"
+	"net"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/adrianosela/rbac/api/config"
 	"github.com/adrianosela/rbac/api/service"
 )
 
 func main() {
-	config := service.Config{
-		OktaOrgDomain: os.Getenv("OKTA_ORG_DOMAIN"),
-		OktaAPIToken:  os.Getenv("OKTA_API_TOKEN"),
+	c, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Print(config.Usage())
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %s", err)
+	}
+
+	store, err := c.NewStorage()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %s", err)
+	}
+	src, err := c.NewGroupsSource()
+	if err != nil {
+		log.Fatalf("Failed to initialize groups source: %s", err)
+	}
+	tlsConfig, err := c.NewTLSConfig()
+	if err != nil {
+		log.Fatalf("Failed to initialize TLS: %s", err)
+	}
+	logger := c.NewLogger(os.Stderr)
+	slog.SetDefault(logger)
+	for _, warning := range c.Warnings() {
+		logger.Warn(warning)
 	}
 
-	handler, err := service.New(config)
+	server, err := service.NewServer(service.Config{
+		Storage:               store,
+		Groups:                src,
+		WebhookMaxAttempts:    c.Webhooks.MaxAttempts,
+		WebhookInitialBackoff: c.Webhooks.InitialBackoff,
+		WebhookAllowPrivate:   c.Webhooks.AllowPrivateDestinations,
+		WatchHistorySize:      c.Watch.HistorySize,
+		Admins:                c.Auth.Admins,
+		RestrictCreation:      c.Auth.RestrictCreation,
+		GroupsCacheTTL:        c.Groups.CacheTTL,
+		Tracing:               c.Tracing,
+		Logger:                logger,
+		TLS:                   tlsConfig,
+	})
 	if err != nil {
 		log.Fatalf("Failed to initialize service: %s", err)
 	}
 
-	if err = http.ListenAndServe(":8080", handler); err != nil {
-		log.Fatalf("Failed to serve HTTP: %s", err)
+	httpLis, err := net.Listen("tcp", c.Listen.HTTP)
+	if err != nil {
+		log.Fatalf("Failed to listen for HTTP: %s", err)
+	}
+	var grpcLis net.Listener
+	if c.Listen.GRPC != "" {
+		if grpcLis, err = net.Listen("tcp", c.Listen.GRPC); err != nil {
+			log.Fatalf("Failed to listen for gRPC: %s", err)
+		}
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		if tlsConfig != nil {
+			// the certificate comes from the TLS config, so that it can be reloaded
+			errs <- server.HTTP.ServeTLS(httpLis, "", "")
+		} else {
+			errs <- server.HTTP.Serve(httpLis)
+		}
+	}()
+	if grpcLis != nil {
+		go func() { errs <- server.GRPC.Serve(grpcLis) }()
+	}
+	logger.Info("serving", slog.String("http", c.Listen.HTTP), slog.String("grpc", c.Listen.GRPC), slog.Bool("tls", tlsConfig != nil))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		// servers only stop on their own when they fail
+		log.Fatalf("Failed to serve: %s", err)
+	case sig := <-signals:
+		logger.Info("shutting down", slog.String("signal", sig.String()), slog.Duration("timeout", c.Shutdown.Timeout))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Shutdown.Timeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Fatalf("Failed to shut down gracefully: %s", err)
 	}
+	logger.Info("shut down")
 }
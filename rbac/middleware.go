@@ -0,0 +1,124 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// DefaultIdentityHeader is the header the default IdentityFunc reads the caller from
+	DefaultIdentityHeader = "MOCK_AUTHENTICATED_USER"
+)
+
+type contextKey string
+
+var userContextKey = contextKey("rbac-user")
+
+// ErrNoIdentity is returned by an IdentityFunc when the request has no caller
+var ErrNoIdentity = errors.New("no caller identity in request")
+
+// IdentityFunc returns the caller of a request
+type IdentityFunc func(*http.Request) (string, error)
+
+// HeaderIdentity returns an IdentityFunc that reads the caller from a header
+func HeaderIdentity(header string) IdentityFunc {
+	return func(r *http.Request) (string, error) {
+		user := r.Header.Get(header)
+		if user == "" {
+			return "", ErrNoIdentity
+		}
+		return user, nil
+	}
+}
+
+// Authorizer builds middleware that only lets requests through
+// when the caller holds the required permissions
+type Authorizer struct {
+	resolver Resolver
+	identify IdentityFunc
+}
+
+// Option configures an Authorizer
+type Option func(*Authorizer)
+
+// WithIdentity sets the function used to get the caller of a request
+func WithIdentity(fn IdentityFunc) Option {
+	return func(a *Authorizer) { a.identify = fn }
+}
+
+// New returns a new Authorizer which resolves permissions through resolver
+func New(resolver Resolver, opts ...Option) *Authorizer {
+	a := &Authorizer{
+		resolver: resolver,
+		identify: HeaderIdentity(DefaultIdentityHeader),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Default is the Authorizer used by the package level Require
+var Default *Authorizer
+
+// Require returns middleware which responds with 403 unless the caller holds
+// every one of the given permissions, using the Default Authorizer
+func Require(permissions ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if Default == nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("rbac: no default authorizer configured"))
+				return
+			}
+			Default.Require(permissions...)(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// Require returns middleware which responds with 403 unless the caller
+// holds every one of the given permissions. The returned value can be used
+// to wrap an http.Handler directly or passed to a mux.Router's Use method.
+func (a *Authorizer) Require(permissions ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := a.identify(r)
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(fmt.Sprintf("rbac: %s", err)))
+				return
+			}
+
+			held, err := a.resolver.UserPermissions(r.Context(), user)
+			if err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte("rbac: failed to resolve caller permissions"))
+				return
+			}
+
+			heldSet := make(map[string]struct{}, len(held))
+			for _, p := range held {
+				heldSet[p] = struct{}{}
+			}
+			for _, p := range permissions {
+				if _, ok := heldSet[p]; !ok {
+					w.WriteHeader(http.StatusForbidden)
+					w.Write([]byte(fmt.Sprintf("rbac: user \"%s\" does not have permission \"%s\"", user, p)))
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+		})
+	}
+}
+
+// User returns the caller authorized by the middleware, if any
+func User(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(userContextKey).(string)
+	return user, ok
+}
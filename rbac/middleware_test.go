@@ -0,0 +1,106 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// failingResolver fails to resolve any user's permissions
+type failingResolver struct{}
+
+func (failingResolver) UserPermissions(ctx context.Context, user string) ([]string, error) {
+	return nil, errors.New("unreachable")
+}
+
+// serve makes a request as user (if non empty) to a handler wrapped in
+// middleware, and returns the response and the user the handler saw
+func serve(middleware mux.MiddlewareFunc, user string) (*httptest.ResponseRecorder, string) {
+	var seen string
+	h := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = User(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if user != "" {
+		req.Header.Set(DefaultIdentityHeader, user)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w, seen
+}
+
+func TestRequire(t *testing.T) {
+	a := New(NewStaticResolver(map[string][]string{
+		"alice": {"docs.read", "docs.write"},
+		"bob":   {"docs.read"},
+	}))
+
+	tests := []struct {
+		name        string
+		user        string
+		permissions []string
+		status      int
+	}{
+		{"all permissions held", "alice", []string{"docs.read", "docs.write"}, http.StatusOK},
+		{"no permissions required", "carol", nil, http.StatusOK},
+		{"one permission missing", "bob", []string{"docs.read", "docs.write"}, http.StatusForbidden},
+		{"unknown user", "carol", []string{"docs.read"}, http.StatusForbidden},
+		{"no identity", "", []string{"docs.read"}, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w, seen := serve(a.Require(test.permissions...), test.user)
+			if w.Code != test.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			if test.status == http.StatusOK && seen != test.user {
+				t.Errorf("handler saw user %q, want %q", seen, test.user)
+			}
+			if test.status != http.StatusOK && seen != "" {
+				t.Errorf("handler was called for a %d response", test.status)
+			}
+		})
+	}
+}
+
+func TestRequireResolverError(t *testing.T) {
+	w, _ := serve(New(failingResolver{}).Require("docs.read"), "alice")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestWithIdentity(t *testing.T) {
+	a := New(NewStaticResolver(map[string][]string{"alice": {"docs.read"}}), WithIdentity(HeaderIdentity("X-User")))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User", "alice")
+	w := httptest.NewRecorder()
+	a.Require("docs.read")(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d with the custom header, want %d", w.Code, http.StatusOK)
+	}
+
+	if w, _ := serve(a.Require("docs.read"), "alice"); w.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d with the default header, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestPackageRequire(t *testing.T) {
+	defer func(d *Authorizer) { Default = d }(Default)
+
+	Default = nil
+	if w, _ := serve(Require("docs.read"), "alice"); w.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d with no Default, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	Default = New(NewStaticResolver(map[string][]string{"alice": {"docs.read"}}))
+	if w, _ := serve(Require("docs.read"), "alice"); w.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
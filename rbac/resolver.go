@@ -0,0 +1,185 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/adrianosela/rbac/api/events"
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/resolver"
+	"github.com/adrianosela/rbac/api/storage"
+	"github.com/adrianosela/rbac/client"
+)
+
+// Resolver returns the effective permissions of a user
+type Resolver interface {
+	UserPermissions(ctx context.Context, user string) ([]string, error)
+}
+
+// ServiceResolver resolves permissions by asking a remote RBAC service
+type ServiceResolver struct {
+	client *client.Client
+}
+
+// NewServiceResolver returns a new ServiceResolver
+func NewServiceResolver(c *client.Client) *ServiceResolver {
+	return &ServiceResolver{client: c}
+}
+
+// UserPermissions returns the effective permissions of a user
+func (sr *ServiceResolver) UserPermissions(ctx context.Context, user string) ([]string, error) {
+	return sr.client.GetUserPermissions(ctx, user)
+}
+
+// LocalResolver resolves permissions directly against RBAC storage and a
+// groups source, the same way the RBAC service itself does
+type LocalResolver struct {
+	store  storage.Storage
+	groups groups.Source
+}
+
+// NewLocalResolver returns a new LocalResolver
+func NewLocalResolver(store storage.Storage, src groups.Source) *LocalResolver {
+	return &LocalResolver{store: store, groups: src}
+}
+
+// UserPermissions returns the effective permissions of a user
+func (lr *LocalResolver) UserPermissions(ctx context.Context, user string) ([]string, error) {
+	perms, err := resolver.UserPermissions(ctx, lr.store, lr.groups, user)
+	if err != nil {
+		return nil, err
+	}
+	return perms.Slice(), nil
+}
+
+// StaticResolver resolves permissions from a fixed map of user to
+// permissions. It is meant for unit-testing handlers wrapped in Require.
+type StaticResolver struct {
+	permissions map[string][]string
+}
+
+// NewStaticResolver returns a new StaticResolver
+func NewStaticResolver(permissions map[string][]string) *StaticResolver {
+	return &StaticResolver{permissions: permissions}
+}
+
+// UserPermissions returns the effective permissions of a user
+func (sr *StaticResolver) UserPermissions(ctx context.Context, user string) ([]string, error) {
+	return sr.permissions[user], nil
+}
+
+// CachedResolver caches the permissions resolved by another Resolver
+type CachedResolver struct {
+	sync.Mutex
+	next    Resolver
+	ttl     time.Duration
+	entries map[string]cacheEntry
+
+	// generation counts invalidations, so that permissions resolved while
+	// an invalidation happened are not cached after it
+	generation uint64
+}
+
+type cacheEntry struct {
+	permissions []string
+	expiry      time.Time
+}
+
+// NewCachedResolver returns a new CachedResolver which keeps
+// resolved permissions for up to ttl
+func NewCachedResolver(next Resolver, ttl time.Duration) *CachedResolver {
+	return &CachedResolver{
+		next:    next,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// UserPermissions returns the effective permissions of a user
+func (cr *CachedResolver) UserPermissions(ctx context.Context, user string) ([]string, error) {
+	cr.Lock()
+	entry, ok := cr.entries[user]
+	generation := cr.generation
+	cr.Unlock()
+
+	if ok && time.Now().Before(entry.expiry) {
+		return entry.permissions, nil
+	}
+
+	perms, err := cr.next.UserPermissions(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	cr.Lock()
+	defer cr.Unlock()
+
+	if cr.generation == generation {
+		cr.entries[user] = cacheEntry{permissions: perms, expiry: time.Now().Add(cr.ttl)}
+	}
+	return perms, nil
+}
+
+// Invalidate drops the cached permissions of the given users
+func (cr *CachedResolver) Invalidate(users ...string) {
+	cr.Lock()
+	defer cr.Unlock()
+
+	cr.generation++
+	for _, user := range users {
+		delete(cr.entries, user)
+	}
+}
+
+// InvalidateAll drops all cached permissions
+func (cr *CachedResolver) InvalidateAll() {
+	cr.Lock()
+	defer cr.Unlock()
+
+	cr.generation++
+	cr.entries = make(map[string]cacheEntry)
+}
+
+// InvalidateOnChanges watches a RBAC service for changes and drops cached
+// permissions as soon as they may be stale. It blocks until ctx is cancelled,
+// reconnecting and resuming from the last seen revision when the stream ends.
+// Watches from the current revision, i.e. the first one and any after missed
+// events, drop all cached permissions once connected, as they may have been
+// cached before changes which the watch does not replay. Revisions from
+// before a restart of the service are gone, so the watch after one is too.
+func (cr *CachedResolver) InvalidateOnChanges(ctx context.Context, c *client.Client) error {
+	var revision uint64
+	for {
+		var connected func()
+		if revision == 0 {
+			connected = cr.InvalidateAll
+		}
+		err := c.WatchConnected(ctx, revision, connected, func(e events.Event) error {
+			revision = e.Revision
+			switch e.Type {
+			case events.UserRoleAdded, events.UserRoleRemoved:
+				cr.Invalidate(e.Name)
+			default:
+				cr.InvalidateAll()
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, client.ErrGone) {
+			// missed events can't be replayed, so nothing cached can be
+			// trusted, until connected to the current revision either
+			cr.InvalidateAll()
+			revision = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package rbac
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adrianosela/rbac/api/groups"
+	"github.com/adrianosela/rbac/api/service"
+	"github.com/adrianosela/rbac/api/service/payloads"
+	"github.com/adrianosela/rbac/api/storage"
+	"github.com/adrianosela/rbac/client"
+)
+
+// countingResolver resolves permissions from a map which can be changed,
+// and counts the calls for each user
+type countingResolver struct {
+	sync.Mutex
+	permissions map[string][]string
+	calls       map[string]int
+}
+
+func newCountingResolver(permissions map[string][]string) *countingResolver {
+	return &countingResolver{permissions: permissions, calls: make(map[string]int)}
+}
+
+func (r *countingResolver) UserPermissions(ctx context.Context, user string) ([]string, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.calls[user]++
+	return r.permissions[user], nil
+}
+
+func (r *countingResolver) set(user string, permissions ...string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.permissions[user] = permissions
+}
+
+// eventually fails the test unless user's cached permissions become want
+func eventually(t *testing.T, cr *CachedResolver, user string, want ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		got, err := cr.UserPermissions(context.Background(), user)
+		if err != nil {
+			t.Fatalf("failed to resolve permissions: %s", err)
+		}
+		if equal(got, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got permissions %v for %s, want %v", got, user, want)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStaticResolver(t *testing.T) {
+	sr := NewStaticResolver(map[string][]string{"alice": {"docs.read"}})
+
+	if perms, err := sr.UserPermissions(context.Background(), "alice"); err != nil || !equal(perms, []string{"docs.read"}) {
+		t.Errorf("got %v, %v for alice", perms, err)
+	}
+	if perms, err := sr.UserPermissions(context.Background(), "bob"); err != nil || len(perms) != 0 {
+		t.Errorf("got %v, %v for an unknown user, want no permissions", perms, err)
+	}
+}
+
+func TestCachedResolver(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingResolver(map[string][]string{"alice": {"docs.read"}, "bob": {}})
+	cr := NewCachedResolver(next, time.Hour)
+
+	cr.UserPermissions(ctx, "alice")
+	cr.UserPermissions(ctx, "alice")
+	if next.calls["alice"] != 1 {
+		t.Errorf("resolved alice %d times, want once", next.calls["alice"])
+	}
+
+	cr.UserPermissions(ctx, "bob")
+	cr.Invalidate("alice")
+	cr.UserPermissions(ctx, "alice")
+	cr.UserPermissions(ctx, "bob")
+	if next.calls["alice"] != 2 || next.calls["bob"] != 1 {
+		t.Errorf("resolved alice %d and bob %d times after invalidating alice, want 2 and 1", next.calls["alice"], next.calls["bob"])
+	}
+
+	cr.InvalidateAll()
+	cr.UserPermissions(ctx, "bob")
+	if next.calls["bob"] != 2 {
+		t.Errorf("resolved bob %d times after invalidating all, want 2", next.calls["bob"])
+	}
+
+	expiring := NewCachedResolver(next, time.Millisecond)
+	expiring.UserPermissions(ctx, "alice")
+	time.Sleep(time.Millisecond * 5)
+	expiring.UserPermissions(ctx, "alice")
+	if next.calls["alice"] != 4 {
+		t.Errorf("resolved alice %d times, want the expired entry resolved again", next.calls["alice"])
+	}
+}
+
+func TestInvalidateOnChanges(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	src := groups.NewMemorySource(map[string][]string{"alice": {}, "bob": {}})
+	h, err := service.New(service.Config{Storage: store, Groups: src, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	alice := client.New(srv.URL, client.WithUser("alice"))
+
+	cr := NewCachedResolver(NewLocalResolver(store, src), time.Hour)
+	eventually(t, cr, "bob") // cached before the watch starts
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cr.InvalidateOnChanges(ctx, alice)
+
+	if err := alice.CreatePermission(ctx, &payloads.CreatePermissionRequest{Name: "docs.read"}); err != nil {
+		t.Fatalf("CreatePermission: %s", err)
+	}
+	if err := alice.CreateRole(ctx, &payloads.CreateRoleRequest{Name: "readers", Permissions: []string{"docs.read"}, Users: []string{"bob"}}); err != nil {
+		t.Fatalf("CreateRole: %s", err)
+	}
+	eventually(t, cr, "bob", "docs.read")
+
+	if err := alice.RemoveFromRole(ctx, "readers", &payloads.ModifyRoleRequest{Users: []string{"bob"}}); err != nil {
+		t.Fatalf("RemoveFromRole: %s", err)
+	}
+	eventually(t, cr, "bob")
+}
+
+func TestInvalidateOnConnect(t *testing.T) {
+	next := newCountingResolver(map[string][]string{"alice": {"docs.read"}})
+	cr := NewCachedResolver(next, time.Hour)
+	eventually(t, cr, "alice", "docs.read")
+
+	// changed before the watch connects, so no event will come for it
+	next.set("alice", "docs.write")
+
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+
+		switch n {
+		case 1:
+			// a stream which ends after one event
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "id: 5\nevent: permission.updated\ndata: {\"revision\":5,\"type\":\"permission.updated\",\"name\":\"docs.write\"}\n\n")
+			return
+		case 2:
+			if r.URL.Query().Get("revision") != "5" {
+				t.Errorf("got revision %q on reconnect, want 5", r.URL.Query().Get("revision"))
+			}
+			w.WriteHeader(http.StatusGone)
+			io.WriteString(w, `{"code":"REVISION_COMPACTED","message":"gone"}`)
+			return
+		case 3:
+			// cached while disconnected, then changed before the watch connects
+			cr.UserPermissions(r.Context(), "alice")
+			next.set("alice", "docs.admin")
+		}
+		if r.URL.Query().Get("revision") != "" {
+			t.Errorf("got revision %q after the revision was gone, want none", r.URL.Query().Get("revision"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cr.InvalidateOnChanges(ctx, client.New(srv.URL))
+
+	eventually(t, cr, "alice", "docs.write")
+	eventually(t, cr, "alice", "docs.admin")
+}
+
+// blockingResolver resolves permissions from next, and returns them once released
+type blockingResolver struct {
+	next     Resolver
+	resolved chan struct{}
+	released chan struct{}
+}
+
+func (r *blockingResolver) UserPermissions(ctx context.Context, user string) ([]string, error) {
+	perms, err := r.next.UserPermissions(ctx, user)
+	r.resolved <- struct{}{}
+	<-r.released
+	return perms, err
+}
+
+func TestCachedResolverInvalidatedWhileResolving(t *testing.T) {
+	ctx := context.Background()
+	next := newCountingResolver(map[string][]string{"alice": {"docs.read"}})
+	blocking := &blockingResolver{next: next, resolved: make(chan struct{}), released: make(chan struct{})}
+	cr := NewCachedResolver(blocking, time.Hour)
+
+	// resolved before a change and its invalidation, and returned after them
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cr.UserPermissions(ctx, "alice")
+	}()
+	<-blocking.resolved
+	next.set("alice", "docs.write")
+	cr.Invalidate("alice")
+	close(blocking.released)
+	<-done
+
+	go func() { <-blocking.resolved }()
+	if perms, err := cr.UserPermissions(ctx, "alice"); err != nil || !equal(perms, []string{"docs.write"}) {
+		t.Errorf("got %v, %v, want the permissions resolved after the invalidation", perms, err)
+	}
+}
+
+func TestInvalidateOnRestart(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	src := groups.NewMemorySource(map[string][]string{"alice": {}, "bob": {}})
+	newHandler := func() http.Handler {
+		h, err := service.New(service.Config{Storage: store, Groups: src, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+		if err != nil {
+			t.Fatalf("failed to create service: %s", err)
+		}
+		return h
+	}
+
+	var mu sync.Mutex
+	current := newHandler()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		h := current
+		mu.Unlock()
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	alice := client.New(srv.URL, client.WithUser("alice"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := alice.CreatePermission(ctx, &payloads.CreatePermissionRequest{Name: "docs.read"}); err != nil {
+		t.Fatalf("CreatePermission: %s", err)
+	}
+	if err := alice.CreateRole(ctx, &payloads.CreateRoleRequest{Name: "readers", Permissions: []string{"docs.read"}}); err != nil {
+		t.Fatalf("CreateRole: %s", err)
+	}
+
+	cr := NewCachedResolver(NewLocalResolver(store, src), time.Hour)
+	go cr.InvalidateOnChanges(ctx, alice)
+	// once connected, an event invalidates bob, and the watch resumes from its revision
+	for _, connected := range []bool{false, true} {
+		deadline := time.Now().Add(time.Second * 5)
+		for invalidated := false; !invalidated; {
+			if time.Now().After(deadline) {
+				t.Fatalf("cached permissions not invalidated, connected %t", connected)
+			}
+			cr.UserPermissions(ctx, "bob")
+			if err := alice.UpdateRole(ctx, "readers", "watched"); err != nil {
+				t.Fatalf("UpdateRole: %s", err)
+			}
+			time.Sleep(time.Millisecond * 10)
+			cr.Lock()
+			_, cached := cr.entries["bob"]
+			cr.Unlock()
+			invalidated = !cached
+		}
+	}
+	eventually(t, cr, "bob")
+
+	// changed after the restart and before the watch reconnects
+	mu.Lock()
+	current = newHandler()
+	mu.Unlock()
+	if err := alice.AddToRole(ctx, "readers", &payloads.ModifyRoleRequest{Users: []string{"bob"}}); err != nil {
+		t.Fatalf("AddToRole: %s", err)
+	}
+	srv.CloseClientConnections()
+
+	eventually(t, cr, "bob", "docs.read")
+}